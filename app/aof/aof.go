@@ -0,0 +1,392 @@
+package aof
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/store"
+)
+
+// ErrRewriteInProgress is returned when a rewrite is requested while one runs
+var ErrRewriteInProgress = errors.New("ERR Background append only file rewriting already in progress")
+
+// ErrInvalidPolicy is returned for an unknown appendfsync value
+var ErrInvalidPolicy = errors.New("argument(s) must be one of the following: always, everysec, no")
+
+// Policy decides when appended commands are flushed to disk
+type Policy int
+
+const (
+	FsyncAlways   Policy = iota // after every command, before the client is answered
+	FsyncEverySec               // at most once a second, losing up to a second of writes
+	FsyncNo                     // whenever the operating system flushes its buffers
+)
+
+var policyNames = map[Policy]string{
+	FsyncAlways:   "always",
+	FsyncEverySec: "everysec",
+	FsyncNo:       "no",
+}
+
+// ParsePolicy parses an appendfsync value
+func ParsePolicy(name string) (Policy, error) {
+	for policy, policyName := range policyNames {
+		if policyName == name {
+			return policy, nil
+		}
+	}
+	return 0, ErrInvalidPolicy
+}
+
+// String returns the appendfsync value of the policy
+func (p Policy) String() string {
+	return policyNames[p]
+}
+
+// AOF logs write commands to the multi-part append-only file: a base snapshot
+// followed by incremental files of commands, listed by a manifest
+type AOF struct {
+	databases *store.Databases
+	dir       string
+	filename  string
+	writes    sync.Locker // held by writers from executing a command until it is appended
+
+	mutex     sync.Mutex
+	enabled   bool
+	policy    Policy
+	manifest  *manifest
+	file      *os.File  // incremental file being appended to
+	selected  int       // database of the last appended command, -1 at the start of a file
+	unsynced  bool      // commands were written since the last fsync
+	lastFsync time.Time // when the file was last flushed to disk
+	writeErr  error     // outcome of the last write
+	offset    int64     // replication offset of the last command appended
+	fsynced   int64     // replication offset up to which the file is on disk
+
+	rewriting       bool
+	rewriteStarted  time.Time
+	rewriteErr      error // outcome of the last rewrite
+	rewriteDuration time.Duration
+	rewrites        int
+}
+
+// New creates an append-only file in dir whose files are named after filename.
+// writes must be held by every writer from executing a command until it is
+// appended, so a rewrite can take its snapshot between two writes.
+func New(databases *store.Databases, dir, filename string, writes sync.Locker) *AOF {
+	return &AOF{
+		databases:       databases,
+		dir:             dir,
+		filename:        filename,
+		writes:          writes,
+		policy:          FsyncEverySec,
+		selected:        -1,
+		rewriteDuration: -1,
+	}
+}
+
+// Enabled reports whether writes are being logged
+func (a *AOF) Enabled() bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.enabled
+}
+
+// Policy returns the fsync policy
+func (a *AOF) Policy() Policy {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.policy
+}
+
+// SetPolicy changes the fsync policy, flushing what the previous one left pending
+func (a *AOF) SetPolicy(policy Policy) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.enabled && a.unsynced {
+		a.sync()
+	}
+	a.policy = policy
+}
+
+// FsyncedOffset returns the replication offset up to which logged commands
+// are on disk, or -1 while writes are not logged
+func (a *AOF) FsyncedOffset() int64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if !a.enabled {
+		return -1
+	}
+	return a.fsynced
+}
+
+// Command is a write to log, executed against database DB
+type Command struct {
+	DB   int
+	Args []string
+}
+
+// Append logs commands that executed together, such as the MULTI, writes and
+// EXEC of a transaction, which end at offset in the replication stream. They
+// go to the file in a single write, so a crash cannot split them. Callers
+// hold the writes lock, or otherwise exclude other writers, so commands are
+// logged in the order they executed.
+func (a *AOF) Append(commands []Command, offset int64) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.offset = offset
+	if !a.enabled {
+		return
+	}
+
+	var buf []byte
+	selected := a.selected
+	for _, command := range commands {
+		if command.DB != selected {
+			buf = resp.AppendCommand(buf, []string{"SELECT", strconv.Itoa(command.DB)})
+			selected = command.DB
+		}
+		buf = resp.AppendCommand(buf, command.Args)
+	}
+
+	if _, err := a.file.Write(buf); err != nil {
+		fmt.Printf("Error writing to the AOF: %v\n", err)
+		a.writeErr = err
+		// A partial write may have cut a SELECT, so the next command repeats it
+		a.selected = -1
+		return
+	}
+	a.writeErr = nil
+	a.selected = selected
+
+	switch a.policy {
+	case FsyncAlways:
+		a.sync()
+	case FsyncNo:
+		// The operating system decides when it reaches the disk, so a
+		// command counts as flushed once written
+		a.fsynced = offset
+		a.unsynced = true
+	default:
+		a.unsynced = true
+	}
+}
+
+// sync flushes the incremental file to disk. The caller must hold the mutex.
+func (a *AOF) sync() {
+	if err := a.file.Sync(); err != nil {
+		fmt.Printf("Error flushing the AOF: %v\n", err)
+		a.writeErr = err
+		return
+	}
+	a.unsynced = false
+	a.lastFsync = time.Now()
+	a.fsynced = a.offset
+}
+
+// Cron flushes the file once a second under the everysec policy. It is meant
+// to be called periodically.
+func (a *AOF) Cron() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.enabled && a.policy == FsyncEverySec && a.unsynced && time.Since(a.lastFsync) >= time.Second {
+		a.sync()
+	}
+}
+
+// Open starts logging writes once the dataset has been loaded, appending to the
+// last incremental file. Without a manifest, the loaded dataset becomes the
+// base of a new set of files.
+func (a *AOF) Open() error {
+	a.mutex.Lock()
+	if a.manifest == nil {
+		a.mutex.Unlock()
+		return a.Enable()
+	}
+	defer a.mutex.Unlock()
+
+	if a.enabled {
+		return nil
+	}
+	if len(a.manifest.incrs) == 0 {
+		m := a.manifest.clone()
+		if err := a.startIncr(m); err != nil {
+			return err
+		}
+		a.manifest = m
+	} else {
+		last := a.manifest.incrs[len(a.manifest.incrs)-1]
+		file, err := os.OpenFile(filepath.Join(a.dir, last.name), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return err
+		}
+		a.switchFile(file)
+	}
+	a.enabled = true
+	a.fsynced = a.offset
+	return nil
+}
+
+// Enable starts logging writes. The live dataset is written as a new base in
+// the foreground, so the files describe it completely from the first write
+// logged.
+func (a *AOF) Enable() error {
+	a.writes.Lock()
+	defer a.writes.Unlock()
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.enabled {
+		return nil
+	}
+	if a.rewriting {
+		return ErrRewriteInProgress
+	}
+	if err := os.MkdirAll(a.dir, 0o755); err != nil {
+		return err
+	}
+
+	m := &manifest{}
+	if a.manifest != nil {
+		m = a.manifest.clone()
+	}
+	snapshot, _ := a.databases.Snapshot()
+	base, err := a.writeBase(m.nextBaseSeq(), snapshot)
+	if err != nil {
+		return err
+	}
+
+	// The new base covers every file listed so far
+	if m.base != nil {
+		m.history = append(m.history, manifestFile{name: m.base.name, seq: m.base.seq, kind: typeHistory})
+	}
+	for _, incr := range m.incrs {
+		m.history = append(m.history, manifestFile{name: incr.name, seq: incr.seq, kind: typeHistory})
+	}
+	m.base = &base
+	m.incrs = nil
+	if err := a.startIncr(m); err != nil {
+		return err
+	}
+	a.manifest = m
+	a.enabled = true
+	a.fsynced = a.offset
+	a.deleteHistory()
+	return nil
+}
+
+// Disable stops logging writes, flushing what was already logged
+func (a *AOF) Disable() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if !a.enabled {
+		return
+	}
+	a.switchFile(nil)
+	a.enabled = false
+}
+
+// startIncr creates the next incremental file, records it in m and saves m, then
+// appends to the new file. The caller must hold the mutex.
+func (a *AOF) startIncr(m *manifest) error {
+	seq := m.nextIncrSeq()
+	incr := manifestFile{name: fmt.Sprintf("%s.%d.incr.aof", a.filename, seq), seq: seq, kind: typeIncr}
+	file, err := os.OpenFile(filepath.Join(a.dir, incr.name), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	m.incrs = append(m.incrs, incr)
+	if err := saveManifest(manifestPath(a.dir, a.filename), m); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	a.switchFile(file)
+	return nil
+}
+
+// switchFile flushes and closes the current incremental file and appends to
+// file from now on. The caller must hold the mutex.
+func (a *AOF) switchFile(file *os.File) {
+	if a.file != nil {
+		if a.unsynced {
+			a.sync()
+		}
+		a.file.Close()
+	}
+	a.file = file
+	a.selected = -1
+	a.unsynced = false
+	a.lastFsync = time.Now()
+}
+
+// deleteHistory removes the files a rewrite superseded and drops them from the
+// manifest. The caller must hold the mutex.
+func (a *AOF) deleteHistory() {
+	if len(a.manifest.history) == 0 {
+		return
+	}
+	for _, file := range a.manifest.history {
+		if err := os.Remove(filepath.Join(a.dir, file.name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("Error removing %s: %v\n", file.name, err)
+		}
+	}
+
+	m := a.manifest.clone()
+	m.history = nil
+	if err := saveManifest(manifestPath(a.dir, a.filename), m); err != nil {
+		fmt.Printf("Error updating the AOF manifest: %v\n", err)
+		return
+	}
+	a.manifest = m
+}
+
+// PersistenceInfo returns the AOF fields of the INFO persistence section in order
+func (a *AOF) PersistenceInfo() [][2]string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	enabled := "0"
+	if a.enabled {
+		enabled = "1"
+	}
+	inProgress, current := "0", "-1"
+	if a.rewriting {
+		inProgress = "1"
+		current = strconv.Itoa(int(time.Since(a.rewriteStarted).Seconds()))
+	}
+	lastDuration := "-1"
+	if a.rewriteDuration >= 0 {
+		lastDuration = strconv.Itoa(int(a.rewriteDuration.Seconds()))
+	}
+
+	return [][2]string{
+		{"aof_enabled", enabled},
+		{"aof_rewrite_in_progress", inProgress},
+		{"aof_rewrite_scheduled", "0"},
+		{"aof_last_rewrite_time_sec", lastDuration},
+		{"aof_current_rewrite_time_sec", current},
+		{"aof_last_bgrewrite_status", status(a.rewriteErr)},
+		{"aof_rewrites", strconv.Itoa(a.rewrites)},
+		{"aof_last_write_status", status(a.writeErr)},
+	}
+}
+
+// status formats the outcome of an operation for INFO
+func status(err error) string {
+	if err != nil {
+		return "err"
+	}
+	return "ok"
+}
@@ -0,0 +1,84 @@
+package aof
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/store"
+)
+
+// payloads are values made of the bytes that delimit protocol lines and the
+// old "field:value,field:value" stream encoding
+var payloads = []string{"a:b", "c,d", "line\r\nbreak", "nul\x00byte", "", "\r\n", "\x00\xff\x80"}
+
+func TestBinaryReplayRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	dbs := store.NewDatabases(16)
+	// Keys present when logging starts go to the base snapshot
+	dbs.DB(0).Set("base\r\n", "v\x00")
+	dbs.DB(0).RPush("base:list", payloads...)
+
+	a := New(dbs, dir, "appendonly.aof", &sync.Mutex{})
+	if err := a.Enable(); err != nil {
+		t.Fatal(err)
+	}
+	a.SetPolicy(FsyncAlways)
+
+	logged := [][]Command{
+		{{DB: 0, Args: []string{"SET", "k\r\n", "v\x00\r\n"}}},
+		{{DB: 0, Args: append([]string{"RPUSH", "l"}, payloads...)}},
+		{{DB: 2, Args: []string{"XADD", "s", "1-1", "f:1,", "\r\n", "\x00", "v,w:x"}}},
+		{
+			{DB: 2, Args: []string{"MULTI"}},
+			{DB: 2, Args: []string{"SET", "*1\r\n$3\r\n", "$-1\r\n"}},
+			{DB: 2, Args: []string{"EXEC"}},
+		},
+	}
+	var offset int64
+	for _, commands := range logged {
+		offset++
+		a.Append(commands, offset)
+	}
+	a.Disable()
+
+	// Replaying selects each command's database once before it, as logged
+	want := [][]string{
+		{"SELECT", "0"},
+		{"SET", "k\r\n", "v\x00\r\n"},
+		append([]string{"RPUSH", "l"}, payloads...),
+		{"SELECT", "2"},
+		{"XADD", "s", "1-1", "f:1,", "\r\n", "\x00", "v,w:x"},
+		{"MULTI"},
+		{"SET", "*1\r\n$3\r\n", "$-1\r\n"},
+		{"EXEC"},
+	}
+
+	loaded := store.NewDatabases(16)
+	var replayed [][]string
+	stats, found, err := New(loaded, dir, "appendonly.aof", &sync.Mutex{}).Load(func(command resp.RespValue) error {
+		args, ok := resp.StringArgs(command.Value.([]resp.RespValue))
+		if !ok {
+			t.Fatalf("replayed %#v", command)
+		}
+		replayed = append(replayed, args)
+		return nil
+	})
+	if err != nil || !found {
+		t.Fatalf("Load = %v, %v", found, err)
+	}
+	if stats.Keys != 2 || stats.Commands != len(want) {
+		t.Errorf("loaded %d keys and %d commands, want 2 and %d", stats.Keys, stats.Commands, len(want))
+	}
+	if !reflect.DeepEqual(replayed, want) {
+		t.Errorf("replayed %q, want %q", replayed, want)
+	}
+
+	if value, _, _ := loaded.DB(0).Get("base\r\n"); value != "v\x00" {
+		t.Errorf("base string = %q, want %q", value, "v\x00")
+	}
+	if list, _ := loaded.DB(0).LRange("base:list", 0, -1); !reflect.DeepEqual(list, payloads) {
+		t.Errorf("base list = %q, want %q", list, payloads)
+	}
+}
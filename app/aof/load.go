@@ -0,0 +1,138 @@
+package aof
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/rdb"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// LoadStats summarises what a load restored
+type LoadStats struct {
+	Keys     int // keys restored from the base snapshot
+	Commands int // commands replayed from the incremental files
+}
+
+// Load restores the dataset from the files the manifest lists: the base, then
+// every incremental file in order, each command passed to replay. It reports
+// whether a manifest was found. A command cut short at the end of the last
+// file, as a crash mid-write leaves it, is truncated away.
+func (a *AOF) Load(replay func(command resp.RespValue) error) (LoadStats, bool, error) {
+	var stats LoadStats
+
+	m, err := readManifest(manifestPath(a.dir, a.filename))
+	if errors.Is(err, os.ErrNotExist) {
+		return stats, false, nil
+	}
+	if err != nil {
+		return stats, false, err
+	}
+
+	if m.base != nil {
+		path := filepath.Join(a.dir, m.base.name)
+		if strings.HasSuffix(m.base.name, ".rdb") {
+			// LoadFile treats a missing snapshot as empty, but a listed base must exist
+			if _, err := os.Stat(path); err != nil {
+				return stats, true, err
+			}
+			baseStats, err := rdb.LoadFile(path, a.databases)
+			if err != nil {
+				return stats, true, fmt.Errorf("%s: %w", m.base.name, err)
+			}
+			stats.Keys = baseStats.Keys
+		} else if err := replayFile(path, false, replay, &stats); err != nil {
+			return stats, true, err
+		}
+	}
+	for i, incr := range m.incrs {
+		last := i == len(m.incrs)-1
+		if err := replayFile(filepath.Join(a.dir, incr.name), last, replay, &stats); err != nil {
+			return stats, true, err
+		}
+	}
+
+	// Replaying the log is not a change that needs saving again
+	a.databases.ClearDirty(a.databases.Dirty())
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.manifest = m
+	return stats, true, nil
+}
+
+// replayFile passes every command in the file at path to replay. When the file
+// is the last one, an incomplete trailing command, or a transaction missing
+// its EXEC, is truncated away instead of failing the load. The commands of
+// such a transaction were only queued, so they never took effect.
+func replayFile(path string, last bool, replay func(command resp.RespValue) error, stats *LoadStats) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	counter := &countingReader{r: file}
+	reader := bufio.NewReader(counter)
+	var valid int64      // offset just past the last complete command
+	var multi int64 = -1 // offset of the MULTI of an open transaction
+	for {
+		_, err := reader.Peek(1)
+		if err == io.EOF && multi < 0 {
+			return nil
+		}
+
+		var command resp.RespValue
+		if err == nil {
+			command, err = resp.ParseRESP(reader)
+		}
+		if err != nil {
+			if last && (errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) {
+				file.Close()
+				if multi >= 0 {
+					fmt.Printf("!!! Warning: %s ends inside a MULTI/EXEC transaction, reverting it by truncating the file to offset %d\n", filepath.Base(path), multi)
+					return os.Truncate(path, multi)
+				}
+				fmt.Printf("!!! Warning: short read while loading %s, truncating it to the last valid command at offset %d\n", filepath.Base(path), valid)
+				return os.Truncate(path, valid)
+			}
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("%s: unexpected end of file inside MULTI at offset %d", filepath.Base(path), multi)
+			}
+			return fmt.Errorf("%s: bad file format at offset %d: %w", filepath.Base(path), valid, err)
+		}
+		items, ok := command.Value.([]resp.RespValue)
+		if command.Type != resp.ArrayType || !ok || len(items) == 0 {
+			return fmt.Errorf("%s: bad file format at offset %d", filepath.Base(path), valid)
+		}
+		name, _ := items[0].Value.(string)
+		switch strings.ToUpper(name) {
+		case "MULTI":
+			multi = valid
+		case "EXEC":
+			multi = -1
+		}
+		if err := replay(command); err != nil {
+			return err
+		}
+		stats.Commands++
+		valid = counter.n - int64(reader.Buffered())
+	}
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,167 @@
+package aof
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// File types recorded in the manifest
+const (
+	typeBase    = "b" // snapshot of the dataset the incremental files apply to
+	typeHistory = "h" // superseded by a rewrite and waiting to be deleted
+	typeIncr    = "i" // commands logged after the base was taken
+)
+
+// manifestFile is one file listed in the manifest
+type manifestFile struct {
+	name string
+	seq  int
+	kind string
+}
+
+// manifest lists the files that together make up the append-only file: a
+// base, then incremental files replayed in order
+type manifest struct {
+	base    *manifestFile
+	history []manifestFile
+	incrs   []manifestFile
+}
+
+// manifestPath returns the path of the manifest for the files named filename in dir
+func manifestPath(dir, filename string) string {
+	return filepath.Join(dir, filename+".manifest")
+}
+
+// readManifest parses the manifest at path, one "file <name> seq <n> type <t>" line per file
+func readManifest(path string) (*manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &manifest{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields)%2 != 0 {
+			return nil, fmt.Errorf("invalid manifest line %d", line)
+		}
+		var file manifestFile
+		for i := 0; i < len(fields); i += 2 {
+			switch fields[i] {
+			case "file":
+				file.name = fields[i+1]
+			case "seq":
+				if file.seq, err = strconv.Atoi(fields[i+1]); err != nil || file.seq < 1 {
+					return nil, fmt.Errorf("invalid sequence on manifest line %d", line)
+				}
+			case "type":
+				file.kind = fields[i+1]
+			}
+		}
+		if file.name == "" || file.seq == 0 {
+			return nil, fmt.Errorf("incomplete manifest line %d", line)
+		}
+
+		switch file.kind {
+		case typeBase:
+			if m.base != nil {
+				return nil, fmt.Errorf("more than one base file in the manifest")
+			}
+			m.base = &file
+		case typeHistory:
+			m.history = append(m.history, file)
+		case typeIncr:
+			if len(m.incrs) > 0 && file.seq <= m.incrs[len(m.incrs)-1].seq {
+				return nil, fmt.Errorf("incremental files out of order on manifest line %d", line)
+			}
+			m.incrs = append(m.incrs, file)
+		default:
+			return nil, fmt.Errorf("unknown file type on manifest line %d", line)
+		}
+	}
+	return m, scanner.Err()
+}
+
+// encode formats the manifest, base first and incremental files in replay order
+func (m *manifest) encode() []byte {
+	var buf bytes.Buffer
+	write := func(file manifestFile) {
+		fmt.Fprintf(&buf, "file %s seq %d type %s\n", file.name, file.seq, file.kind)
+	}
+	if m.base != nil {
+		write(*m.base)
+	}
+	for _, file := range m.history {
+		write(file)
+	}
+	for _, file := range m.incrs {
+		write(file)
+	}
+	return buf.Bytes()
+}
+
+// clone returns a copy that can be changed without affecting m
+func (m *manifest) clone() *manifest {
+	c := &manifest{
+		history: append([]manifestFile(nil), m.history...),
+		incrs:   append([]manifestFile(nil), m.incrs...),
+	}
+	if m.base != nil {
+		base := *m.base
+		c.base = &base
+	}
+	return c
+}
+
+// nextBaseSeq returns the sequence number of the next base file
+func (m *manifest) nextBaseSeq() int {
+	if m.base == nil {
+		return 1
+	}
+	return m.base.seq + 1
+}
+
+// nextIncrSeq returns the sequence number of the next incremental file
+func (m *manifest) nextIncrSeq() int {
+	if len(m.incrs) == 0 {
+		return 1
+	}
+	return m.incrs[len(m.incrs)-1].seq + 1
+}
+
+// saveManifest replaces the manifest at path only once the new one is on disk
+func saveManifest(path string, m *manifest) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "temp-*.manifest")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(m.encode()); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Chmod(0o644); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
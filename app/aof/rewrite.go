@@ -0,0 +1,100 @@
+package aof
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/rdb"
+	"github.com/codecrafters-io/redis-starter-go/app/store"
+)
+
+// Rewrite compacts the append-only file. Writes move to a new incremental file
+// at once, while a new base is written from a snapshot of the live dataset in
+// a background goroutine. Once the base is on disk, the manifest drops the
+// files it replaces.
+func (a *AOF) Rewrite() error {
+	a.writes.Lock()
+	defer a.writes.Unlock()
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.rewriting {
+		return ErrRewriteInProgress
+	}
+	if err := os.MkdirAll(a.dir, 0o755); err != nil {
+		return err
+	}
+
+	m := &manifest{}
+	if a.manifest != nil {
+		m = a.manifest.clone()
+	}
+	// Incremental files from this one on hold writes the snapshot misses
+	keepFrom := m.nextIncrSeq()
+	if a.enabled {
+		if err := a.startIncr(m); err != nil {
+			return err
+		}
+		a.manifest = m
+	}
+
+	snapshot, _ := a.databases.Snapshot()
+	a.rewriting = true
+	a.rewriteStarted = time.Now()
+	go a.finishRewrite(m.nextBaseSeq(), keepFrom, snapshot)
+	return nil
+}
+
+// finishRewrite writes the new base and retires the files it replaces
+func (a *AOF) finishRewrite(seq, keepFrom int, snapshot [][]store.SnapshotItem) {
+	base, err := a.writeBase(seq, snapshot)
+	if err != nil {
+		fmt.Printf("Background AOF rewrite error: %v\n", err)
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.rewriting = false
+	a.rewriteErr = err
+	a.rewriteDuration = time.Since(a.rewriteStarted)
+	if err != nil {
+		return
+	}
+
+	m := &manifest{}
+	if a.manifest != nil {
+		m = a.manifest.clone()
+	}
+	if m.base != nil {
+		m.history = append(m.history, manifestFile{name: m.base.name, seq: m.base.seq, kind: typeHistory})
+	}
+	incrs := m.incrs[:0:0]
+	for _, incr := range m.incrs {
+		if incr.seq >= keepFrom {
+			incrs = append(incrs, incr)
+		} else {
+			m.history = append(m.history, manifestFile{name: incr.name, seq: incr.seq, kind: typeHistory})
+		}
+	}
+	m.base = &base
+	m.incrs = incrs
+
+	if err := saveManifest(manifestPath(a.dir, a.filename), m); err != nil {
+		fmt.Printf("Background AOF rewrite error: %v\n", err)
+		a.rewriteErr = err
+		os.Remove(filepath.Join(a.dir, base.name))
+		return
+	}
+	a.manifest = m
+	a.rewrites++
+	a.deleteHistory()
+	fmt.Println("Background AOF rewrite finished successfully")
+}
+
+// writeBase writes snapshot as the base file with sequence number seq
+func (a *AOF) writeBase(seq int, snapshot [][]store.SnapshotItem) (manifestFile, error) {
+	base := manifestFile{name: fmt.Sprintf("%s.%d.base.rdb", a.filename, seq), seq: seq, kind: typeBase}
+	return base, rdb.SaveFile(filepath.Join(a.dir, base.name), snapshot)
+}
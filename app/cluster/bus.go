@@ -0,0 +1,492 @@
+package cluster
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+const (
+	pingPeriod   = time.Second            // how often each known node is pinged
+	busTimeout   = time.Second            // how long a node may take to answer a message
+	cronPeriod   = 100 * time.Millisecond // how often the configuration is saved if changed
+	meetAttempts = 5                      // how many times a MEET is tried before giving up
+)
+
+// Kinds of message nodes exchange on the bus
+const (
+	meetMessage = "MEET"
+	pingMessage = "PING"
+	pongMessage = "PONG"
+)
+
+// message is what nodes tell each other on the bus: who the sender is, the
+// slots it serves and some of the nodes it knows
+type message struct {
+	kind         string
+	id           string
+	port         int
+	cport        int
+	currentEpoch uint64
+	configEpoch  uint64
+	slots        []int
+	gossip       []gossipEntry
+}
+
+// gossipEntry is a node the sender of a message knows
+type gossipEntry struct {
+	id    string
+	ip    string
+	port  int
+	cport int
+}
+
+// encode formats m as a RESP array of bulk strings
+func (m message) encode() []byte {
+	args := []string{
+		m.kind, m.id, strconv.Itoa(m.port), strconv.Itoa(m.cport),
+		strconv.FormatUint(m.currentEpoch, 10), strconv.FormatUint(m.configEpoch, 10),
+		formatRanges(slotRanges(m.slots)),
+	}
+	for _, g := range m.gossip {
+		args = append(args, g.id, g.ip, strconv.Itoa(g.port), strconv.Itoa(g.cport))
+	}
+
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(arg))+"\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	return buf
+}
+
+// readMessage reads the next message from a bus connection
+func readMessage(reader *bufio.Reader) (message, error) {
+	value, err := resp.ParseRESP(reader)
+	if err != nil {
+		return message{}, err
+	}
+	items, _ := value.Value.([]resp.RespValue)
+	if len(items) < 7 || (len(items)-7)%4 != 0 {
+		return message{}, errors.New("malformed cluster bus message")
+	}
+	args := make([]string, len(items))
+	for i, item := range items {
+		args[i], _ = item.Value.(string)
+	}
+
+	m := message{kind: args[0], id: args[1]}
+	m.port, _ = strconv.Atoi(args[2])
+	m.cport, _ = strconv.Atoi(args[3])
+	m.currentEpoch, _ = strconv.ParseUint(args[4], 10, 64)
+	m.configEpoch, _ = strconv.ParseUint(args[5], 10, 64)
+	if m.slots, err = parseRanges(args[6]); err != nil {
+		return message{}, err
+	}
+	for i := 7; i < len(args); i += 4 {
+		g := gossipEntry{id: args[i], ip: args[i+1]}
+		g.port, _ = strconv.Atoi(args[i+2])
+		g.cport, _ = strconv.Atoi(args[i+3])
+		m.gossip = append(m.gossip, g)
+	}
+	return m, nil
+}
+
+// Start listens for other nodes on the bus port, starts pinging the nodes
+// already known and saves the configuration whenever it changes
+func (c *Cluster) Start() error {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(c.port+busPortOffset))
+	if err != nil {
+		return err
+	}
+	go c.accept(listener)
+
+	c.mutex.Lock()
+	for _, n := range c.nodes {
+		if n != c.myself {
+			go c.link(n)
+		}
+	}
+	c.dirty = true
+	c.mutex.Unlock()
+
+	go c.cron()
+	return nil
+}
+
+// accept serves every node connecting to the bus
+func (c *Cluster) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			fmt.Printf("Error accepting cluster bus connection: %v\n", err)
+			continue
+		}
+		go c.serve(conn)
+	}
+}
+
+// serve answers the messages a node sends on conn with PONGs
+func (c *Cluster) serve(conn net.Conn) {
+	defer conn.Close()
+
+	localIP, remoteIP := hostOf(conn.LocalAddr()), hostOf(conn.RemoteAddr())
+	reader := bufio.NewReader(conn)
+	for {
+		m, err := readMessage(reader)
+		if err != nil {
+			return
+		}
+		c.learnIP(localIP)
+		c.handle(m, remoteIP, m.kind == meetMessage)
+
+		conn.SetWriteDeadline(time.Now().Add(busTimeout))
+		if _, err := conn.Write(c.message(pongMessage, m.id).encode()); err != nil {
+			return
+		}
+	}
+}
+
+// link pings n every second over a connection it keeps open, until n is
+// forgotten
+func (c *Cluster) link(n *node) {
+	var conn net.Conn
+	var reader *bufio.Reader
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.done:
+			return
+		case <-ticker.C:
+		}
+
+		c.mutex.Lock()
+		address, id := n.busAddress(), n.id
+		if n.pingSent.IsZero() {
+			n.pingSent = time.Now()
+		}
+		c.mutex.Unlock()
+
+		if conn == nil {
+			var err error
+			if conn, err = net.DialTimeout("tcp", address, busTimeout); err != nil {
+				conn = nil
+				c.setLink(n, false)
+				continue
+			}
+			reader = bufio.NewReader(conn)
+		}
+
+		conn.SetDeadline(time.Now().Add(busTimeout))
+		_, err := conn.Write(c.message(pingMessage, id).encode())
+		var reply message
+		if err == nil {
+			reply, err = readMessage(reader)
+		}
+		if err != nil || reply.id != id {
+			conn.Close()
+			conn = nil
+			c.setLink(n, false)
+			continue
+		}
+		c.handle(reply, "", false)
+	}
+}
+
+// setLink records whether this node can reach n
+func (c *Cluster) setLink(n *node, up bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	n.linkUp = up
+}
+
+// Meet introduces this node to the node whose bus listens on ip and cport,
+// which then tells the rest of its cluster about this node and back
+func (c *Cluster) Meet(ip string, port, cport int) error {
+	if net.ParseIP(ip) == nil || port < 1 || port > 65535 || cport < 1 || cport > 65535 {
+		return errors.New("ERR Invalid node address specified: " + net.JoinHostPort(ip, strconv.Itoa(port)))
+	}
+	go c.meet(ip, cport)
+	return nil
+}
+
+// meet sends a MEET to the node whose bus listens on ip and cport, retrying
+// a few times while it cannot be reached
+func (c *Cluster) meet(ip string, cport int) {
+	address := net.JoinHostPort(ip, strconv.Itoa(cport))
+	c.mutex.Lock()
+	if c.meeting[address] {
+		c.mutex.Unlock()
+		return
+	}
+	c.meeting[address] = true
+	c.mutex.Unlock()
+
+	defer func() {
+		c.mutex.Lock()
+		delete(c.meeting, address)
+		c.mutex.Unlock()
+	}()
+
+	for attempt := 0; attempt < meetAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(pingPeriod)
+		}
+		if err := c.sendMeet(address, ip); err == nil {
+			return
+		}
+	}
+	fmt.Printf("Failed to meet cluster node at %s\n", address)
+}
+
+// sendMeet sends a single MEET to address and takes in the PONG answering it
+func (c *Cluster) sendMeet(address, ip string) error {
+	conn, err := net.DialTimeout("tcp", address, busTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(busTimeout))
+	if _, err := conn.Write(c.message(meetMessage, "").encode()); err != nil {
+		return err
+	}
+	reply, err := readMessage(bufio.NewReader(conn))
+	if err != nil {
+		return err
+	}
+	c.learnIP(hostOf(conn.LocalAddr()))
+	c.handle(reply, ip, true)
+	return nil
+}
+
+// message builds a message of the given kind for the node with the given ID,
+// gossiping about every other node this node knows
+func (c *Cluster) message(kind, to string) message {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	m := message{
+		kind:         kind,
+		id:           c.myself.id,
+		port:         c.myself.port,
+		cport:        c.myself.cport,
+		currentEpoch: c.currentEpoch,
+		configEpoch:  c.myself.configEpoch,
+		slots:        c.slotsOf(c.myself),
+	}
+	for _, n := range c.nodes {
+		if n != c.myself && n.id != to && n.ip != "" {
+			m.gossip = append(m.gossip, gossipEntry{id: n.id, ip: n.ip, port: n.port, cport: n.cport})
+		}
+	}
+	c.messagesSent++
+	return m
+}
+
+// handle takes in what a message tells about its sender and the nodes it
+// knows. A sender this node does not know yet is only added when trusted,
+// that is when it sent a MEET or answered one. ip is the address the sender
+// was reached on, empty when it is already known.
+func (c *Cluster) handle(m message, ip string, trusted bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.messagesRecved++
+	if m.id == c.myself.id {
+		return
+	}
+	sender := c.nodes[m.id]
+	if sender == nil {
+		if !trusted || c.isForgotten(m.id) || ip == "" {
+			return
+		}
+		sender = c.addNode(m.id, ip, m.port, m.cport)
+	} else if ip != "" && (sender.ip != ip || sender.port != m.port || sender.cport != m.cport) {
+		sender.ip, sender.port, sender.cport = ip, m.port, m.cport
+		c.dirty = true
+	}
+
+	if m.kind == pongMessage {
+		sender.pongReceived = time.Now()
+		sender.pingSent = time.Time{}
+		sender.linkUp = true
+	}
+
+	if m.currentEpoch > c.currentEpoch {
+		c.currentEpoch = m.currentEpoch
+		c.dirty = true
+	}
+	if m.configEpoch != sender.configEpoch {
+		sender.configEpoch = m.configEpoch
+		c.dirty = true
+	}
+	c.claimSlots(sender, m.slots)
+
+	// Two nodes with the same config epoch could both claim a slot, so the
+	// one with the lower ID moves on to a new epoch
+	if sender.configEpoch == c.myself.configEpoch && c.myself.id < sender.id {
+		c.currentEpoch++
+		c.myself.configEpoch = c.currentEpoch
+		c.dirty = true
+	}
+
+	for _, g := range m.gossip {
+		if g.id == c.myself.id || g.ip == "" || c.nodes[g.id] != nil || c.isForgotten(g.id) {
+			continue
+		}
+		go c.meet(g.ip, g.cport)
+	}
+}
+
+// claimSlots gives sender the slots it claims to serve, unless their owner
+// has a greater config epoch or this node is importing them. The caller must
+// hold the mutex.
+func (c *Cluster) claimSlots(sender *node, slots []int) {
+	for _, slot := range slots {
+		owner := c.slots[slot]
+		if owner == sender || c.importing[slot] != nil {
+			continue
+		}
+		if owner == nil || owner.configEpoch < sender.configEpoch {
+			if owner == c.myself {
+				c.migrating[slot] = nil
+				fmt.Printf("Slot %d is now served by %s\n", slot, sender.id)
+			}
+			c.assign(slot, sender)
+		}
+	}
+}
+
+// addNode adds a node this node was introduced to and starts pinging it.
+// The caller must hold the mutex.
+func (c *Cluster) addNode(id, ip string, port, cport int) *node {
+	n := &node{id: id, ip: ip, port: port, cport: cport, done: make(chan struct{})}
+	c.nodes[id] = n
+	c.dirty = true
+	go c.link(n)
+	return n
+}
+
+// isForgotten reports whether the node with the given ID was forgotten too
+// recently to be added back. The caller must hold the mutex.
+func (c *Cluster) isForgotten(id string) bool {
+	until, ok := c.forgotten[id]
+	return ok && time.Now().Before(until)
+}
+
+// learnIP records the address other nodes reach this node on, until it is
+// known
+func (c *Cluster) learnIP(ip string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.myself.ip == "" && ip != "" {
+		c.myself.ip = ip
+		c.dirty = true
+	}
+}
+
+// cron saves the configuration whenever it changed and drops forgotten
+// nodes gossip may add back again
+func (c *Cluster) cron() {
+	ticker := time.NewTicker(cronPeriod)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.mutex.Lock()
+		for id, until := range c.forgotten {
+			if time.Now().After(until) {
+				delete(c.forgotten, id)
+			}
+		}
+		dirty := c.dirty
+		c.dirty = false
+		c.mutex.Unlock()
+
+		if dirty {
+			if err := c.save(); err != nil {
+				fmt.Printf("Error saving cluster configuration: %v\n", err)
+			}
+		}
+	}
+}
+
+// hostOf returns the IP of a TCP address
+func hostOf(addr net.Addr) string {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp.IP.String()
+	}
+	return ""
+}
+
+// slotRanges groups sorted slots into ranges of consecutive slots
+func slotRanges(slots []int) [][2]int {
+	var ranges [][2]int
+	for _, slot := range slots {
+		if n := len(ranges); n > 0 && ranges[n-1][1] == slot-1 {
+			ranges[n-1][1] = slot
+		} else {
+			ranges = append(ranges, [2]int{slot, slot})
+		}
+	}
+	return ranges
+}
+
+// formatRanges formats slot ranges as "0-5460,5462"
+func formatRanges(ranges [][2]int) string {
+	parts := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		parts = append(parts, formatRange(r))
+	}
+	return strings.Join(parts, ",")
+}
+
+// formatRange formats a slot range as "0-5460", or "5462" for a single slot
+func formatRange(r [2]int) string {
+	if r[0] == r[1] {
+		return strconv.Itoa(r[0])
+	}
+	return strconv.Itoa(r[0]) + "-" + strconv.Itoa(r[1])
+}
+
+// parseRanges parses slot ranges formatted by formatRanges into the slots
+// they hold
+func parseRanges(s string) ([]int, error) {
+	var slots []int
+	if s == "" {
+		return slots, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		first, last, found := strings.Cut(part, "-")
+		start, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, ErrInvalidSlot
+		}
+		end := start
+		if found {
+			if end, err = strconv.Atoi(last); err != nil {
+				return nil, ErrInvalidSlot
+			}
+		}
+		if start < 0 || end >= SlotCount || start > end {
+			return nil, ErrInvalidSlot
+		}
+		for slot := start; slot <= end; slot++ {
+			slots = append(slots, slot)
+		}
+	}
+	return slots, nil
+}
@@ -0,0 +1,493 @@
+package cluster
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Errors returned for commands this node cannot serve, or cluster commands
+// that cannot be applied
+var (
+	ErrCrossSlot   = errors.New("CROSSSLOT Keys in request don't hash to the same slot")
+	ErrClusterDown = errors.New("CLUSTERDOWN The cluster is down")
+	ErrSlotUnbound = errors.New("CLUSTERDOWN Hash slot not served")
+	ErrTryAgain    = errors.New("TRYAGAIN Multiple keys request during rehashing of slot")
+	ErrInvalidSlot = errors.New("ERR Invalid or out of range slot")
+	ErrForgetSelf  = errors.New("ERR I tried hard but I can't forget myself...")
+	ErrResetKeys   = errors.New("ERR CLUSTER RESET can't be called with master nodes containing keys")
+)
+
+// busPortOffset is how far above the client port nodes listen for each other
+const busPortOffset = 10000
+
+// forgetTTL is how long a forgotten node is kept from being added back by
+// gossip, giving every node time to forget it
+const forgetTTL = 60 * time.Second
+
+// Keyspace is the data of this node, whose keys tell whether a slot still
+// holds keys and whether a key has already been migrated
+type Keyspace interface {
+	Exists(keys ...string) int
+	Keys() []string
+}
+
+// node is a member of the cluster as this node knows it. Its fields are
+// guarded by the Cluster mutex.
+type node struct {
+	id           string
+	ip           string
+	port         int
+	cport        int
+	configEpoch  uint64
+	myself       bool
+	pingSent     time.Time // when the unanswered PING was sent, zero once answered
+	pongReceived time.Time
+	linkUp       bool
+	done         chan struct{} // closed once the node is forgotten
+}
+
+// address returns the client address of n
+func (n *node) address() string {
+	return net.JoinHostPort(n.ip, strconv.Itoa(n.port))
+}
+
+// busAddress returns the address n listens on for other nodes
+func (n *node) busAddress() string {
+	return net.JoinHostPort(n.ip, strconv.Itoa(n.cport))
+}
+
+// failing reports whether n has not answered a PING in time
+func (n *node) failing(timeout time.Duration) bool {
+	return !n.pingSent.IsZero() && time.Since(n.pingSent) > timeout
+}
+
+// Cluster is the state of this node as a member of a cluster: the nodes it
+// knows, which of them serves each hash slot and the slots being migrated
+type Cluster struct {
+	keys       Keyspace
+	configPath string
+	port       int
+
+	mutex          sync.Mutex
+	myself         *node
+	nodes          map[string]*node // by ID, this node included
+	slots          [SlotCount]*node
+	assigned       int // number of slots with a node
+	migrating      [SlotCount]*node
+	importing      [SlotCount]*node
+	currentEpoch   uint64
+	nodeTimeout    time.Duration
+	fullCoverage   bool                 // every slot must be served for the cluster to be up
+	meeting        map[string]bool      // bus addresses a MEET is being sent to
+	forgotten      map[string]time.Time // IDs gossip may not add back before then
+	dirty          bool                 // the configuration changed since it was saved
+	messagesSent   int64
+	messagesRecved int64
+}
+
+// New creates the cluster state of a node listening on port for clients,
+// knowing only itself until its configuration is loaded
+func New(keys Keyspace, configPath string, port int) *Cluster {
+	c := &Cluster{
+		keys:         keys,
+		configPath:   configPath,
+		port:         port,
+		nodes:        make(map[string]*node),
+		nodeTimeout:  15 * time.Second,
+		fullCoverage: true,
+		meeting:      make(map[string]bool),
+		forgotten:    make(map[string]time.Time),
+	}
+	c.myself = &node{id: newNodeID(), port: port, cport: port + busPortOffset, myself: true}
+	c.nodes[c.myself.id] = c.myself
+	return c
+}
+
+// newNodeID returns a random 40 character node ID
+func newNodeID() string {
+	buf := make([]byte, 20)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// MyID returns the ID of this node
+func (c *Cluster) MyID() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.myself.id
+}
+
+// Route returns the error redirecting a command on keys to the node serving
+// their slot, or nil when this node serves it. asking tells whether the
+// client sent ASKING, which lets it use a slot this node is importing.
+func (c *Cluster) Route(keys []string, asking bool) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	slot := KeySlot(keys[0])
+	for _, key := range keys[1:] {
+		if KeySlot(key) != slot {
+			return ErrCrossSlot
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.stateOK() {
+		return ErrClusterDown
+	}
+	owner := c.slots[slot]
+	if owner == nil {
+		return ErrSlotUnbound
+	}
+
+	// Keys of a slot being migrated are either still here or already moved
+	migrating, importing := c.migrating[slot], c.importing[slot]
+	missing := 0
+	if (owner == c.myself && migrating != nil) || (importing != nil && asking) {
+		for _, key := range keys {
+			if c.keys.Exists(key) == 0 {
+				missing++
+			}
+		}
+	}
+	if owner == c.myself && migrating != nil && missing > 0 {
+		if missing < len(keys) {
+			return ErrTryAgain
+		}
+		return fmt.Errorf("ASK %d %s", slot, migrating.address())
+	}
+	if importing != nil && asking {
+		if len(keys) > 1 && missing > 0 {
+			return ErrTryAgain
+		}
+		return nil
+	}
+	if owner != c.myself {
+		return fmt.Errorf("MOVED %d %s", slot, owner.address())
+	}
+	return nil
+}
+
+// stateOK reports whether the cluster is up: when full coverage is
+// required, every slot must be served. The caller must hold the mutex.
+func (c *Cluster) stateOK() bool {
+	return !c.fullCoverage || c.assigned == SlotCount
+}
+
+// assign makes n the node serving slot, nil leaving it unserved. The caller
+// must hold the mutex.
+func (c *Cluster) assign(slot int, n *node) {
+	if c.slots[slot] == nil && n != nil {
+		c.assigned++
+	} else if c.slots[slot] != nil && n == nil {
+		c.assigned--
+	}
+	c.slots[slot] = n
+	c.dirty = true
+}
+
+// slotsOf returns the slots n serves in order. The caller must hold the mutex.
+func (c *Cluster) slotsOf(n *node) []int {
+	var slots []int
+	for slot, owner := range c.slots {
+		if owner == n {
+			slots = append(slots, slot)
+		}
+	}
+	return slots
+}
+
+// AddSlots makes this node serve slots no node serves yet
+func (c *Cluster) AddSlots(slots []int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := checkSlots(slots); err != nil {
+		return err
+	}
+	for _, slot := range slots {
+		if c.slots[slot] != nil {
+			return fmt.Errorf("ERR Slot %d is already busy", slot)
+		}
+	}
+	for _, slot := range slots {
+		c.importing[slot] = nil
+		c.assign(slot, c.myself)
+	}
+	return nil
+}
+
+// DelSlots makes the nodes serving slots stop serving them, as far as this
+// node is concerned
+func (c *Cluster) DelSlots(slots []int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := checkSlots(slots); err != nil {
+		return err
+	}
+	for _, slot := range slots {
+		if c.slots[slot] == nil {
+			return fmt.Errorf("ERR Slot %d is already unassigned", slot)
+		}
+	}
+	for _, slot := range slots {
+		c.migrating[slot], c.importing[slot] = nil, nil
+		c.assign(slot, nil)
+	}
+	return nil
+}
+
+// checkSlots checks slots are in range and given once each
+func checkSlots(slots []int) error {
+	seen := make(map[int]bool, len(slots))
+	for _, slot := range slots {
+		if slot < 0 || slot >= SlotCount {
+			return ErrInvalidSlot
+		}
+		if seen[slot] {
+			return fmt.Errorf("ERR Slot %d specified multiple times", slot)
+		}
+		seen[slot] = true
+	}
+	return nil
+}
+
+// SetSlotMigrating marks a slot this node serves as moving to the node with
+// the given ID: clients asking for keys no longer here are sent there
+func (c *Cluster) SetSlotMigrating(slot int, id string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.slots[slot] != c.myself {
+		return fmt.Errorf("ERR I'm not the owner of hash slot %d", slot)
+	}
+	target, err := c.lookup(id)
+	if err != nil {
+		return err
+	}
+	if target == c.myself {
+		return errors.New("ERR I can't migrate to myself")
+	}
+	c.migrating[slot] = target
+	c.dirty = true
+	return nil
+}
+
+// SetSlotImporting marks a slot as moving to this node from the node with the
+// given ID: clients that send ASKING may use its keys here
+func (c *Cluster) SetSlotImporting(slot int, id string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.slots[slot] == c.myself {
+		return fmt.Errorf("ERR I'm already the owner of hash slot %d", slot)
+	}
+	source, err := c.lookup(id)
+	if err != nil {
+		return err
+	}
+	if source == c.myself {
+		return errors.New("ERR I can't import from myself")
+	}
+	c.importing[slot] = source
+	c.dirty = true
+	return nil
+}
+
+// SetSlotStable clears the migration state of a slot
+func (c *Cluster) SetSlotStable(slot int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.migrating[slot], c.importing[slot] = nil, nil
+	c.dirty = true
+}
+
+// SetSlotNode makes the node with the given ID serve a slot, ending its
+// migration. A node taking over a slot it imported claims a new config epoch,
+// so its claim wins over the old owner's with every other node.
+func (c *Cluster) SetSlotNode(slot int, id string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	target, err := c.lookup(id)
+	if err != nil {
+		return err
+	}
+	if c.slots[slot] == c.myself && target != c.myself && c.countKeysInSlot(slot) > 0 {
+		return fmt.Errorf("ERR Can't assign hashslot %d to a different node while I still hold keys for this hash slot.", slot)
+	}
+	if target != c.myself {
+		c.migrating[slot] = nil
+	}
+	if target == c.myself && c.importing[slot] != nil {
+		c.importing[slot] = nil
+		c.bumpConfigEpoch()
+	}
+	c.assign(slot, target)
+	return nil
+}
+
+// bumpConfigEpoch gives this node a config epoch greater than any other,
+// unless it already has one. The caller must hold the mutex.
+func (c *Cluster) bumpConfigEpoch() {
+	maxEpoch := c.currentEpoch
+	for _, n := range c.nodes {
+		maxEpoch = max(maxEpoch, n.configEpoch)
+	}
+	if c.myself.configEpoch == 0 || c.myself.configEpoch != maxEpoch {
+		c.currentEpoch++
+		c.myself.configEpoch = c.currentEpoch
+		c.dirty = true
+	}
+}
+
+// lookup returns the node with the given ID. The caller must hold the mutex.
+func (c *Cluster) lookup(id string) (*node, error) {
+	n, ok := c.nodes[id]
+	if !ok {
+		return nil, errors.New("ERR Unknown node " + id)
+	}
+	return n, nil
+}
+
+// CountKeysInSlot returns how many keys of slot this node holds
+func (c *Cluster) CountKeysInSlot(slot int) int {
+	return c.countKeysInSlot(slot)
+}
+
+// countKeysInSlot counts the keys of slot by hashing every key, which is
+// slow on large datasets but needs no index kept up to date with every write
+func (c *Cluster) countKeysInSlot(slot int) int {
+	return len(c.KeysInSlot(slot, -1))
+}
+
+// KeysInSlot returns up to count keys of slot this node holds, all of them
+// when count is negative
+func (c *Cluster) KeysInSlot(slot, count int) []string {
+	keys := []string{}
+	for _, key := range c.keys.Keys() {
+		if count >= 0 && len(keys) >= count {
+			break
+		}
+		if KeySlot(key) == slot {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Forget removes the node with the given ID from this node's view of the
+// cluster, keeping gossip from adding it back for a minute
+func (c *Cluster) Forget(id string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	n, err := c.lookup(id)
+	if err != nil {
+		return err
+	}
+	if n == c.myself {
+		return ErrForgetSelf
+	}
+	c.forgotten[id] = time.Now().Add(forgetTTL)
+	c.removeNode(n)
+	return nil
+}
+
+// removeNode drops n and the slots it serves. The caller must hold the mutex.
+func (c *Cluster) removeNode(n *node) {
+	for slot := range c.slots {
+		if c.slots[slot] == n {
+			c.assign(slot, nil)
+		}
+		if c.migrating[slot] == n {
+			c.migrating[slot] = nil
+		}
+		if c.importing[slot] == n {
+			c.importing[slot] = nil
+		}
+	}
+	close(n.done)
+	delete(c.nodes, n.id)
+	c.dirty = true
+}
+
+// Reset makes this node forget every other node and the slots it serves. A
+// hard reset also gives it a new ID and starts its epochs over.
+func (c *Cluster) Reset(hard bool) error {
+	if len(c.keys.Keys()) > 0 {
+		return ErrResetKeys
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, n := range c.nodes {
+		if n != c.myself {
+			c.removeNode(n)
+		}
+	}
+	for slot := range c.slots {
+		c.migrating[slot], c.importing[slot] = nil, nil
+		c.assign(slot, nil)
+	}
+	if hard {
+		delete(c.nodes, c.myself.id)
+		c.myself.id = newNodeID()
+		c.nodes[c.myself.id] = c.myself
+		c.currentEpoch = 0
+		c.myself.configEpoch = 0
+	}
+	c.dirty = true
+	return nil
+}
+
+// NodeTimeout returns the cluster-node-timeout parameter
+func (c *Cluster) NodeTimeout() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return strconv.FormatInt(c.nodeTimeout.Milliseconds(), 10)
+}
+
+// SetNodeTimeout sets the cluster-node-timeout parameter, in milliseconds
+func (c *Cluster) SetNodeTimeout(value string) error {
+	ms, err := strconv.Atoi(value)
+	if err != nil || ms < 1 {
+		return errors.New("argument must be a positive integer")
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.nodeTimeout = time.Duration(ms) * time.Millisecond
+	return nil
+}
+
+// FullCoverage returns the cluster-require-full-coverage parameter
+func (c *Cluster) FullCoverage() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.fullCoverage {
+		return "yes"
+	}
+	return "no"
+}
+
+// SetFullCoverage sets the cluster-require-full-coverage parameter
+func (c *Cluster) SetFullCoverage(value string) error {
+	if value != "yes" && value != "no" {
+		return errors.New("argument must be 'yes' or 'no'")
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.fullCoverage = value == "yes"
+	return nil
+}
@@ -0,0 +1,246 @@
+package cluster
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// keyspace is a set of keys standing in for the data of a node
+type keyspace map[string]bool
+
+func (k keyspace) Exists(keys ...string) int {
+	count := 0
+	for _, key := range keys {
+		if k[key] {
+			count++
+		}
+	}
+	return count
+}
+
+func (k keyspace) Keys() []string {
+	keys := make([]string, 0, len(k))
+	for key := range k {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// newTestCluster returns a node on port 7000 and a peer on port 7001 it
+// knows without linking to it, splitting the slots between them at split
+func newTestCluster(t *testing.T, keys keyspace, split int) (*Cluster, *node) {
+	t.Helper()
+	c := New(keys, filepath.Join(t.TempDir(), "nodes.conf"), 7000)
+	c.myself.ip = "127.0.0.1"
+	peer := &node{id: newNodeID(), ip: "127.0.0.1", port: 7001, cport: 17001, done: make(chan struct{})}
+	c.nodes[peer.id] = peer
+	for slot := 0; slot < SlotCount; slot++ {
+		if slot < split {
+			c.assign(slot, c.myself)
+		} else {
+			c.assign(slot, peer)
+		}
+	}
+	return c, peer
+}
+
+func TestKeySlot(t *testing.T) {
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{"", 0},
+		{"foo", 12182},
+		{"bar", 5061},
+		{"hello", 866},
+		{"123456789", 12739},
+		{"{foo}bar", 12182},
+		{"baz{foo}", 12182},
+		{"{foo}{bar}", 12182},
+	}
+	for _, tt := range tests {
+		if got := KeySlot(tt.key); got != tt.want {
+			t.Errorf("KeySlot(%q) = %d, want %d", tt.key, got, tt.want)
+		}
+	}
+
+	// Only a non-empty tag after the first { is hashed
+	same := [][2]string{
+		{"{user1000}.following", "{user1000}.followers"},
+		{"foo{{bar}}zap", "{bar"},
+		{"foo{bar}{zap}", "bar"},
+	}
+	for _, pair := range same {
+		if KeySlot(pair[0]) != KeySlot(pair[1]) {
+			t.Errorf("KeySlot(%q) != KeySlot(%q)", pair[0], pair[1])
+		}
+	}
+	if KeySlot("foo{}{bar}") == KeySlot("bar") {
+		t.Errorf("KeySlot(%q) hashed the tag after an empty one", "foo{}{bar}")
+	}
+}
+
+func TestRoute(t *testing.T) {
+	c, peer := newTestCluster(t, keyspace{}, 8192)
+	mine, theirs := "bar", "foo" // slots 5061 and 12182
+
+	tests := []struct {
+		name string
+		keys []string
+		want string
+	}{
+		{"no keys", nil, ""},
+		{"served here", []string{mine}, ""},
+		{"same tag here", []string{"{bar}a", "{bar}b"}, ""},
+		{"served elsewhere", []string{theirs}, "MOVED 12182 127.0.0.1:7001"},
+		{"cross slot", []string{mine, theirs}, ErrCrossSlot.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorString(c.Route(tt.keys, false)); got != tt.want {
+				t.Errorf("Route(%q) = %q, want %q", tt.keys, got, tt.want)
+			}
+		})
+	}
+
+	c.assign(KeySlot(theirs), nil)
+	if err := c.Route([]string{mine}, false); !errors.Is(err, ErrClusterDown) {
+		t.Errorf("Route with a slot unserved = %v, want %v", err, ErrClusterDown)
+	}
+	c.fullCoverage = false
+	if err := c.Route([]string{theirs}, false); !errors.Is(err, ErrSlotUnbound) {
+		t.Errorf("Route to an unserved slot = %v, want %v", err, ErrSlotUnbound)
+	}
+	if err := c.Route([]string{mine}, false); err != nil {
+		t.Errorf("Route without full coverage = %v, want nil", err)
+	}
+	c.assign(KeySlot(theirs), peer)
+}
+
+func TestRouteMigrating(t *testing.T) {
+	keys := keyspace{"{bar}here": true}
+	c, peer := newTestCluster(t, keys, 8192)
+	slot := KeySlot("bar")
+	if err := c.SetSlotMigrating(slot, peer.id); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		keys []string
+		want string
+	}{
+		{"key still here", []string{"{bar}here"}, ""},
+		{"key moved", []string{"{bar}moved"}, "ASK 5061 127.0.0.1:7001"},
+		{"some keys moved", []string{"{bar}here", "{bar}moved"}, ErrTryAgain.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorString(c.Route(tt.keys, false)); got != tt.want {
+				t.Errorf("Route(%q) = %q, want %q", tt.keys, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteImporting(t *testing.T) {
+	keys := keyspace{"{foo}here": true}
+	c, peer := newTestCluster(t, keys, 8192)
+	slot := KeySlot("foo")
+	if err := c.SetSlotImporting(slot, peer.id); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		keys   []string
+		asking bool
+		want   string
+	}{
+		{"without asking", []string{"{foo}here"}, false, "MOVED 12182 127.0.0.1:7001"},
+		{"asking", []string{"{foo}new"}, true, ""},
+		{"asking for keys all here", []string{"{foo}here", "{foo}here"}, true, ""},
+		{"asking for keys not all here", []string{"{foo}here", "{foo}new"}, true, ErrTryAgain.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorString(c.Route(tt.keys, tt.asking)); got != tt.want {
+				t.Errorf("Route(%q, %v) = %q, want %q", tt.keys, tt.asking, got, tt.want)
+			}
+		})
+	}
+
+	if err := c.SetSlotNode(slot, c.myself.id); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Route([]string{"{foo}new"}, false); err != nil {
+		t.Errorf("Route after taking the slot over = %v, want nil", err)
+	}
+	if c.myself.configEpoch == 0 {
+		t.Error("taking over an imported slot kept config epoch 0")
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	c, peer := newTestCluster(t, keyspace{}, 100)
+	if err := c.SetSlotMigrating(5, peer.id); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetSlotImporting(200, peer.id); err != nil {
+		t.Fatal(err)
+	}
+	c.currentEpoch = 7
+	if err := c.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := New(keyspace{}, c.configPath, 7000)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.myself.id != c.myself.id || len(loaded.nodes) != 2 {
+		t.Fatalf("loaded myself %s with %d nodes, want %s with 2", loaded.myself.id, len(loaded.nodes), c.myself.id)
+	}
+	if loaded.currentEpoch != 7 || loaded.assigned != SlotCount {
+		t.Errorf("loaded epoch %d with %d slots assigned", loaded.currentEpoch, loaded.assigned)
+	}
+	for _, slot := range []int{0, 99, 100, SlotCount - 1} {
+		want := peer.id
+		if slot < 100 {
+			want = c.myself.id
+		}
+		if got := loaded.slots[slot].id; got != want {
+			t.Errorf("slot %d served by %s, want %s", slot, got, want)
+		}
+	}
+	if loaded.migrating[5] == nil || loaded.migrating[5].id != peer.id {
+		t.Error("slot 5 no longer migrating")
+	}
+	if loaded.importing[200] == nil || loaded.importing[200].id != peer.id {
+		t.Error("slot 200 no longer importing")
+	}
+}
+
+func TestParseRanges(t *testing.T) {
+	slots, err := parseRanges("0-2,5,16383")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := formatRanges(slotRanges(slots)); got != "0-2,5,16383" {
+		t.Errorf("round trip = %q", got)
+	}
+	for _, bad := range []string{"a", "3-1", "0-16384", "-1", strconv.Itoa(SlotCount)} {
+		if _, err := parseRanges(bad); err == nil {
+			t.Errorf("parseRanges(%q) succeeded", bad)
+		}
+	}
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
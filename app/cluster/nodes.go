@@ -0,0 +1,330 @@
+package cluster
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrBadConfig is returned by Load for a configuration file it cannot parse
+var ErrBadConfig = errors.New("unrecoverable error: corrupted cluster config file")
+
+// NodeInfo is how a node serving slots is reported to clients
+type NodeInfo struct {
+	ID     string
+	IP     string
+	Port   int
+	Health string // online or failed
+}
+
+// SlotRange is a range of consecutive slots served by the same node
+type SlotRange struct {
+	Start int
+	End   int
+	Node  NodeInfo
+}
+
+// Shard is a node and the slot ranges it serves
+type Shard struct {
+	Slots [][2]int
+	Node  NodeInfo
+}
+
+// Nodes describes every node this node knows, one per line, as CLUSTER NODES
+// reports them and the configuration file stores them
+func (c *Cluster) Nodes() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.describeNodes()
+}
+
+// describeNodes formats the CLUSTER NODES lines. The caller must hold the mutex.
+func (c *Cluster) describeNodes() string {
+	var b strings.Builder
+	for _, n := range c.sortedNodes() {
+		flags := "master"
+		if n.myself {
+			flags = "myself,master"
+		} else if n.failing(c.nodeTimeout) {
+			flags = "master,fail?"
+		}
+		link := "connected"
+		if !n.myself && !n.linkUp {
+			link = "disconnected"
+		}
+		fields := []string{
+			n.id, n.address() + "@" + strconv.Itoa(n.cport), flags, "-",
+			unixMillis(n.pingSent), unixMillis(n.pongReceived),
+			strconv.FormatUint(n.configEpoch, 10), link,
+		}
+		for _, r := range slotRanges(c.slotsOf(n)) {
+			fields = append(fields, formatRange(r))
+		}
+		if n.myself {
+			for slot := range c.slots {
+				if target := c.migrating[slot]; target != nil {
+					fields = append(fields, "["+strconv.Itoa(slot)+"->-"+target.id+"]")
+				}
+				if source := c.importing[slot]; source != nil {
+					fields = append(fields, "["+strconv.Itoa(slot)+"-<-"+source.id+"]")
+				}
+			}
+		}
+		b.WriteString(strings.Join(fields, " ") + "\n")
+	}
+	return b.String()
+}
+
+// Slots returns the ranges of slots served, in order. localIP stands in for
+// the address of this node until another node has told it.
+func (c *Cluster) Slots(localIP string) []SlotRange {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var ranges []SlotRange
+	for slot, owner := range c.slots {
+		if owner == nil {
+			continue
+		}
+		if n := len(ranges); n > 0 && ranges[n-1].End == slot-1 && ranges[n-1].Node.ID == owner.id {
+			ranges[n-1].End = slot
+			continue
+		}
+		ranges = append(ranges, SlotRange{Start: slot, End: slot, Node: c.nodeInfo(owner, localIP)})
+	}
+	return ranges
+}
+
+// Shards returns every node with the ranges of slots it serves, those serving
+// slots first. localIP stands in for the address of this node until another
+// node has told it.
+func (c *Cluster) Shards(localIP string) []Shard {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	shards := make([]Shard, 0, len(c.nodes))
+	for _, n := range c.sortedNodes() {
+		shards = append(shards, Shard{Slots: slotRanges(c.slotsOf(n)), Node: c.nodeInfo(n, localIP)})
+	}
+	sort.SliceStable(shards, func(i, j int) bool {
+		a, b := shards[i].Slots, shards[j].Slots
+		if len(a) == 0 || len(b) == 0 {
+			return len(b) == 0 && len(a) > 0
+		}
+		return a[0][0] < b[0][0]
+	})
+	return shards
+}
+
+// nodeInfo returns how n is reported to clients. The caller must hold the
+// mutex.
+func (c *Cluster) nodeInfo(n *node, localIP string) NodeInfo {
+	info := NodeInfo{ID: n.id, IP: n.ip, Port: n.port, Health: "online"}
+	if info.IP == "" && n.myself {
+		info.IP = localIP
+	}
+	if n.failing(c.nodeTimeout) {
+		info.Health = "failed"
+	}
+	return info
+}
+
+// Info returns the fields CLUSTER INFO reports
+func (c *Cluster) Info() [][2]string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	state := "fail"
+	if c.stateOK() {
+		state = "ok"
+	}
+	pfail, size := 0, 0
+	serving := make(map[*node]bool)
+	for _, owner := range c.slots {
+		if owner == nil {
+			continue
+		}
+		if owner.failing(c.nodeTimeout) {
+			pfail++
+		}
+		if !serving[owner] {
+			serving[owner] = true
+			size++
+		}
+	}
+	return [][2]string{
+		{"cluster_state", state},
+		{"cluster_slots_assigned", strconv.Itoa(c.assigned)},
+		{"cluster_slots_ok", strconv.Itoa(c.assigned - pfail)},
+		{"cluster_slots_pfail", strconv.Itoa(pfail)},
+		{"cluster_slots_fail", "0"},
+		{"cluster_known_nodes", strconv.Itoa(len(c.nodes))},
+		{"cluster_size", strconv.Itoa(size)},
+		{"cluster_current_epoch", strconv.FormatUint(c.currentEpoch, 10)},
+		{"cluster_my_epoch", strconv.FormatUint(c.myself.configEpoch, 10)},
+		{"cluster_stats_messages_sent", strconv.FormatInt(c.messagesSent, 10)},
+		{"cluster_stats_messages_received", strconv.FormatInt(c.messagesRecved, 10)},
+		{"total_cluster_links_buffer_limit_exceeded", "0"},
+	}
+}
+
+// sortedNodes returns the known nodes ordered by ID. The caller must hold
+// the mutex.
+func (c *Cluster) sortedNodes() []*node {
+	nodes := make([]*node, 0, len(c.nodes))
+	for _, n := range c.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].id < nodes[j].id })
+	return nodes
+}
+
+// SaveConfig writes the configuration file right away
+func (c *Cluster) SaveConfig() error {
+	return c.save()
+}
+
+// save writes the nodes this node knows and its epochs to the configuration
+// file, replacing it only once fully written
+func (c *Cluster) save() error {
+	c.mutex.Lock()
+	content := c.describeNodes() + "vars currentEpoch " + strconv.FormatUint(c.currentEpoch, 10) + " lastVoteEpoch 0\n"
+	c.mutex.Unlock()
+
+	tmp := c.configPath + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.configPath)
+}
+
+// Load restores the nodes and slots saved in the configuration file, which
+// is not an error when the file does not exist yet
+func (c *Cluster) Load() error {
+	data, err := os.ReadFile(c.configPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var lines [][]string
+	nodes := make(map[string]*node)
+	var myself *node
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "vars" {
+			for i := 1; i+1 < len(fields); i += 2 {
+				if fields[i] == "currentEpoch" {
+					c.currentEpoch, _ = strconv.ParseUint(fields[i+1], 10, 64)
+				}
+			}
+			continue
+		}
+		if len(fields) < 8 {
+			return ErrBadConfig
+		}
+		n, err := parseNode(fields)
+		if err != nil {
+			return err
+		}
+		if n.myself {
+			n.port, n.cport = c.port, c.port+busPortOffset
+			myself = n
+		}
+		nodes[n.id] = n
+		lines = append(lines, fields)
+	}
+	if myself == nil {
+		return ErrBadConfig
+	}
+
+	c.myself, c.nodes = myself, nodes
+	for _, fields := range lines {
+		n := nodes[fields[0]]
+		for _, field := range fields[8:] {
+			if err := c.loadSlots(n, field); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseNode parses the node a CLUSTER NODES line describes
+func parseNode(fields []string) (*node, error) {
+	n := &node{id: fields[0], done: make(chan struct{})}
+	address, cport, found := strings.Cut(fields[1], "@")
+	cport, _, _ = strings.Cut(cport, ",")
+	host, port, err := net.SplitHostPort(address)
+	if !found || err != nil {
+		return nil, ErrBadConfig
+	}
+	n.ip = host
+	if n.port, err = strconv.Atoi(port); err != nil {
+		return nil, ErrBadConfig
+	}
+	if n.cport, err = strconv.Atoi(cport); err != nil {
+		return nil, ErrBadConfig
+	}
+	n.myself = strings.Contains(fields[2], "myself")
+	if n.configEpoch, err = strconv.ParseUint(fields[6], 10, 64); err != nil {
+		return nil, ErrBadConfig
+	}
+	return n, nil
+}
+
+// loadSlots applies a slot field of n's line: a range it serves or, on this
+// node's line, a slot being migrated as "[slot->-id]" or imported as
+// "[slot-<-id]". The caller must hold the mutex.
+func (c *Cluster) loadSlots(n *node, field string) error {
+	if strings.HasPrefix(field, "[") {
+		inner := strings.TrimSuffix(strings.TrimPrefix(field, "["), "]")
+		if slot, id, found := strings.Cut(inner, "->-"); found {
+			return c.loadMigration(&c.migrating, slot, id)
+		}
+		if slot, id, found := strings.Cut(inner, "-<-"); found {
+			return c.loadMigration(&c.importing, slot, id)
+		}
+		return ErrBadConfig
+	}
+	slots, err := parseRanges(field)
+	if err != nil {
+		return ErrBadConfig
+	}
+	for _, slot := range slots {
+		c.assign(slot, n)
+	}
+	return nil
+}
+
+// loadMigration records the node a slot is migrating to or importing from.
+// The caller must hold the mutex.
+func (c *Cluster) loadMigration(table *[SlotCount]*node, slot, id string) error {
+	s, err := strconv.Atoi(slot)
+	n, ok := c.nodes[id]
+	if err != nil || s < 0 || s >= SlotCount || !ok {
+		return ErrBadConfig
+	}
+	table[s] = n
+	return nil
+}
+
+// unixMillis formats t as milliseconds since the epoch, or 0 if it is unset
+func unixMillis(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
@@ -0,0 +1,45 @@
+package cluster
+
+import "strings"
+
+// SlotCount is the number of hash slots the keyspace is divided into
+const SlotCount = 16384
+
+// crc16Table is the lookup table of the CRC16-CCITT (XMODEM) checksum Redis
+// uses to map keys to slots
+var crc16Table = func() [256]uint16 {
+	var table [256]uint16
+	for i := range table {
+		crc := uint16(i) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// crc16 computes the CRC16-CCITT (XMODEM) checksum of s
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^s[i]]
+	}
+	return crc
+}
+
+// KeySlot returns the hash slot of a key or shard channel. When the name
+// contains a non-empty hash tag between the first { and the following }, only
+// the tag is hashed, so related names can be kept in one slot.
+func KeySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key)) & (SlotCount - 1)
+}
@@ -1,26 +1,221 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"flag"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 )
 
 // Config holds the application configuration
 type Config struct {
-	Port    int
-	Address string
+	Port                 int
+	Address              string
+	Databases            int
+	NotifyKeyspaceEvents string
+	Save                 string
+	AppendOnly           string
+	AppendFsync          string
+	ReplicaOf            string
+	RunID                string
+
+	// Sentinel mode monitors masters instead of serving a dataset
+	Sentinel                bool
+	SentinelMonitors        []string // masters to monitor as "<name> <host> <port> <quorum>"
+	SentinelDownAfter       int      // milliseconds without a valid reply before an instance is down
+	SentinelFailoverTimeout int      // milliseconds a failover may take
+
+	// Cluster mode shards the keyspace across nodes by hash slot
+	ClusterEnabled     bool
+	ClusterConfigFile  string // file under dir where the node saves its view of the cluster
+	ClusterNodeTimeout int    // milliseconds a node may not answer before it is failing
+
+	mutex          sync.RWMutex
+	parameters     map[string]Parameter
+	dir            string
+	dbFilename     string
+	appendDirName  string
+	appendFilename string
 }
 
 // NewConfig creates a new configuration from command line flags
 func NewConfig() *Config {
-	var port int
+	var port, databases int
+	var notifyKeyspaceEvents, dir, dbFilename, save string
+	var appendOnly, appendFsync, appendDirName, appendFilename, replicaOf string
+	var sentinel bool
+	var sentinelMonitors stringList
+	var sentinelDownAfter, sentinelFailoverTimeout int
+	var clusterEnabled bool
+	var clusterConfigFile string
+	var clusterNodeTimeout int
 	flag.IntVar(&port, "port", 6379, "Port to bind the Redis server to")
+	flag.IntVar(&databases, "databases", 16, "Number of logical databases")
+	flag.StringVar(&notifyKeyspaceEvents, "notify-keyspace-events", "", "Keyspace event classes to publish")
+	flag.StringVar(&dir, "dir", ".", "Directory holding the RDB snapshot")
+	flag.StringVar(&dbFilename, "dbfilename", "dump.rdb", "File name of the RDB snapshot")
+	flag.StringVar(&save, "save", "3600 1 300 100 60 10000", "Snapshot schedule as <seconds> <changes> pairs")
+	flag.StringVar(&appendOnly, "appendonly", "no", "Whether to log every write to the append-only file")
+	flag.StringVar(&appendFsync, "appendfsync", "everysec", "When the append-only file is flushed to disk: always, everysec or no")
+	flag.StringVar(&appendDirName, "appenddirname", "appendonlydir", "Directory under dir holding the append-only files")
+	flag.StringVar(&appendFilename, "appendfilename", "appendonly.aof", "Base name of the append-only files")
+	flag.StringVar(&replicaOf, "replicaof", "", "Master to replicate as \"<host> <port>\"")
+	flag.BoolVar(&sentinel, "sentinel", false, "Run as a sentinel monitoring masters")
+	flag.Var(&sentinelMonitors, "sentinel-monitor", "Master a sentinel monitors as \"<name> <host> <port> <quorum>\", may be repeated")
+	flag.IntVar(&sentinelDownAfter, "sentinel-down-after-milliseconds", 30000, "Milliseconds without a valid reply before a sentinel considers an instance down")
+	flag.IntVar(&sentinelFailoverTimeout, "sentinel-failover-timeout", 180000, "Milliseconds a sentinel lets a failover take")
+	flag.BoolVar(&clusterEnabled, "cluster-enabled", false, "Run as a node of a cluster sharding keys by hash slot")
+	flag.StringVar(&clusterConfigFile, "cluster-config-file", "nodes.conf", "File under dir where a cluster node saves its configuration")
+	flag.IntVar(&clusterNodeTimeout, "cluster-node-timeout", 15000, "Milliseconds a cluster node may not answer before it is failing")
 	flag.Parse()
 
-	return &Config{
-		Port:    port,
-		Address: "0.0.0.0:" + strconv.Itoa(port),
+	if databases < 1 {
+		databases = 1
 	}
+	// Sentinels listen on their own well-known port unless told otherwise
+	if sentinel && !flagSet("port") {
+		port = 26379
+	}
+
+	cfg := &Config{
+		Port:                 port,
+		Address:              "0.0.0.0:" + strconv.Itoa(port),
+		Databases:            databases,
+		NotifyKeyspaceEvents: notifyKeyspaceEvents,
+		Save:                 save,
+		AppendOnly:           appendOnly,
+		AppendFsync:          appendFsync,
+		ReplicaOf:            replicaOf,
+		RunID:                newRunID(),
+		dir:                  dir,
+		dbFilename:           dbFilename,
+		appendDirName:        appendDirName,
+		appendFilename:       appendFilename,
+
+		Sentinel:                sentinel,
+		SentinelMonitors:        sentinelMonitors,
+		SentinelDownAfter:       sentinelDownAfter,
+		SentinelFailoverTimeout: sentinelFailoverTimeout,
+
+		ClusterEnabled:     clusterEnabled,
+		ClusterConfigFile:  clusterConfigFile,
+		ClusterNodeTimeout: clusterNodeTimeout,
+	}
+	cfg.RegisterParameter("port", Parameter{Get: func() string { return strconv.Itoa(cfg.Port) }})
+	cfg.RegisterParameter("databases", Parameter{Get: func() string { return strconv.Itoa(cfg.Databases) }})
+	cfg.RegisterParameter("dir", Parameter{Get: cfg.GetDir, Set: cfg.setDir})
+	cfg.RegisterParameter("dbfilename", Parameter{Get: cfg.GetDBFilename, Set: cfg.setDBFilename})
+	cfg.RegisterParameter("appenddirname", Parameter{Get: func() string { return cfg.appendDirName }})
+	cfg.RegisterParameter("appendfilename", Parameter{Get: cfg.GetAppendFilename})
+	cfg.RegisterParameter("cluster-enabled", Parameter{Get: func() string { return yesNo(cfg.ClusterEnabled) }})
+	cfg.RegisterParameter("cluster-config-file", Parameter{Get: func() string { return cfg.ClusterConfigFile }})
+	return cfg
+}
+
+// stringList is a flag that may be given several times
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ", ") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+// flagSet reports whether the flag with the given name was passed
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// newRunID returns a random 40 character ID telling this process apart from
+// earlier runs of the server
+func newRunID() string {
+	buf := make([]byte, 20)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// yesNo formats a boolean parameter
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// GetClusterConfigPath returns the path of the cluster node configuration
+func (c *Config) GetClusterConfigPath() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return filepath.Join(c.dir, c.ClusterConfigFile)
+}
+
+// GetDir returns the directory holding the RDB snapshot
+func (c *Config) GetDir() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.dir
+}
+
+// GetDBFilename returns the file name of the RDB snapshot
+func (c *Config) GetDBFilename() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.dbFilename
+}
+
+// GetRDBPath returns the path of the RDB snapshot
+func (c *Config) GetRDBPath() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return filepath.Join(c.dir, c.dbFilename)
+}
+
+// GetAOFDir returns the directory holding the append-only files
+func (c *Config) GetAOFDir() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return filepath.Join(c.dir, c.appendDirName)
+}
+
+// GetAppendFilename returns the base name of the append-only files
+func (c *Config) GetAppendFilename() string {
+	return c.appendFilename
+}
+
+// setDir changes the snapshot directory, which must already exist
+func (c *Config) setDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New("not a directory")
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.dir = dir
+	return nil
+}
+
+// setDBFilename changes the snapshot file name, which may not include a directory
+func (c *Config) setDBFilename(name string) error {
+	if strings.ContainsRune(name, os.PathSeparator) {
+		return errors.New("dbfilename can't be a path, just a filename")
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.dbFilename = name
+	return nil
 }
 
 // GetAddress returns the server address
@@ -33,13 +228,23 @@ func (c *Config) GetPort() int {
 	return c.Port
 }
 
+// GetDatabases returns the number of logical databases
+func (c *Config) GetDatabases() int {
+	return c.Databases
+}
+
 // GetServerInfo returns server information for INFO command
 func (c *Config) GetServerInfo() map[string]string {
+	mode := "standalone"
+	if c.Sentinel {
+		mode = "sentinel"
+	} else if c.ClusterEnabled {
+		mode = "cluster"
+	}
 	return map[string]string{
-		"redis_version":    "7.0.0",
-		"redis_mode":       "standalone",
-		"tcp_port":         strconv.Itoa(c.Port),
-		"role":             "master",
-		"connected_slaves": "0",
+		"redis_version": "7.0.0",
+		"redis_mode":    mode,
+		"run_id":        c.RunID,
+		"tcp_port":      strconv.Itoa(c.Port),
 	}
 }
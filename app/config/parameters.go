@@ -0,0 +1,68 @@
+package config
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pattern"
+)
+
+// ErrUnknownParameter is returned by SetParameter for names that are not registered
+var ErrUnknownParameter = errors.New("unknown parameter")
+
+// ErrImmutableParameter is returned by SetParameter for parameters without a setter
+var ErrImmutableParameter = errors.New("can't set immutable config")
+
+// Parameter is a setting exposed through CONFIG GET and CONFIG SET
+type Parameter struct {
+	Get func() string
+	Set func(value string) error // nil for parameters fixed at startup
+}
+
+// RegisterParameter exposes a setting under name, replacing any previous registration
+func (c *Config) RegisterParameter(name string, param Parameter) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.parameters == nil {
+		c.parameters = make(map[string]Parameter)
+	}
+	c.parameters[strings.ToLower(name)] = param
+}
+
+// MatchParameters returns the names and values of the parameters matching the
+// glob pattern, as alternating entries sorted by name
+func (c *Config) MatchParameters(glob string) []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	names := make([]string, 0, len(c.parameters))
+	for name := range c.parameters {
+		if pattern.Match(glob, name, true) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		pairs = append(pairs, name, c.parameters[name].Get())
+	}
+	return pairs
+}
+
+// SetParameter changes the value of a registered parameter
+func (c *Config) SetParameter(name, value string) error {
+	c.mutex.RLock()
+	param, exists := c.parameters[strings.ToLower(name)]
+	c.mutex.RUnlock()
+
+	if !exists {
+		return ErrUnknownParameter
+	}
+	if param.Set == nil {
+		return ErrImmutableParameter
+	}
+	return param.Set(value)
+}
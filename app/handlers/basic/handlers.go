@@ -1,15 +1,18 @@
 package basic
 
 import (
+	"errors"
+	"fmt"
 	"net"
+	"strconv"
+	"strings"
 
+	"github.com/codecrafters-io/redis-starter-go/app/config"
 	"github.com/codecrafters-io/redis-starter-go/app/resp"
 )
 
 // PingHandler handles PING commands
-type PingHandler struct {
-	writer *resp.ResponseWriter
-}
+type PingHandler struct{}
 
 // NewPingHandler creates a new PING handler
 func NewPingHandler() *PingHandler {
@@ -17,27 +20,21 @@ func NewPingHandler() *PingHandler {
 }
 
 // Handle processes the PING command
-func (h *PingHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
+func (h *PingHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
 	if len(parts) == 1 {
-		return h.writer.WriteSimpleString("PONG")
+		return writer.WriteSimpleString("PONG")
 	}
 	if len(parts) == 2 {
+		// The message is arbitrary client data, so it is echoed as a bulk string
 		if msg, ok := parts[1].Value.(string); ok {
-			return h.writer.WriteSimpleString(msg)
+			return writer.WriteBulkString(msg)
 		}
 	}
-	return h.writer.WriteError("ERR wrong number of arguments for 'ping' command")
-}
-
-// SetWriter sets the response writer for this handler
-func (h *PingHandler) SetWriter(writer *resp.ResponseWriter) {
-	h.writer = writer
+	return writer.WriteError("ERR wrong number of arguments for 'ping' command")
 }
 
 // EchoHandler handles ECHO commands
-type EchoHandler struct {
-	writer *resp.ResponseWriter
-}
+type EchoHandler struct{}
 
 // NewEchoHandler creates a new ECHO handler
 func NewEchoHandler() *EchoHandler {
@@ -45,27 +42,24 @@ func NewEchoHandler() *EchoHandler {
 }
 
 // Handle processes the ECHO command
-func (h *EchoHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
+func (h *EchoHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
 	if len(parts) != 2 {
-		return h.writer.WriteError("ERR wrong number of arguments for 'echo' command")
+		return writer.WriteError("ERR wrong number of arguments for 'echo' command")
 	}
 
 	if msg, ok := parts[1].Value.(string); ok {
-		return h.writer.WriteBulkString(msg)
+		return writer.WriteBulkString(msg)
 	}
 
-	return h.writer.WriteError("ERR invalid argument type")
-}
-
-// SetWriter sets the response writer for this handler
-func (h *EchoHandler) SetWriter(writer *resp.ResponseWriter) {
-	h.writer = writer
+	return writer.WriteError("ERR invalid argument type")
 }
 
 // InfoHandler handles INFO commands
 type InfoHandler struct {
-	writer *resp.ResponseWriter
-	config ServerConfig
+	config      ServerConfig
+	keyspace    KeyspaceStats
+	replication ReplicationStats
+	persistence []PersistenceStats
 }
 
 // ServerConfig interface for server configuration
@@ -73,26 +67,283 @@ type ServerConfig interface {
 	GetServerInfo() map[string]string
 }
 
+// KeyspaceStats reports per-database key counts for the keyspace section
+type KeyspaceStats interface {
+	Count() int
+	Stats(index int) (keys, expires int)
+}
+
+// ReplicationStats reports the fields of the replication section in order
+type ReplicationStats interface {
+	ReplicationInfo() [][2]string
+}
+
+// PersistenceStats reports the fields of the persistence section in order
+type PersistenceStats interface {
+	PersistenceInfo() [][2]string
+}
+
 // NewInfoHandler creates a new INFO handler
-func NewInfoHandler(config ServerConfig) *InfoHandler {
+func NewInfoHandler(config ServerConfig, keyspace KeyspaceStats, replication ReplicationStats, persistence ...PersistenceStats) *InfoHandler {
 	return &InfoHandler{
-		config: config,
+		config:      config,
+		keyspace:    keyspace,
+		replication: replication,
+		persistence: persistence,
 	}
 }
 
 // Handle processes the INFO command
-func (h *InfoHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
-	info := h.config.GetServerInfo()
+func (h *InfoHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	section := ""
+	if len(parts) > 1 {
+		if s, ok := parts[1].Value.(string); ok {
+			section = strings.ToLower(s)
+		}
+	}
 
 	var infoString string
-	for key, value := range info {
-		infoString += key + ":" + value + "\r\n"
+	info := h.config.GetServerInfo()
+	if section != "keyspace" && section != "persistence" && section != "replication" && section != "cluster" {
+		for key, value := range info {
+			infoString += key + ":" + value + "\r\n"
+		}
+	}
+
+	switch section {
+	case "", "all", "default", "everything", "persistence":
+		if infoString != "" {
+			infoString += "\r\n"
+		}
+		infoString += h.persistenceSection()
+	}
+
+	switch section {
+	case "", "all", "default", "everything", "replication":
+		if infoString != "" {
+			infoString += "\r\n"
+		}
+		infoString += h.replicationSection()
+	}
+
+	switch section {
+	case "", "all", "default", "everything", "keyspace":
+		if infoString != "" {
+			infoString += "\r\n"
+		}
+		infoString += h.keyspaceSection()
+	}
+
+	switch section {
+	case "", "all", "default", "everything", "cluster":
+		if infoString != "" {
+			infoString += "\r\n"
+		}
+		enabled := "0"
+		if info["redis_mode"] == "cluster" {
+			enabled = "1"
+		}
+		infoString += "# Cluster\r\ncluster_enabled:" + enabled + "\r\n"
+	}
+
+	return writer.WriteBulkString(infoString)
+}
+
+// persistenceSection reports the state of RDB snapshots and the append-only file
+func (h *InfoHandler) persistenceSection() string {
+	section := "# Persistence\r\n"
+	for _, stats := range h.persistence {
+		for _, field := range stats.PersistenceInfo() {
+			section += field[0] + ":" + field[1] + "\r\n"
+		}
+	}
+	return section
+}
+
+// replicationSection reports the role of the server and the state of its
+// replicas or of its link to its master
+func (h *InfoHandler) replicationSection() string {
+	section := "# Replication\r\n"
+	for _, field := range h.replication.ReplicationInfo() {
+		section += field[0] + ":" + field[1] + "\r\n"
+	}
+	return section
+}
+
+// keyspaceSection lists the key counts of every non-empty database
+func (h *InfoHandler) keyspaceSection() string {
+	section := "# Keyspace\r\n"
+	for i := 0; i < h.keyspace.Count(); i++ {
+		keys, expires := h.keyspace.Stats(i)
+		if keys == 0 {
+			continue
+		}
+		section += fmt.Sprintf("db%d:keys=%d,expires=%d,avg_ttl=0\r\n", i, keys, expires)
 	}
+	return section
+}
+
+// HelloHandler handles HELLO commands
+type HelloHandler struct {
+	config  ServerConfig
+	clients ClientRegistry
+	role    RoleReporter
+}
+
+// ClientRegistry tracks the per-connection state HELLO negotiates
+type ClientRegistry interface {
+	ID(conn net.Conn) int
+	Protocol(conn net.Conn) int
+	SetProtocol(conn net.Conn, protocol int)
+	SetName(conn net.Conn, name string)
+}
+
+// RoleReporter reports whether the server is a master or a replica
+type RoleReporter interface {
+	Role() string
+}
+
+// NewHelloHandler creates a new HELLO handler
+func NewHelloHandler(config ServerConfig, clients ClientRegistry, role RoleReporter) *HelloHandler {
+	return &HelloHandler{
+		config:  config,
+		clients: clients,
+		role:    role,
+	}
+}
 
-	return h.writer.WriteBulkString(infoString)
+// Handle processes the HELLO command, switching protocol version when one is given
+func (h *HelloHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	protocol := h.clients.Protocol(conn)
+	name, setName := "", false
+
+	if len(parts) > 1 {
+		version, _ := parts[1].Value.(string)
+		switch version {
+		case "2":
+			protocol = resp.RESP2
+		case "3":
+			protocol = resp.RESP3
+		default:
+			if _, err := strconv.Atoi(version); err != nil {
+				return writer.WriteError("ERR Protocol version is not an integer or out of range")
+			}
+			return writer.WriteError("NOPROTO unsupported protocol version")
+		}
+	}
+
+	for i := 2; i < len(parts); i++ {
+		option, _ := parts[i].Value.(string)
+		switch {
+		case strings.EqualFold(option, "AUTH") && i+2 < len(parts):
+			// No passwords are configured, so only the default user exists
+			if user, _ := parts[i+1].Value.(string); user != "default" {
+				return writer.WriteError("WRONGPASS invalid username-password pair or user is disabled.")
+			}
+			i += 2
+		case strings.EqualFold(option, "SETNAME") && i+1 < len(parts):
+			name, _ = parts[i+1].Value.(string)
+			if strings.ContainsAny(name, " \n") {
+				return writer.WriteError("ERR Client names cannot contain spaces, newlines or special characters.")
+			}
+			setName = true
+			i++
+		default:
+			return writer.WriteError("ERR Syntax error in HELLO option '" + option + "'")
+		}
+	}
+
+	h.clients.SetProtocol(conn, protocol)
+	if setName {
+		h.clients.SetName(conn, name)
+	}
+
+	info := h.config.GetServerInfo()
+	writer.SetProtocol(protocol)
+	return writer.WriteValue(resp.RespValue{Type: resp.MapType, Value: []resp.RespValue{
+		{Type: resp.BulkString, Value: "server"}, {Type: resp.BulkString, Value: "redis"},
+		{Type: resp.BulkString, Value: "version"}, {Type: resp.BulkString, Value: info["redis_version"]},
+		{Type: resp.BulkString, Value: "proto"}, {Type: resp.IntegerType, Value: protocol},
+		{Type: resp.BulkString, Value: "id"}, {Type: resp.IntegerType, Value: h.clients.ID(conn)},
+		{Type: resp.BulkString, Value: "mode"}, {Type: resp.BulkString, Value: info["redis_mode"]},
+		{Type: resp.BulkString, Value: "role"}, {Type: resp.BulkString, Value: h.role.Role()},
+		{Type: resp.BulkString, Value: "modules"}, {Type: resp.ArrayType, Value: []resp.RespValue{}},
+	}})
 }
 
-// SetWriter sets the response writer for this handler
-func (h *InfoHandler) SetWriter(writer *resp.ResponseWriter) {
-	h.writer = writer
+// ConfigHandler handles CONFIG GET and CONFIG SET commands
+type ConfigHandler struct {
+	parameters ParameterStore
+}
+
+// ParameterStore exposes the runtime configuration parameters
+type ParameterStore interface {
+	MatchParameters(glob string) []string
+	SetParameter(name, value string) error
+}
+
+// NewConfigHandler creates a new CONFIG handler
+func NewConfigHandler(parameters ParameterStore) *ConfigHandler {
+	return &ConfigHandler{parameters: parameters}
+}
+
+// Handle processes the CONFIG command
+func (h *ConfigHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	args := make([]string, len(parts))
+	for i, part := range parts {
+		args[i], _ = part.Value.(string)
+	}
+
+	switch strings.ToUpper(args[1]) {
+	case "GET":
+		if len(args) < 3 {
+			return writer.WriteError("ERR wrong number of arguments for 'config|get' command")
+		}
+		return h.get(args[2:], writer)
+	case "SET":
+		if len(args) < 4 || len(args)%2 != 0 {
+			return writer.WriteError("ERR wrong number of arguments for 'config|set' command")
+		}
+		return h.set(args[2:], writer)
+	default:
+		return writer.WriteError("ERR unknown subcommand '" + args[1] + "'. Try CONFIG HELP.")
+	}
+}
+
+// get replies with every parameter matching any of the patterns, each listed once
+func (h *ConfigHandler) get(patterns []string, writer *resp.ResponseWriter) error {
+	seen := make(map[string]bool)
+	var items []resp.RespValue
+	for _, glob := range patterns {
+		pairs := h.parameters.MatchParameters(glob)
+		for i := 0; i < len(pairs); i += 2 {
+			if seen[pairs[i]] {
+				continue
+			}
+			seen[pairs[i]] = true
+			items = append(items,
+				resp.RespValue{Type: resp.BulkString, Value: pairs[i]},
+				resp.RespValue{Type: resp.BulkString, Value: pairs[i+1]})
+		}
+	}
+	if items == nil {
+		items = []resp.RespValue{}
+	}
+	return writer.WriteValue(resp.RespValue{Type: resp.MapType, Value: items})
+}
+
+// set applies name and value pairs in order, stopping at the first failure
+func (h *ConfigHandler) set(pairs []string, writer *resp.ResponseWriter) error {
+	for i := 0; i < len(pairs); i += 2 {
+		name := pairs[i]
+		err := h.parameters.SetParameter(name, pairs[i+1])
+		switch {
+		case err == nil:
+		case errors.Is(err, config.ErrUnknownParameter):
+			return writer.WriteError("ERR Unknown option or number of arguments for CONFIG SET - '" + name + "'")
+		default:
+			return writer.WriteError("ERR CONFIG SET failed (possibly related to argument '" + name + "') - " + err.Error())
+		}
+	}
+	return writer.WriteSimpleString("OK")
 }
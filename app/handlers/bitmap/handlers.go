@@ -0,0 +1,777 @@
+package bitmap
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/notify"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/store"
+)
+
+// maxBitOffset is the highest addressable bit in a 512MB string
+const maxBitOffset = 512*1024*1024*8 - 1
+
+var (
+	errNotInteger   = errors.New("ERR value is not an integer or out of range")
+	errSyntax       = errors.New("ERR syntax error")
+	errBitOffset    = errors.New("ERR bit offset is not an integer or out of range")
+	errBitValue     = errors.New("ERR bit is not an integer or out of range")
+	errBitfieldType = errors.New("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+)
+
+// parseBitOffset parses a bit offset, rejecting anything past the maximum string size
+func parseBitOffset(s string) (int, error) {
+	offset, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || offset < 0 || offset > maxBitOffset {
+		return 0, errBitOffset
+	}
+	return int(offset), nil
+}
+
+// getBit returns the bit at offset, treating bytes past the end as zero
+func getBit(value []byte, offset int) int {
+	byteIndex := offset >> 3
+	if byteIndex >= len(value) {
+		return 0
+	}
+	return int(value[byteIndex]>>(7-uint(offset&7))) & 1
+}
+
+// setBit sets the bit at offset; value must already be large enough
+func setBit(value []byte, offset int, bit int) {
+	byteIndex := offset >> 3
+	mask := byte(1 << (7 - uint(offset&7)))
+	if bit == 1 {
+		value[byteIndex] |= mask
+	} else {
+		value[byteIndex] &^= mask
+	}
+}
+
+// grow zero-pads value so that it holds at least size bytes
+func grow(value []byte, size int) []byte {
+	if size <= len(value) {
+		return value
+	}
+	return append(value, make([]byte, size-len(value))...)
+}
+
+// normalizeRange applies Redis's negative index rules to an inclusive range
+// over length units, reporting false when the range is empty
+func normalizeRange(start, end, length int) (int, int, bool) {
+	if start < 0 && end < 0 && start > end {
+		return 0, 0, false
+	}
+	if start < 0 {
+		start = length + start
+	}
+	if end < 0 {
+		end = length + end
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= length {
+		end = length - 1
+	}
+	if length == 0 || start > end {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// parseRangeUnit parses the optional BYTE|BIT range modifier
+func parseRangeUnit(s string) (bool, error) {
+	switch strings.ToUpper(s) {
+	case "BYTE":
+		return false, nil
+	case "BIT":
+		return true, nil
+	}
+	return false, errSyntax
+}
+
+// SetBitHandler handles SETBIT commands
+type SetBitHandler struct {
+	store  KeyValueStore
+	events EventNotifier
+}
+
+// NewSetBitHandler creates a new SETBIT handler
+func NewSetBitHandler(store KeyValueStore, events EventNotifier) *SetBitHandler {
+	return &SetBitHandler{store: store, events: events}
+}
+
+// Handle processes the SETBIT command
+func (h *SetBitHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 4 {
+		return writer.WriteError("ERR wrong number of arguments for 'setbit' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	offset, err := parseBitOffset(args[2])
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+
+	if args[3] != "0" && args[3] != "1" {
+		return writer.WriteError(errBitValue.Error())
+	}
+	bit := int(args[3][0] - '0')
+
+	var old int
+	err = h.store.Update(args[1], func(entry *store.StringEntry) (bool, error) {
+		value := grow([]byte(entry.Value), offset>>3+1)
+		old = getBit(value, offset)
+		setBit(value, offset, bit)
+
+		entry.Value = string(value)
+		entry.Exists = true
+		return true, nil
+	})
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	h.events.Notify(notify.String, "setbit", args[1])
+
+	return writer.WriteInteger(old)
+}
+
+// GetBitHandler handles GETBIT commands
+type GetBitHandler struct {
+	store KeyValueStore
+}
+
+// NewGetBitHandler creates a new GETBIT handler
+func NewGetBitHandler(store KeyValueStore) *GetBitHandler {
+	return &GetBitHandler{store: store}
+}
+
+// Handle processes the GETBIT command
+func (h *GetBitHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 3 {
+		return writer.WriteError("ERR wrong number of arguments for 'getbit' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	offset, err := parseBitOffset(args[2])
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+
+	value, _, err := h.store.Get(args[1])
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	return writer.WriteInteger(getBit([]byte(value), offset))
+}
+
+// BitCountHandler handles BITCOUNT commands
+type BitCountHandler struct {
+	store KeyValueStore
+}
+
+// NewBitCountHandler creates a new BITCOUNT handler
+func NewBitCountHandler(store KeyValueStore) *BitCountHandler {
+	return &BitCountHandler{store: store}
+}
+
+// Handle processes the BITCOUNT command
+func (h *BitCountHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) < 2 {
+		return writer.WriteError("ERR wrong number of arguments for 'bitcount' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	if len(args) == 3 || len(args) > 5 {
+		return writer.WriteError(errSyntax.Error())
+	}
+
+	value, _, err := h.store.Get(args[1])
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	data := []byte(value)
+
+	// Without a range the whole string is counted
+	startBit, endBit := 0, len(data)*8-1
+	if len(args) >= 4 {
+		start, err1 := strconv.Atoi(args[2])
+		end, err2 := strconv.Atoi(args[3])
+		if err1 != nil || err2 != nil {
+			return writer.WriteError(errNotInteger.Error())
+		}
+
+		isBit := false
+		if len(args) == 5 {
+			var err error
+			if isBit, err = parseRangeUnit(args[4]); err != nil {
+				return writer.WriteError(err.Error())
+			}
+		}
+
+		length := len(data)
+		if isBit {
+			length *= 8
+		}
+		var ok bool
+		start, end, ok = normalizeRange(start, end, length)
+		if !ok {
+			return writer.WriteInteger(0)
+		}
+		if isBit {
+			startBit, endBit = start, end
+		} else {
+			startBit, endBit = start*8, end*8+7
+		}
+	}
+
+	return writer.WriteInteger(countBits(data, startBit, endBit))
+}
+
+// countBits counts the set bits in the inclusive bit range [startBit, endBit]
+func countBits(data []byte, startBit, endBit int) int {
+	count := 0
+	for offset := startBit; offset <= endBit; {
+		if offset&7 == 0 && offset+7 <= endBit {
+			count += bits.OnesCount8(data[offset>>3])
+			offset += 8
+			continue
+		}
+		count += getBit(data, offset)
+		offset++
+	}
+	return count
+}
+
+// BitPosHandler handles BITPOS commands
+type BitPosHandler struct {
+	store KeyValueStore
+}
+
+// NewBitPosHandler creates a new BITPOS handler
+func NewBitPosHandler(store KeyValueStore) *BitPosHandler {
+	return &BitPosHandler{store: store}
+}
+
+// Handle processes the BITPOS command
+func (h *BitPosHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) < 3 || len(parts) > 6 {
+		return writer.WriteError("ERR wrong number of arguments for 'bitpos' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	if args[2] != "0" && args[2] != "1" {
+		return writer.WriteError("ERR The bit argument must be 1 or 0.")
+	}
+	bit := int(args[2][0] - '0')
+
+	value, exists, err := h.store.Get(args[1])
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	if !exists {
+		// A missing key is an infinite run of zero bits
+		if bit == 1 {
+			return writer.WriteInteger(-1)
+		}
+		return writer.WriteInteger(0)
+	}
+	data := []byte(value)
+
+	isBit := false
+	if len(args) == 6 {
+		var err error
+		if isBit, err = parseRangeUnit(args[5]); err != nil {
+			return writer.WriteError(err.Error())
+		}
+	}
+
+	length := len(data)
+	if isBit {
+		length *= 8
+	}
+
+	start, end := 0, length-1
+	endGiven := false
+	if len(args) >= 4 {
+		var err error
+		if start, err = strconv.Atoi(args[3]); err != nil {
+			return writer.WriteError(errNotInteger.Error())
+		}
+	}
+	if len(args) >= 5 {
+		var err error
+		if end, err = strconv.Atoi(args[4]); err != nil {
+			return writer.WriteError(errNotInteger.Error())
+		}
+		endGiven = true
+	}
+
+	start, end, ok = normalizeRange(start, end, length)
+	if !ok {
+		return writer.WriteInteger(-1)
+	}
+
+	startBit, endBit := start, end
+	if !isBit {
+		startBit, endBit = start*8, end*8+7
+	}
+
+	pos := findBit(data, bit, startBit, endBit)
+	if pos == -1 && bit == 0 && !endGiven {
+		// Without an explicit end the string is considered zero padded on the right
+		return writer.WriteInteger(endBit + 1)
+	}
+	return writer.WriteInteger(pos)
+}
+
+// findBit returns the first offset in [startBit, endBit] holding bit, or -1
+func findBit(data []byte, bit int, startBit, endBit int) int {
+	skip := byte(0x00)
+	if bit == 0 {
+		skip = 0xff
+	}
+
+	for offset := startBit; offset <= endBit; {
+		if offset&7 == 0 && offset+7 <= endBit && data[offset>>3] == skip {
+			offset += 8
+			continue
+		}
+		if getBit(data, offset) == bit {
+			return offset
+		}
+		offset++
+	}
+	return -1
+}
+
+// BitOpHandler handles BITOP commands
+type BitOpHandler struct {
+	store  KeyValueStore
+	events EventNotifier
+}
+
+// NewBitOpHandler creates a new BITOP handler
+func NewBitOpHandler(store KeyValueStore, events EventNotifier) *BitOpHandler {
+	return &BitOpHandler{store: store, events: events}
+}
+
+// Handle processes the BITOP command
+func (h *BitOpHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) < 4 {
+		return writer.WriteError("ERR wrong number of arguments for 'bitop' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	op := strings.ToUpper(args[1])
+	switch op {
+	case "AND", "OR", "XOR":
+	case "NOT":
+		if len(args) != 4 {
+			return writer.WriteError("ERR BITOP NOT must be called with a single source key.")
+		}
+	default:
+		return writer.WriteError(errSyntax.Error())
+	}
+
+	// The destination is the first key so sources and destination are read and
+	// written under the same lock. It is overwritten whatever its type, while
+	// sources must be strings.
+	keys := args[2:]
+	var length int
+	err := h.store.ReplaceMultiple(keys, func(entries []*store.StringEntry) (bool, error) {
+		sources := entries[1:]
+		for _, src := range sources {
+			if src.OtherType {
+				return false, store.ErrWrongType
+			}
+			if len(src.Value) > length {
+				length = len(src.Value)
+			}
+		}
+
+		result := make([]byte, length)
+		for i := 0; i < length; i++ {
+			var b byte
+			for j, src := range sources {
+				var v byte
+				if i < len(src.Value) {
+					v = src.Value[i]
+				}
+				switch {
+				case op == "NOT":
+					b = ^v
+				case j == 0:
+					b = v
+				case op == "AND":
+					b &= v
+				case op == "OR":
+					b |= v
+				case op == "XOR":
+					b ^= v
+				}
+			}
+			result[i] = b
+		}
+
+		dest := entries[0]
+		if length == 0 {
+			// An empty result deletes the destination
+			changed := dest.Exists
+			dest.Exists = false
+			return changed, nil
+		}
+		dest.Value = string(result)
+		dest.Exists = true
+		dest.Expiry = nil
+		return true, nil
+	})
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	// Deleting an empty destination is reported by the store
+	if length > 0 {
+		h.events.Notify(notify.String, "set", keys[0])
+	}
+
+	return writer.WriteInteger(length)
+}
+
+// Overflow behaviours for BITFIELD SET and INCRBY
+const (
+	overflowWrap = iota
+	overflowSat
+	overflowFail
+)
+
+// bitfieldOp is a single parsed BITFIELD subcommand
+type bitfieldOp struct {
+	kind     string // GET, SET or INCRBY
+	signed   bool
+	bits     int
+	offset   int
+	value    int64
+	overflow int
+}
+
+// BitFieldHandler handles BITFIELD and BITFIELD_RO commands
+type BitFieldHandler struct {
+	store    KeyValueStore
+	events   EventNotifier
+	command  string
+	readOnly bool
+}
+
+// NewBitFieldHandler creates a new BITFIELD handler
+func NewBitFieldHandler(store KeyValueStore, events EventNotifier) *BitFieldHandler {
+	return &BitFieldHandler{store: store, events: events, command: "bitfield"}
+}
+
+// NewBitFieldROHandler creates a new BITFIELD_RO handler
+func NewBitFieldROHandler(store KeyValueStore) *BitFieldHandler {
+	return &BitFieldHandler{store: store, command: "bitfield_ro", readOnly: true}
+}
+
+// Handle processes the BITFIELD/BITFIELD_RO command
+func (h *BitFieldHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) < 2 {
+		return writer.WriteError("ERR wrong number of arguments for '" + h.command + "' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	ops, writes, err := parseBitfieldOps(args[2:])
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	if h.readOnly && writes {
+		return writer.WriteError("ERR BITFIELD_RO only supports the GET subcommand")
+	}
+
+	results := make([]resp.RespValue, 0, len(ops))
+	changed := false
+	err = h.store.Update(args[1], func(entry *store.StringEntry) (bool, error) {
+		value := []byte(entry.Value)
+
+		for _, op := range ops {
+			if op.kind == "GET" {
+				results = append(results, integer(readField(value, op)))
+				continue
+			}
+
+			old := readField(value, op)
+			newValue, overflowed := applyOverflow(old, op)
+			if overflowed && op.overflow == overflowFail {
+				results = append(results, resp.RespValue{Type: resp.BulkString, Value: nil})
+				continue
+			}
+
+			value = grow(value, (op.offset+op.bits-1)>>3+1)
+			writeField(value, op, newValue)
+			changed = true
+
+			if op.kind == "SET" {
+				results = append(results, integer(old))
+			} else {
+				results = append(results, integer(newValue))
+			}
+		}
+
+		if !changed {
+			return false, nil
+		}
+		entry.Value = string(value)
+		entry.Exists = true
+		return true, nil
+	})
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	if changed {
+		h.events.Notify(notify.String, "setbit", args[1])
+	}
+
+	return writer.WriteValue(resp.RespValue{Type: resp.ArrayType, Value: results})
+}
+
+// integer wraps an int64 as a RESP integer
+func integer(v int64) resp.RespValue {
+	return resp.RespValue{Type: resp.IntegerType, Value: v}
+}
+
+// parseBitfieldOps parses BITFIELD subcommands, reporting whether any of them write
+func parseBitfieldOps(args []string) ([]bitfieldOp, bool, error) {
+	var ops []bitfieldOp
+	writes := false
+	overflow := overflowWrap
+
+	for i := 0; i < len(args); {
+		kind := strings.ToUpper(args[i])
+		switch kind {
+		case "OVERFLOW":
+			if i+1 >= len(args) {
+				return nil, false, errSyntax
+			}
+			switch strings.ToUpper(args[i+1]) {
+			case "WRAP":
+				overflow = overflowWrap
+			case "SAT":
+				overflow = overflowSat
+			case "FAIL":
+				overflow = overflowFail
+			default:
+				return nil, false, errors.New("ERR Invalid OVERFLOW type specified")
+			}
+			i += 2
+			continue
+		case "GET":
+			if i+2 >= len(args) {
+				return nil, false, errSyntax
+			}
+		case "SET", "INCRBY":
+			if i+3 >= len(args) {
+				return nil, false, errSyntax
+			}
+			writes = true
+		default:
+			return nil, false, errSyntax
+		}
+
+		op := bitfieldOp{kind: kind, overflow: overflow}
+
+		typ := args[i+1]
+		if len(typ) < 2 || (typ[0] != 'i' && typ[0] != 'I' && typ[0] != 'u' && typ[0] != 'U') {
+			return nil, false, errBitfieldType
+		}
+		op.signed = typ[0] == 'i' || typ[0] == 'I'
+		width, err := strconv.Atoi(typ[1:])
+		if err != nil || width < 1 || (op.signed && width > 64) || (!op.signed && width > 63) {
+			return nil, false, errBitfieldType
+		}
+		op.bits = width
+
+		// "#N" addresses the Nth field of this width
+		offsetArg := args[i+2]
+		multiply := strings.HasPrefix(offsetArg, "#")
+		if multiply {
+			offsetArg = offsetArg[1:]
+		}
+		offset, err := strconv.ParseInt(offsetArg, 10, 64)
+		if err != nil || offset < 0 {
+			return nil, false, errBitOffset
+		}
+		// Bounds are checked before any arithmetic, which could overflow
+		if multiply {
+			if offset > maxBitOffset/int64(width) {
+				return nil, false, errBitOffset
+			}
+			offset *= int64(width)
+		}
+		if offset > maxBitOffset-int64(width)+1 {
+			return nil, false, errBitOffset
+		}
+		op.offset = int(offset)
+
+		if kind == "GET" {
+			i += 3
+		} else {
+			if op.value, err = strconv.ParseInt(args[i+3], 10, 64); err != nil {
+				return nil, false, errNotInteger
+			}
+			i += 4
+		}
+
+		ops = append(ops, op)
+	}
+
+	return ops, writes, nil
+}
+
+// readField reads the integer stored at the op's offset and width
+func readField(value []byte, op bitfieldOp) int64 {
+	var u uint64
+	for i := 0; i < op.bits; i++ {
+		u = u<<1 | uint64(getBit(value, op.offset+i))
+	}
+	if op.signed && op.bits < 64 && u&(1<<uint(op.bits-1)) != 0 {
+		// Sign extend negative values
+		u |= math.MaxUint64 << uint(op.bits)
+	}
+	return int64(u)
+}
+
+// writeField stores v at the op's offset and width; value must be large enough
+func writeField(value []byte, op bitfieldOp, v int64) {
+	u := uint64(v)
+	for i := 0; i < op.bits; i++ {
+		bit := int(u>>uint(op.bits-1-i)) & 1
+		setBit(value, op.offset+i, bit)
+	}
+}
+
+// applyOverflow computes the value a SET or INCRBY would store and reports
+// whether it overflowed the field; WRAP and SAT adjust the value accordingly
+func applyOverflow(old int64, op bitfieldOp) (int64, bool) {
+	value, incr := old, op.value
+	if op.kind == "SET" {
+		value, incr = op.value, 0
+	}
+
+	if op.signed {
+		return signedOverflow(value, incr, op.bits, op.overflow)
+	}
+	return unsignedOverflow(uint64(value), incr, op.bits, op.overflow)
+}
+
+// signedOverflow mirrors Redis's checkSignedBitfieldOverflow
+func signedOverflow(value, incr int64, width int, overflow int) (int64, bool) {
+	max := int64(math.MaxInt64)
+	if width != 64 {
+		max = int64(1)<<uint(width-1) - 1
+	}
+	min := -max - 1
+
+	maxIncr := max - value
+	minIncr := min - value
+
+	wrap := func() int64 {
+		c := uint64(value) + uint64(incr)
+		if width < 64 {
+			msb := uint64(1) << uint(width-1)
+			mask := uint64(math.MaxUint64) << uint(width)
+			if c&msb != 0 {
+				c |= mask
+			} else {
+				c &^= mask
+			}
+		}
+		return int64(c)
+	}
+
+	if value > max || (width != 64 && incr > maxIncr) || (value >= 0 && incr > 0 && incr > maxIncr) {
+		if overflow == overflowSat {
+			return max, true
+		}
+		return wrap(), true
+	}
+	if value < min || (width != 64 && incr < minIncr) || (value < 0 && incr < 0 && incr < minIncr) {
+		if overflow == overflowSat {
+			return min, true
+		}
+		return wrap(), true
+	}
+	return value + incr, false
+}
+
+// unsignedOverflow mirrors Redis's checkUnsignedBitfieldOverflow
+func unsignedOverflow(value uint64, incr int64, width int, overflow int) (int64, bool) {
+	max := uint64(1)<<uint(width) - 1
+	maxIncr := int64(max - value)
+	minIncr := -int64(value)
+
+	wrap := func() int64 {
+		mask := uint64(math.MaxUint64) << uint(width)
+		return int64((value + uint64(incr)) &^ mask)
+	}
+
+	if value > max || (incr > 0 && incr > maxIncr) {
+		if overflow == overflowSat {
+			return int64(max), true
+		}
+		return wrap(), true
+	}
+	if incr < 0 && incr < minIncr {
+		if overflow == overflowSat {
+			return 0, true
+		}
+		return wrap(), true
+	}
+	return int64(value + uint64(incr)), false
+}
+
+// Common interfaces and types
+type KeyValueStore interface {
+	Set(key, value string, expiry ...time.Duration) error
+	Get(key string) (string, bool, error)
+	Update(key string, fn store.UpdateFunc) error
+	UpdateMultiple(keys []string, fn store.MultiUpdateFunc) error
+	ReplaceMultiple(keys []string, fn store.MultiUpdateFunc) error
+}
+
+// EventNotifier publishes keyspace notifications for the handler's database
+type EventNotifier interface {
+	Notify(class notify.Class, event, key string)
+}
@@ -0,0 +1,287 @@
+package cluster
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	topology "github.com/codecrafters-io/redis-starter-go/app/cluster"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// ClusterHandler handles CLUSTER commands
+type ClusterHandler struct {
+	cluster Cluster
+}
+
+// NewClusterHandler creates a new CLUSTER handler
+func NewClusterHandler(cluster Cluster) *ClusterHandler {
+	return &ClusterHandler{cluster: cluster}
+}
+
+// Handle processes the CLUSTER command
+func (h *ClusterHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	args := make([]string, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		arg, _ := part.Value.(string)
+		args = append(args, arg)
+	}
+	subcommand := strings.ToLower(args[0])
+
+	// Subcommands taking slots need at least one, ranges come in pairs
+	arity := map[string]int{
+		"info": 1, "myid": 1, "nodes": 1, "slots": 1, "shards": 1, "keyslot": 2,
+		"countkeysinslot": 2, "getkeysinslot": 3, "forget": 2, "saveconfig": 1,
+	}
+	n, fixed := arity[subcommand]
+	switch {
+	case fixed && len(args) != n,
+		subcommand == "meet" && len(args) != 3 && len(args) != 4,
+		(subcommand == "addslots" || subcommand == "delslots") && len(args) < 2,
+		(subcommand == "addslotsrange" || subcommand == "delslotsrange") && (len(args) < 3 || len(args)%2 != 1),
+		subcommand == "setslot" && len(args) < 3,
+		subcommand == "reset" && len(args) > 2:
+		return writer.WriteError("ERR wrong number of arguments for 'cluster|" + subcommand + "' command")
+	}
+
+	switch subcommand {
+	case "info":
+		var info string
+		for _, field := range h.cluster.Info() {
+			info += field[0] + ":" + field[1] + "\r\n"
+		}
+		return writer.WriteBulkString(info)
+	case "myid":
+		return writer.WriteBulkString(h.cluster.MyID())
+	case "nodes":
+		return writer.WriteBulkString(h.cluster.Nodes())
+	case "slots":
+		return h.writeSlots(localIP(conn), writer)
+	case "shards":
+		return h.writeShards(localIP(conn), writer)
+	case "keyslot":
+		return writer.WriteInteger(topology.KeySlot(args[1]))
+	case "countkeysinslot":
+		slot, err := strconv.Atoi(args[1])
+		if err != nil || slot < 0 || slot >= topology.SlotCount {
+			return writer.WriteError("ERR Invalid slot")
+		}
+		return writer.WriteInteger(h.cluster.CountKeysInSlot(slot))
+	case "getkeysinslot":
+		slot, err := strconv.Atoi(args[1])
+		count, countErr := strconv.Atoi(args[2])
+		if err != nil || countErr != nil || slot < 0 || slot >= topology.SlotCount || count < 0 {
+			return writer.WriteError("ERR Invalid slot or number of keys")
+		}
+		return writer.WriteArray(h.cluster.KeysInSlot(slot, count))
+	case "meet":
+		return h.meet(args[1:], writer)
+	case "addslots", "delslots":
+		slots, err := parseSlots(args[1:])
+		if err != nil {
+			return writer.WriteError(err.Error())
+		}
+		return h.writeResult(h.updateSlots(subcommand == "addslots", slots), writer)
+	case "addslotsrange", "delslotsrange":
+		var slots []int
+		for i := 1; i < len(args); i += 2 {
+			bounds, err := parseSlots(args[i : i+2])
+			if err != nil {
+				return writer.WriteError(err.Error())
+			}
+			if bounds[0] > bounds[1] {
+				return writer.WriteError("ERR start slot number " + args[i] + " is greater than end slot number " + args[i+1])
+			}
+			for slot := bounds[0]; slot <= bounds[1]; slot++ {
+				slots = append(slots, slot)
+			}
+		}
+		return h.writeResult(h.updateSlots(subcommand == "addslotsrange", slots), writer)
+	case "setslot":
+		return h.setSlot(args[1:], writer)
+	case "forget":
+		return h.writeResult(h.cluster.Forget(args[1]), writer)
+	case "reset":
+		hard := false
+		if len(args) == 2 {
+			switch strings.ToLower(args[1]) {
+			case "hard":
+				hard = true
+			case "soft":
+			default:
+				return writer.WriteError("ERR syntax error")
+			}
+		}
+		return h.writeResult(h.cluster.Reset(hard), writer)
+	case "saveconfig":
+		if err := h.cluster.SaveConfig(); err != nil {
+			return writer.WriteError("ERR error saving the cluster node config: " + err.Error())
+		}
+		return writer.WriteSimpleString("OK")
+	}
+	return writer.WriteError("ERR unknown subcommand '" + args[0] + "'. Try CLUSTER HELP.")
+}
+
+// meet introduces this node to another: CLUSTER MEET <ip> <port> [<cluster-bus-port>]
+func (h *ClusterHandler) meet(args []string, writer *resp.ResponseWriter) error {
+	port, err := strconv.Atoi(args[1])
+	if err != nil {
+		return writer.WriteError("ERR Invalid base port specified: " + args[1])
+	}
+	cport := port + 10000
+	if len(args) == 3 {
+		if cport, err = strconv.Atoi(args[2]); err != nil {
+			return writer.WriteError("ERR Invalid bus port specified: " + args[2])
+		}
+	}
+	return h.writeResult(h.cluster.Meet(args[0], port, cport), writer)
+}
+
+// setSlot changes who serves a slot or its migration state:
+// CLUSTER SETSLOT <slot> IMPORTING <node-id> | MIGRATING <node-id> | STABLE | NODE <node-id>
+func (h *ClusterHandler) setSlot(args []string, writer *resp.ResponseWriter) error {
+	slots, err := parseSlots(args[:1])
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	slot := slots[0]
+
+	action := strings.ToLower(args[1])
+	switch {
+	case action == "stable" && len(args) == 2:
+		h.cluster.SetSlotStable(slot)
+		return writer.WriteSimpleString("OK")
+	case action == "importing" && len(args) == 3:
+		return h.writeResult(h.cluster.SetSlotImporting(slot, args[2]), writer)
+	case action == "migrating" && len(args) == 3:
+		return h.writeResult(h.cluster.SetSlotMigrating(slot, args[2]), writer)
+	case action == "node" && len(args) == 3:
+		return h.writeResult(h.cluster.SetSlotNode(slot, args[2]), writer)
+	}
+	return writer.WriteError("ERR Invalid CLUSTER SETSLOT action or number of arguments. Try CLUSTER HELP")
+}
+
+// updateSlots adds slots to this node or removes them from their owners
+func (h *ClusterHandler) updateSlots(add bool, slots []int) error {
+	if add {
+		return h.cluster.AddSlots(slots)
+	}
+	return h.cluster.DelSlots(slots)
+}
+
+// writeResult replies OK or with the error a change returned
+func (h *ClusterHandler) writeResult(err error, writer *resp.ResponseWriter) error {
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	return writer.WriteSimpleString("OK")
+}
+
+// writeSlots replies with each range of slots served and the node serving it
+func (h *ClusterHandler) writeSlots(localIP string, writer *resp.ResponseWriter) error {
+	items := []resp.RespValue{}
+	for _, r := range h.cluster.Slots(localIP) {
+		items = append(items, resp.RespValue{Type: resp.ArrayType, Value: []resp.RespValue{
+			{Type: resp.IntegerType, Value: r.Start},
+			{Type: resp.IntegerType, Value: r.End},
+			{Type: resp.ArrayType, Value: []resp.RespValue{
+				{Type: resp.BulkString, Value: r.Node.IP},
+				{Type: resp.IntegerType, Value: r.Node.Port},
+				{Type: resp.BulkString, Value: r.Node.ID},
+			}},
+		}})
+	}
+	return writer.WriteValue(resp.RespValue{Type: resp.ArrayType, Value: items})
+}
+
+// writeShards replies with each node, the slots it serves and its health
+func (h *ClusterHandler) writeShards(localIP string, writer *resp.ResponseWriter) error {
+	items := []resp.RespValue{}
+	for _, shard := range h.cluster.Shards(localIP) {
+		slots := []resp.RespValue{}
+		for _, r := range shard.Slots {
+			slots = append(slots,
+				resp.RespValue{Type: resp.IntegerType, Value: r[0]},
+				resp.RespValue{Type: resp.IntegerType, Value: r[1]},
+			)
+		}
+		node := resp.RespValue{Type: resp.MapType, Value: []resp.RespValue{
+			{Type: resp.BulkString, Value: "id"}, {Type: resp.BulkString, Value: shard.Node.ID},
+			{Type: resp.BulkString, Value: "port"}, {Type: resp.IntegerType, Value: shard.Node.Port},
+			{Type: resp.BulkString, Value: "ip"}, {Type: resp.BulkString, Value: shard.Node.IP},
+			{Type: resp.BulkString, Value: "endpoint"}, {Type: resp.BulkString, Value: shard.Node.IP},
+			{Type: resp.BulkString, Value: "role"}, {Type: resp.BulkString, Value: "master"},
+			{Type: resp.BulkString, Value: "replication-offset"}, {Type: resp.IntegerType, Value: 0},
+			{Type: resp.BulkString, Value: "health"}, {Type: resp.BulkString, Value: shard.Node.Health},
+		}}
+		items = append(items, resp.RespValue{Type: resp.MapType, Value: []resp.RespValue{
+			{Type: resp.BulkString, Value: "slots"}, {Type: resp.ArrayType, Value: slots},
+			{Type: resp.BulkString, Value: "nodes"}, {Type: resp.ArrayType, Value: []resp.RespValue{node}},
+		}})
+	}
+	return writer.WriteValue(resp.RespValue{Type: resp.ArrayType, Value: items})
+}
+
+// parseSlots parses slot numbers given as arguments
+func parseSlots(args []string) ([]int, error) {
+	slots := make([]int, 0, len(args))
+	for _, arg := range args {
+		slot, err := strconv.Atoi(arg)
+		if err != nil || slot < 0 || slot >= topology.SlotCount {
+			return nil, topology.ErrInvalidSlot
+		}
+		slots = append(slots, slot)
+	}
+	return slots, nil
+}
+
+// localIP returns the address the client reached this node on
+func localIP(conn net.Conn) string {
+	if addr, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	return ""
+}
+
+// AskingHandler handles ASKING commands
+type AskingHandler struct {
+	clients ClientRegistry
+}
+
+// NewAskingHandler creates a new ASKING handler
+func NewAskingHandler(clients ClientRegistry) *AskingHandler {
+	return &AskingHandler{clients: clients}
+}
+
+// Handle processes the ASKING command, letting the client's next command use
+// a slot this node is importing
+func (h *AskingHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	h.clients.SetAsking(conn, true)
+	return writer.WriteSimpleString("OK")
+}
+
+// Common interfaces and types
+type Cluster interface {
+	MyID() string
+	Info() [][2]string
+	Nodes() string
+	Slots(localIP string) []topology.SlotRange
+	Shards(localIP string) []topology.Shard
+	CountKeysInSlot(slot int) int
+	KeysInSlot(slot, count int) []string
+	Meet(ip string, port, cport int) error
+	AddSlots(slots []int) error
+	DelSlots(slots []int) error
+	SetSlotImporting(slot int, id string) error
+	SetSlotMigrating(slot int, id string) error
+	SetSlotStable(slot int)
+	SetSlotNode(slot int, id string) error
+	Forget(id string) error
+	Reset(hard bool) error
+	SaveConfig() error
+}
+
+// ClientRegistry tracks whether a client sent ASKING
+type ClientRegistry interface {
+	SetAsking(conn net.Conn, asking bool)
+}
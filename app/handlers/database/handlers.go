@@ -0,0 +1,226 @@
+package database
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/notify"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// parseIndex parses a database index argument and checks it is in range
+func parseIndex(arg string, count int) (int, string) {
+	index, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, "ERR value is not an integer or out of range"
+	}
+	if index < 0 || index >= count {
+		return 0, "ERR DB index is out of range"
+	}
+	return index, ""
+}
+
+// parseFlushMode parses the optional ASYNC or SYNC argument of FLUSHDB and FLUSHALL
+func parseFlushMode(parts []resp.RespValue) (bool, bool) {
+	if len(parts) == 1 {
+		return false, true
+	}
+	if len(parts) != 2 {
+		return false, false
+	}
+
+	mode, ok := parts[1].Value.(string)
+	if !ok {
+		return false, false
+	}
+	switch strings.ToUpper(mode) {
+	case "ASYNC":
+		return true, true
+	case "SYNC":
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// SelectHandler handles SELECT commands
+type SelectHandler struct{}
+
+// NewSelectHandler creates a new SELECT handler
+func NewSelectHandler() *SelectHandler {
+	return &SelectHandler{}
+}
+
+// Handle processes the SELECT command (actual logic is in command processor)
+func (h *SelectHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 2 {
+		return writer.WriteError("ERR wrong number of arguments for 'select' command")
+	}
+	// This should not be reached as SELECT is handled specially in the processor
+	return writer.WriteSimpleString("OK")
+}
+
+// MoveHandler handles MOVE commands
+type MoveHandler struct {
+	databases DatabaseSet
+	notifier  Notifier
+	index     int
+}
+
+// NewMoveHandler creates a new MOVE handler for the database with the given index
+func NewMoveHandler(databases DatabaseSet, notifier Notifier, index int) *MoveHandler {
+	return &MoveHandler{databases: databases, notifier: notifier, index: index}
+}
+
+// Handle processes the MOVE command
+func (h *MoveHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 3 {
+		return writer.WriteError("ERR wrong number of arguments for 'move' command")
+	}
+
+	key, ok := parts[1].Value.(string)
+	if !ok {
+		return writer.WriteError("ERR invalid key type")
+	}
+	arg, ok := parts[2].Value.(string)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	target, errMsg := parseIndex(arg, h.databases.Count())
+	if errMsg != "" {
+		return writer.WriteError(errMsg)
+	}
+	if target == h.index {
+		return writer.WriteError("ERR source and destination objects are the same")
+	}
+
+	if h.databases.Move(key, h.index, target) {
+		h.notifier.Notify(notify.Generic, "move_from", h.index, key)
+		h.notifier.Notify(notify.Generic, "move_to", target, key)
+		return writer.WriteInteger(1)
+	}
+	return writer.WriteInteger(0)
+}
+
+// SwapDBHandler handles SWAPDB commands
+type SwapDBHandler struct {
+	databases DatabaseSet
+}
+
+// NewSwapDBHandler creates a new SWAPDB handler
+func NewSwapDBHandler(databases DatabaseSet) *SwapDBHandler {
+	return &SwapDBHandler{databases: databases}
+}
+
+// Handle processes the SWAPDB command
+func (h *SwapDBHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 3 {
+		return writer.WriteError("ERR wrong number of arguments for 'swapdb' command")
+	}
+
+	first, ok := parts[1].Value.(string)
+	if !ok {
+		return writer.WriteError("ERR invalid first DB index")
+	}
+	second, ok := parts[2].Value.(string)
+	if !ok {
+		return writer.WriteError("ERR invalid second DB index")
+	}
+
+	i, err := strconv.Atoi(first)
+	if err != nil {
+		return writer.WriteError("ERR invalid first DB index")
+	}
+	j, err := strconv.Atoi(second)
+	if err != nil {
+		return writer.WriteError("ERR invalid second DB index")
+	}
+
+	count := h.databases.Count()
+	if i < 0 || i >= count || j < 0 || j >= count {
+		return writer.WriteError("ERR DB index is out of range")
+	}
+
+	h.databases.Swap(i, j)
+	return writer.WriteSimpleString("OK")
+}
+
+// FlushDBHandler handles FLUSHDB commands
+type FlushDBHandler struct {
+	db Database
+}
+
+// NewFlushDBHandler creates a new FLUSHDB handler
+func NewFlushDBHandler(db Database) *FlushDBHandler {
+	return &FlushDBHandler{db: db}
+}
+
+// Handle processes the FLUSHDB command
+func (h *FlushDBHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	async, ok := parseFlushMode(parts)
+	if !ok {
+		return writer.WriteError("ERR syntax error")
+	}
+
+	h.db.Flush(async)
+	return writer.WriteSimpleString("OK")
+}
+
+// FlushAllHandler handles FLUSHALL commands
+type FlushAllHandler struct {
+	databases DatabaseSet
+}
+
+// NewFlushAllHandler creates a new FLUSHALL handler
+func NewFlushAllHandler(databases DatabaseSet) *FlushAllHandler {
+	return &FlushAllHandler{databases: databases}
+}
+
+// Handle processes the FLUSHALL command
+func (h *FlushAllHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	async, ok := parseFlushMode(parts)
+	if !ok {
+		return writer.WriteError("ERR syntax error")
+	}
+
+	h.databases.FlushAll(async)
+	return writer.WriteSimpleString("OK")
+}
+
+// DBSizeHandler handles DBSIZE commands
+type DBSizeHandler struct {
+	db Database
+}
+
+// NewDBSizeHandler creates a new DBSIZE handler
+func NewDBSizeHandler(db Database) *DBSizeHandler {
+	return &DBSizeHandler{db: db}
+}
+
+// Handle processes the DBSIZE command
+func (h *DBSizeHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 1 {
+		return writer.WriteError("ERR wrong number of arguments for 'dbsize' command")
+	}
+	return writer.WriteInteger(h.db.Size())
+}
+
+// Common interfaces and types
+type DatabaseSet interface {
+	Count() int
+	Move(key string, from, to int) bool
+	Swap(i, j int)
+	FlushAll(async bool)
+}
+
+// Notifier publishes keyspace notifications for any database
+type Notifier interface {
+	Notify(class notify.Class, event string, db int, key string)
+}
+
+type Database interface {
+	Size() int
+	Flush(async bool)
+}
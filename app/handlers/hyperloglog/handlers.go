@@ -0,0 +1,216 @@
+package hyperloglog
+
+import (
+	"net"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/hll"
+	"github.com/codecrafters-io/redis-starter-go/app/notify"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/store"
+)
+
+// PFAddHandler handles PFADD commands
+type PFAddHandler struct {
+	store  KeyValueStore
+	events EventNotifier
+}
+
+// NewPFAddHandler creates a new PFADD handler
+func NewPFAddHandler(store KeyValueStore, events EventNotifier) *PFAddHandler {
+	return &PFAddHandler{store: store, events: events}
+}
+
+// Handle processes the PFADD command
+func (h *PFAddHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) < 2 {
+		return writer.WriteError("ERR wrong number of arguments for 'pfadd' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	updated := false
+	err := h.store.Update(args[1], func(entry *store.StringEntry) (bool, error) {
+		sketch := hll.New()
+		if entry.Exists {
+			var err error
+			if sketch, err = hll.Parse(entry.Value); err != nil {
+				return false, err
+			}
+		} else {
+			// Creating the key counts as an update even without elements
+			updated = true
+		}
+
+		for _, element := range args[2:] {
+			if sketch.Add(element) {
+				updated = true
+			}
+		}
+
+		if !updated {
+			return false, nil
+		}
+		entry.Value = sketch.String()
+		entry.Exists = true
+		return true, nil
+	})
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+
+	if updated {
+		h.events.Notify(notify.String, "pfadd", args[1])
+		return writer.WriteInteger(1)
+	}
+	return writer.WriteInteger(0)
+}
+
+// PFCountHandler handles PFCOUNT commands
+type PFCountHandler struct {
+	store KeyValueStore
+}
+
+// NewPFCountHandler creates a new PFCOUNT handler
+func NewPFCountHandler(store KeyValueStore) *PFCountHandler {
+	return &PFCountHandler{store: store}
+}
+
+// Handle processes the PFCOUNT command
+func (h *PFCountHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) < 2 {
+		return writer.WriteError("ERR wrong number of arguments for 'pfcount' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	if len(args) > 2 {
+		return h.countUnion(args[1:], writer)
+	}
+
+	// A single key refreshes the cached cardinality stored in its header
+	var count uint64
+	err := h.store.Update(args[1], func(entry *store.StringEntry) (bool, error) {
+		if !entry.Exists {
+			return false, nil
+		}
+		sketch, err := hll.Parse(entry.Value)
+		if err != nil {
+			return false, err
+		}
+
+		stale := !sketch.HasCachedCount()
+		count = sketch.Count()
+		if !stale {
+			return false, nil
+		}
+		entry.Value = sketch.String()
+		return true, nil
+	})
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+
+	return writer.WriteInteger(int(count))
+}
+
+// countUnion estimates the cardinality of the union of several sketches
+// without modifying any of them. They are read under one lock, which also
+// rejects keys of other types.
+func (h *PFCountHandler) countUnion(keys []string, writer *resp.ResponseWriter) error {
+	union := hll.New()
+	err := h.store.UpdateMultiple(keys, func(entries []*store.StringEntry) (bool, error) {
+		for _, entry := range entries {
+			if !entry.Exists {
+				continue
+			}
+			sketch, err := hll.Parse(entry.Value)
+			if err != nil {
+				return false, err
+			}
+			union.Merge(sketch)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+
+	return writer.WriteInteger(int(union.Count()))
+}
+
+// PFMergeHandler handles PFMERGE commands
+type PFMergeHandler struct {
+	store  KeyValueStore
+	events EventNotifier
+}
+
+// NewPFMergeHandler creates a new PFMERGE handler
+func NewPFMergeHandler(store KeyValueStore, events EventNotifier) *PFMergeHandler {
+	return &PFMergeHandler{store: store, events: events}
+}
+
+// Handle processes the PFMERGE command
+func (h *PFMergeHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) < 2 {
+		return writer.WriteError("ERR wrong number of arguments for 'pfmerge' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	// The destination takes part in the merge, so it is the first key read. A
+	// destination of another type is overwritten, while sources must be strings.
+	err := h.store.ReplaceMultiple(args[1:], func(entries []*store.StringEntry) (bool, error) {
+		merged := hll.New()
+		for i, entry := range entries {
+			if entry.OtherType && i > 0 {
+				return false, store.ErrWrongType
+			}
+			if !entry.Exists || entry.OtherType {
+				continue
+			}
+			sketch, err := hll.Parse(entry.Value)
+			if err != nil {
+				return false, err
+			}
+			merged.Merge(sketch)
+		}
+
+		dest := entries[0]
+		if dest.OtherType {
+			dest.Expiry = nil
+		}
+		dest.Value = merged.String()
+		dest.Exists = true
+		return true, nil
+	})
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	h.events.Notify(notify.String, "pfadd", args[1])
+
+	return writer.WriteSimpleString("OK")
+}
+
+// Common interfaces and types
+type KeyValueStore interface {
+	Set(key, value string, expiry ...time.Duration) error
+	Get(key string) (string, bool, error)
+	Update(key string, fn store.UpdateFunc) error
+	UpdateMultiple(keys []string, fn store.MultiUpdateFunc) error
+	ReplaceMultiple(keys []string, fn store.MultiUpdateFunc) error
+}
+
+// EventNotifier publishes keyspace notifications for the handler's database
+type EventNotifier interface {
+	Notify(class notify.Class, event, key string)
+}
@@ -0,0 +1,333 @@
+package keyspace
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/notify"
+	"github.com/codecrafters-io/redis-starter-go/app/pattern"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// DelHandler handles DEL and UNLINK commands
+type DelHandler struct {
+	store KeyspaceStore
+	name  string
+	lazy  bool
+}
+
+// NewDelHandler creates a new DEL handler
+func NewDelHandler(store KeyspaceStore) *DelHandler {
+	return &DelHandler{store: store, name: "del"}
+}
+
+// NewUnlinkHandler creates a new UNLINK handler that frees large values in the background
+func NewUnlinkHandler(store KeyspaceStore) *DelHandler {
+	return &DelHandler{store: store, name: "unlink", lazy: true}
+}
+
+// Handle processes the DEL or UNLINK command
+func (h *DelHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) < 2 {
+		return writer.WriteError("ERR wrong number of arguments for '" + h.name + "' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	if h.lazy {
+		return writer.WriteInteger(h.store.Unlink(args[1:]...))
+	}
+	return writer.WriteInteger(h.store.Del(args[1:]...))
+}
+
+// ExistsHandler handles EXISTS and TOUCH commands
+type ExistsHandler struct {
+	store KeyspaceStore
+	name  string
+}
+
+// NewExistsHandler creates a new EXISTS handler
+func NewExistsHandler(store KeyspaceStore) *ExistsHandler {
+	return &ExistsHandler{store: store, name: "exists"}
+}
+
+// NewTouchHandler creates a new TOUCH handler. Access times are not tracked,
+// so touching a key only reports whether it exists.
+func NewTouchHandler(store KeyspaceStore) *ExistsHandler {
+	return &ExistsHandler{store: store, name: "touch"}
+}
+
+// Handle processes the EXISTS or TOUCH command
+func (h *ExistsHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) < 2 {
+		return writer.WriteError("ERR wrong number of arguments for '" + h.name + "' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	return writer.WriteInteger(h.store.Exists(args[1:]...))
+}
+
+// KeysHandler handles KEYS commands
+type KeysHandler struct {
+	store KeyspaceStore
+}
+
+// NewKeysHandler creates a new KEYS handler
+func NewKeysHandler(store KeyspaceStore) *KeysHandler {
+	return &KeysHandler{store: store}
+}
+
+// Handle processes the KEYS command
+func (h *KeysHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 2 {
+		return writer.WriteError("ERR wrong number of arguments for 'keys' command")
+	}
+
+	glob, ok := parts[1].Value.(string)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	matches := []string{}
+	for _, key := range h.store.Keys() {
+		if glob == "*" || pattern.Match(glob, key, false) {
+			matches = append(matches, key)
+		}
+	}
+	return writer.WriteArray(matches)
+}
+
+// scanTypes are the type names accepted by the TYPE option of SCAN
+var scanTypes = map[string]bool{
+	"string": true, "list": true, "set": true, "zset": true, "hash": true, "stream": true,
+}
+
+// ScanHandler handles SCAN commands
+type ScanHandler struct {
+	store KeyspaceStore
+}
+
+// NewScanHandler creates a new SCAN handler
+func NewScanHandler(store KeyspaceStore) *ScanHandler {
+	return &ScanHandler{store: store}
+}
+
+// Handle processes the SCAN command
+func (h *ScanHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) < 2 {
+		return writer.WriteError("ERR wrong number of arguments for 'scan' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	cursor, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return writer.WriteError("ERR invalid cursor")
+	}
+
+	glob, count, keyType := "*", 10, ""
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return writer.WriteError("ERR syntax error")
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			glob = args[i+1]
+		case "COUNT":
+			count, err = strconv.Atoi(args[i+1])
+			if err != nil {
+				return writer.WriteError("ERR value is not an integer or out of range")
+			}
+			if count < 1 {
+				return writer.WriteError("ERR syntax error")
+			}
+		case "TYPE":
+			keyType = strings.ToLower(args[i+1])
+			if !scanTypes[keyType] {
+				return writer.WriteError("ERR unknown type name '" + args[i+1] + "'")
+			}
+		default:
+			return writer.WriteError("ERR syntax error")
+		}
+	}
+
+	next, keys := h.store.Scan(cursor, count, keyType)
+
+	matches := []resp.RespValue{}
+	for _, key := range keys {
+		if glob == "*" || pattern.Match(glob, key, false) {
+			matches = append(matches, resp.RespValue{Type: resp.BulkString, Value: key})
+		}
+	}
+
+	return writer.WriteValue(resp.RespValue{Type: resp.ArrayType, Value: []resp.RespValue{
+		{Type: resp.BulkString, Value: strconv.FormatUint(next, 10)},
+		{Type: resp.ArrayType, Value: matches},
+	}})
+}
+
+// RenameHandler handles RENAME and RENAMENX commands
+type RenameHandler struct {
+	store  KeyspaceStore
+	events EventNotifier
+	nx     bool
+}
+
+// NewRenameHandler creates a new RENAME handler
+func NewRenameHandler(store KeyspaceStore, events EventNotifier) *RenameHandler {
+	return &RenameHandler{store: store, events: events}
+}
+
+// NewRenameNXHandler creates a new RENAMENX handler
+func NewRenameNXHandler(store KeyspaceStore, events EventNotifier) *RenameHandler {
+	return &RenameHandler{store: store, events: events, nx: true}
+}
+
+// Handle processes the RENAME or RENAMENX command
+func (h *RenameHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 3 {
+		if h.nx {
+			return writer.WriteError("ERR wrong number of arguments for 'renamenx' command")
+		}
+		return writer.WriteError("ERR wrong number of arguments for 'rename' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	renamed, err := h.store.Rename(args[1], args[2], h.nx)
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	if renamed {
+		h.events.Notify(notify.Generic, "rename_from", args[1])
+		h.events.Notify(notify.Generic, "rename_to", args[2])
+	}
+
+	if !h.nx {
+		return writer.WriteSimpleString("OK")
+	}
+	if renamed {
+		return writer.WriteInteger(1)
+	}
+	return writer.WriteInteger(0)
+}
+
+// CopyHandler handles COPY commands
+type CopyHandler struct {
+	databases DatabaseSet
+	notifier  Notifier
+	index     int
+}
+
+// NewCopyHandler creates a new COPY handler for the database with the given index
+func NewCopyHandler(databases DatabaseSet, notifier Notifier, index int) *CopyHandler {
+	return &CopyHandler{databases: databases, notifier: notifier, index: index}
+}
+
+// Handle processes the COPY command
+func (h *CopyHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) < 3 {
+		return writer.WriteError("ERR wrong number of arguments for 'copy' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	replace, target := false, h.index
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "REPLACE":
+			replace = true
+		case "DB":
+			if i+1 >= len(args) {
+				return writer.WriteError("ERR syntax error")
+			}
+			i++
+			db, err := strconv.Atoi(args[i])
+			if err != nil {
+				return writer.WriteError("ERR value is not an integer or out of range")
+			}
+			if db < 0 || db >= h.databases.Count() {
+				return writer.WriteError("ERR DB index is out of range")
+			}
+			target = db
+		default:
+			return writer.WriteError("ERR syntax error")
+		}
+	}
+
+	if args[1] == args[2] && target == h.index {
+		return writer.WriteError("ERR source and destination objects are the same")
+	}
+
+	if h.databases.Copy(args[1], args[2], h.index, target, replace) {
+		h.notifier.Notify(notify.Generic, "copy_to", target, args[2])
+		return writer.WriteInteger(1)
+	}
+	return writer.WriteInteger(0)
+}
+
+// RandomKeyHandler handles RANDOMKEY commands
+type RandomKeyHandler struct {
+	store KeyspaceStore
+}
+
+// NewRandomKeyHandler creates a new RANDOMKEY handler
+func NewRandomKeyHandler(store KeyspaceStore) *RandomKeyHandler {
+	return &RandomKeyHandler{store: store}
+}
+
+// Handle processes the RANDOMKEY command
+func (h *RandomKeyHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 1 {
+		return writer.WriteError("ERR wrong number of arguments for 'randomkey' command")
+	}
+
+	key, exists := h.store.RandomKey()
+	if !exists {
+		return writer.WriteNullBulkString()
+	}
+	return writer.WriteBulkString(key)
+}
+
+// Common interfaces and types
+type KeyspaceStore interface {
+	Del(keys ...string) int
+	Unlink(keys ...string) int
+	Exists(keys ...string) int
+	Keys() []string
+	RandomKey() (string, bool)
+	Scan(cursor uint64, count int, keyType string) (uint64, []string)
+	Rename(src, dst string, nx bool) (bool, error)
+}
+
+type DatabaseSet interface {
+	Count() int
+	Copy(src, dst string, from, to int, replace bool) bool
+}
+
+// EventNotifier publishes keyspace notifications for the handler's database
+type EventNotifier interface {
+	Notify(class notify.Class, event, key string)
+}
+
+// Notifier publishes keyspace notifications for any database
+type Notifier interface {
+	Notify(class notify.Class, event string, db int, key string)
+}
@@ -3,79 +3,88 @@ package keyvalue
 import (
 	"net"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/codecrafters-io/redis-starter-go/app/notify"
 	"github.com/codecrafters-io/redis-starter-go/app/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/store"
 )
 
 // SetHandler handles SET commands
 type SetHandler struct {
-	writer *resp.ResponseWriter
 	store  KeyValueStore
+	events EventNotifier
 }
 
 // NewSetHandler creates a new SET handler
-func NewSetHandler(store KeyValueStore) *SetHandler {
-	return &SetHandler{store: store}
+func NewSetHandler(store KeyValueStore, events EventNotifier) *SetHandler {
+	return &SetHandler{store: store, events: events}
 }
 
 // Handle processes the SET command
-func (h *SetHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
+func (h *SetHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
 	if len(parts) < 3 {
-		return h.writer.WriteError("ERR wrong number of arguments for 'set' command")
+		return writer.WriteError("ERR wrong number of arguments for 'set' command")
 	}
 
 	key, ok := parts[1].Value.(string)
 	if !ok {
-		return h.writer.WriteError("ERR invalid key type")
+		return writer.WriteError("ERR invalid key type")
 	}
 
 	value, ok := parts[2].Value.(string)
 	if !ok {
-		return h.writer.WriteError("ERR invalid value type")
+		return writer.WriteError("ERR invalid value type")
 	}
 
 	var expiry time.Duration
-	// Parse optional PX (milliseconds) or EX (seconds) parameters
+	expired := false
+	// Parse optional PX (milliseconds) or EX (seconds) parameters, or the
+	// absolute PXAT and EXAT ones that relative expiries are propagated as
 	for i := 3; i < len(parts)-1; i += 2 {
 		param, ok := parts[i].Value.(string)
 		if !ok {
 			continue
 		}
 
-		switch param {
-		case "PX":
-			if ms, ok := parts[i+1].Value.(string); ok {
-				if msInt, err := strconv.Atoi(ms); err == nil {
-					expiry = time.Duration(msInt) * time.Millisecond
-				}
+		switch option := strings.ToUpper(param); option {
+		case "PX", "EX", "PXAT", "EXAT":
+			arg, ok := parts[i+1].Value.(string)
+			if !ok {
+				return writer.WriteError(errSyntax.Error())
 			}
-		case "EX":
-			if s, ok := parts[i+1].Value.(string); ok {
-				if sInt, err := strconv.Atoi(s); err == nil {
-					expiry = time.Duration(sInt) * time.Second
-				}
+			deadline, err := parseExpiry(option, arg, "set")
+			if err != nil {
+				return writer.WriteError(err.Error())
 			}
+			expiry = time.Until(deadline)
+			expired = expiry <= 0
 		}
 	}
 
+	// A deadline that already passed leaves no key behind, as when an old
+	// write is replayed. The store reports the deletion itself.
+	if expired {
+		h.store.Del(key)
+		return writer.WriteSimpleString("OK")
+	}
+
 	err := h.store.Set(key, value, expiry)
 	if err != nil {
-		return h.writer.WriteError("ERR " + err.Error())
+		return writer.WriteError("ERR " + err.Error())
+	}
+	h.events.Notify(notify.String, "set", key)
+	if expiry > 0 {
+		h.events.Notify(notify.Generic, "expire", key)
 	}
 
-	return h.writer.WriteSimpleString("OK")
-}
-
-// SetWriter sets the response writer for this handler
-func (h *SetHandler) SetWriter(writer *resp.ResponseWriter) {
-	h.writer = writer
+	return writer.WriteSimpleString("OK")
 }
 
 // GetHandler handles GET commands
 type GetHandler struct {
-	writer *resp.ResponseWriter
-	store  KeyValueStore
+	store KeyValueStore
 }
 
 // NewGetHandler creates a new GET handler
@@ -84,169 +93,110 @@ func NewGetHandler(store KeyValueStore) *GetHandler {
 }
 
 // Handle processes the GET command
-func (h *GetHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
+func (h *GetHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
 	if len(parts) != 2 {
-		return h.writer.WriteError("ERR wrong number of arguments for 'get' command")
+		return writer.WriteError("ERR wrong number of arguments for 'get' command")
 	}
 
 	key, ok := parts[1].Value.(string)
 	if !ok {
-		return h.writer.WriteError("ERR invalid key type")
+		return writer.WriteError("ERR invalid key type")
 	}
 
-	value, exists := h.store.Get(key)
+	value, exists, err := h.store.Get(key)
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
 	if !exists {
-		return h.writer.WriteNullBulkString()
+		return writer.WriteNullBulkString()
 	}
 
-	return h.writer.WriteBulkString(value)
-}
-
-// SetWriter sets the response writer for this handler
-func (h *GetHandler) SetWriter(writer *resp.ResponseWriter) {
-	h.writer = writer
+	return writer.WriteBulkString(value)
 }
 
 // IncrHandler handles INCR commands
 type IncrHandler struct {
-	writer *resp.ResponseWriter
 	store  KeyValueStore
+	events EventNotifier
 }
 
 // NewIncrHandler creates a new INCR handler
-func NewIncrHandler(store KeyValueStore) *IncrHandler {
-	return &IncrHandler{store: store}
+func NewIncrHandler(store KeyValueStore, events EventNotifier) *IncrHandler {
+	return &IncrHandler{store: store, events: events}
 }
 
 // Handle processes the INCR command
-func (h *IncrHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
+func (h *IncrHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
 	if len(parts) != 2 {
-		return h.writer.WriteError("ERR wrong number of arguments for 'incr' command")
+		return writer.WriteError("ERR wrong number of arguments for 'incr' command")
 	}
 
 	key, ok := parts[1].Value.(string)
 	if !ok {
-		return h.writer.WriteError("ERR invalid key type")
+		return writer.WriteError("ERR invalid key type")
 	}
 
-	value, exists := h.store.Get(key)
 	var intValue int
-	var err error
-
-	if exists {
-		intValue, err = strconv.Atoi(value)
-		if err != nil {
-			return h.writer.WriteError("ERR value is not an integer or out of range")
+	err := h.store.Update(key, func(entry *store.StringEntry) (bool, error) {
+		if entry.Exists {
+			current, err := strconv.Atoi(entry.Value)
+			if err != nil {
+				return false, errNotInteger
+			}
+			intValue = current
 		}
-	}
 
-	intValue++
-	err = h.store.Set(key, strconv.Itoa(intValue))
+		intValue++
+		entry.Value = strconv.Itoa(intValue)
+		entry.Exists = true
+		return true, nil
+	})
 	if err != nil {
-		return h.writer.WriteError("ERR " + err.Error())
+		return writer.WriteError(err.Error())
 	}
+	h.events.Notify(notify.String, "incrby", key)
 
-	return h.writer.WriteInteger(intValue)
-}
-
-// SetWriter sets the response writer for this handler
-func (h *IncrHandler) SetWriter(writer *resp.ResponseWriter) {
-	h.writer = writer
+	return writer.WriteInteger(intValue)
 }
 
 // TypeHandler handles TYPE commands
 type TypeHandler struct {
-	writer    *resp.ResponseWriter
-	kvStore   KeyValueStore
-	listStore ListStore
+	kvStore KeyValueStore
 }
 
 // NewTypeHandler creates a new TYPE handler
-func NewTypeHandler(kvStore KeyValueStore, listStore ListStore) *TypeHandler {
-	return &TypeHandler{
-		kvStore:   kvStore,
-		listStore: listStore,
-	}
+func NewTypeHandler(kvStore KeyValueStore) *TypeHandler {
+	return &TypeHandler{kvStore: kvStore}
 }
 
 // Handle processes the TYPE command
-func (h *TypeHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
+func (h *TypeHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
 	if len(parts) != 2 {
-		return h.writer.WriteError("ERR wrong number of arguments for 'type' command")
+		return writer.WriteError("ERR wrong number of arguments for 'type' command")
 	}
 
 	key, ok := parts[1].Value.(string)
 	if !ok {
-		return h.writer.WriteError("ERR invalid key type")
-	}
-
-	// Check if key exists in key-value store as a regular string
-	if _, exists := h.kvStore.Get(key); exists {
-		return h.writer.WriteSimpleString("string")
-	}
-
-	// Check if key exists in list store
-	if _, exists := h.listStore.LLen(key); exists {
-		return h.writer.WriteSimpleString("list")
-	}
-
-	// Check if key exists as a stream (look for entries with pattern key:*)
-	if h.hasStreamEntries(key) {
-		return h.writer.WriteSimpleString("stream")
+		return writer.WriteError("ERR invalid key type")
 	}
 
-	return h.writer.WriteSimpleString("none")
-}
-
-// hasStreamEntries checks if there are any stream entries for the given key
-func (h *TypeHandler) hasStreamEntries(key string) bool {
-	prefix := key + ":"
-
-	// Check for common stream ID patterns to see if any stream entries exist
-	// This is a simplified implementation - in a real system we'd have a proper stream index
-	testPatterns := []string{
-		"0-1", "0-2", "0-3", "0-4", "0-5",
-		"1-0", "1-1", "1-2", "1-3", "1-4", "1-5",
-		"2-0", "2-1", "2-2", "2-3", "2-4", "2-5",
-		"3-0", "3-1", "3-2", "3-3", "3-4", "3-5",
-		"4-0", "4-1", "4-2", "4-3", "4-4", "4-5",
-		"5-0", "5-1", "5-2", "5-3", "5-4", "5-5",
-	}
-
-	for _, pattern := range testPatterns {
-		if _, exists := h.kvStore.Get(prefix + pattern); exists {
-			return true
-		}
-	}
-
-	// Also check for timestamp-based IDs (auto-generated ones)
-	// Look for recent timestamps (simplified approach for testing)
-	currentTime := time.Now().UnixMilli()
-	for i := int64(0); i < 10; i++ {
-		timestampToCheck := currentTime - i*1000 // Check last 10 seconds
-		for seq := int64(0); seq < 5; seq++ {
-			testKey := prefix + strconv.FormatInt(timestampToCheck, 10) + "-" + strconv.FormatInt(seq, 10)
-			if _, exists := h.kvStore.Get(testKey); exists {
-				return true
-			}
-		}
-	}
-
-	return false
-}
-
-// SetWriter sets the response writer for this handler
-func (h *TypeHandler) SetWriter(writer *resp.ResponseWriter) {
-	h.writer = writer
+	return writer.WriteSimpleString(h.kvStore.Type(key))
 }
 
 // Common interfaces and types
 type KeyValueStore interface {
 	Set(key, value string, expiry ...time.Duration) error
-	Get(key string) (string, bool)
-	Delete(key string) error
-}
-
-type ListStore interface {
-	LLen(key string) (int, bool)
+	Get(key string) (string, bool, error)
+	Del(keys ...string) int
+	Update(key string, fn store.UpdateFunc) error
+	Replace(key string, fn store.UpdateFunc) error
+	UpdateMultiple(keys []string, fn store.MultiUpdateFunc) error
+	ReplaceMultiple(keys []string, fn store.MultiUpdateFunc) error
+	GetMultiple(keys []string) ([]string, []bool)
+	Type(key string) string
+}
+
+// EventNotifier publishes keyspace notifications for the handler's database
+type EventNotifier interface {
+	Notify(class notify.Class, event, key string)
 }
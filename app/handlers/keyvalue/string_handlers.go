@@ -0,0 +1,789 @@
+package keyvalue
+
+import (
+	"errors"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/notify"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/store"
+)
+
+// maxStringLength mirrors Redis's proto-max-bulk-len default of 512MB
+const maxStringLength = 512 * 1024 * 1024
+
+var (
+	errNotInteger     = errors.New("ERR value is not an integer or out of range")
+	errSyntax         = errors.New("ERR syntax error")
+	errOffsetRange    = errors.New("ERR offset is out of range")
+	errStringTooLarge = errors.New("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+	errLCSTooLarge    = errors.New("ERR Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len")
+)
+
+// parseExpiry parses an expiry option (EX, PX, EXAT, PXAT) into an absolute time.
+// Expiries are bounds-checked before scaling, so none wraps around.
+func parseExpiry(option, value, command string) (time.Time, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, errNotInteger
+	}
+	errInvalid := errors.New("ERR invalid expire time in '" + command + "' command")
+	if n <= 0 {
+		return time.Time{}, errInvalid
+	}
+
+	switch option {
+	case "EX", "PX":
+		unit := time.Second
+		if option == "PX" {
+			unit = time.Millisecond
+		}
+		// The key's TTL must still fit in a time.Duration from now
+		if n > math.MaxInt64/int64(unit) {
+			return time.Time{}, errInvalid
+		}
+		return time.Now().Add(time.Duration(n) * unit), nil
+	case "EXAT":
+		if n > math.MaxInt64/1000 {
+			return time.Time{}, errInvalid
+		}
+		return time.Unix(n, 0), nil
+	case "PXAT":
+		return time.UnixMilli(n), nil
+	}
+	return time.Time{}, errSyntax
+}
+
+// AppendHandler handles APPEND commands
+type AppendHandler struct {
+	store  KeyValueStore
+	events EventNotifier
+}
+
+// NewAppendHandler creates a new APPEND handler
+func NewAppendHandler(store KeyValueStore, events EventNotifier) *AppendHandler {
+	return &AppendHandler{store: store, events: events}
+}
+
+// Handle processes the APPEND command
+func (h *AppendHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 3 {
+		return writer.WriteError("ERR wrong number of arguments for 'append' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	var length int
+	err := h.store.Update(args[1], func(entry *store.StringEntry) (bool, error) {
+		if len(entry.Value)+len(args[2]) > maxStringLength {
+			return false, errStringTooLarge
+		}
+		entry.Value += args[2]
+		entry.Exists = true
+		length = len(entry.Value)
+		return true, nil
+	})
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	h.events.Notify(notify.String, "append", args[1])
+
+	return writer.WriteInteger(length)
+}
+
+// StrLenHandler handles STRLEN commands
+type StrLenHandler struct {
+	store KeyValueStore
+}
+
+// NewStrLenHandler creates a new STRLEN handler
+func NewStrLenHandler(store KeyValueStore) *StrLenHandler {
+	return &StrLenHandler{store: store}
+}
+
+// Handle processes the STRLEN command
+func (h *StrLenHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 2 {
+		return writer.WriteError("ERR wrong number of arguments for 'strlen' command")
+	}
+
+	key, ok := parts[1].Value.(string)
+	if !ok {
+		return writer.WriteError("ERR invalid key type")
+	}
+
+	value, _, err := h.store.Get(key)
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	return writer.WriteInteger(len(value))
+}
+
+// GetRangeHandler handles GETRANGE and SUBSTR commands
+type GetRangeHandler struct {
+	store KeyValueStore
+}
+
+// NewGetRangeHandler creates a new GETRANGE handler
+func NewGetRangeHandler(store KeyValueStore) *GetRangeHandler {
+	return &GetRangeHandler{store: store}
+}
+
+// Handle processes the GETRANGE command
+func (h *GetRangeHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 4 {
+		return writer.WriteError("ERR wrong number of arguments for 'getrange' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	start, err1 := strconv.Atoi(args[2])
+	end, err2 := strconv.Atoi(args[3])
+	if err1 != nil || err2 != nil {
+		return writer.WriteError(errNotInteger.Error())
+	}
+
+	value, _, err := h.store.Get(args[1])
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	return writer.WriteBulkString(substring(value, start, end))
+}
+
+// substring returns the inclusive [start, end] range of value using Redis's index rules
+func substring(value string, start, end int) string {
+	length := len(value)
+	if start < 0 && end < 0 && start > end {
+		return ""
+	}
+
+	if start < 0 {
+		start = length + start
+	}
+	if end < 0 {
+		end = length + end
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= length {
+		end = length - 1
+	}
+	if length == 0 || start > end {
+		return ""
+	}
+
+	return value[start : end+1]
+}
+
+// SetRangeHandler handles SETRANGE commands
+type SetRangeHandler struct {
+	store  KeyValueStore
+	events EventNotifier
+}
+
+// NewSetRangeHandler creates a new SETRANGE handler
+func NewSetRangeHandler(store KeyValueStore, events EventNotifier) *SetRangeHandler {
+	return &SetRangeHandler{store: store, events: events}
+}
+
+// Handle processes the SETRANGE command
+func (h *SetRangeHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 4 {
+		return writer.WriteError("ERR wrong number of arguments for 'setrange' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	offset, err := strconv.Atoi(args[2])
+	if err != nil {
+		return writer.WriteError(errNotInteger.Error())
+	}
+	if offset < 0 {
+		return writer.WriteError(errOffsetRange.Error())
+	}
+
+	patch := args[3]
+	var length int
+	changed := false
+	err = h.store.Update(args[1], func(entry *store.StringEntry) (bool, error) {
+		// An empty patch never creates or grows the key
+		if patch == "" {
+			length = len(entry.Value)
+			return false, nil
+		}
+		// Compared this way round, a huge offset cannot overflow the sum
+		if offset > maxStringLength-len(patch) {
+			return false, errStringTooLarge
+		}
+
+		value := []byte(entry.Value)
+		if needed := offset + len(patch); needed > len(value) {
+			value = append(value, make([]byte, needed-len(value))...)
+		}
+		copy(value[offset:], patch)
+
+		entry.Value = string(value)
+		entry.Exists = true
+		length = len(value)
+		changed = true
+		return true, nil
+	})
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	if changed {
+		h.events.Notify(notify.String, "setrange", args[1])
+	}
+
+	return writer.WriteInteger(length)
+}
+
+// GetDelHandler handles GETDEL commands
+type GetDelHandler struct {
+	store KeyValueStore
+}
+
+// NewGetDelHandler creates a new GETDEL handler
+func NewGetDelHandler(store KeyValueStore) *GetDelHandler {
+	return &GetDelHandler{store: store}
+}
+
+// Handle processes the GETDEL command
+func (h *GetDelHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 2 {
+		return writer.WriteError("ERR wrong number of arguments for 'getdel' command")
+	}
+
+	key, ok := parts[1].Value.(string)
+	if !ok {
+		return writer.WriteError("ERR invalid key type")
+	}
+
+	var value string
+	var found bool
+	err := h.store.Update(key, func(entry *store.StringEntry) (bool, error) {
+		value, found = entry.Value, entry.Exists
+		entry.Exists = false
+		return found, nil
+	})
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+
+	if !found {
+		return writer.WriteNullBulkString()
+	}
+	return writer.WriteBulkString(value)
+}
+
+// GetExHandler handles GETEX commands
+type GetExHandler struct {
+	store  KeyValueStore
+	events EventNotifier
+}
+
+// NewGetExHandler creates a new GETEX handler
+func NewGetExHandler(store KeyValueStore, events EventNotifier) *GetExHandler {
+	return &GetExHandler{store: store, events: events}
+}
+
+// Handle processes the GETEX command
+func (h *GetExHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) < 2 {
+		return writer.WriteError("ERR wrong number of arguments for 'getex' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	// Parse the optional expiry modifier; at most one may be given
+	var expiry *time.Time
+	persist := false
+	switch len(args) {
+	case 2:
+	case 3:
+		if strings.ToUpper(args[2]) != "PERSIST" {
+			return writer.WriteError(errSyntax.Error())
+		}
+		persist = true
+	case 4:
+		t, err := parseExpiry(strings.ToUpper(args[2]), args[3], "getex")
+		if err != nil {
+			return writer.WriteError(err.Error())
+		}
+		expiry = &t
+	default:
+		return writer.WriteError(errSyntax.Error())
+	}
+
+	var value string
+	var found bool
+	event := ""
+	err := h.store.Update(args[1], func(entry *store.StringEntry) (bool, error) {
+		value, found = entry.Value, entry.Exists
+		if !found {
+			return false, nil
+		}
+		switch {
+		case persist && entry.Expiry != nil:
+			entry.Expiry = nil
+			event = "persist"
+		case expiry != nil:
+			entry.Expiry = expiry
+			event = "expire"
+		default:
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	if event != "" {
+		h.events.Notify(notify.Generic, event, args[1])
+	}
+
+	if !found {
+		return writer.WriteNullBulkString()
+	}
+	return writer.WriteBulkString(value)
+}
+
+// GetSetHandler handles GETSET commands
+type GetSetHandler struct {
+	store  KeyValueStore
+	events EventNotifier
+}
+
+// NewGetSetHandler creates a new GETSET handler
+func NewGetSetHandler(store KeyValueStore, events EventNotifier) *GetSetHandler {
+	return &GetSetHandler{store: store, events: events}
+}
+
+// Handle processes the GETSET command
+func (h *GetSetHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 3 {
+		return writer.WriteError("ERR wrong number of arguments for 'getset' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	var old string
+	var found bool
+	err := h.store.Update(args[1], func(entry *store.StringEntry) (bool, error) {
+		old, found = entry.Value, entry.Exists
+		entry.Value = args[2]
+		entry.Exists = true
+		entry.Expiry = nil
+		return true, nil
+	})
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	h.events.Notify(notify.String, "set", args[1])
+
+	if !found {
+		return writer.WriteNullBulkString()
+	}
+	return writer.WriteBulkString(old)
+}
+
+// SetNXHandler handles SETNX commands
+type SetNXHandler struct {
+	store  KeyValueStore
+	events EventNotifier
+}
+
+// NewSetNXHandler creates a new SETNX handler
+func NewSetNXHandler(store KeyValueStore, events EventNotifier) *SetNXHandler {
+	return &SetNXHandler{store: store, events: events}
+}
+
+// Handle processes the SETNX command
+func (h *SetNXHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 3 {
+		return writer.WriteError("ERR wrong number of arguments for 'setnx' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	set := false
+	err := h.store.Replace(args[1], func(entry *store.StringEntry) (bool, error) {
+		if entry.Exists {
+			return false, nil
+		}
+		entry.Value = args[2]
+		entry.Exists = true
+		entry.Expiry = nil
+		set = true
+		return true, nil
+	})
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+
+	if set {
+		h.events.Notify(notify.String, "set", args[1])
+		return writer.WriteInteger(1)
+	}
+	return writer.WriteInteger(0)
+}
+
+// SetExHandler handles SETEX and PSETEX commands
+type SetExHandler struct {
+	store   KeyValueStore
+	events  EventNotifier
+	command string
+	unit    string
+}
+
+// NewSetExHandler creates a new SETEX handler (expiry in seconds)
+func NewSetExHandler(store KeyValueStore, events EventNotifier) *SetExHandler {
+	return &SetExHandler{store: store, events: events, command: "setex", unit: "EX"}
+}
+
+// NewPSetExHandler creates a new PSETEX handler (expiry in milliseconds)
+func NewPSetExHandler(store KeyValueStore, events EventNotifier) *SetExHandler {
+	return &SetExHandler{store: store, events: events, command: "psetex", unit: "PX"}
+}
+
+// Handle processes the SETEX/PSETEX command
+func (h *SetExHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 4 {
+		return writer.WriteError("ERR wrong number of arguments for '" + h.command + "' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	expiry, err := parseExpiry(h.unit, args[2], h.command)
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+
+	err = h.store.Replace(args[1], func(entry *store.StringEntry) (bool, error) {
+		entry.Value = args[3]
+		entry.Exists = true
+		entry.Expiry = &expiry
+		return true, nil
+	})
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	h.events.Notify(notify.String, "set", args[1])
+	h.events.Notify(notify.Generic, "expire", args[1])
+
+	return writer.WriteSimpleString("OK")
+}
+
+// LCSHandler handles LCS commands
+type LCSHandler struct {
+	store KeyValueStore
+}
+
+// NewLCSHandler creates a new LCS handler
+func NewLCSHandler(store KeyValueStore) *LCSHandler {
+	return &LCSHandler{store: store}
+}
+
+// Handle processes the LCS command
+func (h *LCSHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) < 3 {
+		return writer.WriteError("ERR wrong number of arguments for 'lcs' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	getLen, getIdx, withMatchLen := false, false, false
+	minMatchLen := 0
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "LEN":
+			getLen = true
+		case "IDX":
+			getIdx = true
+		case "WITHMATCHLEN":
+			withMatchLen = true
+		case "MINMATCHLEN":
+			if i+1 >= len(args) {
+				return writer.WriteError(errSyntax.Error())
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return writer.WriteError(errNotInteger.Error())
+			}
+			if n > 0 {
+				minMatchLen = n
+			}
+			i++
+		default:
+			return writer.WriteError(errSyntax.Error())
+		}
+	}
+
+	if getLen && getIdx {
+		return writer.WriteError("ERR If you want both the length and indexes, please just use IDX.")
+	}
+
+	a, _, err := h.store.Get(args[1])
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	b, _, err := h.store.Get(args[2])
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+
+	result, err := computeLCS(a, b, minMatchLen, withMatchLen)
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	switch {
+	case getIdx:
+		return writer.WriteValue(resp.RespValue{Type: resp.ArrayType, Value: []resp.RespValue{
+			{Type: resp.BulkString, Value: "matches"},
+			{Type: resp.ArrayType, Value: result.matches},
+			{Type: resp.BulkString, Value: "len"},
+			{Type: resp.IntegerType, Value: len(result.sequence)},
+		}})
+	case getLen:
+		return writer.WriteInteger(len(result.sequence))
+	default:
+		return writer.WriteBulkString(result.sequence)
+	}
+}
+
+// lcsResult holds the common subsequence and the matching ranges, last match first
+type lcsResult struct {
+	sequence string
+	matches  []resp.RespValue
+}
+
+// computeLCS finds the longest common subsequence of a and b with the same
+// dynamic-programming walk Redis uses, so IDX ranges are reported identically.
+// Like Redis, it refuses inputs whose table would exceed proto-max-bulk-len.
+func computeLCS(a, b string, minMatchLen int, withMatchLen bool) (lcsResult, error) {
+	alen, blen := len(a), len(b)
+	// Neither length exceeds maxStringLength, so the product cannot overflow
+	if uint64(alen+1)*uint64(blen+1)*4 > maxStringLength {
+		return lcsResult{}, errLCSTooLarge
+	}
+	width := blen + 1
+	table := make([]uint32, (alen+1)*width)
+	lcs := func(i, j int) uint32 { return table[i*width+j] }
+
+	for i := 1; i <= alen; i++ {
+		for j := 1; j <= blen; j++ {
+			switch {
+			case a[i-1] == b[j-1]:
+				table[i*width+j] = lcs(i-1, j-1) + 1
+			case lcs(i-1, j) > lcs(i, j-1):
+				table[i*width+j] = lcs(i-1, j)
+			default:
+				table[i*width+j] = lcs(i, j-1)
+			}
+		}
+	}
+
+	idx := int(lcs(alen, blen))
+	sequence := make([]byte, idx)
+	matches := make([]resp.RespValue, 0)
+
+	rangePair := func(start, end int) resp.RespValue {
+		return resp.RespValue{Type: resp.ArrayType, Value: []resp.RespValue{
+			{Type: resp.IntegerType, Value: start},
+			{Type: resp.IntegerType, Value: end},
+		}}
+	}
+
+	// arangeStart == alen means no range is currently being tracked
+	arangeStart, arangeEnd, brangeStart, brangeEnd := alen, 0, 0, 0
+	i, j := alen, blen
+	for i > 0 && j > 0 {
+		emitRange := false
+		if a[i-1] == b[j-1] {
+			sequence[idx-1] = a[i-1]
+
+			if arangeStart == alen {
+				arangeStart, arangeEnd = i-1, i-1
+				brangeStart, brangeEnd = j-1, j-1
+			} else if arangeStart == i && brangeStart == j {
+				// The match is contiguous, extend the range backwards
+				arangeStart--
+				brangeStart--
+			} else {
+				emitRange = true
+			}
+
+			if arangeStart == 0 || brangeStart == 0 {
+				emitRange = true
+			}
+			idx--
+			i--
+			j--
+		} else {
+			if lcs(i-1, j) > lcs(i, j-1) {
+				i--
+			} else {
+				j--
+			}
+			if arangeStart != alen {
+				emitRange = true
+			}
+		}
+
+		if emitRange {
+			matchLen := arangeEnd - arangeStart + 1
+			if minMatchLen == 0 || matchLen >= minMatchLen {
+				match := []resp.RespValue{
+					rangePair(arangeStart, arangeEnd),
+					rangePair(brangeStart, brangeEnd),
+				}
+				if withMatchLen {
+					match = append(match, resp.RespValue{Type: resp.IntegerType, Value: matchLen})
+				}
+				matches = append(matches, resp.RespValue{Type: resp.ArrayType, Value: match})
+			}
+			arangeStart = alen
+		}
+	}
+
+	return lcsResult{sequence: string(sequence), matches: matches}, nil
+}
+
+// MGetHandler handles MGET commands
+type MGetHandler struct {
+	store KeyValueStore
+}
+
+// NewMGetHandler creates a new MGET handler
+func NewMGetHandler(store KeyValueStore) *MGetHandler {
+	return &MGetHandler{store: store}
+}
+
+// Handle processes the MGET command
+func (h *MGetHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) < 2 {
+		return writer.WriteError("ERR wrong number of arguments for 'mget' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	values, found := h.store.GetMultiple(args[1:])
+	items := make([]resp.RespValue, len(values))
+	for i, value := range values {
+		if found[i] {
+			items[i] = resp.RespValue{Type: resp.BulkString, Value: value}
+		} else {
+			items[i] = resp.RespValue{Type: resp.BulkString, Value: nil}
+		}
+	}
+
+	return writer.WriteValue(resp.RespValue{Type: resp.ArrayType, Value: items})
+}
+
+// MSetHandler handles MSET and MSETNX commands
+type MSetHandler struct {
+	store     KeyValueStore
+	events    EventNotifier
+	command   string
+	onlyIfNew bool
+}
+
+// NewMSetHandler creates a new MSET handler
+func NewMSetHandler(store KeyValueStore, events EventNotifier) *MSetHandler {
+	return &MSetHandler{store: store, events: events, command: "mset"}
+}
+
+// NewMSetNXHandler creates a new MSETNX handler
+func NewMSetNXHandler(store KeyValueStore, events EventNotifier) *MSetHandler {
+	return &MSetHandler{store: store, events: events, command: "msetnx", onlyIfNew: true}
+}
+
+// Handle processes the MSET/MSETNX command
+func (h *MSetHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) < 3 || len(parts)%2 != 1 {
+		return writer.WriteError("ERR wrong number of arguments for '" + h.command + "' command")
+	}
+
+	args, ok := resp.StringArgs(parts)
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	keys := make([]string, 0, len(args)/2)
+	values := make([]string, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		keys = append(keys, args[i])
+		values = append(values, args[i+1])
+	}
+
+	// Like SET, MSET overwrites keys of any type, and MSETNX counts them as existing
+	applied := false
+	err := h.store.ReplaceMultiple(keys, func(entries []*store.StringEntry) (bool, error) {
+		if h.onlyIfNew {
+			for _, entry := range entries {
+				if entry.Exists {
+					return false, nil
+				}
+			}
+		}
+
+		for i, entry := range entries {
+			entry.Value = values[i]
+			entry.Exists = true
+			entry.Expiry = nil
+		}
+		applied = true
+		return true, nil
+	})
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	if applied {
+		for _, key := range keys {
+			h.events.Notify(notify.String, "set", key)
+		}
+	}
+
+	if !h.onlyIfNew {
+		return writer.WriteSimpleString("OK")
+	}
+	if applied {
+		return writer.WriteInteger(1)
+	}
+	return writer.WriteInteger(0)
+}
@@ -0,0 +1,134 @@
+package keyvalue
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/notify"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/store"
+)
+
+// handler is the part of a command handler the tests drive
+type handler interface {
+	Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error
+}
+
+// run sends args to h and returns its reply
+func run(t *testing.T, h handler, args ...string) resp.RespValue {
+	t.Helper()
+	parts := make([]resp.RespValue, len(args))
+	for i, arg := range args {
+		parts[i] = resp.RespValue{Type: resp.BulkString, Value: arg}
+	}
+	writer, conn := resp.NewCapturingWriter()
+	if err := h.Handle(parts, conn, writer); err != nil {
+		t.Fatal(err)
+	}
+	return conn.GetCapturedResponse()
+}
+
+func TestLCS(t *testing.T) {
+	db := store.NewDatabase()
+	db.Set("a", "ohmytext")
+	db.Set("b", "mynewtext")
+	h := NewLCSHandler(db)
+
+	if got := run(t, h, "LCS", "a", "b"); got.Value != "mytext" {
+		t.Errorf("LCS = %v, want mytext", got.Value)
+	}
+	if got := run(t, h, "LCS", "a", "b", "LEN"); got.Value != int64(6) {
+		t.Errorf("LCS LEN = %v, want 6", got.Value)
+	}
+	got := run(t, h, "LCS", "a", "b", "IDX", "MINMATCHLEN", "4")
+	want := resp.RespValue{Type: resp.ArrayType, Value: []resp.RespValue{
+		{Type: resp.BulkString, Value: "matches"},
+		{Type: resp.ArrayType, Value: []resp.RespValue{
+			{Type: resp.ArrayType, Value: []resp.RespValue{
+				{Type: resp.ArrayType, Value: []resp.RespValue{{Type: resp.IntegerType, Value: int64(4)}, {Type: resp.IntegerType, Value: int64(7)}}},
+				{Type: resp.ArrayType, Value: []resp.RespValue{{Type: resp.IntegerType, Value: int64(5)}, {Type: resp.IntegerType, Value: int64(8)}}},
+			}},
+		}},
+		{Type: resp.BulkString, Value: "len"},
+		{Type: resp.IntegerType, Value: int64(6)},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LCS IDX = %v, want %v", got, want)
+	}
+}
+
+func TestLCSTooLarge(t *testing.T) {
+	// The table of two 16KB strings takes 1GB, over proto-max-bulk-len
+	db := store.NewDatabase()
+	db.Set("s", strings.Repeat("a", 16*1024))
+	h := NewLCSHandler(db)
+
+	got := run(t, h, "LCS", "s", "s", "IDX")
+	if got.Type != resp.ErrorType || got.Value != errLCSTooLarge.Error() {
+		t.Errorf("LCS = %v, want %q", got, errLCSTooLarge.Error())
+	}
+}
+
+func TestExpiryOverflow(t *testing.T) {
+	db := store.NewDatabase()
+	db.Set("k", "v")
+	events := notify.NewNotifier(nil).ForDatabase(0)
+
+	tests := []struct {
+		h    handler
+		args []string
+		want string
+	}{
+		{NewSetExHandler(db, events), []string{"SETEX", "k", "9999999999999", "v"}, "ERR invalid expire time in 'setex' command"},
+		{NewPSetExHandler(db, events), []string{"PSETEX", "k", "9223372036854775807", "v"}, "ERR invalid expire time in 'psetex' command"},
+		{NewGetExHandler(db, events), []string{"GETEX", "k", "EX", "9999999999999"}, "ERR invalid expire time in 'getex' command"},
+		{NewGetExHandler(db, events), []string{"GETEX", "k", "EXAT", "9223372036854775807"}, "ERR invalid expire time in 'getex' command"},
+		{NewSetHandler(db, events), []string{"SET", "k", "v", "EX", "9999999999999"}, "ERR invalid expire time in 'set' command"},
+		{NewSetHandler(db, events), []string{"SET", "k", "v", "PX", "0"}, "ERR invalid expire time in 'set' command"},
+	}
+	for _, tt := range tests {
+		got := run(t, tt.h, tt.args...)
+		if got.Type != resp.ErrorType || got.Value != tt.want {
+			t.Errorf("%q = %v, want %q", tt.args, got.Value, tt.want)
+		}
+	}
+
+	// The largest TTL a time.Duration holds is still accepted
+	if got := run(t, NewSetExHandler(db, events), "SETEX", "k", "9223372036", "v"); got.Value != "OK" {
+		t.Errorf("SETEX with a TTL of 292 years = %v, want OK", got.Value)
+	}
+}
+
+// publisher records the messages published on each channel
+type publisher map[string][]string
+
+func (p publisher) Publish(channel, message string) int {
+	p[channel] = append(p[channel], message)
+	return 1
+}
+
+func TestSetPastDeadlineDeletesOnce(t *testing.T) {
+	published := publisher{}
+	notifier := notify.NewNotifier(published)
+	notifier.SetClasses(notify.Keyevent | notify.All)
+	dbs := store.NewDatabases(1)
+	dbs.SetKeyEventHook(notifier.StoreEvent)
+	db := dbs.DB(0)
+	db.Set("k", "v")
+
+	h := NewSetHandler(db, notifier.ForDatabase(0))
+	if got := run(t, h, "SET", "k", "v", "PXAT", "1"); got.Value != "OK" {
+		t.Fatalf("SET = %v, want OK", got.Value)
+	}
+	if _, exists, _ := db.Get("k"); exists {
+		t.Error("SET with a past deadline left the key")
+	}
+	if got := published["__keyevent@0__:del"]; !reflect.DeepEqual(got, []string{"k"}) {
+		t.Errorf("del events = %q, want one for k", got)
+	}
+	if got := published["__keyevent@0__:set"]; got != nil {
+		t.Errorf("set events = %q, want none", got)
+	}
+}
@@ -1,32 +1,34 @@
 package list
 
 import (
+	"github.com/codecrafters-io/redis-starter-go/app/notify"
 	"github.com/codecrafters-io/redis-starter-go/app/resp"
 	"net"
 	"strconv"
+	"sync"
 	"time"
 )
 
 // LPushHandler handles LPUSH commands
 type LPushHandler struct {
-	writer *resp.ResponseWriter
 	store  ListStore
+	events EventNotifier
 }
 
 // NewLPushHandler creates a new LPUSH handler
-func NewLPushHandler(store ListStore) *LPushHandler {
-	return &LPushHandler{store: store}
+func NewLPushHandler(store ListStore, events EventNotifier) *LPushHandler {
+	return &LPushHandler{store: store, events: events}
 }
 
 // Handle processes the LPUSH command
-func (h *LPushHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
+func (h *LPushHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
 	if len(parts) < 3 {
-		return h.writer.WriteError("ERR wrong number of arguments for 'lpush' command")
+		return writer.WriteError("ERR wrong number of arguments for 'lpush' command")
 	}
 
 	key, ok := parts[1].Value.(string)
 	if !ok {
-		return h.writer.WriteError("ERR invalid key type")
+		return writer.WriteError("ERR invalid key type")
 	}
 
 	values := make([]string, 0, len(parts)-2)
@@ -34,43 +36,39 @@ func (h *LPushHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
 		if val, ok := parts[i].Value.(string); ok {
 			values = append(values, val)
 		} else {
-			return h.writer.WriteError("ERR invalid value type")
+			return writer.WriteError("ERR invalid value type")
 		}
 	}
 
 	length, err := h.store.LPush(key, values...)
 	if err != nil {
-		return h.writer.WriteError("ERR " + err.Error())
+		return writer.WriteError(err.Error())
 	}
+	h.events.Notify(notify.List, "lpush", key)
 
-	return h.writer.WriteInteger(length)
-}
-
-// SetWriter sets the response writer for this handler
-func (h *LPushHandler) SetWriter(writer *resp.ResponseWriter) {
-	h.writer = writer
+	return writer.WriteInteger(length)
 }
 
 // RPushHandler handles RPUSH commands
 type RPushHandler struct {
-	writer *resp.ResponseWriter
 	store  ListStore
+	events EventNotifier
 }
 
 // NewRPushHandler creates a new RPUSH handler
-func NewRPushHandler(store ListStore) *RPushHandler {
-	return &RPushHandler{store: store}
+func NewRPushHandler(store ListStore, events EventNotifier) *RPushHandler {
+	return &RPushHandler{store: store, events: events}
 }
 
 // Handle processes the RPUSH command
-func (h *RPushHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
+func (h *RPushHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
 	if len(parts) < 3 {
-		return h.writer.WriteError("ERR wrong number of arguments for 'rpush' command")
+		return writer.WriteError("ERR wrong number of arguments for 'rpush' command")
 	}
 
 	key, ok := parts[1].Value.(string)
 	if !ok {
-		return h.writer.WriteError("ERR invalid key type")
+		return writer.WriteError("ERR invalid key type")
 	}
 
 	values := make([]string, 0, len(parts)-2)
@@ -78,43 +76,39 @@ func (h *RPushHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
 		if val, ok := parts[i].Value.(string); ok {
 			values = append(values, val)
 		} else {
-			return h.writer.WriteError("ERR invalid value type")
+			return writer.WriteError("ERR invalid value type")
 		}
 	}
 
 	length, err := h.store.RPush(key, values...)
 	if err != nil {
-		return h.writer.WriteError("ERR " + err.Error())
+		return writer.WriteError(err.Error())
 	}
+	h.events.Notify(notify.List, "rpush", key)
 
-	return h.writer.WriteInteger(length)
-}
-
-// SetWriter sets the response writer for this handler
-func (h *RPushHandler) SetWriter(writer *resp.ResponseWriter) {
-	h.writer = writer
+	return writer.WriteInteger(length)
 }
 
 // LPopHandler handles LPOP commands
 type LPopHandler struct {
-	writer *resp.ResponseWriter
 	store  ListStore
+	events EventNotifier
 }
 
 // NewLPopHandler creates a new LPOP handler
-func NewLPopHandler(store ListStore) *LPopHandler {
-	return &LPopHandler{store: store}
+func NewLPopHandler(store ListStore, events EventNotifier) *LPopHandler {
+	return &LPopHandler{store: store, events: events}
 }
 
 // Handle processes the LPOP command
-func (h *LPopHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
+func (h *LPopHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
 	if len(parts) < 2 || len(parts) > 3 {
-		return h.writer.WriteError("ERR wrong number of arguments for 'lpop' command")
+		return writer.WriteError("ERR wrong number of arguments for 'lpop' command")
 	}
 
 	key, ok := parts[1].Value.(string)
 	if !ok {
-		return h.writer.WriteError("ERR invalid key type")
+		return writer.WriteError("ERR invalid key type")
 	}
 
 	count := 1
@@ -123,34 +117,32 @@ func (h *LPopHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
 			var err error
 			count, err = strconv.Atoi(countStr)
 			if err != nil || count < 0 {
-				return h.writer.WriteError("ERR value is not an integer or out of range")
+				return writer.WriteError("ERR value is not an integer or out of range")
 			}
 		} else {
-			return h.writer.WriteError("ERR invalid count type")
+			return writer.WriteError("ERR invalid count type")
 		}
 	}
 
-	values, exists := h.store.LPop(key, count)
+	values, emptied, exists := h.store.LPop(key, count)
 	if !exists {
-		return h.writer.WriteNullBulkString()
+		return writer.WriteNullBulkString()
+	}
+	h.events.Notify(notify.List, "lpop", key)
+	if emptied {
+		h.events.Notify(notify.Generic, "del", key)
 	}
 
 	if len(parts) == 2 && len(values) > 0 {
-		return h.writer.WriteBulkString(values[0])
+		return writer.WriteBulkString(values[0])
 	}
 
-	return h.writer.WriteArray(values)
-}
-
-// SetWriter sets the response writer for this handler
-func (h *LPopHandler) SetWriter(writer *resp.ResponseWriter) {
-	h.writer = writer
+	return writer.WriteArray(values)
 }
 
 // LRangeHandler handles LRANGE commands
 type LRangeHandler struct {
-	writer *resp.ResponseWriter
-	store  ListStore
+	store ListStore
 }
 
 // NewLRangeHandler creates a new LRANGE handler
@@ -159,53 +151,47 @@ func NewLRangeHandler(store ListStore) *LRangeHandler {
 }
 
 // Handle processes the LRANGE command
-func (h *LRangeHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
+func (h *LRangeHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
 	if len(parts) != 4 {
-		return h.writer.WriteError("ERR wrong number of arguments for 'lrange' command")
+		return writer.WriteError("ERR wrong number of arguments for 'lrange' command")
 	}
 
 	key, ok := parts[1].Value.(string)
 	if !ok {
-		return h.writer.WriteError("ERR invalid key type")
+		return writer.WriteError("ERR invalid key type")
 	}
 
 	startStr, ok := parts[2].Value.(string)
 	if !ok {
-		return h.writer.WriteError("ERR invalid start index type")
+		return writer.WriteError("ERR invalid start index type")
 	}
 
 	endStr, ok := parts[3].Value.(string)
 	if !ok {
-		return h.writer.WriteError("ERR invalid end index type")
+		return writer.WriteError("ERR invalid end index type")
 	}
 
 	start, err := strconv.Atoi(startStr)
 	if err != nil {
-		return h.writer.WriteError("ERR value is not an integer or out of range")
+		return writer.WriteError("ERR value is not an integer or out of range")
 	}
 
 	end, err := strconv.Atoi(endStr)
 	if err != nil {
-		return h.writer.WriteError("ERR value is not an integer or out of range")
+		return writer.WriteError("ERR value is not an integer or out of range")
 	}
 
 	values, exists := h.store.LRange(key, start, end)
 	if !exists {
-		return h.writer.WriteArray([]string{})
+		return writer.WriteArray([]string{})
 	}
 
-	return h.writer.WriteArray(values)
-}
-
-// SetWriter sets the response writer for this handler
-func (h *LRangeHandler) SetWriter(writer *resp.ResponseWriter) {
-	h.writer = writer
+	return writer.WriteArray(values)
 }
 
 // LLenHandler handles LLEN commands
 type LLenHandler struct {
-	writer *resp.ResponseWriter
-	store  ListStore
+	store ListStore
 }
 
 // NewLLenHandler creates a new LLEN handler
@@ -214,55 +200,61 @@ func NewLLenHandler(store ListStore) *LLenHandler {
 }
 
 // Handle processes the LLEN command
-func (h *LLenHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
+func (h *LLenHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
 	if len(parts) != 2 {
-		return h.writer.WriteError("ERR wrong number of arguments for 'llen' command")
+		return writer.WriteError("ERR wrong number of arguments for 'llen' command")
 	}
 
 	key, ok := parts[1].Value.(string)
 	if !ok {
-		return h.writer.WriteError("ERR invalid key type")
+		return writer.WriteError("ERR invalid key type")
 	}
 
 	length, exists := h.store.LLen(key)
 	if !exists {
-		return h.writer.WriteInteger(0)
+		return writer.WriteInteger(0)
 	}
 
-	return h.writer.WriteInteger(length)
-}
-
-// SetWriter sets the response writer for this handler
-func (h *LLenHandler) SetWriter(writer *resp.ResponseWriter) {
-	h.writer = writer
+	return writer.WriteInteger(length)
 }
 
 // BLPopHandler handles BLPOP commands
 type BLPopHandler struct {
-	writer *resp.ResponseWriter
-	store  ListStore
+	store     ListStore
+	events    EventNotifier
+	locker    sync.Locker
+	propagate func(conn net.Conn, parts []resp.RespValue, reply resp.RespValue)
 }
 
 // NewBLPopHandler creates a new BLPOP handler
-func NewBLPopHandler(store ListStore) *BLPopHandler {
-	return &BLPopHandler{store: store}
+func NewBLPopHandler(store ListStore, events EventNotifier) *BLPopHandler {
+	return &BLPopHandler{store: store, events: events, locker: nopLocker{}, propagate: func(net.Conn, []resp.RespValue, resp.RespValue) {}}
 }
 
 // Handle processes the BLPOP command
-func (h *BLPopHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
+func (h *BLPopHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	return h.handle(parts, conn, true, writer)
+}
+
+// HandleNonBlocking processes the BLPOP command without waiting, as inside a transaction
+func (h *BLPopHandler) HandleNonBlocking(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	return h.handle(parts, conn, false, writer)
+}
+
+func (h *BLPopHandler) handle(parts []resp.RespValue, conn net.Conn, blocking bool, writer *resp.ResponseWriter) error {
 	if len(parts) < 3 {
-		return h.writer.WriteError("ERR wrong number of arguments for 'blpop' command")
+		return writer.WriteError("ERR wrong number of arguments for 'blpop' command")
 	}
 
 	// Last argument is timeout
 	timeoutStr, ok := parts[len(parts)-1].Value.(string)
 	if !ok {
-		return h.writer.WriteError("ERR timeout is not a float or out of range")
+		return writer.WriteError("ERR timeout is not a float or out of range")
 	}
 
 	timeoutSeconds, err := strconv.ParseFloat(timeoutStr, 64)
 	if err != nil || timeoutSeconds < 0 {
-		return h.writer.WriteError("ERR timeout is not a float or out of range")
+		return writer.WriteError("ERR timeout is not a float or out of range")
 	}
 
 	// Extract keys
@@ -271,63 +263,87 @@ func (h *BLPopHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
 		if key, ok := parts[i].Value.(string); ok {
 			keys = append(keys, key)
 		} else {
-			return h.writer.WriteError("ERR wrong number of arguments for 'blpop' command")
+			return writer.WriteError("ERR wrong number of arguments for 'blpop' command")
 		}
 	}
 
-	// Try immediate pop
-	for _, key := range keys {
-		values, exists := h.store.LPop(key)
-		if exists && len(values) > 0 {
-			result := []string{key, values[0]}
-			return h.writer.WriteArray(result)
+	if !blocking {
+		if result, ok := h.popFirst(keys); ok {
+			return writer.WriteArray(result)
 		}
+		return writer.WriteNullArray()
 	}
 
-	// Block with timeout
-	if timeoutSeconds == 0 {
-		// Block indefinitely
-		for {
-			for _, key := range keys {
-				values, exists := h.store.LPop(key)
-				if exists && len(values) > 0 {
-					result := []string{key, values[0]}
-					return h.writer.WriteArray(result)
-				}
-			}
-			time.Sleep(10 * time.Millisecond)
+	// A zero timeout blocks indefinitely
+	var deadline time.Time
+	if timeoutSeconds > 0 {
+		deadline = time.Now().Add(time.Duration(timeoutSeconds * float64(time.Second)))
+	}
+
+	for {
+		h.locker.Lock()
+		result, ok := h.popFirst(keys)
+		if ok {
+			h.propagate(conn, parts, resp.RespValue{Type: resp.ArrayType, Value: []resp.RespValue{
+				{Type: resp.BulkString, Value: result[0]},
+				{Type: resp.BulkString, Value: result[1]},
+			}})
 		}
-	} else {
-		// Block with timeout
-		timeout := time.Duration(timeoutSeconds * float64(time.Second))
-		deadline := time.Now().Add(timeout)
-
-		for time.Now().Before(deadline) {
-			for _, key := range keys {
-				values, exists := h.store.LPop(key)
-				if exists && len(values) > 0 {
-					result := []string{key, values[0]}
-					return h.writer.WriteArray(result)
-				}
-			}
-			time.Sleep(10 * time.Millisecond)
+		h.locker.Unlock()
+		if ok {
+			return writer.WriteArray(result)
 		}
 
 		// Timeout reached
-		return h.writer.WriteNullArray()
+		if timeoutSeconds > 0 && !time.Now().Before(deadline) {
+			return writer.WriteNullArray()
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
 }
 
-// SetWriter sets the response writer for this handler
-func (h *BLPopHandler) SetWriter(writer *resp.ResponseWriter) {
-	h.writer = writer
+// popFirst pops from the first non-empty list, returning its key and the value
+func (h *BLPopHandler) popFirst(keys []string) ([]string, bool) {
+	for _, key := range keys {
+		values, emptied, exists := h.store.LPop(key)
+		if exists && len(values) > 0 {
+			h.events.Notify(notify.List, "lpop", key)
+			if emptied {
+				h.events.Notify(notify.Generic, "del", key)
+			}
+			return []string{key, values[0]}, true
+		}
+	}
+	return nil, false
+}
+
+// SetLocker sets the lock held while checking the lists
+func (h *BLPopHandler) SetLocker(locker sync.Locker) {
+	h.locker = locker
+}
+
+// SetPropagator sets the function a successful pop is propagated with, along
+// with the connection it was sent on and its reply
+func (h *BLPopHandler) SetPropagator(propagate func(conn net.Conn, parts []resp.RespValue, reply resp.RespValue)) {
+	h.propagate = propagate
 }
 
+// nopLocker is the default locker of blocking handlers
+type nopLocker struct{}
+
+func (nopLocker) Lock()   {}
+func (nopLocker) Unlock() {}
+
 // Common interfaces and types
 type ListStore interface {
 	LPush(key string, values ...string) (int, error)
 	RPush(key string, values ...string) (int, error)
-	LPop(key string, count ...int) ([]string, bool)
+	LPop(key string, count ...int) (values []string, emptied bool, exists bool)
 	LRange(key string, start, end int) ([]string, bool)
 	LLen(key string) (int, bool)
 }
+
+// EventNotifier publishes keyspace notifications for the handler's database
+type EventNotifier interface {
+	Notify(class notify.Class, event, key string)
+}
@@ -0,0 +1,121 @@
+package list
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/notify"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/store"
+)
+
+// handler is the part of a command handler the tests drive
+type handler interface {
+	Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error
+}
+
+// run sends args to h and returns its reply
+func run(t *testing.T, h handler, args ...string) resp.RespValue {
+	t.Helper()
+	parts := make([]resp.RespValue, len(args))
+	for i, arg := range args {
+		parts[i] = resp.RespValue{Type: resp.BulkString, Value: arg}
+	}
+	writer, conn := resp.NewCapturingWriter()
+	if err := h.Handle(parts, conn, writer); err != nil {
+		t.Fatal(err)
+	}
+	return conn.GetCapturedResponse()
+}
+
+// publisher records the messages published to keyspace channels in order
+type publisher struct {
+	messages []string
+}
+
+func (p *publisher) Publish(channel, message string) int {
+	p.messages = append(p.messages, channel+" "+message)
+	return 1
+}
+
+// newTestDatabase returns a database whose key events are published, with
+// every keyspace notification enabled
+func newTestDatabase() (*store.Database, *notify.DatabaseNotifier, *publisher) {
+	published := &publisher{}
+	notifier := notify.NewNotifier(published)
+	notifier.SetClasses(notify.Keyspace | notify.All)
+	dbs := store.NewDatabases(1)
+	dbs.SetKeyEventHook(notifier.StoreEvent)
+	return dbs.DB(0), notifier.ForDatabase(0), published
+}
+
+func TestPopEventOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		h    func(db *store.Database, events EventNotifier) handler
+		args []string
+	}{
+		{"LPOP", func(db *store.Database, events EventNotifier) handler { return NewLPopHandler(db, events) }, []string{"LPOP", "k"}},
+		{"LPOP with a count", func(db *store.Database, events EventNotifier) handler { return NewLPopHandler(db, events) }, []string{"LPOP", "k", "5"}},
+		{"BLPOP", func(db *store.Database, events EventNotifier) handler { return NewBLPopHandler(db, events) }, []string{"BLPOP", "k", "0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, events, published := newTestDatabase()
+			db.RPush("k", "a")
+			published.messages = nil
+
+			run(t, tt.h(db, events), tt.args...)
+
+			// The pop event comes first, then the deletion of the emptied list
+			want := []string{"__keyspace@0__:k lpop", "__keyspace@0__:k del"}
+			if !reflect.DeepEqual(published.messages, want) {
+				t.Errorf("events = %q, want %q", published.messages, want)
+			}
+		})
+	}
+}
+
+func TestPopKeepsNonEmptyList(t *testing.T) {
+	db, events, published := newTestDatabase()
+	db.RPush("k", "a", "b")
+	published.messages = nil
+
+	if got := run(t, NewLPopHandler(db, events), "LPOP", "k"); got.Value != "a" {
+		t.Fatalf("LPOP = %v, want a", got.Value)
+	}
+	want := []string{"__keyspace@0__:k lpop"}
+	if !reflect.DeepEqual(published.messages, want) {
+		t.Errorf("events = %q, want %q", published.messages, want)
+	}
+	if n, _ := db.LLen("k"); n != 1 {
+		t.Errorf("LLEN = %d, want 1", n)
+	}
+}
+
+func TestBinaryValuesRoundTrip(t *testing.T) {
+	db, events, _ := newTestDatabase()
+	values := []string{"a:b", "c,d", "line\r\nbreak", "nul\x00byte", "", "\x00\xff\x80"}
+
+	args := append([]string{"RPUSH", "k"}, values...)
+	if got := run(t, NewRPushHandler(db, events), args...); got.Value != int64(len(values)) {
+		t.Fatalf("RPUSH = %v, want %d", got.Value, len(values))
+	}
+
+	got := run(t, NewLRangeHandler(db), "LRANGE", "k", "0", "-1")
+	items, _ := got.Value.([]resp.RespValue)
+	ranged := make([]string, len(items))
+	for i, item := range items {
+		ranged[i], _ = item.Value.(string)
+	}
+	if !reflect.DeepEqual(ranged, values) {
+		t.Errorf("LRANGE = %q, want %q", ranged, values)
+	}
+
+	for _, want := range values {
+		if got := run(t, NewLPopHandler(db, events), "LPOP", "k"); got.Value != want {
+			t.Errorf("LPOP = %q, want %q", got.Value, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package persistence
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/aof"
+	"github.com/codecrafters-io/redis-starter-go/app/rdb"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// SaveHandler handles SAVE commands
+type SaveHandler struct {
+	saver Saver
+}
+
+// NewSaveHandler creates a new SAVE handler
+func NewSaveHandler(saver Saver) *SaveHandler {
+	return &SaveHandler{saver: saver}
+}
+
+// Handle processes the SAVE command
+func (h *SaveHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 1 {
+		return writer.WriteError("ERR wrong number of arguments for 'save' command")
+	}
+
+	if err := h.saver.Save(); err != nil {
+		if errors.Is(err, rdb.ErrSaveInProgress) {
+			return writer.WriteError(err.Error())
+		}
+		return writer.WriteError("ERR " + err.Error())
+	}
+	return writer.WriteSimpleString("OK")
+}
+
+// BGSaveHandler handles BGSAVE commands
+type BGSaveHandler struct {
+	saver Saver
+}
+
+// NewBGSaveHandler creates a new BGSAVE handler
+func NewBGSaveHandler(saver Saver) *BGSaveHandler {
+	return &BGSaveHandler{saver: saver}
+}
+
+// Handle processes the BGSAVE command. With SCHEDULE, a request made while a
+// save runs is deferred instead of rejected.
+func (h *BGSaveHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) > 2 {
+		return writer.WriteError("ERR wrong number of arguments for 'bgsave' command")
+	}
+
+	if len(parts) == 2 {
+		option, _ := parts[1].Value.(string)
+		if !strings.EqualFold(option, "SCHEDULE") {
+			return writer.WriteError("ERR syntax error")
+		}
+		if h.saver.ScheduleBackgroundSave() {
+			return writer.WriteSimpleString("Background saving scheduled")
+		}
+		return writer.WriteSimpleString("Background saving started")
+	}
+
+	if err := h.saver.BackgroundSave(); err != nil {
+		return writer.WriteError(err.Error())
+	}
+	return writer.WriteSimpleString("Background saving started")
+}
+
+// LastSaveHandler handles LASTSAVE commands
+type LastSaveHandler struct {
+	saver Saver
+}
+
+// NewLastSaveHandler creates a new LASTSAVE handler
+func NewLastSaveHandler(saver Saver) *LastSaveHandler {
+	return &LastSaveHandler{saver: saver}
+}
+
+// Handle processes the LASTSAVE command
+func (h *LastSaveHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 1 {
+		return writer.WriteError("ERR wrong number of arguments for 'lastsave' command")
+	}
+	return writer.WriteInteger(int(h.saver.LastSave().Unix()))
+}
+
+// BGRewriteAOFHandler handles BGREWRITEAOF commands
+type BGRewriteAOFHandler struct {
+	rewriter Rewriter
+}
+
+// NewBGRewriteAOFHandler creates a new BGREWRITEAOF handler
+func NewBGRewriteAOFHandler(rewriter Rewriter) *BGRewriteAOFHandler {
+	return &BGRewriteAOFHandler{rewriter: rewriter}
+}
+
+// Handle processes the BGREWRITEAOF command
+func (h *BGRewriteAOFHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 1 {
+		return writer.WriteError("ERR wrong number of arguments for 'bgrewriteaof' command")
+	}
+
+	if err := h.rewriter.Rewrite(); err != nil {
+		if errors.Is(err, aof.ErrRewriteInProgress) {
+			return writer.WriteError(err.Error())
+		}
+		return writer.WriteError("ERR " + err.Error())
+	}
+	return writer.WriteSimpleString("Background append only file rewriting started")
+}
+
+// Common interfaces and types
+type Saver interface {
+	Save() error
+	BackgroundSave() error
+	ScheduleBackgroundSave() bool
+	LastSave() time.Time
+}
+
+type Rewriter interface {
+	Rewrite() error
+}
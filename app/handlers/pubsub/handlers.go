@@ -0,0 +1,200 @@
+package pubsub
+
+import (
+	"net"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/cluster"
+	broker "github.com/codecrafters-io/redis-starter-go/app/pubsub"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// sameSlot reports whether every shard channel maps to the same hash slot
+func sameSlot(channels []string) bool {
+	for _, channel := range channels[1:] {
+		if cluster.KeySlot(channel) != cluster.KeySlot(channels[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+// SubscribeHandler handles SUBSCRIBE, PSUBSCRIBE and SSUBSCRIBE commands
+type SubscribeHandler struct {
+	broker Broker
+	kind   broker.Kind
+	name   string
+}
+
+// NewSubscribeHandler creates a new SUBSCRIBE handler
+func NewSubscribeHandler(b Broker) *SubscribeHandler {
+	return &SubscribeHandler{broker: b, kind: broker.Channel, name: "subscribe"}
+}
+
+// NewPSubscribeHandler creates a new PSUBSCRIBE handler
+func NewPSubscribeHandler(b Broker) *SubscribeHandler {
+	return &SubscribeHandler{broker: b, kind: broker.Pattern, name: "psubscribe"}
+}
+
+// NewSSubscribeHandler creates a new SSUBSCRIBE handler
+func NewSSubscribeHandler(b Broker) *SubscribeHandler {
+	return &SubscribeHandler{broker: b, kind: broker.Shard, name: "ssubscribe"}
+}
+
+// Handle processes the subscribe commands; the broker queues the
+// confirmations so they stay in order with messages
+func (h *SubscribeHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) < 2 {
+		return writer.WriteError("ERR wrong number of arguments for '" + h.name + "' command")
+	}
+
+	names, ok := resp.StringArgs(parts[1:])
+	if !ok {
+		return writer.WriteError("ERR invalid channel name")
+	}
+	if h.kind == broker.Shard && !sameSlot(names) {
+		return writer.WriteError("CROSSSLOT Keys in request don't hash to the same slot")
+	}
+
+	h.broker.Subscribe(conn, writer.Protocol(), h.kind, names)
+	return nil
+}
+
+// UnsubscribeHandler handles UNSUBSCRIBE, PUNSUBSCRIBE and SUNSUBSCRIBE commands
+type UnsubscribeHandler struct {
+	broker Broker
+	kind   broker.Kind
+}
+
+// NewUnsubscribeHandler creates a new UNSUBSCRIBE handler
+func NewUnsubscribeHandler(b Broker) *UnsubscribeHandler {
+	return &UnsubscribeHandler{broker: b, kind: broker.Channel}
+}
+
+// NewPUnsubscribeHandler creates a new PUNSUBSCRIBE handler
+func NewPUnsubscribeHandler(b Broker) *UnsubscribeHandler {
+	return &UnsubscribeHandler{broker: b, kind: broker.Pattern}
+}
+
+// NewSUnsubscribeHandler creates a new SUNSUBSCRIBE handler
+func NewSUnsubscribeHandler(b Broker) *UnsubscribeHandler {
+	return &UnsubscribeHandler{broker: b, kind: broker.Shard}
+}
+
+// Handle processes the unsubscribe commands
+func (h *UnsubscribeHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	names, ok := resp.StringArgs(parts[1:])
+	if !ok {
+		return writer.WriteError("ERR invalid channel name")
+	}
+	if h.kind == broker.Shard && len(names) > 0 && !sameSlot(names) {
+		return writer.WriteError("CROSSSLOT Keys in request don't hash to the same slot")
+	}
+
+	h.broker.Unsubscribe(conn, writer.Protocol(), h.kind, names)
+	return nil
+}
+
+// PublishHandler handles PUBLISH and SPUBLISH commands
+type PublishHandler struct {
+	broker  Broker
+	sharded bool
+	name    string
+}
+
+// NewPublishHandler creates a new PUBLISH handler
+func NewPublishHandler(b Broker) *PublishHandler {
+	return &PublishHandler{broker: b, name: "publish"}
+}
+
+// NewSPublishHandler creates a new SPUBLISH handler
+func NewSPublishHandler(b Broker) *PublishHandler {
+	return &PublishHandler{broker: b, sharded: true, name: "spublish"}
+}
+
+// Handle processes the PUBLISH and SPUBLISH commands
+func (h *PublishHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 3 {
+		return writer.WriteError("ERR wrong number of arguments for '" + h.name + "' command")
+	}
+
+	args, ok := resp.StringArgs(parts[1:])
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	if h.sharded {
+		return writer.WriteInteger(h.broker.SPublish(args[0], args[1]))
+	}
+	return writer.WriteInteger(h.broker.Publish(args[0], args[1]))
+}
+
+// PubSubHandler handles the PUBSUB introspection commands
+type PubSubHandler struct {
+	broker Broker
+}
+
+// NewPubSubHandler creates a new PUBSUB handler
+func NewPubSubHandler(b Broker) *PubSubHandler {
+	return &PubSubHandler{broker: b}
+}
+
+// Handle processes the PUBSUB CHANNELS, NUMSUB, NUMPAT, SHARDCHANNELS and
+// SHARDNUMSUB subcommands
+func (h *PubSubHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) < 2 {
+		return writer.WriteError("ERR wrong number of arguments for 'pubsub' command")
+	}
+
+	args, ok := resp.StringArgs(parts[1:])
+	if !ok {
+		return writer.WriteError("ERR invalid arguments")
+	}
+
+	subcommand := strings.ToUpper(args[0])
+	switch {
+	case (subcommand == "CHANNELS" || subcommand == "SHARDCHANNELS") && len(args) <= 2:
+		glob := ""
+		if len(args) == 2 {
+			glob = args[1]
+		}
+		return writer.WriteArray(h.broker.Channels(subcommandKind(subcommand), glob))
+	case subcommand == "NUMSUB" || subcommand == "SHARDNUMSUB":
+		return h.writeCounts(args[1:], h.broker.NumSub(subcommandKind(subcommand), args[1:]), writer)
+	case subcommand == "NUMPAT" && len(args) == 1:
+		return writer.WriteInteger(h.broker.NumPat())
+	default:
+		return writer.WriteError("ERR unknown subcommand or wrong number of arguments for '" + args[0] + "'. Try PUBSUB HELP.")
+	}
+}
+
+// subcommandKind returns the subscription kind a PUBSUB subcommand inspects
+func subcommandKind(subcommand string) broker.Kind {
+	if strings.HasPrefix(subcommand, "SHARD") {
+		return broker.Shard
+	}
+	return broker.Channel
+}
+
+// writeCounts writes channels and their subscriber counts as a flat array
+func (h *PubSubHandler) writeCounts(channels []string, counts []int, writer *resp.ResponseWriter) error {
+	items := make([]resp.RespValue, 0, len(channels)*2)
+	for i, channel := range channels {
+		items = append(items,
+			resp.RespValue{Type: resp.BulkString, Value: channel},
+			resp.RespValue{Type: resp.IntegerType, Value: counts[i]},
+		)
+	}
+	return writer.WriteValue(resp.RespValue{Type: resp.ArrayType, Value: items})
+}
+
+// Common interfaces and types
+type Broker interface {
+	Subscribe(conn net.Conn, protocol int, kind broker.Kind, names []string)
+	Unsubscribe(conn net.Conn, protocol int, kind broker.Kind, names []string)
+	Publish(channel, message string) int
+	SPublish(channel, message string) int
+	Channels(kind broker.Kind, glob string) []string
+	NumSub(kind broker.Kind, channels []string) []int
+	NumPat() int
+}
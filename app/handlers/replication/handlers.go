@@ -0,0 +1,396 @@
+package replication
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	repl "github.com/codecrafters-io/redis-starter-go/app/replication"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// PSyncHandler handles PSYNC commands sent by replicas
+type PSyncHandler struct {
+	replicator Replicator
+}
+
+// NewPSyncHandler creates a new PSYNC handler
+func NewPSyncHandler(replicator Replicator) *PSyncHandler {
+	return &PSyncHandler{replicator: replicator}
+}
+
+// Handle processes the PSYNC command. The resync reply and the stream that
+// follows are written to the replica by the replication state. A master
+// handing its role over adds FAILOVER.
+func (h *PSyncHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 3 && len(parts) != 4 {
+		return writer.WriteError("ERR wrong number of arguments for 'psync' command")
+	}
+
+	replid, _ := parts[1].Value.(string)
+	arg, _ := parts[2].Value.(string)
+	offset, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return writer.WriteError("ERR value is not an integer or out of range")
+	}
+	failover := false
+	if len(parts) == 4 {
+		option, _ := parts[3].Value.(string)
+		if !strings.EqualFold(option, "FAILOVER") {
+			return writer.WriteError("ERR syntax error")
+		}
+		failover = true
+	}
+
+	if err := h.replicator.Sync(conn, replid, offset, failover); err != nil {
+		return writer.WriteError(err.Error())
+	}
+	return nil
+}
+
+// ReplConfHandler handles REPLCONF commands sent by replicas
+type ReplConfHandler struct {
+	replicator Replicator
+}
+
+// NewReplConfHandler creates a new REPLCONF handler
+func NewReplConfHandler(replicator Replicator) *ReplConfHandler {
+	return &ReplConfHandler{replicator: replicator}
+}
+
+// Handle processes the REPLCONF command. ACK is not replied to, since the
+// replica sends it on the stream the master writes to.
+func (h *ReplConfHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts)%2 == 0 {
+		return writer.WriteError("ERR syntax error")
+	}
+
+	for i := 1; i < len(parts); i += 2 {
+		option, _ := parts[i].Value.(string)
+		value, _ := parts[i+1].Value.(string)
+		switch strings.ToLower(option) {
+		case "listening-port":
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				return writer.WriteError("ERR value is not an integer or out of range")
+			}
+			h.replicator.SetListeningPort(conn, port)
+		case "capa", "ip-address":
+			// Every capability a replica announces is supported
+		case "ack":
+			// REPLCONF ACK <offset> [FACK <aofoffset>]
+			offset, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil
+			}
+			aofOffset := int64(-1)
+			if i+3 < len(parts) {
+				if option, _ := parts[i+2].Value.(string); strings.EqualFold(option, "FACK") {
+					arg, _ := parts[i+3].Value.(string)
+					if n, err := strconv.ParseInt(arg, 10, 64); err == nil {
+						aofOffset = n
+					}
+				}
+			}
+			h.replicator.Ack(conn, offset, aofOffset)
+			return nil
+		case "getack":
+			// Only masters ask for acknowledgements
+			return nil
+		default:
+			return writer.WriteError("ERR Unrecognized REPLCONF option: " + option)
+		}
+	}
+	return writer.WriteSimpleString("OK")
+}
+
+// ReplicaOfHandler handles REPLICAOF and SLAVEOF commands
+type ReplicaOfHandler struct {
+	replicator Replicator
+}
+
+// NewReplicaOfHandler creates a new REPLICAOF handler
+func NewReplicaOfHandler(replicator Replicator) *ReplicaOfHandler {
+	return &ReplicaOfHandler{replicator: replicator}
+}
+
+// Handle processes the REPLICAOF command, which makes this server a replica
+// of the given master, or a master again with NO ONE
+func (h *ReplicaOfHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 3 {
+		return writer.WriteError("ERR wrong number of arguments for 'replicaof' command")
+	}
+
+	host, _ := parts[1].Value.(string)
+	arg, _ := parts[2].Value.(string)
+	if strings.EqualFold(host, "NO") && strings.EqualFold(arg, "ONE") {
+		if err := h.replicator.ReplicaOfNoOne(); err != nil {
+			return writer.WriteError(err.Error())
+		}
+		return writer.WriteSimpleString("OK")
+	}
+
+	port, err := strconv.Atoi(arg)
+	if err != nil || port < 0 || port > 65535 {
+		return writer.WriteError("ERR Invalid master port")
+	}
+	if err := h.replicator.ReplicaOf(host, port); err != nil {
+		if errors.Is(err, repl.ErrAlreadyConnected) {
+			return writer.WriteSimpleString("OK Already connected to specified master")
+		}
+		return writer.WriteError(err.Error())
+	}
+	return writer.WriteSimpleString("OK")
+}
+
+// WaitHandler handles WAIT commands
+type WaitHandler struct {
+	replicator Replicator
+	clients    ClientOffsets
+}
+
+// NewWaitHandler creates a new WAIT handler
+func NewWaitHandler(replicator Replicator, clients ClientOffsets) *WaitHandler {
+	return &WaitHandler{replicator: replicator, clients: clients}
+}
+
+// Handle processes the WAIT command, blocking until enough replicas
+// acknowledged the writes the client made so far or the timeout elapses
+func (h *WaitHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	return h.handle(parts, conn, true, writer)
+}
+
+// HandleNonBlocking processes WAIT inside a transaction, where it reports
+// how many replicas acknowledged without waiting
+func (h *WaitHandler) HandleNonBlocking(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	return h.handle(parts, conn, false, writer)
+}
+
+func (h *WaitHandler) handle(parts []resp.RespValue, conn net.Conn, block bool, writer *resp.ResponseWriter) error {
+	if len(parts) != 3 {
+		return writer.WriteError("ERR wrong number of arguments for 'wait' command")
+	}
+
+	arg, _ := parts[1].Value.(string)
+	numReplicas, err := strconv.Atoi(arg)
+	if err != nil {
+		return writer.WriteError("ERR value is not an integer or out of range")
+	}
+	timeout, errMsg := parseTimeout(parts[2])
+	if errMsg != "" {
+		return writer.WriteError(errMsg)
+	}
+	if !block {
+		timeout = -1
+	}
+
+	acked, err := h.replicator.WaitForReplicas(h.clients.WriteOffset(conn), numReplicas, timeout)
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	return writer.WriteInteger(acked)
+}
+
+// SetLocker is a no-op: waiting only reads the replication state
+func (h *WaitHandler) SetLocker(locker sync.Locker) {}
+
+// WaitAOFHandler handles WAITAOF commands
+type WaitAOFHandler struct {
+	replicator Replicator
+	clients    ClientOffsets
+}
+
+// NewWaitAOFHandler creates a new WAITAOF handler
+func NewWaitAOFHandler(replicator Replicator, clients ClientOffsets) *WaitAOFHandler {
+	return &WaitAOFHandler{replicator: replicator, clients: clients}
+}
+
+// Handle processes the WAITAOF command, blocking until the writes the client
+// made so far are on disk locally and on enough replicas or the timeout elapses
+func (h *WaitAOFHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	return h.handle(parts, conn, true, writer)
+}
+
+// HandleNonBlocking processes WAITAOF inside a transaction without waiting
+func (h *WaitAOFHandler) HandleNonBlocking(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	return h.handle(parts, conn, false, writer)
+}
+
+func (h *WaitAOFHandler) handle(parts []resp.RespValue, conn net.Conn, block bool, writer *resp.ResponseWriter) error {
+	if len(parts) != 4 {
+		return writer.WriteError("ERR wrong number of arguments for 'waitaof' command")
+	}
+
+	localArg, _ := parts[1].Value.(string)
+	numLocal, err := strconv.Atoi(localArg)
+	if err != nil {
+		return writer.WriteError("ERR value is not an integer or out of range")
+	}
+	replicasArg, _ := parts[2].Value.(string)
+	numReplicas, err := strconv.Atoi(replicasArg)
+	if err != nil {
+		return writer.WriteError("ERR value is not an integer or out of range")
+	}
+	timeout, errMsg := parseTimeout(parts[3])
+	if errMsg != "" {
+		return writer.WriteError(errMsg)
+	}
+	if !block {
+		timeout = -1
+	}
+
+	local, replicas, err := h.replicator.WaitForFsync(h.clients.WriteOffset(conn), numLocal, numReplicas, timeout)
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	return writer.WriteValue(resp.RespValue{Type: resp.ArrayType, Value: []resp.RespValue{
+		{Type: resp.IntegerType, Value: local},
+		{Type: resp.IntegerType, Value: replicas},
+	}})
+}
+
+// SetLocker is a no-op: waiting only reads the replication state
+func (h *WaitAOFHandler) SetLocker(locker sync.Locker) {}
+
+// FailoverHandler handles FAILOVER commands
+type FailoverHandler struct {
+	replicator Replicator
+}
+
+// NewFailoverHandler creates a new FAILOVER handler
+func NewFailoverHandler(replicator Replicator) *FailoverHandler {
+	return &FailoverHandler{replicator: replicator}
+}
+
+// Handle processes the FAILOVER command: FAILOVER [TO host port [FORCE]]
+// [ABORT] [TIMEOUT milliseconds]
+func (h *FailoverHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	var options repl.FailoverOptions
+	abort := false
+	for i := 1; i < len(parts); i++ {
+		option, _ := parts[i].Value.(string)
+		switch {
+		case strings.EqualFold(option, "TO") && i+2 < len(parts):
+			options.Host, _ = parts[i+1].Value.(string)
+			arg, _ := parts[i+2].Value.(string)
+			port, err := strconv.Atoi(arg)
+			if err != nil {
+				return writer.WriteError("ERR value is not an integer or out of range")
+			}
+			options.Port = port
+			i += 2
+		case strings.EqualFold(option, "TIMEOUT") && i+1 < len(parts):
+			arg, _ := parts[i+1].Value.(string)
+			ms, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				return writer.WriteError("ERR value is not an integer or out of range")
+			}
+			if ms <= 0 {
+				return writer.WriteError("ERR FAILOVER timeout must be greater than 0")
+			}
+			options.Timeout = time.Duration(ms) * time.Millisecond
+			i++
+		case strings.EqualFold(option, "FORCE"):
+			options.Force = true
+		case strings.EqualFold(option, "ABORT"):
+			abort = true
+		default:
+			return writer.WriteError("ERR syntax error")
+		}
+	}
+
+	if abort {
+		if len(parts) != 2 {
+			return writer.WriteError("ERR FAILOVER abort cannot be used with other options.")
+		}
+		if err := h.replicator.AbortFailover(); err != nil {
+			return writer.WriteError(err.Error())
+		}
+		return writer.WriteSimpleString("OK")
+	}
+	if options.Force && (options.Timeout == 0 || options.Host == "") {
+		return writer.WriteError("ERR FAILOVER with force option requires both a timeout and target HOST and IP.")
+	}
+
+	if err := h.replicator.Failover(options); err != nil {
+		return writer.WriteError(err.Error())
+	}
+	return writer.WriteSimpleString("OK")
+}
+
+// RoleHandler handles ROLE commands sent to a data node
+type RoleHandler struct {
+	replicator Replicator
+}
+
+// NewRoleHandler creates a new ROLE handler
+func NewRoleHandler(replicator Replicator) *RoleHandler {
+	return &RoleHandler{replicator: replicator}
+}
+
+// Handle processes the ROLE command. A master replies with its offset and
+// the address and acknowledged offset of each replica, a replica with its
+// master, the state of the link to it and its offset.
+func (h *RoleHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	state := h.replicator.RoleState()
+	if state.Replica {
+		return writer.WriteValue(resp.RespValue{Type: resp.ArrayType, Value: []resp.RespValue{
+			{Type: resp.BulkString, Value: "slave"},
+			{Type: resp.BulkString, Value: state.MasterHost},
+			{Type: resp.IntegerType, Value: state.MasterPort},
+			{Type: resp.BulkString, Value: state.LinkState},
+			{Type: resp.IntegerType, Value: state.Offset},
+		}})
+	}
+
+	replicas := make([]resp.RespValue, 0, len(state.Replicas))
+	for _, replica := range state.Replicas {
+		replicas = append(replicas, resp.RespValue{Type: resp.ArrayType, Value: []resp.RespValue{
+			{Type: resp.BulkString, Value: replica.IP},
+			{Type: resp.BulkString, Value: strconv.Itoa(replica.Port)},
+			{Type: resp.BulkString, Value: strconv.FormatInt(replica.Offset, 10)},
+		}})
+	}
+	return writer.WriteValue(resp.RespValue{Type: resp.ArrayType, Value: []resp.RespValue{
+		{Type: resp.BulkString, Value: "master"},
+		{Type: resp.IntegerType, Value: state.Offset},
+		{Type: resp.ArrayType, Value: replicas},
+	}})
+}
+
+// parseTimeout parses a timeout in milliseconds, returning the error to reply
+// with when it is invalid
+func parseTimeout(part resp.RespValue) (time.Duration, string) {
+	arg, _ := part.Value.(string)
+	ms, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, "ERR timeout is not an integer or out of range"
+	}
+	if ms < 0 {
+		return 0, "ERR timeout is negative"
+	}
+	return time.Duration(ms) * time.Millisecond, ""
+}
+
+// Common interfaces and types
+type Replicator interface {
+	Sync(conn net.Conn, replid string, offset int64, failover bool) error
+	SetListeningPort(conn net.Conn, port int)
+	Ack(conn net.Conn, offset, aofOffset int64)
+	ReplicaOf(host string, port int) error
+	ReplicaOfNoOne() error
+	WaitForReplicas(offset int64, numReplicas int, timeout time.Duration) (int, error)
+	WaitForFsync(offset int64, numLocal, numReplicas int, timeout time.Duration) (int, int, error)
+	Failover(options repl.FailoverOptions) error
+	AbortFailover() error
+	RoleState() repl.RoleState
+}
+
+// ClientOffsets reports where in the replication stream the last write of a
+// client ends
+type ClientOffsets interface {
+	WriteOffset(conn net.Conn) int64
+}
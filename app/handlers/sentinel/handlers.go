@@ -0,0 +1,243 @@
+package sentinel
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// SentinelHandler handles SENTINEL commands, both from clients discovering
+// masters and from other sentinels
+type SentinelHandler struct {
+	monitor Monitor
+}
+
+// NewSentinelHandler creates a new SENTINEL handler
+func NewSentinelHandler(monitor Monitor) *SentinelHandler {
+	return &SentinelHandler{monitor: monitor}
+}
+
+// Handle processes the SENTINEL command
+func (h *SentinelHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	args := make([]string, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		arg, _ := part.Value.(string)
+		args = append(args, arg)
+	}
+	subcommand := strings.ToLower(args[0])
+
+	// Each subcommand takes a fixed number of arguments, but SET
+	arity := map[string]int{
+		"masters": 1, "master": 2, "replicas": 2, "slaves": 2, "sentinels": 2,
+		"get-master-addr-by-name": 2, "is-master-down-by-addr": 5, "failover": 2,
+		"monitor": 5, "remove": 2, "ckquorum": 2, "myid": 1,
+	}
+	if n, ok := arity[subcommand]; ok && len(args) != n || subcommand == "set" && (len(args) < 4 || len(args)%2 != 0) {
+		return writer.WriteError("ERR wrong number of arguments for 'sentinel|" + subcommand + "' command")
+	}
+
+	switch subcommand {
+	case "masters":
+		return h.writeInstances(h.monitor.Masters(), nil, writer)
+	case "master":
+		fields, err := h.monitor.Master(args[1])
+		if err != nil {
+			return writer.WriteError(err.Error())
+		}
+		return writer.WriteValue(fieldsValue(fields))
+	case "replicas", "slaves":
+		replicas, err := h.monitor.Replicas(args[1])
+		return h.writeInstances(replicas, err, writer)
+	case "sentinels":
+		sentinels, err := h.monitor.Sentinels(args[1])
+		return h.writeInstances(sentinels, err, writer)
+	case "get-master-addr-by-name":
+		host, port, ok := h.monitor.MasterAddr(args[1])
+		if !ok {
+			return writer.WriteNullArray()
+		}
+		return writer.WriteArray([]string{host, strconv.Itoa(port)})
+	case "is-master-down-by-addr":
+		return h.isMasterDownByAddr(args[1:], writer)
+	case "failover":
+		if err := h.monitor.Failover(args[1]); err != nil {
+			return writer.WriteError(err.Error())
+		}
+		return writer.WriteSimpleString("OK")
+	case "monitor":
+		port, err := strconv.Atoi(args[3])
+		if err != nil {
+			return writer.WriteError("ERR Invalid port number")
+		}
+		quorum, err := strconv.Atoi(args[4])
+		if err != nil {
+			return writer.WriteError("ERR Invalid quorum")
+		}
+		if err := h.monitor.Monitor(args[1], args[2], port, quorum); err != nil {
+			return writer.WriteError(err.Error())
+		}
+		return writer.WriteSimpleString("OK")
+	case "remove":
+		if err := h.monitor.Remove(args[1]); err != nil {
+			return writer.WriteError(err.Error())
+		}
+		return writer.WriteSimpleString("OK")
+	case "set":
+		var options [][2]string
+		for i := 2; i < len(args); i += 2 {
+			options = append(options, [2]string{strings.ToLower(args[i]), args[i+1]})
+		}
+		if err := h.monitor.Set(args[1], options); err != nil {
+			return writer.WriteError(err.Error())
+		}
+		return writer.WriteSimpleString("OK")
+	case "ckquorum":
+		status, err := h.monitor.CheckQuorum(args[1])
+		if err != nil {
+			return writer.WriteError(err.Error())
+		}
+		return writer.WriteSimpleString(status)
+	case "myid":
+		return writer.WriteBulkString(h.monitor.MyID())
+	}
+	return writer.WriteError("ERR unknown subcommand '" + args[0] + "'. Try SENTINEL HELP.")
+}
+
+// isMasterDownByAddr answers another sentinel asking whether a master is down
+// and, unless the run ID is "*", for a vote: SENTINEL is-master-down-by-addr
+// <ip> <port> <current-epoch> <runid>
+func (h *SentinelHandler) isMasterDownByAddr(args []string, writer *resp.ResponseWriter) error {
+	port, err := strconv.Atoi(args[1])
+	if err != nil {
+		return writer.WriteError("ERR value is not an integer or out of range")
+	}
+	epoch, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		return writer.WriteError("ERR value is not an integer or out of range")
+	}
+
+	down, leader, leaderEpoch := h.monitor.IsMasterDownByAddr(args[0], port, epoch, args[3])
+	isDown := 0
+	if down {
+		isDown = 1
+	}
+	return writer.WriteValue(resp.RespValue{Type: resp.ArrayType, Value: []resp.RespValue{
+		{Type: resp.IntegerType, Value: isDown},
+		{Type: resp.BulkString, Value: leader},
+		{Type: resp.IntegerType, Value: int(leaderEpoch)},
+	}})
+}
+
+// writeInstances replies with the state of each instance as a map
+func (h *SentinelHandler) writeInstances(instances [][][2]string, err error, writer *resp.ResponseWriter) error {
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	items := make([]resp.RespValue, 0, len(instances))
+	for _, fields := range instances {
+		items = append(items, fieldsValue(fields))
+	}
+	return writer.WriteValue(resp.RespValue{Type: resp.ArrayType, Value: items})
+}
+
+// fieldsValue returns the state of an instance as a map, which RESP2 clients
+// receive as a flat array of names and values
+func fieldsValue(fields [][2]string) resp.RespValue {
+	items := make([]resp.RespValue, 0, 2*len(fields))
+	for _, field := range fields {
+		items = append(items,
+			resp.RespValue{Type: resp.BulkString, Value: field[0]},
+			resp.RespValue{Type: resp.BulkString, Value: field[1]},
+		)
+	}
+	return resp.RespValue{Type: resp.MapType, Value: items}
+}
+
+// RoleHandler handles ROLE commands
+type RoleHandler struct {
+	monitor Monitor
+}
+
+// NewRoleHandler creates a new ROLE handler
+func NewRoleHandler(monitor Monitor) *RoleHandler {
+	return &RoleHandler{monitor: monitor}
+}
+
+// Handle processes the ROLE command, listing the masters a sentinel monitors
+func (h *RoleHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	names := make([]resp.RespValue, 0)
+	for _, name := range h.monitor.MasterNames() {
+		names = append(names, resp.RespValue{Type: resp.BulkString, Value: name})
+	}
+	return writer.WriteValue(resp.RespValue{Type: resp.ArrayType, Value: []resp.RespValue{
+		{Type: resp.BulkString, Value: "sentinel"},
+		{Type: resp.ArrayType, Value: names},
+	}})
+}
+
+// InfoHandler handles INFO commands sent to a sentinel
+type InfoHandler struct {
+	config  ServerConfig
+	monitor Monitor
+}
+
+// NewInfoHandler creates a new INFO handler for a sentinel
+func NewInfoHandler(config ServerConfig, monitor Monitor) *InfoHandler {
+	return &InfoHandler{config: config, monitor: monitor}
+}
+
+// Handle processes the INFO command, reporting the server and the masters
+// monitored
+func (h *InfoHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	section := ""
+	if len(parts) > 1 {
+		if s, ok := parts[1].Value.(string); ok {
+			section = strings.ToLower(s)
+		}
+	}
+
+	var infoString string
+	if section != "sentinel" {
+		for key, value := range h.config.GetServerInfo() {
+			infoString += key + ":" + value + "\r\n"
+		}
+	}
+
+	switch section {
+	case "", "all", "default", "everything", "sentinel":
+		if infoString != "" {
+			infoString += "\r\n"
+		}
+		infoString += "# Sentinel\r\n"
+		for _, field := range h.monitor.SentinelInfo() {
+			infoString += field[0] + ":" + field[1] + "\r\n"
+		}
+	}
+
+	return writer.WriteBulkString(infoString)
+}
+
+// Common interfaces and types
+type Monitor interface {
+	MyID() string
+	MasterNames() []string
+	Masters() [][][2]string
+	Master(name string) ([][2]string, error)
+	Replicas(name string) ([][][2]string, error)
+	Sentinels(name string) ([][][2]string, error)
+	MasterAddr(name string) (string, int, bool)
+	IsMasterDownByAddr(host string, port int, epoch uint64, runID string) (bool, string, uint64)
+	Failover(name string) error
+	Monitor(name, host string, port, quorum int) error
+	Remove(name string) error
+	Set(name string, options [][2]string) error
+	CheckQuorum(name string) (string, error)
+	SentinelInfo() [][2]string
+}
+
+// ServerConfig interface for server configuration
+type ServerConfig interface {
+	GetServerInfo() map[string]string
+}
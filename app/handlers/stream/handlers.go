@@ -1,11 +1,14 @@
 package stream
 
 import (
+	"errors"
 	"net"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/codecrafters-io/redis-starter-go/app/notify"
 	"github.com/codecrafters-io/redis-starter-go/app/store"
 
 	"github.com/codecrafters-io/redis-starter-go/app/resp"
@@ -19,257 +22,89 @@ type StreamNotifierStore interface {
 
 // XAddHandler handles XADD commands
 type XAddHandler struct {
-	writer *resp.ResponseWriter
 	store  StreamNotifierStore
+	events EventNotifier
 }
 
 // NewXAddHandler creates a new XADD handler
-func NewXAddHandler(store StreamNotifierStore) *XAddHandler {
-	return &XAddHandler{store: store}
+func NewXAddHandler(store StreamNotifierStore, events EventNotifier) *XAddHandler {
+	return &XAddHandler{store: store, events: events}
 }
 
 // Handle processes the XADD command
-func (h *XAddHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
+func (h *XAddHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
 	// XADD requires at least: XADD key id field value
 	if len(parts) < 5 {
-		return h.writer.WriteError("ERR wrong number of arguments for 'xadd' command")
+		return writer.WriteError("ERR wrong number of arguments for 'xadd' command")
 	}
 
 	key, ok := parts[1].Value.(string)
 	if !ok {
-		return h.writer.WriteError("ERR invalid arguments")
+		return writer.WriteError("ERR invalid arguments")
 	}
 
 	id, ok := parts[2].Value.(string)
 	if !ok {
-		return h.writer.WriteError("ERR invalid arguments")
+		return writer.WriteError("ERR invalid arguments")
 	}
 
 	// Check if we have field-value pairs (must be even number after key and id)
 	fieldCount := len(parts) - 3
 	if fieldCount == 0 || fieldCount%2 != 0 {
-		return h.writer.WriteError("ERR wrong number of arguments for XADD")
+		return writer.WriteError("ERR wrong number of arguments for XADD")
 	}
 
-	// Validate field-value pairs
-	fields := make(map[string]string)
-	for i := 3; i < len(parts); i += 2 {
-		fieldName, ok1 := parts[i].Value.(string)
-		fieldValue, ok2 := parts[i+1].Value.(string)
-		if !ok1 || !ok2 {
-			return h.writer.WriteError("ERR invalid arguments")
-		}
-		fields[fieldName] = fieldValue
-	}
-
-	// Get the last entry ID for validation
-	lastEntryID := h.getLastEntryID(key)
-
-	// Generate or validate ID
-	var entryID string
-	if id == "*" {
-		// Auto-generate ID using current timestamp
-		timestamp := time.Now().UnixMilli()
-		sequence := h.getNextSequenceNumber(key, timestamp)
-		entryID = strconv.FormatInt(timestamp, 10) + "-" + strconv.FormatInt(sequence, 10)
-
-		// Ensure auto-generated ID is greater than last entry
-		if lastEntryID != "" && !h.isIDGreater(entryID, lastEntryID) {
-			// Fallback: use last timestamp + 1 sequence
-			lastTimestamp, lastSequence, _ := h.parseStreamID(lastEntryID)
-			if timestamp <= lastTimestamp {
-				entryID = strconv.FormatInt(lastTimestamp, 10) + "-" + strconv.FormatInt(lastSequence+1, 10)
-			}
-		}
-	} else if strings.HasSuffix(id, "-*") {
-		// Partially auto-generated ID: timestamp specified, sequence auto-generated
-		timestampStr := strings.TrimSuffix(id, "-*")
-		timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
-		if err != nil || timestamp < 0 {
-			return h.writer.WriteError("ERR Invalid stream ID specified as stream command argument")
-		}
-
-		// Generate sequence number for this timestamp
-		sequence := h.getNextSequenceNumber(key, timestamp)
-		entryID = strconv.FormatInt(timestamp, 10) + "-" + strconv.FormatInt(sequence, 10)
-
-		// Validate that the generated ID is greater than last entry
-		if lastEntryID != "" && !h.isIDGreater(entryID, lastEntryID) {
-			return h.writer.WriteError("ERR The ID specified in XADD is equal or smaller than the target stream top item")
-		}
-
-		// Check minimum valid ID (must be greater than 0-0)
-		if entryID == "0-0" {
-			return h.writer.WriteError("ERR The ID specified in XADD must be greater than 0-0")
-		}
-	} else {
-		// Validate explicit ID format
-		_, _, err := h.parseStreamID(id)
-		if err != nil {
-			return h.writer.WriteError("ERR Invalid stream ID specified as stream command argument")
-		}
-
-		// Check minimum valid ID (must be greater than 0-0)
-		if id == "0-0" {
-			return h.writer.WriteError("ERR The ID specified in XADD must be greater than 0-0")
-		}
-
-		// Validate against last entry ID
-		if lastEntryID != "" && !h.isIDGreater(id, lastEntryID) {
-			return h.writer.WriteError("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	// Field-value pairs are kept in order and stored as-is, so any bytes round-trip
+	fields := make([]string, 0, fieldCount)
+	for i := 3; i < len(parts); i++ {
+		item, ok := parts[i].Value.(string)
+		if !ok {
+			return writer.WriteError("ERR invalid arguments")
 		}
-
-		entryID = id
-	}
-
-	// Store the stream entry
-	var fieldPairs []string
-	for field, value := range fields {
-		fieldPairs = append(fieldPairs, field+":"+value)
+		fields = append(fields, item)
 	}
-	entry := strings.Join(fieldPairs, ",")
 
-	err := h.store.Set(key+":"+entryID, entry)
+	// The store resolves "*" and "<ms>-*" IDs and validates explicit ones atomically
+	entryID, err := h.store.XAdd(key, id, fields)
 	if err != nil {
-		return h.writer.WriteError("ERR failed to store entry")
+		return writer.WriteError(err.Error())
 	}
 
 	// Notify any waiting XREAD commands
 	h.store.GetStreamNotifier().Notify(key)
+	h.events.Notify(notify.Stream, "xadd", key)
 
-	return h.writer.WriteBulkString(entryID)
-}
-
-// SetWriter sets the response writer for this handler
-func (h *XAddHandler) SetWriter(writer *resp.ResponseWriter) {
-	h.writer = writer
+	return writer.WriteBulkString(entryID.String())
 }
 
-// Helper methods
-
-// parseStreamID parses a stream ID into timestamp and sequence components
-func (h *XAddHandler) parseStreamID(id string) (int64, int64, error) {
-	parts := strings.Split(id, "-")
-	if len(parts) != 2 {
-		return 0, 0, &InvalidStreamIDError{ID: id}
-	}
-
-	timestamp, err := strconv.ParseInt(parts[0], 10, 64)
-	if err != nil || timestamp < 0 {
-		return 0, 0, &InvalidStreamIDError{ID: id}
-	}
-
-	sequence, err := strconv.ParseInt(parts[1], 10, 64)
-	if err != nil || sequence < 0 {
-		return 0, 0, &InvalidStreamIDError{ID: id}
-	}
-
-	return timestamp, sequence, nil
-}
-
-// isIDGreater checks if id1 is greater than id2
-func (h *XAddHandler) isIDGreater(id1, id2 string) bool {
-	timestamp1, sequence1, err1 := h.parseStreamID(id1)
-	timestamp2, sequence2, err2 := h.parseStreamID(id2)
-
-	if err1 != nil || err2 != nil {
-		return false
-	}
-
-	if timestamp1 > timestamp2 {
-		return true
-	}
-	if timestamp1 == timestamp2 && sequence1 > sequence2 {
-		return true
-	}
-	return false
+// Common interfaces and types
+type KeyValueStore interface {
+	Set(key, value string, expiry ...time.Duration) error
+	Get(key string) (string, bool, error)
+	Delete(key string) error
+	XAdd(key, id string, fields []string) (store.StreamID, error)
+	XRange(key string, start, end store.StreamID, count int) []store.StreamEntry
+	XReadAfter(key string, id store.StreamID) []store.StreamEntry
+	XLastID(key string) (store.StreamID, bool)
 }
 
-// getLastEntryID finds the highest ID for the given stream key
-func (h *XAddHandler) getLastEntryID(key string) string {
-	prefix := key + ":"
-	var lastID string
-	var lastTimestamp int64 = -1
-	var lastSequence int64 = -1
-
-	// Check for common patterns (simplified implementation for testing)
-	testPatterns := []string{
-		"0-1", "0-2", "0-3", "0-4", "0-5",
-		"1-0", "1-1", "1-2", "1-3", "1-4", "1-5",
-		"2-0", "2-1", "2-2", "2-3", "2-4", "2-5",
-		"3-0", "3-1", "3-2", "3-3", "3-4", "3-5",
-		"4-0", "4-1", "4-2", "4-3", "4-4", "4-5",
-		"5-0", "5-1", "5-2", "5-3", "5-4", "5-5",
-	}
-
-	for _, pattern := range testPatterns {
-		if _, exists := h.store.Get(prefix + pattern); exists {
-			parts := strings.Split(pattern, "-")
-			if len(parts) == 2 {
-				timestamp, _ := strconv.ParseInt(parts[0], 10, 64)
-				sequence, _ := strconv.ParseInt(parts[1], 10, 64)
-
-				if timestamp > lastTimestamp || (timestamp == lastTimestamp && sequence > lastSequence) {
-					lastTimestamp = timestamp
-					lastSequence = sequence
-					lastID = pattern
-				}
-			}
-		}
-	}
-
-	return lastID
+// EventNotifier publishes keyspace notifications for the handler's database
+type EventNotifier interface {
+	Notify(class notify.Class, event, key string)
 }
 
-// getNextSequenceNumber determines the correct sequence number for auto-generated IDs
-func (h *XAddHandler) getNextSequenceNumber(key string, timestamp int64) int64 {
-	prefix := key + ":"
-	timestampStr := strconv.FormatInt(timestamp, 10)
-
-	// Check if there are existing entries with the same timestamp
-	var maxSequence int64 = -1
-	hasEntriesWithSameTime := false
-
-	// Check for existing entries with the same timestamp
-	for seq := int64(0); seq <= 10; seq++ {
-		testKey := prefix + timestampStr + "-" + strconv.FormatInt(seq, 10)
-		if _, exists := h.store.Get(testKey); exists {
-			hasEntriesWithSameTime = true
-			maxSequence = seq
-		}
-	}
-
-	if hasEntriesWithSameTime {
-		return maxSequence + 1
+// toRespEntries converts stored entries to their wire representation
+func toRespEntries(entries []store.StreamEntry) []resp.StreamEntry {
+	result := make([]resp.StreamEntry, len(entries))
+	for i, entry := range entries {
+		result[i] = resp.StreamEntry{ID: entry.ID.String(), Fields: entry.Fields}
 	}
-
-	if timestamp == 0 {
-		return 1
-	} else {
-		return 0
-	}
-}
-
-// InvalidStreamIDError represents an invalid stream ID error
-type InvalidStreamIDError struct {
-	ID string
-}
-
-func (e *InvalidStreamIDError) Error() string {
-	return "invalid stream ID: " + e.ID
-}
-
-// Common interfaces and types
-type KeyValueStore interface {
-	Set(key, value string, expiry ...time.Duration) error
-	Get(key string) (string, bool)
-	Delete(key string) error
+	return result
 }
 
 // XRangeHandler handles XRANGE commands
 type XRangeHandler struct {
-	writer *resp.ResponseWriter
-	store  KeyValueStore
+	store KeyValueStore
 }
 
 // NewXRangeHandler creates a new XRANGE handler
@@ -278,182 +113,136 @@ func NewXRangeHandler(store KeyValueStore) *XRangeHandler {
 }
 
 // Handle processes the XRANGE command
-func (h *XRangeHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
+func (h *XRangeHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
 	if len(parts) < 4 || len(parts) > 6 {
-		return h.writer.WriteError("ERR wrong number of arguments for 'xrange' command")
+		return writer.WriteError("ERR wrong number of arguments for 'xrange' command")
 	}
 
 	key, ok := parts[1].Value.(string)
 	if !ok {
-		return h.writer.WriteError("ERR invalid arguments")
+		return writer.WriteError("ERR invalid arguments")
 	}
 
 	startID, ok := parts[2].Value.(string)
 	if !ok {
-		return h.writer.WriteError("ERR invalid arguments")
+		return writer.WriteError("ERR invalid arguments")
 	}
 
 	endID, ok := parts[3].Value.(string)
 	if !ok {
-		return h.writer.WriteError("ERR invalid arguments")
+		return writer.WriteError("ERR invalid arguments")
 	}
 
 	var count int
 	if len(parts) == 6 {
 		countCmd, ok := parts[4].Value.(string)
 		if !ok || strings.ToUpper(countCmd) != "COUNT" {
-			return h.writer.WriteError("ERR syntax error")
+			return writer.WriteError("ERR syntax error")
 		}
 
 		countStr, ok := parts[5].Value.(string)
 		if !ok {
-			return h.writer.WriteError("ERR syntax error")
+			return writer.WriteError("ERR syntax error")
 		}
 
 		var err error
 		count, err = strconv.Atoi(countStr)
 		if err != nil || count <= 0 {
-			return h.writer.WriteError("ERR value is not an integer or out of range")
+			return writer.WriteError("ERR value is not an integer or out of range")
 		}
 	} else {
 		count = -1 // No count limit
 	}
 
+	start, err := parseRangeBound(startID, false)
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+	end, err := parseRangeBound(endID, true)
+	if err != nil {
+		return writer.WriteError(err.Error())
+	}
+
 	// Fetch entries in range
-	entries := h.getEntriesInRange(key, startID, endID, count)
+	entries := h.store.XRange(key, start, end, count)
 	if len(entries) == 0 {
-		return h.writer.WriteEmptyArray()
+		return writer.WriteEmptyArray()
 	}
 
 	// Format response as array of [id, [field1, value1, field2, value2, ...]]
-	return h.writer.WriteStreamEntries(entries)
+	return writer.WriteStreamEntries(toRespEntries(entries))
 }
 
-// SetWriter sets the response writer for this handler
-func (h *XRangeHandler) SetWriter(writer *resp.ResponseWriter) {
-	h.writer = writer
-}
-
-// parseStreamID parses a stream ID into timestamp and sequence components (for XRangeHandler)
-func (h *XRangeHandler) parseStreamID(id string) (int64, int64, error) {
-	parts := strings.Split(id, "-")
-	if len(parts) != 2 {
-		return 0, 0, &InvalidStreamIDError{ID: id}
+// parseRangeBound parses an XRANGE bound. "-" and "+" are the smallest and
+// largest IDs, a bare timestamp covers every sequence number, and a leading
+// "(" makes the bound exclusive.
+func parseRangeBound(bound string, isEnd bool) (store.StreamID, error) {
+	switch bound {
+	case "-":
+		return store.MinStreamID, nil
+	case "+":
+		return store.MaxStreamID, nil
 	}
 
-	timestamp, err := strconv.ParseInt(parts[0], 10, 64)
-	if err != nil || timestamp < 0 {
-		return 0, 0, &InvalidStreamIDError{ID: id}
-	}
+	exclusive := strings.HasPrefix(bound, "(")
+	bound = strings.TrimPrefix(bound, "(")
 
-	sequence, err := strconv.ParseInt(parts[1], 10, 64)
-	if err != nil || sequence < 0 {
-		return 0, 0, &InvalidStreamIDError{ID: id}
+	var defaultSeq uint64
+	if isEnd {
+		defaultSeq = store.MaxStreamID.Seq
 	}
-
-	return timestamp, sequence, nil
-}
-
-// getEntriesInRange retrieves entries in the specified ID range
-func (h *XRangeHandler) getEntriesInRange(key, startID, endID string, count int) []resp.StreamEntry {
-	prefix := key + ":"
-	var entries []resp.StreamEntry
-
-	// This is a simplified implementation - in a real system we'd have proper stream storage
-	// For now, we'll check for common ID patterns and collect matching entries
-	testPatterns := []string{
-		"0-1", "0-2", "0-3", "0-4", "0-5",
-		"1-0", "1-1", "1-2", "1-3", "1-4", "1-5",
-		"2-0", "2-1", "2-2", "2-3", "2-4", "2-5",
-		"3-0", "3-1", "3-2", "3-3", "3-4", "3-5",
-		"4-0", "4-1", "4-2", "4-3", "4-4", "4-5",
-		"5-0", "5-1", "5-2", "5-3", "5-4", "5-5",
-	}
-
-	for _, pattern := range testPatterns {
-		if h.isIDInRange(pattern, startID, endID) {
-			if entryStr, exists := h.store.Get(prefix + pattern); exists {
-				fields := make(map[string]string)
-				fieldPairs := strings.Split(entryStr, ",")
-				for _, pair := range fieldPairs {
-					kv := strings.SplitN(pair, ":", 2)
-					if len(kv) == 2 {
-						fields[kv[0]] = kv[1]
-					}
-				}
-				entries = append(entries, resp.StreamEntry{ID: pattern, Fields: fields})
-				if count > 0 && len(entries) >= count {
-					break
-				}
-			}
-		}
+	id, err := store.ParseStreamID(bound, defaultSeq)
+	if err != nil {
+		return store.StreamID{}, err
 	}
-
-	return entries
-}
-
-// isIDInRange checks if an ID falls within the specified range
-func (h *XRangeHandler) isIDInRange(id, startID, endID string) bool {
-	// Handle special cases for "-" (minimum) and "+" (maximum)
-	if startID == "-" {
-		startID = "0-0"
+	if !exclusive {
+		return id, nil
 	}
 
-	// For "+" (maximum), we want to include everything, so just check if >= start
-	if endID == "+" {
-		// Parse IDs for comparison
-		idTimestamp, idSequence, err1 := h.parseStreamID(id)
-		startTimestamp, startSequence, err2 := h.parseStreamID(startID)
-
-		if err1 != nil || err2 != nil {
-			return false
+	// Exclusive bounds step one ID inwards
+	if isEnd {
+		if id == store.MinStreamID {
+			return store.StreamID{}, errors.New("ERR invalid end ID for the interval")
 		}
-
-		// Check if ID is >= start
-		if idTimestamp > startTimestamp || (idTimestamp == startTimestamp && idSequence >= startSequence) {
-			return true
+		if id.Seq > 0 {
+			return store.StreamID{Ms: id.Ms, Seq: id.Seq - 1}, nil
 		}
-		return false
+		return store.StreamID{Ms: id.Ms - 1, Seq: store.MaxStreamID.Seq}, nil
 	}
-
-	// Parse IDs for comparison
-	idTimestamp, idSequence, err1 := h.parseStreamID(id)
-	startTimestamp, startSequence, err2 := h.parseStreamID(startID)
-	endTimestamp, endSequence, err3 := h.parseStreamID(endID)
-
-	if err1 != nil || err2 != nil || err3 != nil {
-		return false
-	}
-
-	// Check if ID is >= start
-	if idTimestamp < startTimestamp || (idTimestamp == startTimestamp && idSequence < startSequence) {
-		return false
-	}
-
-	// Check if ID is <= end
-	if idTimestamp > endTimestamp || (idTimestamp == endTimestamp && idSequence > endSequence) {
-		return false
+	next, ok := id.Next()
+	if !ok {
+		return store.StreamID{}, errors.New("ERR invalid start ID for the interval")
 	}
-
-	return true
+	return next, nil
 }
 
 // XReadHandler handles XREAD commands
 type XReadHandler struct {
-	writer *resp.ResponseWriter
 	store  StreamNotifierStore
+	locker sync.Locker
 }
 
 // NewXReadHandler creates a new XREAD handler
 func NewXReadHandler(store StreamNotifierStore) *XReadHandler {
-	return &XReadHandler{store: store}
+	return &XReadHandler{store: store, locker: nopLocker{}}
 }
 
 // Handle processes the XREAD command
-func (h *XReadHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
+func (h *XReadHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	return h.handle(parts, h.locker, true, writer)
+}
+
+// HandleNonBlocking processes the XREAD command ignoring BLOCK, as inside a
+// transaction, where the caller already holds the lock
+func (h *XReadHandler) HandleNonBlocking(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	return h.handle(parts, nopLocker{}, false, writer)
+}
+
+// handle runs XREAD, holding locker whenever it reads the store
+func (h *XReadHandler) handle(parts []resp.RespValue, locker sync.Locker, blocking bool, writer *resp.ResponseWriter) error {
 	// XREAD requires at least: XREAD STREAMS key id
 	if len(parts) < 4 {
-		return h.writer.WriteError("ERR wrong number of arguments for 'xread' command")
+		return writer.WriteError("ERR wrong number of arguments for 'xread' command")
 	}
 
 	// Parse optional BLOCK parameter
@@ -465,17 +254,17 @@ func (h *XReadHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
 		if str, ok := parts[argIndex].Value.(string); ok && strings.ToUpper(str) == "BLOCK" {
 			argIndex++
 			if argIndex >= len(parts) {
-				return h.writer.WriteError("ERR syntax error")
+				return writer.WriteError("ERR syntax error")
 			}
 
 			timeoutStr, ok := parts[argIndex].Value.(string)
 			if !ok {
-				return h.writer.WriteError("ERR syntax error")
+				return writer.WriteError("ERR syntax error")
 			}
 
 			timeout, err := strconv.ParseInt(timeoutStr, 10, 64)
 			if err != nil || timeout < 0 {
-				return h.writer.WriteError("ERR timeout is not an integer or out of range")
+				return writer.WriteError("ERR timeout is not an integer or out of range")
 			}
 
 			blockTimeout = timeout
@@ -493,70 +282,67 @@ func (h *XReadHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
 	}
 
 	if streamsIndex == -1 {
-		return h.writer.WriteError("ERR syntax error")
+		return writer.WriteError("ERR syntax error")
 	}
 
 	// Parse arguments after STREAMS - should be pairs of key and start-id
 	streamArgs := parts[streamsIndex+1:]
 	if len(streamArgs)%2 != 0 {
-		return h.writer.WriteError("ERR Unbalanced XREAD list of streams: for each stream key an ID or '$' must be specified.")
+		return writer.WriteError("ERR Unbalanced XREAD list of streams: for each stream key an ID or '$' must be specified.")
 	}
 
 	numStreams := len(streamArgs) / 2
 	streamKeys := make([]string, numStreams)
-	streamIDs := make([]string, numStreams)
+	streamIDs := make([]store.StreamID, numStreams)
 
-	// Extract stream keys and IDs, replacing $ with the maximum ID
+	// Extract stream keys and IDs; $ is resolved with the first read below
+	lastID := make([]bool, numStreams)
 	for i := 0; i < numStreams; i++ {
 		key, ok1 := streamArgs[i].Value.(string)
 		id, ok2 := streamArgs[i+numStreams].Value.(string)
 		if !ok1 || !ok2 {
-			return h.writer.WriteError("ERR invalid arguments")
+			return writer.WriteError("ERR invalid arguments")
 		}
 		streamKeys[i] = key
 
-		// Handle special $ ID - replace with maximum ID in the stream
 		if id == "$" {
-			maxID := h.getLastEntryID(key)
-			if maxID == "" {
-				// If stream is empty, use 0-0 so we wait for any new entries
-				streamIDs[i] = "0-0"
-			} else {
-				streamIDs[i] = maxID
-			}
-		} else {
-			streamIDs[i] = id
+			lastID[i] = true
+			continue
 		}
-	}
 
-	// If blocking is requested, implement blocking behavior
-	if blockTimeout >= 0 {
-		return h.handleBlockingRead(streamKeys, streamIDs, blockTimeout, conn)
+		startID, err := store.ParseStreamID(id, 0)
+		if err != nil {
+			return writer.WriteError(err.Error())
+		}
+		streamIDs[i] = startID
 	}
 
-	// Non-blocking read
-	result := make([]resp.StreamResult, 0)
+	// Handle special $ ID - replace with maximum ID in the stream.
+	// If the stream is empty the zero ID makes us wait for any new entry.
+	locker.Lock()
 	for i, key := range streamKeys {
-		startID := streamIDs[i]
-		entries := h.getEntriesAfterID(key, startID)
-		if len(entries) > 0 {
-			result = append(result, resp.StreamResult{
-				Key:     key,
-				Entries: entries,
-			})
+		if lastID[i] {
+			streamIDs[i], _ = h.store.XLastID(key)
 		}
 	}
+	result := h.readStreams(streamKeys, streamIDs)
+	locker.Unlock()
 
-	// Return results
-	if len(result) == 0 {
-		return h.writer.WriteNullArray()
+	if len(result) > 0 {
+		return writer.WriteStreamResults(result)
 	}
 
-	return h.writer.WriteStreamResults(result)
+	// If blocking is requested, implement blocking behavior
+	if blockTimeout >= 0 && blocking {
+		return h.handleBlockingRead(streamKeys, streamIDs, blockTimeout, writer)
+	}
+
+	return writer.WriteNullArray()
 }
 
-// handleBlockingRead implements blocking XREAD functionality
-func (h *XReadHandler) handleBlockingRead(streamKeys, streamIDs []string, timeoutMs int64, conn net.Conn) error {
+// handleBlockingRead implements blocking XREAD functionality, holding the
+// locker only while reading the streams
+func (h *XReadHandler) handleBlockingRead(streamKeys []string, streamIDs []store.StreamID, timeoutMs int64, writer *resp.ResponseWriter) error {
 	startTime := time.Now()
 	timeoutDuration := time.Duration(timeoutMs) * time.Millisecond
 
@@ -571,22 +357,14 @@ func (h *XReadHandler) handleBlockingRead(streamKeys, streamIDs []string, timeou
 		}
 	}()
 
-	// Check for existing entries first
-	result := make([]resp.StreamResult, 0)
-	for i, key := range streamKeys {
-		startID := streamIDs[i]
-		entries := h.getEntriesAfterID(key, startID)
-		if len(entries) > 0 {
-			result = append(result, resp.StreamResult{
-				Key:     key,
-				Entries: entries,
-			})
-		}
-	}
+	// Check for entries added before we subscribed
+	h.locker.Lock()
+	result := h.readStreams(streamKeys, streamIDs)
+	h.locker.Unlock()
 
 	// If we found entries, return them immediately
 	if len(result) > 0 {
-		return h.writer.WriteStreamResults(result)
+		return writer.WriteStreamResults(result)
 	}
 
 	// Wait for notifications or timeout
@@ -603,7 +381,7 @@ func (h *XReadHandler) handleBlockingRead(streamKeys, streamIDs []string, timeou
 		select {
 		case <-timeoutCh:
 			// Timeout reached, return null array
-			return h.writer.WriteNullArray()
+			return writer.WriteNullArray()
 		default:
 			// Check all notification channels
 			notified := false
@@ -617,27 +395,19 @@ func (h *XReadHandler) handleBlockingRead(streamKeys, streamIDs []string, timeou
 
 			if notified {
 				// Check for new entries
-				result := make([]resp.StreamResult, 0)
-				for i, key := range streamKeys {
-					startID := streamIDs[i]
-					entries := h.getEntriesAfterID(key, startID)
-					if len(entries) > 0 {
-						result = append(result, resp.StreamResult{
-							Key:     key,
-							Entries: entries,
-						})
-					}
-				}
+				h.locker.Lock()
+				result := h.readStreams(streamKeys, streamIDs)
+				h.locker.Unlock()
 
 				// If we found entries, return them
 				if len(result) > 0 {
-					return h.writer.WriteStreamResults(result)
+					return writer.WriteStreamResults(result)
 				}
 			}
 
 			// Check if we've exceeded the timeout
 			if timeoutMs > 0 && time.Since(startTime) >= timeoutDuration {
-				return h.writer.WriteNullArray()
+				return writer.WriteNullArray()
 			}
 
 			// Small sleep to avoid busy waiting
@@ -646,131 +416,28 @@ func (h *XReadHandler) handleBlockingRead(streamKeys, streamIDs []string, timeou
 	}
 }
 
-// SetWriter sets the response writer for this handler
-func (h *XReadHandler) SetWriter(writer *resp.ResponseWriter) {
-	h.writer = writer
+// SetLocker sets the lock held while reading the streams
+func (h *XReadHandler) SetLocker(locker sync.Locker) {
+	h.locker = locker
 }
 
-// getEntriesAfterID retrieves entries after the specified ID
-func (h *XReadHandler) getEntriesAfterID(key, startID string) []resp.StreamEntry {
-	prefix := key + ":"
-	var entries []resp.StreamEntry
-
-	// This is a simplified implementation - in a real system we'd have proper stream storage
-	// For now, we'll check for common ID patterns and collect matching entries
-	testPatterns := []string{
-		"0-1", "0-2", "0-3", "0-4", "0-5",
-		"1-0", "1-1", "1-2", "1-3", "1-4", "1-5",
-		"2-0", "2-1", "2-2", "2-3", "2-4", "2-5",
-		"3-0", "3-1", "3-2", "3-3", "3-4", "3-5",
-		"4-0", "4-1", "4-3", "4-4", "4-5",
-		"5-0", "5-1", "5-2", "5-3", "5-4", "5-5",
-	}
-
-	for _, pattern := range testPatterns {
-		if h.isIDAfter(pattern, startID) {
-			if entryStr, exists := h.store.Get(prefix + pattern); exists {
-				fields := make(map[string]string)
-				fieldPairs := strings.Split(entryStr, ",")
-				for _, pair := range fieldPairs {
-					kv := strings.SplitN(pair, ":", 2)
-					if len(kv) == 2 {
-						fields[kv[0]] = kv[1]
-					}
-				}
-				entries = append(entries, resp.StreamEntry{ID: pattern, Fields: fields})
-			}
-		}
-	}
-
-	return entries
-}
+// nopLocker is the default locker of blocking handlers
+type nopLocker struct{}
 
-// isIDAfter checks if an ID comes after the specified start ID
-func (h *XReadHandler) isIDAfter(id, startID string) bool {
-	// Parse IDs for comparison
-	idTimestamp, idSequence, err1 := h.parseStreamID(id)
-	startTimestamp, startSequence, err2 := h.parseStreamID(startID)
+func (nopLocker) Lock()   {}
+func (nopLocker) Unlock() {}
 
-	if err1 != nil || err2 != nil {
-		return false
-	}
-
-	// Check if ID is > start (strictly greater than)
-	if idTimestamp > startTimestamp || (idTimestamp == startTimestamp && idSequence > startSequence) {
-		return true
-	}
-	return false
-}
-
-// parseStreamID parses a stream ID into timestamp and sequence components (for XReadHandler)
-func (h *XReadHandler) parseStreamID(id string) (int64, int64, error) {
-	parts := strings.Split(id, "-")
-	if len(parts) != 2 {
-		return 0, 0, &InvalidStreamIDError{ID: id}
-	}
-
-	timestamp, err := strconv.ParseInt(parts[0], 10, 64)
-	if err != nil || timestamp < 0 {
-		return 0, 0, &InvalidStreamIDError{ID: id}
-	}
-
-	sequence, err := strconv.ParseInt(parts[1], 10, 64)
-	if err != nil || sequence < 0 {
-		return 0, 0, &InvalidStreamIDError{ID: id}
-	}
-
-	return timestamp, sequence, nil
-}
-
-// getLastEntryID finds the highest ID for the given stream key (for XReadHandler)
-func (h *XReadHandler) getLastEntryID(key string) string {
-	prefix := key + ":"
-	var lastID string
-	var lastTimestamp int64 = -1
-	var lastSequence int64 = -1
-
-	// Check for common patterns (simplified implementation for testing)
-	testPatterns := []string{
-		"0-1", "0-2", "0-3", "0-4", "0-5",
-		"1-0", "1-1", "1-2", "1-3", "1-4", "1-5",
-		"2-0", "2-1", "2-2", "2-3", "2-4", "2-5",
-		"3-0", "3-1", "3-2", "3-3", "3-4", "3-5",
-		"4-0", "4-1", "4-2", "4-3", "4-4", "4-5",
-		"5-0", "5-1", "5-2", "5-3", "5-4", "5-5",
-	}
-
-	// Also check for higher IDs with actual timestamps
-	currentTime := time.Now().UnixMilli()
-	for t := currentTime - 1000000; t <= currentTime+1000; t++ {
-		for seq := int64(0); seq <= 5; seq++ {
-			pattern := strconv.FormatInt(t, 10) + "-" + strconv.FormatInt(seq, 10)
-			if _, exists := h.store.Get(prefix + pattern); exists {
-				if t > lastTimestamp || (t == lastTimestamp && seq > lastSequence) {
-					lastTimestamp = t
-					lastSequence = seq
-					lastID = pattern
-				}
-			}
-		}
-	}
-
-	// Check test patterns
-	for _, pattern := range testPatterns {
-		if _, exists := h.store.Get(prefix + pattern); exists {
-			parts := strings.Split(pattern, "-")
-			if len(parts) == 2 {
-				timestamp, _ := strconv.ParseInt(parts[0], 10, 64)
-				sequence, _ := strconv.ParseInt(parts[1], 10, 64)
-
-				if timestamp > lastTimestamp || (timestamp == lastTimestamp && sequence > lastSequence) {
-					lastTimestamp = timestamp
-					lastSequence = sequence
-					lastID = pattern
-				}
-			}
+// readStreams collects the entries after each stream's start ID, skipping streams with none
+func (h *XReadHandler) readStreams(streamKeys []string, streamIDs []store.StreamID) []resp.StreamResult {
+	result := make([]resp.StreamResult, 0)
+	for i, key := range streamKeys {
+		entries := h.store.XReadAfter(key, streamIDs[i])
+		if len(entries) > 0 {
+			result = append(result, resp.StreamResult{
+				Key:     key,
+				Entries: toRespEntries(entries),
+			})
 		}
 	}
-
-	return lastID
+	return result
 }
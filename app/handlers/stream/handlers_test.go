@@ -0,0 +1,93 @@
+package stream
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/notify"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/store"
+)
+
+// handler is the part of a command handler the tests drive
+type handler interface {
+	Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error
+}
+
+// run sends args to h and returns its reply
+func run(t *testing.T, h handler, args ...string) resp.RespValue {
+	t.Helper()
+	parts := make([]resp.RespValue, len(args))
+	for i, arg := range args {
+		parts[i] = resp.RespValue{Type: resp.BulkString, Value: arg}
+	}
+	writer, conn := resp.NewCapturingWriter()
+	if err := h.Handle(parts, conn, writer); err != nil {
+		t.Fatal(err)
+	}
+	return conn.GetCapturedResponse()
+}
+
+// binaryFields holds field names and values made of the bytes that delimit
+// protocol lines and the old "field:value,field:value" encoding
+var binaryFields = []string{
+	"a:b", "c,d",
+	"line\r\nbreak", "nul\x00byte",
+	"", "\r\n",
+	":,:", "\x00\xff\x80",
+}
+
+// entryFields returns the ID and the fields of an entry of an XRANGE or
+// XREAD reply
+func entryFields(t *testing.T, entry resp.RespValue) (string, []string) {
+	t.Helper()
+	items, ok := entry.Value.([]resp.RespValue)
+	if !ok || len(items) != 2 {
+		t.Fatalf("entry = %#v", entry)
+	}
+	id, _ := items[0].Value.(string)
+	values, _ := items[1].Value.([]resp.RespValue)
+	fields := make([]string, len(values))
+	for i, value := range values {
+		fields[i], _ = value.Value.(string)
+	}
+	return id, fields
+}
+
+func TestBinaryFieldsRoundTrip(t *testing.T) {
+	db := store.NewDatabase()
+	events := notify.NewNotifier(nil).ForDatabase(0)
+
+	args := append([]string{"XADD", "s", "1-1"}, binaryFields...)
+	if got := run(t, NewXAddHandler(db, events), args...); got.Value != "1-1" {
+		t.Fatalf("XADD = %#v, want 1-1", got)
+	}
+
+	got := run(t, NewXRangeHandler(db), "XRANGE", "s", "-", "+")
+	entries, _ := got.Value.([]resp.RespValue)
+	if len(entries) != 1 {
+		t.Fatalf("XRANGE = %#v, want one entry", got)
+	}
+	id, fields := entryFields(t, entries[0])
+	if id != "1-1" || !reflect.DeepEqual(fields, binaryFields) {
+		t.Errorf("XRANGE entry = %s %q, want 1-1 %q", id, fields, binaryFields)
+	}
+
+	got = run(t, NewXReadHandler(db), "XREAD", "STREAMS", "s", "0")
+	streams, _ := got.Value.([]resp.RespValue)
+	if len(streams) != 1 {
+		t.Fatalf("XREAD = %#v, want one stream", got)
+	}
+	stream, _ := streams[0].Value.([]resp.RespValue)
+	if len(stream) != 2 {
+		t.Fatalf("XREAD stream = %#v", streams[0])
+	}
+	read, _ := stream[1].Value.([]resp.RespValue)
+	if len(read) != 1 {
+		t.Fatalf("XREAD entries = %#v, want one", stream[1])
+	}
+	if _, fields := entryFields(t, read[0]); !reflect.DeepEqual(fields, binaryFields) {
+		t.Errorf("XREAD fields = %q, want %q", fields, binaryFields)
+	}
+}
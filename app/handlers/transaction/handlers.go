@@ -6,9 +6,7 @@ import (
 )
 
 // MultiHandler handles MULTI commands
-type MultiHandler struct {
-	writer *resp.ResponseWriter
-}
+type MultiHandler struct{}
 
 // NewMultiHandler creates a new MULTI handler
 func NewMultiHandler() *MultiHandler {
@@ -16,22 +14,15 @@ func NewMultiHandler() *MultiHandler {
 }
 
 // Handle processes the MULTI command
-func (h *MultiHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
+func (h *MultiHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
 	if len(parts) != 1 {
-		return h.writer.WriteError("ERR wrong number of arguments for 'multi' command")
+		return writer.WriteError("ERR wrong number of arguments for 'multi' command")
 	}
-	return h.writer.WriteSimpleString("OK")
-}
-
-// SetWriter sets the response writer for this handler
-func (h *MultiHandler) SetWriter(writer *resp.ResponseWriter) {
-	h.writer = writer
+	return writer.WriteSimpleString("OK")
 }
 
 // ExecHandler handles EXEC commands
-type ExecHandler struct {
-	writer *resp.ResponseWriter
-}
+type ExecHandler struct{}
 
 // NewExecHandler creates a new EXEC handler
 func NewExecHandler() *ExecHandler {
@@ -39,23 +30,16 @@ func NewExecHandler() *ExecHandler {
 }
 
 // Handle processes the EXEC command (actual logic is in command processor)
-func (h *ExecHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
+func (h *ExecHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
 	if len(parts) != 1 {
-		return h.writer.WriteError("ERR wrong number of arguments for 'exec' command")
+		return writer.WriteError("ERR wrong number of arguments for 'exec' command")
 	}
 	// This should not be reached as EXEC is handled specially in the processor
-	return h.writer.WriteError("ERR EXEC without MULTI")
-}
-
-// SetWriter sets the response writer for this handler
-func (h *ExecHandler) SetWriter(writer *resp.ResponseWriter) {
-	h.writer = writer
+	return writer.WriteError("ERR EXEC without MULTI")
 }
 
 // DiscardHandler handles DISCARD commands
-type DiscardHandler struct {
-	writer *resp.ResponseWriter
-}
+type DiscardHandler struct{}
 
 // NewDiscardHandler creates a new DISCARD handler
 func NewDiscardHandler() *DiscardHandler {
@@ -63,15 +47,44 @@ func NewDiscardHandler() *DiscardHandler {
 }
 
 // Handle processes the DISCARD command (actual logic is in command processor)
-func (h *DiscardHandler) Handle(parts []resp.RespValue, conn net.Conn) error {
+func (h *DiscardHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
 	if len(parts) != 1 {
-		return h.writer.WriteError("ERR wrong number of arguments for 'discard' command")
+		return writer.WriteError("ERR wrong number of arguments for 'discard' command")
 	}
 	// This should not be reached as DISCARD is handled specially in the processor
-	return h.writer.WriteError("ERR DISCARD without MULTI")
+	return writer.WriteError("ERR DISCARD without MULTI")
+}
+
+// WatchHandler handles WATCH commands
+type WatchHandler struct{}
+
+// NewWatchHandler creates a new WATCH handler
+func NewWatchHandler() *WatchHandler {
+	return &WatchHandler{}
 }
 
-// SetWriter sets the response writer for this handler
-func (h *DiscardHandler) SetWriter(writer *resp.ResponseWriter) {
-	h.writer = writer
+// Handle processes the WATCH command (actual logic is in command processor)
+func (h *WatchHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) < 2 {
+		return writer.WriteError("ERR wrong number of arguments for 'watch' command")
+	}
+	// This should not be reached as WATCH is handled specially in the processor
+	return writer.WriteError("ERR WATCH inside MULTI is not allowed")
+}
+
+// UnwatchHandler handles UNWATCH commands
+type UnwatchHandler struct{}
+
+// NewUnwatchHandler creates a new UNWATCH handler
+func NewUnwatchHandler() *UnwatchHandler {
+	return &UnwatchHandler{}
+}
+
+// Handle processes the UNWATCH command. Outside a transaction the processor
+// unwatches the keys; inside one EXEC unwatches them anyway, so this only replies.
+func (h *UnwatchHandler) Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error {
+	if len(parts) != 1 {
+		return writer.WriteError("ERR wrong number of arguments for 'unwatch' command")
+	}
+	return writer.WriteSimpleString("OK")
 }
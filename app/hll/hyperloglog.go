@@ -0,0 +1,368 @@
+package hll
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+)
+
+// Parameters matching Redis's HyperLogLog implementation so that values are
+// interchangeable with real Redis instances
+const (
+	precision      = 14
+	registerCount  = 1 << precision // 16384
+	registerBits   = 6
+	registerMax    = 1<<registerBits - 1
+	hashBits       = 64 - precision // Q in the Redis sources
+	headerSize     = 16
+	denseSize      = headerSize + (registerCount*registerBits+7)/8
+	sparseMaxBytes = 3000
+	alphaInf       = 0.721347520444481703680 // 0.5/ln(2)
+
+	encodingDense  = 0
+	encodingSparse = 1
+
+	// Sparse opcodes
+	sparseZeroMaxLen  = 64
+	sparseXZeroMaxLen = 16384
+	sparseValMaxValue = 32
+	sparseValMaxLen   = 4
+
+	magic = "HYLL"
+)
+
+var (
+	// ErrInvalid is returned for strings that are not HyperLogLog values
+	ErrInvalid = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	// ErrCorrupted is returned when the sparse representation is malformed
+	ErrCorrupted = errors.New("INVALIDOBJ Corrupted HLL object detected")
+)
+
+// HyperLogLog is a decoded HyperLogLog sketch. Registers are kept unpacked in
+// memory and re-encoded as sparse or dense when serialized.
+type HyperLogLog struct {
+	registers  [registerCount]uint8
+	sparse     bool
+	cachedCard uint64
+	cacheValid bool
+}
+
+// New creates an empty, sparse-encoded HyperLogLog
+func New() *HyperLogLog {
+	return &HyperLogLog{sparse: true, cacheValid: true}
+}
+
+// Parse decodes a HyperLogLog from its Redis string representation
+func Parse(data string) (*HyperLogLog, error) {
+	if len(data) < headerSize || !strings.HasPrefix(data, magic) {
+		return nil, ErrInvalid
+	}
+
+	h := &HyperLogLog{}
+	switch data[4] {
+	case encodingDense:
+		if len(data) != denseSize {
+			return nil, ErrInvalid
+		}
+		h.decodeDense(data[headerSize:])
+	case encodingSparse:
+		h.sparse = true
+		if err := h.decodeSparse(data[headerSize:]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrInvalid
+	}
+
+	// The most significant bit of the last cardinality byte marks the cache as stale
+	card := data[8:16]
+	if card[7]&(1<<7) == 0 {
+		h.cacheValid = true
+		h.cachedCard = binary.LittleEndian.Uint64([]byte(card))
+	}
+	return h, nil
+}
+
+// Add hashes element into the sketch and reports whether a register changed
+func (h *HyperLogLog) Add(element string) bool {
+	index, count := patternLength(element)
+	if h.registers[index] >= count {
+		return false
+	}
+	h.registers[index] = count
+	h.cacheValid = false
+	return true
+}
+
+// Merge folds other into h by taking the maximum of every register
+func (h *HyperLogLog) Merge(other *HyperLogLog) {
+	for i, v := range other.registers {
+		if v > h.registers[i] {
+			h.registers[i] = v
+			h.cacheValid = false
+		}
+	}
+	if !other.sparse {
+		h.sparse = false
+	}
+}
+
+// Count returns the estimated cardinality, using the cached value when valid
+func (h *HyperLogLog) Count() uint64 {
+	if h.cacheValid {
+		return h.cachedCard
+	}
+	h.cachedCard = h.estimate()
+	h.cacheValid = true
+	return h.cachedCard
+}
+
+// HasCachedCount reports whether Count can be answered from the cached cardinality
+func (h *HyperLogLog) HasCachedCount() bool {
+	return h.cacheValid
+}
+
+// IsSparse reports whether the sketch will be serialized with the sparse encoding
+func (h *HyperLogLog) IsSparse() bool {
+	return h.sparse
+}
+
+// String serializes the sketch. Sparse sketches are promoted to the dense
+// encoding once a register exceeds the sparse range or the encoding grows too big.
+func (h *HyperLogLog) String() string {
+	var body []byte
+	if h.sparse {
+		body = h.encodeSparse()
+		if body == nil {
+			h.sparse = false
+		}
+	}
+	if !h.sparse {
+		body = h.encodeDense()
+	}
+
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	if h.sparse {
+		header[4] = encodingSparse
+	} else {
+		header[4] = encodingDense
+	}
+	if h.cacheValid {
+		binary.LittleEndian.PutUint64(header[8:], h.cachedCard)
+	} else {
+		header[15] = 1 << 7
+	}
+
+	return string(header) + string(body)
+}
+
+// estimate computes the cardinality with Otmar Ertl's improved estimator,
+// which is what Redis uses since 5.0
+func (h *HyperLogLog) estimate() uint64 {
+	var histogram [64]int
+	for _, v := range h.registers {
+		histogram[v]++
+	}
+
+	m := float64(registerCount)
+	z := m * tau((m-float64(histogram[hashBits+1]))/m)
+	for j := hashBits; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * sigma(float64(histogram[0])/m)
+
+	return uint64(math.Round(alphaInf * m * m / z))
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z {
+			return z
+		}
+	}
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrime == z {
+			return z / 3
+		}
+	}
+}
+
+// patternLength returns the register an element maps to and the length of the
+// run of zero bits (plus one) in the rest of its hash
+func patternLength(element string) (int, uint8) {
+	hash := murmurHash64A([]byte(element), 0xadc83b19)
+	index := int(hash & (registerCount - 1))
+	hash >>= precision
+	hash |= 1 << hashBits // guarantees the loop terminates
+
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+// murmurHash64A is the 64 bit MurmurHash2 variant used by Redis, reading
+// blocks in little-endian order regardless of platform
+func murmurHash64A(data []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+
+	h := seed ^ (uint64(len(data)) * m)
+
+	for len(data) >= 8 {
+		k := binary.LittleEndian.Uint64(data)
+		k *= m
+		k ^= k >> r
+		k *= m
+
+		h ^= k
+		h *= m
+		data = data[8:]
+	}
+
+	if len(data) > 0 {
+		for i := len(data) - 1; i >= 0; i-- {
+			h ^= uint64(data[i]) << (8 * uint(i))
+		}
+		h *= m
+	}
+
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+// decodeDense unpacks the 6 bit registers of the dense encoding
+func (h *HyperLogLog) decodeDense(data string) {
+	for i := range h.registers {
+		byteIndex := i * registerBits / 8
+		fb := uint(i * registerBits & 7)
+		b0 := uint(data[byteIndex])
+		var b1 uint
+		if byteIndex+1 < len(data) {
+			b1 = uint(data[byteIndex+1])
+		}
+		h.registers[i] = uint8((b0>>fb | b1<<(8-fb)) & registerMax)
+	}
+}
+
+// encodeDense packs the registers into the dense encoding
+func (h *HyperLogLog) encodeDense() []byte {
+	data := make([]byte, denseSize-headerSize)
+	for i, v := range h.registers {
+		byteIndex := i * registerBits / 8
+		fb := uint(i * registerBits & 7)
+		val := uint(v)
+		data[byteIndex] &^= byte(registerMax << fb)
+		data[byteIndex] |= byte(val << fb)
+		if byteIndex+1 < len(data) {
+			data[byteIndex+1] &^= byte(registerMax >> (8 - fb))
+			data[byteIndex+1] |= byte(val >> (8 - fb))
+		}
+	}
+	return data
+}
+
+// decodeSparse expands the ZERO, XZERO and VAL opcodes of the sparse encoding
+func (h *HyperLogLog) decodeSparse(data string) error {
+	index := 0
+	for i := 0; i < len(data); {
+		op := data[i]
+		var runLen int
+		var value uint8
+
+		switch {
+		case op&0xc0 == 0x00: // ZERO: 00xxxxxx
+			runLen = int(op&0x3f) + 1
+			i++
+		case op&0xc0 == 0x40: // XZERO: 01xxxxxx yyyyyyyy
+			if i+1 >= len(data) {
+				return ErrCorrupted
+			}
+			runLen = (int(op&0x3f)<<8 | int(data[i+1])) + 1
+			i += 2
+		default: // VAL: 1vvvvvxx
+			value = (op>>2)&0x1f + 1
+			runLen = int(op&0x03) + 1
+			i++
+		}
+
+		if index+runLen > registerCount {
+			return ErrCorrupted
+		}
+		for j := 0; j < runLen; j++ {
+			h.registers[index+j] = value
+		}
+		index += runLen
+	}
+
+	if index != registerCount {
+		return ErrCorrupted
+	}
+	return nil
+}
+
+// encodeSparse run-length encodes the registers, returning nil when the sketch
+// can no longer be represented sparsely
+func (h *HyperLogLog) encodeSparse() []byte {
+	var data []byte
+	for i := 0; i < registerCount; {
+		value := h.registers[i]
+		run := 1
+		for i+run < registerCount && h.registers[i+run] == value {
+			run++
+		}
+		i += run
+
+		if value > sparseValMaxValue {
+			return nil
+		}
+
+		for run > 0 {
+			switch {
+			case value != 0:
+				n := min(run, sparseValMaxLen)
+				data = append(data, 0x80|(value-1)<<2|byte(n-1))
+				run -= n
+			case run > sparseZeroMaxLen:
+				n := min(run, sparseXZeroMaxLen)
+				data = append(data, 0x40|byte((n-1)>>8), byte((n-1)&0xff))
+				run -= n
+			default:
+				data = append(data, byte(run-1))
+				run = 0
+			}
+		}
+
+		if len(data) > sparseMaxBytes {
+			return nil
+		}
+	}
+	return data
+}
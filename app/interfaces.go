@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/codecrafters-io/redis-starter-go/app/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/store"
 )
 
 // CommandHandler interface following Single Responsibility Principle
@@ -15,14 +16,19 @@ type CommandHandler interface {
 // Store interfaces following Interface Segregation Principle
 type KeyValueStore interface {
 	Set(key, value string, expiry ...time.Duration) error
-	Get(key string) (string, bool)
+	Get(key string) (string, bool, error)
 	Delete(key string) error
+	Update(key string, fn store.UpdateFunc) error
+	Replace(key string, fn store.UpdateFunc) error
+	UpdateMultiple(keys []string, fn store.MultiUpdateFunc) error
+	ReplaceMultiple(keys []string, fn store.MultiUpdateFunc) error
+	GetMultiple(keys []string) ([]string, []bool)
 }
 
 type ListStore interface {
 	LPush(key string, values ...string) (int, error)
 	RPush(key string, values ...string) (int, error)
-	LPop(key string, count ...int) ([]string, bool)
+	LPop(key string, count ...int) (values []string, emptied bool, exists bool)
 	LRange(key string, start, end int) ([]string, bool)
 	LLen(key string) (int, bool)
 }
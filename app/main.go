@@ -5,6 +5,7 @@ import (
 	"github.com/codecrafters-io/redis-starter-go/app/config"
 	"github.com/codecrafters-io/redis-starter-go/app/processor"
 	"github.com/codecrafters-io/redis-starter-go/app/server"
+	"github.com/codecrafters-io/redis-starter-go/app/store"
 	"os"
 )
 
@@ -14,20 +15,45 @@ func main() {
 	// Load configuration
 	cfg := config.NewConfig()
 
-	// Create stores
-	kvStore := NewInMemoryKeyValueStore()
-	listStore := NewInMemoryListStore()
+	// Create the logical databases; each serves strings, lists and streams alike
+	databases := store.NewDatabases(cfg.GetDatabases())
 
 	// Create command processor with improved dependency injection
-	commandProcessor := processor.NewCommandProcessor(kvStore, listStore)
-	commandProcessor.SetConfig(cfg)
-	commandProcessor.RegisterHandlers()
+	commandProcessor := processor.NewCommandProcessor(databases)
+	if err := commandProcessor.SetConfig(cfg); err != nil {
+		fmt.Printf("Invalid configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	if cfg.Sentinel {
+		// A sentinel holds no dataset, it only monitors masters
+		if err := commandProcessor.StartSentinel(cfg); err != nil {
+			fmt.Printf("Invalid configuration: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		commandProcessor.RegisterHandlers()
+		if err := commandProcessor.StartCluster(); err != nil {
+			fmt.Printf("Failed to start cluster mode: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Restore the dataset before accepting any connections
+		if err := commandProcessor.LoadData(cfg); err != nil {
+			fmt.Printf("Failed to load data: %v\n", err)
+			os.Exit(1)
+		}
+		if err := commandProcessor.StartReplication(cfg); err != nil {
+			fmt.Printf("Invalid configuration: %v\n", err)
+			os.Exit(1)
+		}
+		commandProcessor.StartCron()
+	}
 
 	// Create and start the server
 	redisServer := server.NewServer(commandProcessor, cfg)
 
-	err := redisServer.Start()
-	if err != nil {
+	if err := redisServer.Start(); err != nil {
 		fmt.Printf("Failed to start server: %v\n", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,156 @@
+package notify
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/codecrafters-io/redis-starter-go/app/store"
+)
+
+// Class is a set of event classes selected by notify-keyspace-events
+type Class int
+
+const (
+	Keyspace Class = 1 << iota // K: publish to __keyspace@<db>__:<key>
+	Keyevent                   // E: publish to __keyevent@<db>__:<event>
+	Generic                    // g: type independent commands like DEL and RENAME
+	String                     // $: string commands
+	List                       // l: list commands
+	Set                        // s: set commands
+	Hash                       // h: hash commands
+	ZSet                       // z: sorted set commands
+	Expired                    // x: keys reclaimed after their TTL
+	Evicted                    // e: keys evicted for maxmemory
+	Stream                     // t: stream commands
+	KeyMiss                    // m: reads of missing keys
+	New                        // n: keys being created
+
+	// All is what A stands for: every class except key misses and new keys
+	All = Generic | String | List | Set | Hash | ZSet | Expired | Evicted | Stream
+)
+
+// ErrInvalidClass is returned for flags containing an unknown class letter
+var ErrInvalidClass = errors.New("Invalid event class character. Use 'Ag$lshzxeKEtmn'.")
+
+// classLetters lists each class with its flag letter, in the order Redis prints them
+var classLetters = []struct {
+	class  Class
+	letter byte
+}{
+	{Generic, 'g'}, {String, '$'}, {List, 'l'}, {Set, 's'}, {Hash, 'h'},
+	{ZSet, 'z'}, {Expired, 'x'}, {Evicted, 'e'}, {Stream, 't'},
+	{Keyspace, 'K'}, {Keyevent, 'E'}, {KeyMiss, 'm'}, {New, 'n'},
+}
+
+// ParseClasses parses notify-keyspace-events flags such as "KEA" or "Elx"
+func ParseClasses(flags string) (Class, error) {
+	var classes Class
+	for i := 0; i < len(flags); i++ {
+		if flags[i] == 'A' {
+			classes |= All
+			continue
+		}
+		found := false
+		for _, cl := range classLetters {
+			if cl.letter == flags[i] {
+				classes |= cl.class
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, ErrInvalidClass
+		}
+	}
+	return classes, nil
+}
+
+// String formats classes back into flags, using A when every class it stands for is set
+func (c Class) String() string {
+	var flags strings.Builder
+	if c&All == All {
+		flags.WriteByte('A')
+	}
+	for _, cl := range classLetters {
+		if c&All == All && All&cl.class != 0 {
+			continue
+		}
+		if c&cl.class != 0 {
+			flags.WriteByte(cl.letter)
+		}
+	}
+	return flags.String()
+}
+
+// Publisher delivers a message to the subscribers of a channel
+type Publisher interface {
+	Publish(channel, message string) int
+}
+
+// Notifier publishes keyspace and keyevent notifications for the enabled classes
+type Notifier struct {
+	classes   atomic.Int64
+	publisher Publisher
+}
+
+// NewNotifier creates a notifier with every class disabled
+func NewNotifier(publisher Publisher) *Notifier {
+	return &Notifier{publisher: publisher}
+}
+
+// Classes returns the enabled classes
+func (n *Notifier) Classes() Class {
+	return Class(n.classes.Load())
+}
+
+// SetClasses replaces the enabled classes
+func (n *Notifier) SetClasses(classes Class) {
+	n.classes.Store(int64(classes))
+}
+
+// Notify publishes event for key in database db if its class is enabled
+func (n *Notifier) Notify(class Class, event string, db int, key string) {
+	classes := n.Classes()
+	if classes&class == 0 {
+		return
+	}
+
+	if classes&Keyspace != 0 {
+		n.publisher.Publish("__keyspace@"+strconv.Itoa(db)+"__:"+key, event)
+	}
+	if classes&Keyevent != 0 {
+		n.publisher.Publish("__keyevent@"+strconv.Itoa(db)+"__:"+event, key)
+	}
+}
+
+// StoreEvent publishes the events the store reports on its own
+func (n *Notifier) StoreEvent(event store.KeyEvent, db int, key string) {
+	switch event {
+	case store.KeyCreated:
+		n.Notify(New, "new", db, key)
+	case store.KeyDeleted:
+		n.Notify(Generic, "del", db, key)
+	case store.KeyExpired:
+		n.Notify(Expired, "expired", db, key)
+	case store.KeyMissed:
+		n.Notify(KeyMiss, "keymiss", db, key)
+	}
+}
+
+// ForDatabase returns a notifier bound to database db
+func (n *Notifier) ForDatabase(db int) *DatabaseNotifier {
+	return &DatabaseNotifier{notifier: n, db: db}
+}
+
+// DatabaseNotifier publishes notifications for the keys of one database
+type DatabaseNotifier struct {
+	notifier *Notifier
+	db       int
+}
+
+// Notify publishes event for key if its class is enabled
+func (d *DatabaseNotifier) Notify(class Class, event, key string) {
+	d.notifier.Notify(class, event, d.db, key)
+}
@@ -0,0 +1,130 @@
+package pattern
+
+// maxNesting bounds the recursion depth of a match, guarding against
+// patterns with many stars
+const maxNesting = 1000
+
+// Match reports whether s matches the glob-style pattern with the exact
+// semantics of Redis's stringmatchlen. A star matches any run of bytes, a
+// question mark matches one byte, [abc] and [a-z] match a class or range
+// (negated by a leading ^) and a backslash escapes the next byte. With nocase
+// set, ASCII letters are compared case-insensitively.
+func Match(pattern, s string, nocase bool) bool {
+	skipLongerMatches := false
+	return match(pattern, s, nocase, &skipLongerMatches, 0)
+}
+
+// match is a port of stringmatchlen_impl. Once the part of the pattern after
+// a star fails to match at every position of the rest of the string, no
+// longer match of an earlier star can succeed either, so skipLongerMatches
+// stops the search instead of backtracking exponentially.
+func match(pattern, s string, nocase bool, skipLongerMatches *bool, nesting int) bool {
+	if nesting > maxNesting {
+		return false
+	}
+
+	for len(pattern) > 0 && len(s) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for len(s) > 0 {
+				if match(pattern[1:], s, nocase, skipLongerMatches, nesting+1) {
+					return true
+				}
+				if *skipLongerMatches {
+					return false
+				}
+				s = s[1:]
+			}
+			*skipLongerMatches = true
+			return false
+		case '?':
+			s = s[1:]
+		case '[':
+			pattern = pattern[1:]
+			negate := len(pattern) > 0 && pattern[0] == '^'
+			if negate {
+				pattern = pattern[1:]
+			}
+
+			matched := false
+			for {
+				if len(pattern) >= 2 && pattern[0] == '\\' {
+					pattern = pattern[1:]
+					if pattern[0] == s[0] {
+						matched = true
+					}
+				} else if len(pattern) == 0 {
+					// Unterminated class: leave one byte for the advance below
+					// to consume, like the C version stepping back onto the NUL
+					pattern = " "
+					break
+				} else if pattern[0] == ']' {
+					break
+				} else if len(pattern) >= 3 && pattern[1] == '-' {
+					start, end, c := pattern[0], pattern[2], s[0]
+					if start > end {
+						start, end = end, start
+					}
+					if nocase {
+						start, end, c = toLower(start), toLower(end), toLower(c)
+					}
+					pattern = pattern[2:]
+					if c >= start && c <= end {
+						matched = true
+					}
+				} else if equal(pattern[0], s[0], nocase) {
+					matched = true
+				}
+				pattern = pattern[1:]
+			}
+
+			if negate {
+				matched = !matched
+			}
+			if !matched {
+				return false
+			}
+			s = s[1:]
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if !equal(pattern[0], s[0], nocase) {
+				return false
+			}
+			s = s[1:]
+		}
+
+		pattern = pattern[1:]
+		if len(s) == 0 {
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			break
+		}
+	}
+
+	return len(pattern) == 0 && len(s) == 0
+}
+
+func equal(a, b byte, nocase bool) bool {
+	if nocase {
+		return toLower(a) == toLower(b)
+	}
+	return a == b
+}
+
+func toLower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
@@ -0,0 +1,177 @@
+package pattern
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		// Literals and the empty cases
+		{"", "", true},
+		{"", "a", false},
+		{"a", "", false},
+		{"hello", "hello", true},
+		{"hello", "hell", false},
+		{"hello", "helloo", false},
+
+		// Question marks
+		{"h?llo", "hello", true},
+		{"h?llo", "hallo", true},
+		{"h?llo", "hllo", false},
+		{"???", "abc", true},
+		{"???", "ab", false},
+
+		// Stars, including runs of them. Like stringmatchlen, a pattern only
+		// matches an empty string if it is empty too.
+		{"*", "", false},
+		{"*", "anything", true},
+		{"**", "", false},
+		{"**", "x", true},
+		{"h*llo", "hllo", true},
+		{"h*llo", "heeeello", true},
+		{"h*llo", "hello world", false},
+		{"*llo", "hello", true},
+		{"he*", "he", true},
+		{"a*b*c", "aXbYc", true},
+		{"a*b*c", "abc", true},
+		{"a*b*c", "acb", false},
+		{"a***b", "ab", true},
+		{"*a*", "bab", true},
+		{"*a*", "bbb", false},
+		{"a*", "", false},
+		{"*?", "", false},
+		{"*?", "x", true},
+		{"?*?", "x", false},
+
+		// Nested stars backtracking over repeated text
+		{"*a*a*a*b", "aaab", true},
+		{"*a*a*a*b", "aaaa", false},
+		{"a*a*a*a*b", "aaaaaaaaab", true},
+		{"*ab*ab*", "xabyabz", true},
+		{"*ab*ab*", "xabyaz", false},
+		{"*.txt", "a.b.txt", true},
+		{"*.txt", "a.txt.bak", false},
+
+		// Classes and ranges
+		{"h[ae]llo", "hello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"[b-a]", "a", true},
+		{"[z-a]", "m", true},
+		{"[a-cx-z]", "y", true},
+		{"[a-cx-z]", "m", false},
+		{"[-a]", "-", true},
+		{"[a-]", "-", false}, // read as the range a-], which swallows the ]
+		{"[]", "a", false},
+		{"[*]", "*", true},
+		{"[*]", "a", false},
+		{"[?]", "?", true},
+		{"[?]", "a", false},
+		{"[[]", "[", true},
+
+		// Negation
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"[^a-c]", "d", true},
+		{"[^a-c]", "b", false},
+		{"[^]", "a", true},
+		{"[^^]", "^", false},
+		{"[a^]", "^", true},
+
+		// Escapes, outside and inside classes
+		{`\*`, "*", true},
+		{`\*`, "a", false},
+		{`\?`, "?", true},
+		{`\?`, "a", false},
+		{`\[a]`, "[a]", true},
+		{`\\`, `\`, true},
+		{`a\`, `a\`, true},
+		{`\a`, "a", true},
+		{`*\*`, "abc*", true},
+		{`*\*`, "abc", false},
+		{`[\]]`, "]", true},
+		{`[\]a]`, "a", true},
+		{`[\-]`, "-", true},
+		{`[\^a]`, "^", true},
+		{`[^\]]`, "]", false},
+		{`[^\]]`, "x", true},
+
+		// Unterminated classes match what they listed so far
+		{"[a", "a", true},
+		{"[a", "b", false},
+		{"[^a", "b", true},
+		{"x[ab", "xb", true},
+
+		// Hash tags, as cluster keys use them
+		{"{a}*", "{a}key", true},
+		{"{a}*", "{b}key", false},
+
+		// Bytes that are not ASCII letters
+		{"a\x00b", "a\x00b", true},
+		{"a?b", "a\x00b", true},
+		{"[\x80-\xff]", "\xc3", true},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.s, false); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestMatchNocase(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"HeLLo", "hello", true},
+		{"h*O", "HELLO", true},
+		{"h[A-C]llo", "hbllo", true},
+		{"h[a-c]llo", "HBLLO", true},
+		{"[^A-C]", "b", false},
+		{"[xy]", "Y", true},
+		{"hello", "hellp", false},
+		{"[@]", "`", false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.s, true); got != tt.want {
+			t.Errorf("Match(%q, %q, nocase) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestMatchLongNestedLoops(t *testing.T) {
+	// Regression test from Redis: without cutting the search short, this
+	// backtracks for longer than any test timeout
+	pattern := strings.Repeat("a*", 50) + "b"
+	s := strings.Repeat("a", 300)
+
+	start := time.Now()
+	if Match(pattern, s, false) {
+		t.Errorf("Match(%q, %q) = true, want false", pattern, s)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Match took %v", elapsed)
+	}
+}
+
+func TestMatchNestingLimit(t *testing.T) {
+	pattern := strings.Repeat("*a", maxNesting+10)
+	s := strings.Repeat("a", maxNesting+10)
+	if Match(pattern, s, false) {
+		t.Errorf("Match nested beyond %d stars, want false", maxNesting)
+	}
+	pattern = strings.Repeat("*a", 100)
+	s = strings.Repeat("a", 100)
+	if !Match(pattern, s, false) {
+		t.Errorf("Match(%q, %q) = false, want true", pattern, s)
+	}
+}
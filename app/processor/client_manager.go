@@ -0,0 +1,134 @@
+package processor
+
+import (
+	"net"
+	"sync"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// clientState is the per-connection state that outlives a single command
+type clientState struct {
+	id       int
+	database int
+	protocol int
+	name     string
+	asking   bool  // the next command may use a slot being imported
+	woff     int64 // replication offset after the client's last write
+}
+
+// ClientManager tracks the state of each connected client
+type ClientManager struct {
+	clients map[net.Conn]*clientState
+	nextID  int
+	mu      sync.RWMutex
+}
+
+// NewClientManager creates a new client manager
+func NewClientManager() *ClientManager {
+	return &ClientManager{
+		clients: make(map[net.Conn]*clientState),
+	}
+}
+
+// stateFor returns the state of conn, registering it on first use.
+// The caller must hold the write lock.
+func (cm *ClientManager) stateFor(conn net.Conn) *clientState {
+	state, exists := cm.clients[conn]
+	if !exists {
+		cm.nextID++
+		state = &clientState{id: cm.nextID, protocol: resp.RESP2}
+		cm.clients[conn] = state
+	}
+	return state
+}
+
+// ID returns the unique id of conn
+func (cm *ClientManager) ID(conn net.Conn) int {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.stateFor(conn).id
+}
+
+// Selected returns the database index selected by conn, defaulting to 0
+func (cm *ClientManager) Selected(conn net.Conn) int {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	if state, exists := cm.clients[conn]; exists {
+		return state.database
+	}
+	return 0
+}
+
+// Select makes index the selected database of conn
+func (cm *ClientManager) Select(conn net.Conn, index int) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.stateFor(conn).database = index
+}
+
+// Protocol returns the protocol version negotiated by conn, defaulting to RESP2
+func (cm *ClientManager) Protocol(conn net.Conn) int {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	if state, exists := cm.clients[conn]; exists {
+		return state.protocol
+	}
+	return resp.RESP2
+}
+
+// SetProtocol records the protocol version negotiated by conn
+func (cm *ClientManager) SetProtocol(conn net.Conn, protocol int) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.stateFor(conn).protocol = protocol
+}
+
+// SetName sets the name of conn
+func (cm *ClientManager) SetName(conn net.Conn, name string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.stateFor(conn).name = name
+}
+
+// Asking reports whether conn sent ASKING for its next command
+func (cm *ClientManager) Asking(conn net.Conn) bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	if state, exists := cm.clients[conn]; exists {
+		return state.asking
+	}
+	return false
+}
+
+// SetAsking records whether conn sent ASKING for its next command
+func (cm *ClientManager) SetAsking(conn net.Conn, asking bool) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.stateFor(conn).asking = asking
+}
+
+// WriteOffset returns the replication offset after the last write of conn,
+// which WAIT and WAITAOF wait for
+func (cm *ClientManager) WriteOffset(conn net.Conn) int64 {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	if state, exists := cm.clients[conn]; exists {
+		return state.woff
+	}
+	return 0
+}
+
+// SetWriteOffset records the replication offset after a write of conn
+func (cm *ClientManager) SetWriteOffset(conn net.Conn, offset int64) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.stateFor(conn).woff = offset
+}
+
+// CleanupConnection forgets the state of a closed connection
+func (cm *ClientManager) CleanupConnection(conn net.Conn) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	delete(cm.clients, conn)
+}
@@ -0,0 +1,104 @@
+package processor
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/cluster"
+	"github.com/codecrafters-io/redis-starter-go/app/config"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// clusterDisabled lists the commands cluster mode refuses, since a node
+// serves a single database and cannot be a replica
+var clusterDisabled = map[string]bool{
+	"MOVE":      true,
+	"SWAPDB":    true,
+	"REPLICAOF": true,
+	"SLAVEOF":   true,
+}
+
+// setClusterConfig creates the cluster state of this node when cluster mode
+// is enabled and exposes its parameters
+func (cp *CommandProcessor) setClusterConfig(cfg *config.Config) error {
+	if !cfg.ClusterEnabled {
+		return nil
+	}
+	if cfg.Sentinel {
+		return errors.New("cluster mode can't be enabled on a sentinel")
+	}
+	if cfg.ReplicaOf != "" {
+		return errors.New("replicaof is not allowed in cluster mode")
+	}
+
+	cp.cluster = cluster.New(cp.databases.DB(0), cfg.GetClusterConfigPath(), cfg.Port)
+	cfg.RegisterParameter("cluster-node-timeout", config.Parameter{Get: cp.cluster.NodeTimeout, Set: cp.cluster.SetNodeTimeout})
+	if err := cfg.SetParameter("cluster-node-timeout", strconv.Itoa(cfg.ClusterNodeTimeout)); err != nil {
+		return err
+	}
+	cfg.RegisterParameter("cluster-require-full-coverage", config.Parameter{Get: cp.cluster.FullCoverage, Set: cp.cluster.SetFullCoverage})
+	return nil
+}
+
+// StartCluster restores the nodes and slots saved in the cluster
+// configuration file and starts talking to the other nodes. Like Redis, it
+// runs before the dataset is loaded.
+func (cp *CommandProcessor) StartCluster() error {
+	if cp.cluster == nil {
+		return nil
+	}
+	if err := cp.cluster.Load(); err != nil {
+		return err
+	}
+	return cp.cluster.Start()
+}
+
+// routed reports whether commands sent on conn are routed by hash slot.
+// Commands replayed from the append-only file or streamed by a master were
+// already routed when they first ran.
+func (cp *CommandProcessor) routed(conn net.Conn) bool {
+	if _, ok := conn.(*replayConn); ok {
+		return false
+	}
+	return !cp.replication.IsMasterClient(conn)
+}
+
+// clusterRedirect returns the error sending a client elsewhere in the
+// cluster for the keys of commands, or nil when this node serves them all.
+// The commands of a transaction are checked together, as their keys must
+// all be in the same slot.
+func (cp *CommandProcessor) clusterRedirect(conn net.Conn, commands ...[]resp.RespValue) error {
+	var keys []string
+	for _, parts := range commands {
+		name, _ := parts[0].Value.(string)
+		name = strings.ToUpper(name)
+		if clusterDisabled[name] {
+			return errors.New("ERR " + name + " is not allowed in cluster mode")
+		}
+		keys = append(keys, commandKeys(name, parts)...)
+	}
+	return cp.cluster.Route(keys, cp.clients.Asking(conn))
+}
+
+// commandKeys returns the keys a command touches. XREAD names its streams
+// after the STREAMS keyword, followed by as many IDs.
+func commandKeys(name string, parts []resp.RespValue) []string {
+	if name != "XREAD" {
+		return commandTable[name].KeyArgs(parts)
+	}
+	for i := 1; i < len(parts); i++ {
+		arg, _ := parts[i].Value.(string)
+		if strings.EqualFold(arg, "STREAMS") {
+			streams := parts[i+1:]
+			keys := make([]string, 0, len(streams)/2)
+			for _, part := range streams[:len(streams)/2] {
+				key, _ := part.Value.(string)
+				keys = append(keys, key)
+			}
+			return keys
+		}
+	}
+	return nil
+}
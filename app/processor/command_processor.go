@@ -1,119 +1,450 @@
 package processor
 
 import (
+	"errors"
 	"net"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/codecrafters-io/redis-starter-go/app/aof"
+	"github.com/codecrafters-io/redis-starter-go/app/cluster"
 	"github.com/codecrafters-io/redis-starter-go/app/config"
+	"github.com/codecrafters-io/redis-starter-go/app/notify"
+	"github.com/codecrafters-io/redis-starter-go/app/pubsub"
+	"github.com/codecrafters-io/redis-starter-go/app/rdb"
+	"github.com/codecrafters-io/redis-starter-go/app/replication"
 	"github.com/codecrafters-io/redis-starter-go/app/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/sentinel"
 	"github.com/codecrafters-io/redis-starter-go/app/store"
 )
 
+// cronInterval is how often periodic background work runs, matching the
+// default hz of 10
+const cronInterval = 100 * time.Millisecond
+
 // CommandProcessor processes Redis commands with improved architecture
 type CommandProcessor struct {
-	handlers           map[string]CommandHandler
+	handlers           []map[string]CommandHandler // one handler set per database
+	databases          *store.Databases
+	execLock           sync.RWMutex // held exclusively by EXEC so transactions run isolated
+	propagateLock      sync.Mutex   // held by a write from executing until it is propagated
 	transactionManager *TransactionManager
+	clients            *ClientManager
+	broker             *pubsub.Broker
+	notifier           *notify.Notifier
+	saver              *rdb.Saver
+	aof                *aof.AOF
+	replication        *replication.Replication
+	cluster            *cluster.Cluster // nil unless cluster mode is enabled
 	handlerFactory     *HandlerFactory
 }
 
 // NewCommandProcessor creates a new command processor
-func NewCommandProcessor(kvStore KeyValueStore, listStore ListStore) *CommandProcessor {
+func NewCommandProcessor(databases *store.Databases) *CommandProcessor {
+	clients := NewClientManager()
+	broker := pubsub.NewBroker()
+	notifier := notify.NewNotifier(broker)
+	databases.SetKeyEventHook(notifier.StoreEvent)
 	cp := &CommandProcessor{
-		handlers:           make(map[string]CommandHandler),
+		handlers:           make([]map[string]CommandHandler, databases.Count()),
+		databases:          databases,
 		transactionManager: NewTransactionManager(),
-		handlerFactory:     NewHandlerFactory(kvStore, listStore),
+		clients:            clients,
+		broker:             broker,
+		notifier:           notifier,
+		handlerFactory:     NewHandlerFactory(databases, broker, clients, notifier),
 	}
 	return cp
 }
 
 // SetConfig sets the configuration for handlers that need it
-func (cp *CommandProcessor) SetConfig(cfg *config.Config) {
-	cp.handlerFactory.SetConfig(cfg)
+func (cp *CommandProcessor) SetConfig(cfg *config.Config) error {
+	cfg.RegisterParameter("notify-keyspace-events", config.Parameter{
+		Get: func() string { return cp.notifier.Classes().String() },
+		Set: func(value string) error {
+			classes, err := notify.ParseClasses(value)
+			if err != nil {
+				return err
+			}
+			cp.notifier.SetClasses(classes)
+			return nil
+		},
+	})
+	if err := cfg.SetParameter("notify-keyspace-events", cfg.NotifyKeyspaceEvents); err != nil {
+		return err
+	}
+
+	cp.saver = rdb.NewSaver(cp.databases, cfg.GetRDBPath)
+	cfg.RegisterParameter("save", config.Parameter{Get: cp.saver.SavePoints, Set: cp.saver.SetSavePoints})
+	if err := cfg.SetParameter("save", cfg.Save); err != nil {
+		return err
+	}
+
+	cp.aof = aof.New(cp.databases, cfg.GetAOFDir(), cfg.GetAppendFilename(), &cp.propagateLock)
+	cfg.RegisterParameter("appendfsync", config.Parameter{
+		Get: func() string { return cp.aof.Policy().String() },
+		Set: func(value string) error {
+			policy, err := aof.ParsePolicy(value)
+			if err != nil {
+				return err
+			}
+			cp.aof.SetPolicy(policy)
+			return nil
+		},
+	})
+	if err := cfg.SetParameter("appendfsync", cfg.AppendFsync); err != nil {
+		return err
+	}
+	// Logging starts once LoadData has restored the dataset
+	if cfg.AppendOnly != "yes" && cfg.AppendOnly != "no" {
+		return errors.New("appendonly must be 'yes' or 'no'")
+	}
+	cfg.RegisterParameter("appendonly", config.Parameter{Get: cp.appendOnly, Set: cp.setAppendOnly})
+
+	cp.replication = replication.New(cp.databases, &cp.propagateLock, cfg.Port)
+	cp.replication.SetExecutor(cp)
+	cfg.RegisterParameter("replica-read-only", config.Parameter{Get: cp.replication.ReadOnly, Set: cp.replication.SetReadOnly})
+	cfg.RegisterParameter("repl-backlog-size", config.Parameter{Get: cp.replication.BacklogSize, Set: cp.replication.SetBacklogSize})
+
+	if err := cp.setClusterConfig(cfg); err != nil {
+		return err
+	}
+
+	cp.handlerFactory.SetConfig(cfg, cp.saver, cp.aof, cp.replication, cp.cluster)
+	return nil
+}
+
+// StartCron runs periodic background work: reclaiming expired keys that are
+// never accessed again, starting the background saves the schedule asks for,
+// flushing the append-only file and pinging replicas
+func (cp *CommandProcessor) StartCron() {
+	go func() {
+		ticker := time.NewTicker(cronInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			// Both expiring keys and taking a snapshot must not land in the middle of an EXEC
+			cp.execLock.RLock()
+			cp.databases.ActiveExpireCycle()
+			if cp.saver != nil {
+				cp.saver.Cron()
+			}
+			if cp.aof != nil {
+				cp.aof.Cron()
+			}
+			if cp.replication != nil {
+				cp.replication.Cron()
+			}
+			cp.execLock.RUnlock()
+		}
+	}()
 }
 
 // RegisterHandlers registers all command handlers
 func (cp *CommandProcessor) RegisterHandlers() {
-	handlers := cp.handlerFactory.CreateAllHandlers()
-	for cmd, handler := range handlers {
-		cp.handlers[cmd] = handler
+	for index := range cp.handlers {
+		cp.handlers[index] = cp.handlerFactory.CreateAllHandlers(index)
+		for name, handler := range cp.handlers[index] {
+			blocking, ok := handler.(BlockingHandler)
+			if !ok {
+				continue
+			}
+			if !commandTable[name].Write {
+				blocking.SetLocker(cp.execLock.RLocker())
+				continue
+			}
+			// Blocking writes propagate what they changed themselves, from
+			// within the attempt that changed it
+			blocking.SetLocker(writeLocker{cp})
+			if propagating, ok := handler.(PropagatingHandler); ok {
+				propagating.SetPropagator(func(conn net.Conn, parts []resp.RespValue, reply resp.RespValue) {
+					cp.propagate(conn, index, commandArgs(parts), reply)
+				})
+			}
+		}
 	}
 }
 
+// StartSentinel makes the server a sentinel monitoring the masters given with
+// --sentinel-monitor, in place of serving a dataset
+func (cp *CommandProcessor) StartSentinel(cfg *config.Config) error {
+	s := sentinel.New(cfg.RunID, cfg.Port, cp.broker,
+		time.Duration(cfg.SentinelDownAfter)*time.Millisecond,
+		time.Duration(cfg.SentinelFailoverTimeout)*time.Millisecond)
+	for _, spec := range cfg.SentinelMonitors {
+		fields := strings.Fields(spec)
+		if len(fields) != 4 {
+			return errors.New("sentinel-monitor must be \"<name> <host> <port> <quorum>\"")
+		}
+		port, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return errors.New("invalid master port")
+		}
+		quorum, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return errors.New("invalid quorum")
+		}
+		if err := s.Monitor(fields[0], fields[1], port, quorum); err != nil {
+			return err
+		}
+	}
+
+	handlers := cp.handlerFactory.CreateSentinelHandlers(s)
+	for index := range cp.handlers {
+		cp.handlers[index] = handlers
+	}
+	s.Start()
+	return nil
+}
+
+// handlerFor returns the handler for cmd bound to the database selected by conn
+func (cp *CommandProcessor) handlerFor(conn net.Conn, cmd string) (CommandHandler, bool) {
+	handler, exists := cp.handlers[cp.clients.Selected(conn)][cmd]
+	return handler, exists
+}
+
+// writerFor returns a response writer for conn using the protocol it negotiated
+func (cp *CommandProcessor) writerFor(conn net.Conn) *resp.ResponseWriter {
+	writer := resp.NewResponseWriter(cp.broker.Output(conn))
+	writer.SetProtocol(cp.clients.Protocol(conn))
+	return writer
+}
+
 // Process processes a command with improved error handling and transaction support
 func (cp *CommandProcessor) Process(command resp.RespValue, conn net.Conn) error {
 	if command.Type != resp.ArrayType {
-		writer := resp.NewResponseWriter(conn)
+		writer := cp.writerFor(conn)
 		return writer.WriteError("ERR unknown command")
 	}
 
 	parts, ok := command.Value.([]resp.RespValue)
 	if !ok || len(parts) == 0 {
-		writer := resp.NewResponseWriter(conn)
+		writer := cp.writerFor(conn)
 		return writer.WriteError("ERR unknown command")
 	}
 
 	cmd, ok := parts[0].Value.(string)
 	if !ok {
-		writer := resp.NewResponseWriter(conn)
+		writer := cp.writerFor(conn)
 		return writer.WriteError("ERR unknown command")
 	}
 
 	cmdUpper := strings.ToUpper(cmd)
-	writer := resp.NewResponseWriter(conn)
+	writer := cp.writerFor(conn)
+
+	inTransaction := cp.transactionManager.IsInTransaction(conn)
 
-	// Get handler
-	handler, exists := cp.handlers[cmdUpper]
+	// Get handler; commands that fail validation abort the transaction they were meant for
+	handler, exists := cp.handlerFor(conn, cmdUpper)
 	if !exists {
+		cp.transactionManager.AbortTransaction(conn)
 		return writer.WriteError("ERR unknown command")
 	}
+	spec, known := commandTable[cmdUpper]
+	if known && !spec.CheckArity(len(parts)) {
+		cp.transactionManager.AbortTransaction(conn)
+		return writer.WriteError("ERR wrong number of arguments for '" + strings.ToLower(cmd) + "' command")
+	}
+	if inTransaction && spec.NoMulti {
+		cp.transactionManager.AbortTransaction(conn)
+		return writer.WriteError("ERR Command not allowed inside a transaction")
+	}
+	// In cluster mode, keys served by another node send the client there.
+	// ASKING only holds for the next command, or the next transaction.
+	if cp.cluster != nil && cp.routed(conn) {
+		if cmdUpper != "ASKING" {
+			defer func() {
+				if !cp.transactionManager.IsInTransaction(conn) {
+					cp.clients.SetAsking(conn, false)
+				}
+			}()
+		}
+		if cmdUpper != "EXEC" {
+			if err := cp.clusterRedirect(conn, parts); err != nil {
+				cp.transactionManager.AbortTransaction(conn)
+				return writer.WriteError(err.Error())
+			}
+		}
+	}
+	// Writes wait while a failover holds them, then find out whether this
+	// is still a master
+	if cp.replication != nil && ((spec.Write && !inTransaction) || cmdUpper == "EXEC") {
+		cp.replication.WaitWrites(conn)
+	}
+	// Replicas only take writes from their master
+	if spec.Write && cp.replication != nil && cp.replication.RejectsWrite(conn) {
+		cp.transactionManager.AbortTransaction(conn)
+		return writer.WriteError(replication.ErrReadOnly.Error())
+	}
 
-	// Update handler writer for this connection
-	handler.SetWriter(writer)
+	// A subscribed RESP2 client can only manage its subscriptions, since
+	// replies would be indistinguishable from messages
+	if cp.clients.Protocol(conn) == resp.RESP2 && cp.broker.Subscriptions(conn) > 0 {
+		if !spec.PubSub {
+			return writer.WriteError("ERR Can't execute '" + strings.ToLower(cmd) +
+				"': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context")
+		}
+		if cmdUpper == "PING" {
+			return cp.subscribedPing(parts, writer)
+		}
+	}
 
 	// Handle transaction commands specially
 	switch cmdUpper {
 	case "MULTI":
+		if inTransaction {
+			return writer.WriteError("ERR MULTI calls can not be nested")
+		}
 		cp.transactionManager.StartTransaction(conn)
 		return writer.WriteSimpleString("OK")
 	case "EXEC":
 		return cp.executeTransaction(conn, writer)
 	case "DISCARD":
 		return cp.discardTransaction(conn, writer)
+	case "WATCH":
+		return cp.watchKeys(conn, parts, writer)
 	}
 
 	// If in transaction, queue the command
-	if cp.transactionManager.IsInTransaction(conn) {
-		cp.transactionManager.QueueCommand(conn, parts, handler)
+	if inTransaction {
+		cp.transactionManager.QueueCommand(conn, parts)
 		return writer.WriteSimpleString("QUEUED")
 	}
 
+	switch cmdUpper {
+	case "SELECT":
+		return cp.selectDatabase(conn, parts, writer)
+	case "UNWATCH":
+		cp.transactionManager.Unwatch(conn)
+		return writer.WriteSimpleString("OK")
+	}
+
+	// Blocking handlers take the execution lock around each attempt, so they
+	// do not hold up transactions while they wait
+	if blocking, ok := handler.(BlockingHandler); ok {
+		return blocking.Handle(parts, conn, writer)
+	}
+
 	// Execute command normally
-	return handler.Handle(parts, conn)
+	cp.execLock.RLock()
+	defer cp.execLock.RUnlock()
+	if spec.Write {
+		return cp.executeWrite(conn, handler, parts, writer)
+	}
+	return handler.Handle(parts, conn, writer)
+}
+
+// subscribedPing replies to PING from a subscribed RESP2 client in the shape
+// of a message, as Redis does
+func (cp *CommandProcessor) subscribedPing(parts []resp.RespValue, writer *resp.ResponseWriter) error {
+	if len(parts) > 2 {
+		return writer.WriteError("ERR wrong number of arguments for 'ping' command")
+	}
+	message := ""
+	if len(parts) == 2 {
+		message, _ = parts[1].Value.(string)
+	}
+	return writer.WriteValue(resp.RespValue{Type: resp.ArrayType, Value: []resp.RespValue{
+		{Type: resp.BulkString, Value: "pong"},
+		{Type: resp.BulkString, Value: message},
+	}})
+}
+
+// selectDatabase switches the database used by conn for subsequent commands
+func (cp *CommandProcessor) selectDatabase(conn net.Conn, parts []resp.RespValue, writer *resp.ResponseWriter) error {
+	if len(parts) != 2 {
+		return writer.WriteError("ERR wrong number of arguments for 'select' command")
+	}
+
+	arg, _ := parts[1].Value.(string)
+	index, err := strconv.Atoi(arg)
+	if err != nil {
+		return writer.WriteError("ERR value is not an integer or out of range")
+	}
+	if index < 0 || index >= len(cp.handlers) {
+		return writer.WriteError("ERR DB index is out of range")
+	}
+	if cp.cluster != nil && index != 0 {
+		return writer.WriteError("ERR SELECT is not allowed in cluster mode")
+	}
+
+	cp.clients.Select(conn, index)
+	return writer.WriteSimpleString("OK")
 }
 
 // executeTransaction executes all queued commands in a transaction
 func (cp *CommandProcessor) executeTransaction(conn net.Conn, writer *resp.ResponseWriter) error {
+	// No other client runs a command until the whole transaction has run
+	cp.execLock.Lock()
+	defer cp.execLock.Unlock()
+
+	// Check the transaction state before ExecuteTransaction resets it
+	aborted := cp.transactionManager.IsAborted(conn)
+	dirty := cp.transactionManager.WatchedKeysChanged(conn)
+
 	commands, ok := cp.transactionManager.ExecuteTransaction(conn)
 	if !ok {
 		return writer.WriteError("ERR EXEC without MULTI")
 	}
 
+	if aborted {
+		return writer.WriteError("EXECABORT Transaction discarded because of previous errors.")
+	}
+
+	// A watched key was modified, so the transaction is aborted
+	if dirty {
+		return writer.WriteNullArray()
+	}
+
 	if len(commands) == 0 {
 		return writer.WriteEmptyArray()
 	}
 
+	// The keys of the whole transaction must be served here, in one slot
+	if cp.cluster != nil && cp.routed(conn) {
+		queued := make([][]resp.RespValue, 0, len(commands))
+		for _, queuedCmd := range commands {
+			queued = append(queued, queuedCmd.Parts)
+		}
+		if err := cp.clusterRedirect(conn, queued...); err != nil {
+			return writer.WriteError(err.Error())
+		}
+	}
+
+	// This server may have become a replica since the writes were queued
+	if cp.replication != nil && cp.replication.RejectsWrite(conn) {
+		for _, queuedCmd := range commands {
+			name, _ := queuedCmd.Parts[0].Value.(string)
+			if commandTable[strings.ToUpper(name)].Write {
+				return writer.WriteError(replication.ErrReadOnly.Error())
+			}
+		}
+	}
+
 	// Execute commands and collect results
 	results := make([]resp.RespValue, 0, len(commands))
+	var writes []propagatedCommand
 	for _, queuedCmd := range commands {
 		// Create a capturing writer to collect the command's response
 		capturingWriter, capturingConn := resp.NewCapturingWriter()
 
-		// Temporarily replace the handler's writer with the capturing writer
-		queuedCmd.Handler.SetWriter(capturingWriter)
+		// Resolve the handler now, since an earlier SELECT in the
+		// transaction may have changed the database
+		name, _ := queuedCmd.Parts[0].Value.(string)
+		name = strings.ToUpper(name)
+		handler, _ := cp.handlerFor(conn, name)
 
 		// Execute the command with the capturing connection
-		err := queuedCmd.Handler.Handle(queuedCmd.Parts, capturingConn)
+		// Blocking commands must not wait while the transaction holds the lock
+		var err error
+		if name == "SELECT" {
+			err = cp.selectDatabase(conn, queuedCmd.Parts, capturingWriter)
+		} else if blocking, ok := handler.(BlockingHandler); ok {
+			err = blocking.HandleNonBlocking(queuedCmd.Parts, capturingConn, capturingWriter)
+		} else {
+			err = handler.Handle(queuedCmd.Parts, capturingConn, capturingWriter)
+		}
 
 		if err != nil {
 			// If there was an error executing the command, capture it
@@ -125,12 +456,45 @@ func (cp *CommandProcessor) executeTransaction(conn net.Conn, writer *resp.Respo
 			// Get the captured response
 			result := capturingConn.GetCapturedResponse()
 			results = append(results, result)
+			if commandTable[name].Write && result.Type != resp.ErrorType {
+				db := cp.clients.Selected(conn)
+				for _, args := range rewriteCommand(commandArgs(queuedCmd.Parts), result, time.Now()) {
+					writes = append(writes, propagatedCommand{db: db, args: args})
+				}
+			}
 		}
 	}
 
+	cp.propagateTransaction(conn, writes)
 	return writer.WriteTransactionResults(results)
 }
 
+// watchKeys starts watching keys of the selected database for the next EXEC
+func (cp *CommandProcessor) watchKeys(conn net.Conn, parts []resp.RespValue, writer *resp.ResponseWriter) error {
+	if len(parts) < 2 {
+		return writer.WriteError("ERR wrong number of arguments for 'watch' command")
+	}
+	if cp.transactionManager.IsInTransaction(conn) {
+		return writer.WriteError("ERR WATCH inside MULTI is not allowed")
+	}
+
+	cp.execLock.RLock()
+	defer cp.execLock.RUnlock()
+
+	keys := make([]string, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		key, ok := part.Value.(string)
+		if !ok {
+			return writer.WriteError("ERR invalid key type")
+		}
+		keys = append(keys, key)
+	}
+
+	db := cp.databases.DB(cp.clients.Selected(conn))
+	cp.transactionManager.Watch(conn, db, keys)
+	return writer.WriteSimpleString("OK")
+}
+
 // discardTransaction discards the current transaction
 func (cp *CommandProcessor) discardTransaction(conn net.Conn, writer *resp.ResponseWriter) error {
 	if !cp.transactionManager.DiscardTransaction(conn) {
@@ -142,20 +506,43 @@ func (cp *CommandProcessor) discardTransaction(conn net.Conn, writer *resp.Respo
 // CleanupConnection cleans up resources for a connection
 func (cp *CommandProcessor) CleanupConnection(conn net.Conn) {
 	cp.transactionManager.CleanupConnection(conn)
+	cp.broker.CleanupConnection(conn)
+	cp.clients.CleanupConnection(conn)
+	if cp.replication != nil {
+		cp.replication.CleanupConnection(conn)
+	}
 }
 
 // Interfaces for dependencies - Updated to match existing store implementations
 type KeyValueStore interface {
 	Set(key, value string, expiry ...time.Duration) error
-	Get(key string) (string, bool)
+	Get(key string) (string, bool, error)
 	Delete(key string) error
+	Update(key string, fn store.UpdateFunc) error
+	Replace(key string, fn store.UpdateFunc) error
+	UpdateMultiple(keys []string, fn store.MultiUpdateFunc) error
+	ReplaceMultiple(keys []string, fn store.MultiUpdateFunc) error
+	GetMultiple(keys []string) ([]string, []bool)
+	XAdd(key, id string, fields []string) (store.StreamID, error)
+	XRange(key string, start, end store.StreamID, count int) []store.StreamEntry
+	XReadAfter(key string, id store.StreamID) []store.StreamEntry
+	XLastID(key string) (store.StreamID, bool)
+	XLen(key string) (int, bool)
 	GetStreamNotifier() *store.StreamNotifier
+	Type(key string) string
+	Del(keys ...string) int
+	Unlink(keys ...string) int
+	Exists(keys ...string) int
+	Keys() []string
+	RandomKey() (string, bool)
+	Scan(cursor uint64, count int, keyType string) (uint64, []string)
+	Rename(src, dst string, nx bool) (bool, error)
 }
 
 type ListStore interface {
 	LPush(key string, values ...string) (int, error)
 	RPush(key string, values ...string) (int, error)
-	LPop(key string, count ...int) ([]string, bool)
+	LPop(key string, count ...int) (values []string, emptied bool, exists bool)
 	LRange(key string, start, end int) ([]string, bool)
 	LLen(key string) (int, bool)
 }
@@ -0,0 +1,177 @@
+package processor
+
+import "github.com/codecrafters-io/redis-starter-go/app/resp"
+
+// CommandSpec describes a command so it can be validated before it runs or is queued
+type CommandSpec struct {
+	// Arity is the exact number of parts including the command name, or its
+	// negation when that is only the minimum, following Redis's convention
+	Arity int
+	// Write marks commands that may modify the keyspace
+	Write bool
+	// NoMulti marks commands that cannot be queued in a transaction
+	NoMulti bool
+	// PubSub marks commands a RESP2 client may still run once it has subscribed
+	PubSub bool
+	// Keys locates the key arguments, which cluster mode routes by hash slot
+	Keys KeySpec
+}
+
+// KeySpec locates the key arguments of a command: every Step-th part from
+// First to Last, a negative Last counting from the end. A zero KeySpec means
+// the command takes no keys.
+type KeySpec struct {
+	First int
+	Last  int
+	Step  int
+}
+
+// Key specs shared by most commands
+var (
+	firstKey = KeySpec{First: 1, Last: 1, Step: 1}
+	allKeys  = KeySpec{First: 1, Last: -1, Step: 1}
+)
+
+// CheckArity reports whether a command with the given number of parts has a valid arity
+func (s CommandSpec) CheckArity(parts int) bool {
+	if s.Arity < 0 {
+		return parts >= -s.Arity
+	}
+	return parts == s.Arity
+}
+
+// KeyArgs returns the key arguments of a command made of parts
+func (s CommandSpec) KeyArgs(parts []resp.RespValue) []string {
+	if s.Keys.Step == 0 {
+		return nil
+	}
+	last := s.Keys.Last
+	if last < 0 {
+		last += len(parts)
+	}
+	var keys []string
+	for i := s.Keys.First; i <= last && i < len(parts); i += s.Keys.Step {
+		key, _ := parts[i].Value.(string)
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// commandTable lists every supported command
+var commandTable = map[string]CommandSpec{
+	// Basic commands
+	"PING":   {Arity: -1, PubSub: true},
+	"ECHO":   {Arity: 2},
+	"INFO":   {Arity: -1},
+	"HELLO":  {Arity: -1, NoMulti: true},
+	"CONFIG": {Arity: -2},
+
+	// Persistence commands
+	"SAVE":         {Arity: 1, NoMulti: true},
+	"BGSAVE":       {Arity: -1},
+	"LASTSAVE":     {Arity: 1},
+	"BGREWRITEAOF": {Arity: 1},
+
+	// Replication commands
+	"PSYNC":     {Arity: -3, NoMulti: true},
+	"REPLCONF":  {Arity: -1, NoMulti: true},
+	"REPLICAOF": {Arity: 3, NoMulti: true},
+	"SLAVEOF":   {Arity: 3, NoMulti: true},
+	"WAIT":      {Arity: 3},
+	"WAITAOF":   {Arity: 4},
+	"FAILOVER":  {Arity: -1, NoMulti: true},
+
+	// Sentinel commands
+	"SENTINEL": {Arity: -2, NoMulti: true},
+	"ROLE":     {Arity: 1},
+
+	// Cluster commands
+	"CLUSTER": {Arity: -2},
+	"ASKING":  {Arity: 1},
+
+	// Keyspace commands
+	"DEL":       {Arity: -2, Write: true, Keys: allKeys},
+	"UNLINK":    {Arity: -2, Write: true, Keys: allKeys},
+	"EXISTS":    {Arity: -2, Keys: allKeys},
+	"TOUCH":     {Arity: -2, Keys: allKeys},
+	"KEYS":      {Arity: 2},
+	"RENAME":    {Arity: 3, Write: true, Keys: KeySpec{First: 1, Last: 2, Step: 1}},
+	"RENAMENX":  {Arity: 3, Write: true, Keys: KeySpec{First: 1, Last: 2, Step: 1}},
+	"COPY":      {Arity: -3, Write: true, Keys: KeySpec{First: 1, Last: 2, Step: 1}},
+	"RANDOMKEY": {Arity: 1},
+	"SCAN":      {Arity: -2},
+
+	// Database commands
+	"SELECT":   {Arity: 2},
+	"MOVE":     {Arity: 3, Write: true, Keys: firstKey},
+	"SWAPDB":   {Arity: 3, Write: true},
+	"FLUSHDB":  {Arity: -1, Write: true},
+	"FLUSHALL": {Arity: -1, Write: true},
+	"DBSIZE":   {Arity: 1},
+
+	// String commands
+	"SET":      {Arity: -3, Write: true, Keys: firstKey},
+	"GET":      {Arity: 2, Keys: firstKey},
+	"INCR":     {Arity: 2, Write: true, Keys: firstKey},
+	"TYPE":     {Arity: 2, Keys: firstKey},
+	"APPEND":   {Arity: 3, Write: true, Keys: firstKey},
+	"STRLEN":   {Arity: 2, Keys: firstKey},
+	"GETRANGE": {Arity: 4, Keys: firstKey},
+	"SUBSTR":   {Arity: 4, Keys: firstKey},
+	"SETRANGE": {Arity: 4, Write: true, Keys: firstKey},
+	"GETDEL":   {Arity: 2, Write: true, Keys: firstKey},
+	"GETEX":    {Arity: -2, Write: true, Keys: firstKey},
+	"GETSET":   {Arity: 3, Write: true, Keys: firstKey},
+	"SETNX":    {Arity: 3, Write: true, Keys: firstKey},
+	"SETEX":    {Arity: 4, Write: true, Keys: firstKey},
+	"PSETEX":   {Arity: 4, Write: true, Keys: firstKey},
+	"LCS":      {Arity: -3, Keys: KeySpec{First: 1, Last: 2, Step: 1}},
+	"MGET":     {Arity: -2, Keys: allKeys},
+	"MSET":     {Arity: -3, Write: true, Keys: KeySpec{First: 1, Last: -1, Step: 2}},
+	"MSETNX":   {Arity: -3, Write: true, Keys: KeySpec{First: 1, Last: -1, Step: 2}},
+
+	// Bitmap commands
+	"SETBIT":      {Arity: 4, Write: true, Keys: firstKey},
+	"GETBIT":      {Arity: 3, Keys: firstKey},
+	"BITCOUNT":    {Arity: -2, Keys: firstKey},
+	"BITPOS":      {Arity: -3, Keys: firstKey},
+	"BITOP":       {Arity: -4, Write: true, Keys: KeySpec{First: 2, Last: -1, Step: 1}},
+	"BITFIELD":    {Arity: -2, Write: true, Keys: firstKey},
+	"BITFIELD_RO": {Arity: -2, Keys: firstKey},
+
+	// HyperLogLog commands
+	"PFADD":   {Arity: -2, Write: true, Keys: firstKey},
+	"PFCOUNT": {Arity: -2, Keys: allKeys},
+	"PFMERGE": {Arity: -2, Write: true, Keys: allKeys},
+
+	// List commands
+	"LPUSH":  {Arity: -3, Write: true, Keys: firstKey},
+	"RPUSH":  {Arity: -3, Write: true, Keys: firstKey},
+	"LPOP":   {Arity: -2, Write: true, Keys: firstKey},
+	"LRANGE": {Arity: 4, Keys: firstKey},
+	"LLEN":   {Arity: 2, Keys: firstKey},
+	"BLPOP":  {Arity: -3, Write: true, Keys: KeySpec{First: 1, Last: -2, Step: 1}},
+
+	// Transaction commands
+	"MULTI":   {Arity: 1},
+	"EXEC":    {Arity: 1},
+	"DISCARD": {Arity: 1},
+	"WATCH":   {Arity: -2, Keys: allKeys},
+	"UNWATCH": {Arity: 1},
+
+	// Stream commands
+	"XADD":   {Arity: -5, Write: true, Keys: firstKey},
+	"XRANGE": {Arity: -4, Keys: firstKey},
+	"XREAD":  {Arity: -4},
+
+	// Pub/Sub commands
+	"SUBSCRIBE":    {Arity: -2, NoMulti: true, PubSub: true},
+	"UNSUBSCRIBE":  {Arity: -1, NoMulti: true, PubSub: true},
+	"PSUBSCRIBE":   {Arity: -2, NoMulti: true, PubSub: true},
+	"PUNSUBSCRIBE": {Arity: -1, NoMulti: true, PubSub: true},
+	"SSUBSCRIBE":   {Arity: -2, NoMulti: true, PubSub: true, Keys: allKeys},
+	"SUNSUBSCRIBE": {Arity: -1, NoMulti: true, PubSub: true, Keys: allKeys},
+	"PUBLISH":      {Arity: 3},
+	"SPUBLISH":     {Arity: 3, Keys: firstKey},
+	"PUBSUB":       {Arity: -2},
+}
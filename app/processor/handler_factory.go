@@ -1,68 +1,216 @@
 package processor
 
 import (
+	"github.com/codecrafters-io/redis-starter-go/app/aof"
+	topology "github.com/codecrafters-io/redis-starter-go/app/cluster"
 	"github.com/codecrafters-io/redis-starter-go/app/config"
 	"github.com/codecrafters-io/redis-starter-go/app/handlers/basic"
+	"github.com/codecrafters-io/redis-starter-go/app/handlers/bitmap"
+	"github.com/codecrafters-io/redis-starter-go/app/handlers/cluster"
+	"github.com/codecrafters-io/redis-starter-go/app/handlers/database"
+	"github.com/codecrafters-io/redis-starter-go/app/handlers/hyperloglog"
+	"github.com/codecrafters-io/redis-starter-go/app/handlers/keyspace"
 	"github.com/codecrafters-io/redis-starter-go/app/handlers/keyvalue"
 	"github.com/codecrafters-io/redis-starter-go/app/handlers/list"
+	"github.com/codecrafters-io/redis-starter-go/app/handlers/persistence"
+	"github.com/codecrafters-io/redis-starter-go/app/handlers/pubsub"
+	"github.com/codecrafters-io/redis-starter-go/app/handlers/replication"
+	"github.com/codecrafters-io/redis-starter-go/app/handlers/sentinel"
 	"github.com/codecrafters-io/redis-starter-go/app/handlers/stream"
 	"github.com/codecrafters-io/redis-starter-go/app/handlers/transaction"
+	"github.com/codecrafters-io/redis-starter-go/app/notify"
+	broker "github.com/codecrafters-io/redis-starter-go/app/pubsub"
+	"github.com/codecrafters-io/redis-starter-go/app/rdb"
+	repl "github.com/codecrafters-io/redis-starter-go/app/replication"
+	monitor "github.com/codecrafters-io/redis-starter-go/app/sentinel"
+	"github.com/codecrafters-io/redis-starter-go/app/store"
 )
 
 // HandlerFactory creates command handlers with proper dependency injection
 type HandlerFactory struct {
-	kvStore   KeyValueStore
-	listStore ListStore
+	databases *store.Databases
+	broker    *broker.Broker
+	clients   *ClientManager
+	notifier  *notify.Notifier
 	config    *config.Config
+	saver     *rdb.Saver
+	aof       *aof.AOF
+	repl      *repl.Replication
+	cluster   *topology.Cluster
 }
 
 // NewHandlerFactory creates a new handler factory
-func NewHandlerFactory(kvStore KeyValueStore, listStore ListStore) *HandlerFactory {
+func NewHandlerFactory(databases *store.Databases, broker *broker.Broker, clients *ClientManager, notifier *notify.Notifier) *HandlerFactory {
 	return &HandlerFactory{
-		kvStore:   kvStore,
-		listStore: listStore,
+		databases: databases,
+		broker:    broker,
+		clients:   clients,
+		notifier:  notifier,
 	}
 }
 
-// SetConfig sets the configuration for handlers that need it
-func (hf *HandlerFactory) SetConfig(cfg *config.Config) {
+// SetConfig sets the configuration and the persistence, replication and
+// cluster state built from it
+func (hf *HandlerFactory) SetConfig(cfg *config.Config, saver *rdb.Saver, aof *aof.AOF, repl *repl.Replication, cluster *topology.Cluster) {
 	hf.config = cfg
+	hf.saver = saver
+	hf.aof = aof
+	hf.repl = repl
+	hf.cluster = cluster
 }
 
-// CreateAllHandlers creates all command handlers
-func (hf *HandlerFactory) CreateAllHandlers() map[string]CommandHandler {
+// CreateAllHandlers creates all command handlers bound to the database with the given index
+func (hf *HandlerFactory) CreateAllHandlers(index int) map[string]CommandHandler {
 	handlers := make(map[string]CommandHandler)
 
+	db := hf.databases.DB(index)
+	var kvStore KeyValueStore = db
+	var listStore ListStore = db
+	events := hf.notifier.ForDatabase(index)
+
 	// Basic commands
 	handlers["PING"] = basic.NewPingHandler()
 	handlers["ECHO"] = basic.NewEchoHandler()
 	if hf.config != nil {
-		handlers["INFO"] = basic.NewInfoHandler(hf.config)
+		handlers["INFO"] = basic.NewInfoHandler(hf.config, hf.databases, hf.repl, hf.saver, hf.aof)
+		handlers["HELLO"] = basic.NewHelloHandler(hf.config, hf.clients, hf.repl)
+		handlers["CONFIG"] = basic.NewConfigHandler(hf.config)
+
+		// Persistence commands
+		handlers["SAVE"] = persistence.NewSaveHandler(hf.saver)
+		handlers["BGSAVE"] = persistence.NewBGSaveHandler(hf.saver)
+		handlers["LASTSAVE"] = persistence.NewLastSaveHandler(hf.saver)
+		handlers["BGREWRITEAOF"] = persistence.NewBGRewriteAOFHandler(hf.aof)
+
+		// Replication commands
+		handlers["PSYNC"] = replication.NewPSyncHandler(hf.repl)
+		handlers["REPLCONF"] = replication.NewReplConfHandler(hf.repl)
+		handlers["REPLICAOF"] = replication.NewReplicaOfHandler(hf.repl)
+		handlers["SLAVEOF"] = replication.NewReplicaOfHandler(hf.repl)
+		handlers["WAIT"] = replication.NewWaitHandler(hf.repl, hf.clients)
+		handlers["WAITAOF"] = replication.NewWaitAOFHandler(hf.repl, hf.clients)
+		handlers["FAILOVER"] = replication.NewFailoverHandler(hf.repl)
+		handlers["ROLE"] = replication.NewRoleHandler(hf.repl)
 	}
 
+	// Cluster commands
+	if hf.cluster != nil {
+		handlers["CLUSTER"] = cluster.NewClusterHandler(hf.cluster)
+		handlers["ASKING"] = cluster.NewAskingHandler(hf.clients)
+	}
+
+	// Keyspace commands
+	handlers["DEL"] = keyspace.NewDelHandler(kvStore)
+	handlers["UNLINK"] = keyspace.NewUnlinkHandler(kvStore)
+	handlers["EXISTS"] = keyspace.NewExistsHandler(kvStore)
+	handlers["TOUCH"] = keyspace.NewTouchHandler(kvStore)
+	handlers["KEYS"] = keyspace.NewKeysHandler(kvStore)
+	handlers["RENAME"] = keyspace.NewRenameHandler(kvStore, events)
+	handlers["RENAMENX"] = keyspace.NewRenameNXHandler(kvStore, events)
+	handlers["COPY"] = keyspace.NewCopyHandler(hf.databases, hf.notifier, index)
+	handlers["RANDOMKEY"] = keyspace.NewRandomKeyHandler(kvStore)
+	handlers["SCAN"] = keyspace.NewScanHandler(kvStore)
+
+	// Database commands
+	handlers["SELECT"] = database.NewSelectHandler()
+	handlers["MOVE"] = database.NewMoveHandler(hf.databases, hf.notifier, index)
+	handlers["SWAPDB"] = database.NewSwapDBHandler(hf.databases)
+	handlers["FLUSHDB"] = database.NewFlushDBHandler(db)
+	handlers["FLUSHALL"] = database.NewFlushAllHandler(hf.databases)
+	handlers["DBSIZE"] = database.NewDBSizeHandler(db)
+
 	// Key-value commands
-	handlers["SET"] = keyvalue.NewSetHandler(hf.kvStore)
-	handlers["GET"] = keyvalue.NewGetHandler(hf.kvStore)
-	handlers["INCR"] = keyvalue.NewIncrHandler(hf.kvStore)
-	handlers["TYPE"] = keyvalue.NewTypeHandler(hf.kvStore, hf.listStore)
+	handlers["SET"] = keyvalue.NewSetHandler(kvStore, events)
+	handlers["GET"] = keyvalue.NewGetHandler(kvStore)
+	handlers["INCR"] = keyvalue.NewIncrHandler(kvStore, events)
+	handlers["TYPE"] = keyvalue.NewTypeHandler(kvStore)
+
+	// String manipulation commands
+	handlers["APPEND"] = keyvalue.NewAppendHandler(kvStore, events)
+	handlers["STRLEN"] = keyvalue.NewStrLenHandler(kvStore)
+	handlers["GETRANGE"] = keyvalue.NewGetRangeHandler(kvStore)
+	handlers["SUBSTR"] = keyvalue.NewGetRangeHandler(kvStore)
+	handlers["SETRANGE"] = keyvalue.NewSetRangeHandler(kvStore, events)
+	handlers["GETDEL"] = keyvalue.NewGetDelHandler(kvStore)
+	handlers["GETEX"] = keyvalue.NewGetExHandler(kvStore, events)
+	handlers["GETSET"] = keyvalue.NewGetSetHandler(kvStore, events)
+	handlers["SETNX"] = keyvalue.NewSetNXHandler(kvStore, events)
+	handlers["SETEX"] = keyvalue.NewSetExHandler(kvStore, events)
+	handlers["PSETEX"] = keyvalue.NewPSetExHandler(kvStore, events)
+	handlers["LCS"] = keyvalue.NewLCSHandler(kvStore)
+	handlers["MGET"] = keyvalue.NewMGetHandler(kvStore)
+	handlers["MSET"] = keyvalue.NewMSetHandler(kvStore, events)
+	handlers["MSETNX"] = keyvalue.NewMSetNXHandler(kvStore, events)
+
+	// Bitmap commands
+	handlers["SETBIT"] = bitmap.NewSetBitHandler(kvStore, events)
+	handlers["GETBIT"] = bitmap.NewGetBitHandler(kvStore)
+	handlers["BITCOUNT"] = bitmap.NewBitCountHandler(kvStore)
+	handlers["BITPOS"] = bitmap.NewBitPosHandler(kvStore)
+	handlers["BITOP"] = bitmap.NewBitOpHandler(kvStore, events)
+	handlers["BITFIELD"] = bitmap.NewBitFieldHandler(kvStore, events)
+	handlers["BITFIELD_RO"] = bitmap.NewBitFieldROHandler(kvStore)
+
+	// HyperLogLog commands
+	handlers["PFADD"] = hyperloglog.NewPFAddHandler(kvStore, events)
+	handlers["PFCOUNT"] = hyperloglog.NewPFCountHandler(kvStore)
+	handlers["PFMERGE"] = hyperloglog.NewPFMergeHandler(kvStore, events)
 
 	// List commands
-	handlers["LPUSH"] = list.NewLPushHandler(hf.listStore)
-	handlers["RPUSH"] = list.NewRPushHandler(hf.listStore)
-	handlers["LPOP"] = list.NewLPopHandler(hf.listStore)
-	handlers["LRANGE"] = list.NewLRangeHandler(hf.listStore)
-	handlers["LLEN"] = list.NewLLenHandler(hf.listStore)
-	handlers["BLPOP"] = list.NewBLPopHandler(hf.listStore)
+	handlers["LPUSH"] = list.NewLPushHandler(listStore, events)
+	handlers["RPUSH"] = list.NewRPushHandler(listStore, events)
+	handlers["LPOP"] = list.NewLPopHandler(listStore, events)
+	handlers["LRANGE"] = list.NewLRangeHandler(listStore)
+	handlers["LLEN"] = list.NewLLenHandler(listStore)
+	handlers["BLPOP"] = list.NewBLPopHandler(listStore, events)
 
 	// Transaction commands (these are handled specially in the processor)
 	handlers["MULTI"] = transaction.NewMultiHandler()
 	handlers["EXEC"] = transaction.NewExecHandler()
 	handlers["DISCARD"] = transaction.NewDiscardHandler()
+	handlers["WATCH"] = transaction.NewWatchHandler()
+	handlers["UNWATCH"] = transaction.NewUnwatchHandler()
 
 	// Stream commands
-	handlers["XADD"] = stream.NewXAddHandler(hf.kvStore)
-	handlers["XRANGE"] = stream.NewXRangeHandler(hf.kvStore)
-	handlers["XREAD"] = stream.NewXReadHandler(hf.kvStore)
+	handlers["XADD"] = stream.NewXAddHandler(kvStore, events)
+	handlers["XRANGE"] = stream.NewXRangeHandler(kvStore)
+	handlers["XREAD"] = stream.NewXReadHandler(kvStore)
+
+	// Pub/Sub commands
+	handlers["SUBSCRIBE"] = pubsub.NewSubscribeHandler(hf.broker)
+	handlers["UNSUBSCRIBE"] = pubsub.NewUnsubscribeHandler(hf.broker)
+	handlers["PSUBSCRIBE"] = pubsub.NewPSubscribeHandler(hf.broker)
+	handlers["PUNSUBSCRIBE"] = pubsub.NewPUnsubscribeHandler(hf.broker)
+	handlers["SSUBSCRIBE"] = pubsub.NewSSubscribeHandler(hf.broker)
+	handlers["SUNSUBSCRIBE"] = pubsub.NewSUnsubscribeHandler(hf.broker)
+	handlers["PUBLISH"] = pubsub.NewPublishHandler(hf.broker)
+	handlers["SPUBLISH"] = pubsub.NewSPublishHandler(hf.broker)
+	handlers["PUBSUB"] = pubsub.NewPubSubHandler(hf.broker)
+
+	return handlers
+}
+
+// CreateSentinelHandlers creates the handlers of a sentinel, which serves no
+// dataset: only its own state and pub/sub for the events it raises
+func (hf *HandlerFactory) CreateSentinelHandlers(s *monitor.Sentinel) map[string]CommandHandler {
+	handlers := make(map[string]CommandHandler)
+
+	// Basic commands
+	handlers["PING"] = basic.NewPingHandler()
+	handlers["INFO"] = sentinel.NewInfoHandler(hf.config, s)
+	handlers["HELLO"] = basic.NewHelloHandler(hf.config, hf.clients, s)
+
+	// Sentinel commands
+	handlers["SENTINEL"] = sentinel.NewSentinelHandler(s)
+	handlers["ROLE"] = sentinel.NewRoleHandler(s)
+
+	// Pub/Sub commands
+	handlers["SUBSCRIBE"] = pubsub.NewSubscribeHandler(hf.broker)
+	handlers["UNSUBSCRIBE"] = pubsub.NewUnsubscribeHandler(hf.broker)
+	handlers["PSUBSCRIBE"] = pubsub.NewPSubscribeHandler(hf.broker)
+	handlers["PUNSUBSCRIBE"] = pubsub.NewPUnsubscribeHandler(hf.broker)
+	handlers["PUBLISH"] = pubsub.NewPublishHandler(hf.broker)
+	handlers["PUBSUB"] = pubsub.NewPubSubHandler(hf.broker)
 
 	return handlers
 }
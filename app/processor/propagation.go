@@ -0,0 +1,236 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/aof"
+	"github.com/codecrafters-io/redis-starter-go/app/config"
+	"github.com/codecrafters-io/redis-starter-go/app/rdb"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// propagatedCommand is a write command waiting to be propagated with its transaction
+type propagatedCommand struct {
+	db   int
+	args []string
+}
+
+// executeWrite runs a write command and propagates it once it has succeeded.
+// Writes run one at a time, so they are propagated in the order they executed.
+// The caller must hold the execution lock for reading.
+func (cp *CommandProcessor) executeWrite(conn net.Conn, handler CommandHandler, parts []resp.RespValue, writer *resp.ResponseWriter) error {
+	capturingWriter, capturingConn := resp.NewCapturingWriter()
+	capturingWriter.SetProtocol(writer.Protocol())
+
+	cp.propagateLock.Lock()
+	if err := handler.Handle(parts, conn, capturingWriter); err != nil {
+		cp.propagateLock.Unlock()
+		return err
+	}
+	reply := capturingConn.GetCapturedResponse()
+	if reply.Type != resp.ErrorType {
+		cp.propagate(conn, cp.clients.Selected(conn), commandArgs(parts), reply)
+	}
+	cp.propagateLock.Unlock()
+
+	return writer.WriteValue(reply)
+}
+
+// propagate logs a write command conn executed against database db,
+// rewritten so that replaying it reproduces what it did. The caller holds
+// the propagation lock or the execution lock exclusively.
+func (cp *CommandProcessor) propagate(conn net.Conn, db int, args []string, reply resp.RespValue) {
+	var commands []aof.Command
+	for _, command := range rewriteCommand(args, reply, time.Now()) {
+		commands = append(commands, aof.Command{DB: db, Args: command})
+	}
+	cp.feed(conn, commands)
+}
+
+// propagateTransaction logs the writes of a transaction of conn wrapped in
+// MULTI and EXEC, so a replay applies them all or none of them
+func (cp *CommandProcessor) propagateTransaction(conn net.Conn, commands []propagatedCommand) {
+	if len(commands) == 0 {
+		return
+	}
+	batch := []aof.Command{{DB: commands[0].db, Args: []string{"MULTI"}}}
+	for _, command := range commands {
+		batch = append(batch, aof.Command{DB: command.db, Args: command.args})
+	}
+	batch = append(batch, aof.Command{DB: commands[len(commands)-1].db, Args: []string{"EXEC"}})
+	cp.feed(conn, batch)
+}
+
+// feed appends commands, as they will be replayed, to the propagation stream
+// and logs them to the append-only file in one piece. The offset they end at
+// is what WAIT and WAITAOF sent by conn later wait for, so pings and other
+// traffic fed after them do not hold the waits up.
+func (cp *CommandProcessor) feed(conn net.Conn, commands []aof.Command) {
+	if len(commands) == 0 {
+		return
+	}
+	var offset int64
+	if cp.replication != nil {
+		for _, command := range commands {
+			offset = cp.replication.Feed(command.DB, command.Args)
+		}
+	}
+	if cp.aof != nil {
+		cp.aof.Append(commands, offset)
+	}
+	cp.clients.SetWriteOffset(conn, offset)
+}
+
+// commandArgs returns the arguments of a command as strings
+func commandArgs(parts []resp.RespValue) []string {
+	args := make([]string, len(parts))
+	for i, part := range parts {
+		args[i], _ = part.Value.(string)
+	}
+	return args
+}
+
+// writeLocker is held by blocking write commands around each attempt, so what
+// they change is propagated in order with every other write
+type writeLocker struct {
+	cp *CommandProcessor
+}
+
+func (l writeLocker) Lock() {
+	l.cp.execLock.RLock()
+	l.cp.propagateLock.Lock()
+}
+
+func (l writeLocker) Unlock() {
+	l.cp.propagateLock.Unlock()
+	l.cp.execLock.RUnlock()
+}
+
+// LoadData restores the dataset before any client connects: from the
+// append-only file when it is enabled, since it holds the latest writes, and
+// from the RDB snapshot otherwise
+func (cp *CommandProcessor) LoadData(cfg *config.Config) error {
+	if cfg.AppendOnly != "yes" {
+		stats, err := rdb.LoadFile(cfg.GetRDBPath(), cp.databases)
+		if err != nil {
+			return fmt.Errorf("%s: %w", cfg.GetRDBPath(), err)
+		}
+		fmt.Printf("Loaded %d keys from %s (%d expired)\n", stats.Keys, cfg.GetRDBPath(), stats.Expired)
+		return nil
+	}
+
+	conn := &replayConn{}
+	defer cp.CleanupConnection(conn)
+	stats, found, err := cp.aof.Load(func(command resp.RespValue) error {
+		conn.reply = conn.reply[:0]
+		if err := cp.Process(command, conn); err != nil {
+			return err
+		}
+		// Every command in the file succeeded when it was logged, so an
+		// error now means the dataset would not be what it was
+		if len(conn.reply) > 0 && conn.reply[0] == '-' {
+			parts, _ := command.Value.([]resp.RespValue)
+			return fmt.Errorf("error replaying %q: %s", strings.Join(commandArgs(parts), " "), strings.TrimSpace(string(conn.reply[1:])))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("append only file: %w", err)
+	}
+	if found {
+		fmt.Printf("Loaded %d keys and replayed %d commands from the append only file\n", stats.Keys, stats.Commands)
+	}
+	return cp.aof.Open()
+}
+
+// LoadSnapshot replaces the dataset with the snapshot a master sent for a
+// full resync and returns its metadata fields. The append-only file is
+// rewritten to match, since what it logged so far no longer leads to the new
+// dataset.
+func (cp *CommandProcessor) LoadSnapshot(r io.Reader) (map[string]string, error) {
+	cp.execLock.Lock()
+	defer cp.execLock.Unlock()
+
+	cp.databases.FlushAll(false)
+	stats, err := rdb.Load(r, cp.databases)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Loaded %d keys from the master's snapshot\n", stats.Keys)
+
+	if cp.aof.Enabled() {
+		if err := cp.aof.Rewrite(); err != nil {
+			fmt.Printf("Failed to rewrite the append only file after a resync: %v\n", err)
+		}
+	}
+	return stats.Aux, nil
+}
+
+// FsyncedOffset returns the replication offset up to which writes are on
+// disk in the append-only file, or -1 while it is off
+func (cp *CommandProcessor) FsyncedOffset() int64 {
+	return cp.aof.FsyncedOffset()
+}
+
+// StartReplication connects to the master given with --replicaof, once the
+// dataset has been loaded
+func (cp *CommandProcessor) StartReplication(cfg *config.Config) error {
+	if cfg.ReplicaOf == "" {
+		return nil
+	}
+	fields := strings.Fields(cfg.ReplicaOf)
+	if len(fields) != 2 {
+		return errors.New("replicaof must be \"<host> <port>\"")
+	}
+	port, err := strconv.Atoi(fields[1])
+	if err != nil || port < 0 || port > 65535 {
+		return errors.New("invalid master port")
+	}
+	return cp.replication.ReplicaOf(fields[0], port)
+}
+
+// setAppendOnly turns logging to the append-only file on or off
+func (cp *CommandProcessor) setAppendOnly(value string) error {
+	switch value {
+	case "yes":
+		return cp.aof.Enable()
+	case "no":
+		cp.aof.Disable()
+		return nil
+	default:
+		return errors.New("argument must be 'yes' or 'no'")
+	}
+}
+
+// appendOnly returns the appendonly parameter
+func (cp *CommandProcessor) appendOnly() string {
+	if cp.aof.Enabled() {
+		return "yes"
+	}
+	return "no"
+}
+
+// replayConn is the connection commands replayed from the append-only file
+// run on; it keeps the reply to the last command so failures stop the load
+type replayConn struct {
+	reply []byte
+}
+
+func (c *replayConn) Write(b []byte) (n int, err error) {
+	c.reply = append(c.reply, b...)
+	return len(b), nil
+}
+
+func (c *replayConn) Read(b []byte) (n int, err error)   { return 0, nil }
+func (c *replayConn) Close() error                       { return nil }
+func (c *replayConn) LocalAddr() net.Addr                { return nil }
+func (c *replayConn) RemoteAddr() net.Addr               { return nil }
+func (c *replayConn) SetDeadline(t time.Time) error      { return nil }
+func (c *replayConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *replayConn) SetWriteDeadline(t time.Time) error { return nil }
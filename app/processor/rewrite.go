@@ -0,0 +1,95 @@
+package processor
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// rewriteCommand turns a write command that executed at now, replying with
+// reply, into the commands that reproduce its effect exactly when replayed
+// later or elsewhere. Relative expiries become absolute, blocking pops
+// become the pop that happened and generated IDs become the IDs chosen.
+// It returns nothing for commands that changed nothing.
+func rewriteCommand(args []string, reply resp.RespValue, now time.Time) [][]string {
+	switch strings.ToUpper(args[0]) {
+	case "SET":
+		return [][]string{rewriteSet(args, now)}
+	case "SETEX", "PSETEX":
+		// The handler rejects expiries that are not positive, so these succeed
+		option := "EX"
+		if strings.EqualFold(args[0], "PSETEX") {
+			option = "PX"
+		}
+		at, _ := deadline(now, option, args[2])
+		return [][]string{{"SET", args[1], args[3], "PXAT", at}}
+	case "GETEX":
+		return rewriteGetEx(args, now)
+	case "BLPOP":
+		// The reply names the list that was popped, if any
+		popped, ok := reply.Value.([]resp.RespValue)
+		if !ok || len(popped) != 2 {
+			return nil
+		}
+		key, _ := popped[0].Value.(string)
+		return [][]string{{"LPOP", key}}
+	case "XADD":
+		// NOMKSTREAM-style null replies added nothing
+		id, ok := reply.Value.(string)
+		if !ok {
+			return nil
+		}
+		rewritten := append([]string(nil), args...)
+		if strings.Contains(rewritten[2], "*") {
+			rewritten[2] = id
+		}
+		return [][]string{rewritten}
+	}
+	return [][]string{args}
+}
+
+// rewriteSet replaces the EX, PX or EXAT option of SET with PXAT. Options are
+// read in pairs, as the handler reads them.
+func rewriteSet(args []string, now time.Time) []string {
+	rewritten := append([]string(nil), args...)
+	for i := 3; i < len(rewritten)-1; i += 2 {
+		if at, ok := deadline(now, rewritten[i], rewritten[i+1]); ok {
+			rewritten[i], rewritten[i+1] = "PXAT", at
+		}
+	}
+	return rewritten
+}
+
+// rewriteGetEx keeps only GETEX calls that changed the expiry, with absolute deadlines
+func rewriteGetEx(args []string, now time.Time) [][]string {
+	switch len(args) {
+	case 2:
+		return nil
+	case 4:
+		if at, ok := deadline(now, args[2], args[3]); ok {
+			return [][]string{{"GETEX", args[1], "PXAT", at}}
+		}
+	}
+	return [][]string{args}
+}
+
+// deadline converts a relative or second-based expiry option into a PXAT
+// deadline in Unix milliseconds. It reports false for other options and for
+// amounts the handlers ignore.
+func deadline(now time.Time, option, amount string) (string, bool) {
+	n, err := strconv.ParseInt(amount, 10, 64)
+	if err != nil || n <= 0 {
+		return "", false
+	}
+	switch strings.ToUpper(option) {
+	case "EX":
+		return strconv.FormatInt(now.UnixMilli()+n*1000, 10), true
+	case "PX":
+		return strconv.FormatInt(now.UnixMilli()+n, 10), true
+	case "EXAT":
+		return strconv.FormatInt(n*1000, 10), true
+	}
+	return "", false
+}
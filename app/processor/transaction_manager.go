@@ -2,20 +2,22 @@ package processor
 
 import (
 	"github.com/codecrafters-io/redis-starter-go/app/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/store"
 	"net"
 	"sync"
 )
 
 // QueuedCommand represents a command queued during a transaction
 type QueuedCommand struct {
-	Parts   []resp.RespValue
-	Handler CommandHandler
+	Parts []resp.RespValue
 }
 
 // TransactionState tracks the transaction state for a connection
 type TransactionState struct {
 	InTransaction  bool
+	Aborted        bool // a command failed validation while being queued
 	QueuedCommands []QueuedCommand
+	Watch          *store.Watch
 	mu             sync.Mutex
 }
 
@@ -32,17 +34,87 @@ func NewTransactionManager() *TransactionManager {
 	}
 }
 
-// StartTransaction begins a transaction for the given connection
-func (tm *TransactionManager) StartTransaction(conn net.Conn) {
+// stateFor returns the transaction state of conn, creating it if needed
+func (tm *TransactionManager) stateFor(conn net.Conn) *TransactionState {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
 	if tm.states[conn] == nil {
-		tm.states[conn] = &TransactionState{}
+		tm.states[conn] = &TransactionState{Watch: store.NewWatch()}
 	}
+	return tm.states[conn]
+}
+
+// StartTransaction begins a transaction for the given connection
+func (tm *TransactionManager) StartTransaction(conn net.Conn) {
+	state := tm.stateFor(conn)
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
 
-	tm.states[conn].InTransaction = true
-	tm.states[conn].QueuedCommands = nil // Clear any existing commands
+	state.InTransaction = true
+	state.Aborted = false
+	state.QueuedCommands = nil // Clear any existing commands
+}
+
+// AbortTransaction flags the transaction of conn so that EXEC discards it
+func (tm *TransactionManager) AbortTransaction(conn net.Conn) {
+	tm.mu.RLock()
+	state, exists := tm.states[conn]
+	tm.mu.RUnlock()
+
+	if !exists {
+		return
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.InTransaction {
+		state.Aborted = true
+	}
+}
+
+// IsAborted checks if the transaction of conn has been flagged by AbortTransaction
+func (tm *TransactionManager) IsAborted(conn net.Conn) bool {
+	tm.mu.RLock()
+	state, exists := tm.states[conn]
+	tm.mu.RUnlock()
+
+	if !exists {
+		return false
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.InTransaction && state.Aborted
+}
+
+// Watch adds keys of db to the keys watched by conn
+func (tm *TransactionManager) Watch(conn net.Conn, db *store.Database, keys []string) {
+	state := tm.stateFor(conn)
+	for _, key := range keys {
+		state.Watch.Add(db, key)
+	}
+}
+
+// Unwatch forgets every key watched by conn
+func (tm *TransactionManager) Unwatch(conn net.Conn) {
+	tm.mu.RLock()
+	state, exists := tm.states[conn]
+	tm.mu.RUnlock()
+
+	if exists {
+		state.Watch.Clear()
+	}
+}
+
+// WatchedKeysChanged reports whether a key watched by conn has been modified
+func (tm *TransactionManager) WatchedKeysChanged(conn net.Conn) bool {
+	tm.mu.RLock()
+	state, exists := tm.states[conn]
+	tm.mu.RUnlock()
+
+	return exists && state.Watch.Dirty()
 }
 
 // IsInTransaction checks if a connection is in a transaction
@@ -55,7 +127,7 @@ func (tm *TransactionManager) IsInTransaction(conn net.Conn) bool {
 }
 
 // QueueCommand adds a command to the transaction queue
-func (tm *TransactionManager) QueueCommand(conn net.Conn, parts []resp.RespValue, handler CommandHandler) {
+func (tm *TransactionManager) QueueCommand(conn net.Conn, parts []resp.RespValue) {
 	tm.mu.RLock()
 	state, exists := tm.states[conn]
 	tm.mu.RUnlock()
@@ -68,8 +140,7 @@ func (tm *TransactionManager) QueueCommand(conn net.Conn, parts []resp.RespValue
 	defer state.mu.Unlock()
 
 	state.QueuedCommands = append(state.QueuedCommands, QueuedCommand{
-		Parts:   parts,
-		Handler: handler,
+		Parts: parts,
 	})
 }
 
@@ -90,7 +161,9 @@ func (tm *TransactionManager) ExecuteTransaction(conn net.Conn) ([]QueuedCommand
 	copy(commands, state.QueuedCommands)
 
 	state.InTransaction = false
+	state.Aborted = false
 	state.QueuedCommands = nil
+	state.Watch.Clear()
 
 	return commands, true
 }
@@ -109,7 +182,9 @@ func (tm *TransactionManager) DiscardTransaction(conn net.Conn) bool {
 	defer state.mu.Unlock()
 
 	state.InTransaction = false
+	state.Aborted = false
 	state.QueuedCommands = nil
+	state.Watch.Clear()
 
 	return true
 }
@@ -119,11 +194,30 @@ func (tm *TransactionManager) CleanupConnection(conn net.Conn) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
+	if state, exists := tm.states[conn]; exists {
+		state.Watch.Clear()
+	}
 	delete(tm.states, conn)
 }
 
-// CommandHandler interface for handling commands
+// CommandHandler interface for handling commands. Handlers are shared by
+// every client of a database, so the reply goes to the writer of each call.
 type CommandHandler interface {
-	Handle(parts []resp.RespValue, conn net.Conn) error
-	SetWriter(writer *resp.ResponseWriter)
+	Handle(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error
+}
+
+// BlockingHandler is implemented by handlers of commands that can wait for
+// data. They hold the locker only while checking for data, and
+// HandleNonBlocking replies immediately instead of waiting, as inside EXEC.
+type BlockingHandler interface {
+	CommandHandler
+	SetLocker(locker sync.Locker)
+	HandleNonBlocking(parts []resp.RespValue, conn net.Conn, writer *resp.ResponseWriter) error
+}
+
+// PropagatingHandler is implemented by blocking handlers of write commands.
+// Their writes happen while they wait, so they propagate the command and its
+// reply themselves from within the attempt that changed the keyspace.
+type PropagatingHandler interface {
+	SetPropagator(propagate func(conn net.Conn, parts []resp.RespValue, reply resp.RespValue))
 }
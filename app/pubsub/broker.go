@@ -0,0 +1,252 @@
+package pubsub
+
+import (
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pattern"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// Kind is a family of subscriptions
+type Kind int
+
+const (
+	// Channel subscriptions receive messages published to a channel by name
+	Channel Kind = iota
+	// Pattern subscriptions receive messages published to every channel matching a glob
+	Pattern
+	// Shard subscriptions receive messages published with SPUBLISH to a
+	// channel, which belongs to a hash slot like a key
+	Shard
+	kinds
+)
+
+// replyNames holds the subscribe and unsubscribe confirmation names of each kind
+var replyNames = [kinds][2]string{
+	Channel: {"subscribe", "unsubscribe"},
+	Pattern: {"psubscribe", "punsubscribe"},
+	Shard:   {"ssubscribe", "sunsubscribe"},
+}
+
+// Broker routes published messages to subscribed connections
+type Broker struct {
+	mu          sync.RWMutex
+	registries  [kinds]map[string]map[*Subscriber]struct{}
+	subscribers map[net.Conn]*Subscriber
+}
+
+// NewBroker creates a new broker with no subscriptions
+func NewBroker() *Broker {
+	b := &Broker{
+		subscribers: make(map[net.Conn]*Subscriber),
+	}
+	for kind := range b.registries {
+		b.registries[kind] = make(map[string]map[*Subscriber]struct{})
+	}
+	return b
+}
+
+// subscriberFor returns the subscriber of conn, creating it on first use.
+// The caller must hold the write lock.
+func (b *Broker) subscriberFor(conn net.Conn, protocol int) *Subscriber {
+	sub, exists := b.subscribers[conn]
+	if !exists {
+		sub = newSubscriber(conn)
+		b.subscribers[conn] = sub
+	}
+	sub.protocol = protocol
+	return sub
+}
+
+// Subscribe subscribes conn to names and queues one confirmation per name
+func (b *Broker) Subscribe(conn net.Conn, protocol int, kind Kind, names []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := b.subscriberFor(conn, protocol)
+	for _, name := range names {
+		if _, exists := sub.subscriptions[kind][name]; !exists {
+			sub.subscriptions[kind][name] = struct{}{}
+			if b.registries[kind][name] == nil {
+				b.registries[kind][name] = make(map[*Subscriber]struct{})
+			}
+			b.registries[kind][name][sub] = struct{}{}
+		}
+		sub.confirm(replyNames[kind][0], name, sub.count(kind))
+	}
+}
+
+// Unsubscribe unsubscribes conn from names, or from every subscription of
+// the kind when names is empty, and queues one confirmation per name
+func (b *Broker) Unsubscribe(conn net.Conn, protocol int, kind Kind, names []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := b.subscriberFor(conn, protocol)
+	if len(names) == 0 {
+		for name := range sub.subscriptions[kind] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			sub.enqueue(resp.FormatPush(sub.protocol,
+				resp.RespValue{Type: resp.BulkString, Value: replyNames[kind][1]},
+				resp.RespValue{Type: resp.BulkString, Value: nil},
+				resp.RespValue{Type: resp.IntegerType, Value: sub.count(kind)},
+			))
+			return
+		}
+	}
+
+	for _, name := range names {
+		b.remove(sub, kind, name)
+		sub.confirm(replyNames[kind][1], name, sub.count(kind))
+	}
+}
+
+// remove drops a single subscription of sub.
+// The caller must hold the write lock.
+func (b *Broker) remove(sub *Subscriber, kind Kind, name string) {
+	delete(sub.subscriptions[kind], name)
+	if subscribers := b.registries[kind][name]; subscribers != nil {
+		delete(subscribers, sub)
+		if len(subscribers) == 0 {
+			delete(b.registries[kind], name)
+		}
+	}
+}
+
+// Publish delivers message to every subscriber of channel and of every
+// pattern matching it, returning the number of deliveries. Delivery only
+// queues the message, so a slow subscriber never holds up the publisher.
+func (b *Broker) Publish(channel, message string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	receivers := 0
+	for sub := range b.registries[Channel][channel] {
+		sub.enqueue(resp.FormatPush(sub.protocol,
+			resp.RespValue{Type: resp.BulkString, Value: "message"},
+			resp.RespValue{Type: resp.BulkString, Value: channel},
+			resp.RespValue{Type: resp.BulkString, Value: message},
+		))
+		receivers++
+	}
+	for glob, subscribers := range b.registries[Pattern] {
+		if !pattern.Match(glob, channel, false) {
+			continue
+		}
+		for sub := range subscribers {
+			sub.enqueue(resp.FormatPush(sub.protocol,
+				resp.RespValue{Type: resp.BulkString, Value: "pmessage"},
+				resp.RespValue{Type: resp.BulkString, Value: glob},
+				resp.RespValue{Type: resp.BulkString, Value: channel},
+				resp.RespValue{Type: resp.BulkString, Value: message},
+			))
+			receivers++
+		}
+	}
+	return receivers
+}
+
+// SPublish delivers message to every shard subscriber of channel, returning
+// the number of deliveries
+func (b *Broker) SPublish(channel, message string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	receivers := 0
+	for sub := range b.registries[Shard][channel] {
+		sub.enqueue(resp.FormatPush(sub.protocol,
+			resp.RespValue{Type: resp.BulkString, Value: "smessage"},
+			resp.RespValue{Type: resp.BulkString, Value: channel},
+			resp.RespValue{Type: resp.BulkString, Value: message},
+		))
+		receivers++
+	}
+	return receivers
+}
+
+// Channels returns the channels of the kind with at least one subscriber,
+// restricted to those matching glob unless it is empty
+func (b *Broker) Channels(kind Kind, glob string) []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	channels := make([]string, 0, len(b.registries[kind]))
+	for name := range b.registries[kind] {
+		if glob == "" || pattern.Match(glob, name, false) {
+			channels = append(channels, name)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// NumSub returns the number of subscribers of each channel of the kind
+func (b *Broker) NumSub(kind Kind, channels []string) []int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	counts := make([]int, len(channels))
+	for i, name := range channels {
+		counts[i] = len(b.registries[kind][name])
+	}
+	return counts
+}
+
+// NumPat returns the number of distinct patterns subscribed to
+func (b *Broker) NumPat() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.registries[Pattern])
+}
+
+// Subscriptions returns the number of subscriptions conn holds
+func (b *Broker) Subscriptions(conn net.Conn) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	sub, exists := b.subscribers[conn]
+	if !exists {
+		return 0
+	}
+	total := 0
+	for _, names := range sub.subscriptions {
+		total += len(names)
+	}
+	return total
+}
+
+// Output returns the connection replies to conn must be written to. Once a
+// connection has subscribed, replies share its message queue so they stay in
+// order with the messages.
+func (b *Broker) Output(conn net.Conn) net.Conn {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if sub, exists := b.subscribers[conn]; exists {
+		return sub
+	}
+	return conn
+}
+
+// CleanupConnection drops every subscription of a closed connection
+func (b *Broker) CleanupConnection(conn net.Conn) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub, exists := b.subscribers[conn]
+	if !exists {
+		return
+	}
+	for kind, names := range sub.subscriptions {
+		for name := range names {
+			b.remove(sub, Kind(kind), name)
+		}
+	}
+	delete(b.subscribers, conn)
+	sub.stop()
+}
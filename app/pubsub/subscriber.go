@@ -0,0 +1,119 @@
+package pubsub
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// queueSize bounds the frames waiting to be written to one subscriber. A
+// subscriber that falls this far behind is disconnected, as Redis does when a
+// client exceeds its pubsub output buffer limit.
+const queueSize = 4096
+
+// errSubscriberClosed is returned for writes after the subscriber has stopped
+var errSubscriberClosed = errors.New("subscriber closed")
+
+// Subscriber is a subscribed connection. Everything written to it is queued
+// and written to the underlying connection by its own goroutine.
+type Subscriber struct {
+	net.Conn
+	protocol      int
+	subscriptions [kinds]map[string]struct{}
+	queue         chan []byte
+	done          chan struct{}
+	stopOnce      sync.Once
+	dropOnce      sync.Once
+}
+
+// newSubscriber creates a subscriber for conn and starts its writer
+func newSubscriber(conn net.Conn) *Subscriber {
+	sub := &Subscriber{
+		Conn:     conn,
+		protocol: resp.RESP2,
+		queue:    make(chan []byte, queueSize),
+		done:     make(chan struct{}),
+	}
+	for kind := range sub.subscriptions {
+		sub.subscriptions[kind] = make(map[string]struct{})
+	}
+	go sub.run()
+	return sub
+}
+
+// Write queues a reply so it is delivered in order with messages
+func (s *Subscriber) Write(b []byte) (int, error) {
+	frame := make([]byte, len(b))
+	copy(frame, b)
+	if !s.enqueue(frame) {
+		return 0, errSubscriberClosed
+	}
+	return len(b), nil
+}
+
+// enqueue queues a frame without blocking, disconnecting the subscriber when
+// its queue is full
+func (s *Subscriber) enqueue(frame []byte) bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+
+	select {
+	case s.queue <- frame:
+		return true
+	default:
+		s.drop()
+		return false
+	}
+}
+
+// confirm queues a subscription confirmation
+func (s *Subscriber) confirm(kind, name string, count int) {
+	s.enqueue(resp.FormatPush(s.protocol,
+		resp.RespValue{Type: resp.BulkString, Value: kind},
+		resp.RespValue{Type: resp.BulkString, Value: name},
+		resp.RespValue{Type: resp.IntegerType, Value: count},
+	))
+}
+
+// count returns the subscription count reported in confirmations of the
+// kind; shard subscriptions are counted separately from the others
+func (s *Subscriber) count(kind Kind) int {
+	if kind == Shard {
+		return len(s.subscriptions[Shard])
+	}
+	return len(s.subscriptions[Channel]) + len(s.subscriptions[Pattern])
+}
+
+// run writes queued frames until the subscriber is stopped
+func (s *Subscriber) run() {
+	for {
+		select {
+		case frame := <-s.queue:
+			if _, err := s.Conn.Write(frame); err != nil {
+				s.drop()
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// drop closes the connection; the server then cleans it up as usual
+func (s *Subscriber) drop() {
+	s.dropOnce.Do(func() {
+		s.Conn.Close()
+	})
+}
+
+// stop stops the writer goroutine
+func (s *Subscriber) stop() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+	})
+}
@@ -0,0 +1,27 @@
+package rdb
+
+// crc64Poly is the reflected Jones polynomial Redis checksums snapshots with
+const crc64Poly = 0x95ac9329ac4bc9b5
+
+var crc64Table = func() (table [256]uint64) {
+	for i := range table {
+		crc := uint64(i)
+		for bit := 0; bit < 8; bit++ {
+			if crc&1 == 1 {
+				crc = crc>>1 ^ crc64Poly
+			} else {
+				crc >>= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// crc64 extends crc with data; unlike hash/crc64 it applies no inversion
+func crc64(crc uint64, data []byte) uint64 {
+	for _, b := range data {
+		crc = crc64Table[byte(crc)^b] ^ crc>>8
+	}
+	return crc
+}
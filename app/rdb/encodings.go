@@ -0,0 +1,373 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// blob reads the compact encodings that Redis stores as a single string
+type blob struct {
+	data []byte
+	pos  int
+	kind string
+}
+
+// take returns the next n bytes
+func (b *blob) take(n int) ([]byte, error) {
+	if n < 0 || b.pos+n > len(b.data) {
+		return nil, fmt.Errorf("%w: truncated %s", ErrCorrupt, b.kind)
+	}
+	out := b.data[b.pos : b.pos+n]
+	b.pos += n
+	return out, nil
+}
+
+// byte returns the next byte
+func (b *blob) byte() (byte, error) {
+	buf, err := b.take(1)
+	if err != nil {
+		return 0, err
+	}
+	return buf[0], nil
+}
+
+// signed reads an n byte little endian two's complement integer
+func (b *blob) signed(n int) (int64, error) {
+	buf, err := b.take(n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for i := n - 1; i >= 0; i-- {
+		v = v<<8 | uint64(buf[i])
+	}
+	shift := 64 - 8*n
+	return int64(v<<shift) >> shift, nil
+}
+
+// parseZiplist decodes the entries of a ziplist
+func parseZiplist(data []byte) ([]string, error) {
+	b := &blob{data: data, kind: "ziplist"}
+	header, err := b.take(10)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]string, 0, binary.LittleEndian.Uint16(header[8:]))
+
+	for {
+		prevLen, err := b.byte()
+		if err != nil {
+			return nil, err
+		}
+		if prevLen == 0xFF {
+			return entries, nil
+		}
+		if prevLen == 0xFE {
+			if _, err := b.take(4); err != nil {
+				return nil, err
+			}
+		}
+
+		enc, err := b.byte()
+		if err != nil {
+			return nil, err
+		}
+		var entry string
+		switch {
+		case enc>>6 == 0:
+			entry, err = b.str(int(enc & 0x3f))
+		case enc>>6 == 1:
+			var next byte
+			if next, err = b.byte(); err == nil {
+				entry, err = b.str(int(enc&0x3f)<<8 | int(next))
+			}
+		case enc == 0x80:
+			var size []byte
+			if size, err = b.take(4); err == nil {
+				entry, err = b.str(int(binary.BigEndian.Uint32(size)))
+			}
+		case enc == 0xC0:
+			entry, err = b.integer(2)
+		case enc == 0xD0:
+			entry, err = b.integer(4)
+		case enc == 0xE0:
+			entry, err = b.integer(8)
+		case enc == 0xF0:
+			entry, err = b.integer(3)
+		case enc == 0xFE:
+			entry, err = b.integer(1)
+		case enc >= 0xF1 && enc <= 0xFD:
+			entry = strconv.Itoa(int(enc&0x0f) - 1)
+		default:
+			err = fmt.Errorf("%w: unknown ziplist encoding 0x%02x", ErrCorrupt, enc)
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// str reads an n byte string
+func (b *blob) str(n int) (string, error) {
+	buf, err := b.take(n)
+	return string(buf), err
+}
+
+// integer reads an n byte signed integer and formats it in decimal
+func (b *blob) integer(n int) (string, error) {
+	v, err := b.signed(n)
+	return strconv.FormatInt(v, 10), err
+}
+
+// parseListpack decodes the entries of a listpack, formatting integers in decimal
+func parseListpack(data []byte) ([]string, error) {
+	b := &blob{data: data, kind: "listpack"}
+	header, err := b.take(6)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]string, 0, binary.LittleEndian.Uint16(header[4:]))
+
+	for {
+		start := b.pos
+		enc, err := b.byte()
+		if err != nil {
+			return nil, err
+		}
+		if enc == 0xFF {
+			return entries, nil
+		}
+
+		var entry string
+		switch {
+		case enc>>7 == 0:
+			entry = strconv.Itoa(int(enc))
+		case enc>>6 == 2:
+			entry, err = b.str(int(enc & 0x3f))
+		case enc>>5 == 6:
+			var next byte
+			if next, err = b.byte(); err == nil {
+				v := int(enc&0x1f)<<8 | int(next)
+				if v >= 1<<12 {
+					v -= 1 << 13
+				}
+				entry = strconv.Itoa(v)
+			}
+		case enc>>4 == 0xE:
+			var next byte
+			if next, err = b.byte(); err == nil {
+				entry, err = b.str(int(enc&0x0f)<<8 | int(next))
+			}
+		case enc == 0xF0:
+			var size []byte
+			if size, err = b.take(4); err == nil {
+				entry, err = b.str(int(binary.LittleEndian.Uint32(size)))
+			}
+		case enc == 0xF1:
+			entry, err = b.integer(2)
+		case enc == 0xF2:
+			entry, err = b.integer(3)
+		case enc == 0xF3:
+			entry, err = b.integer(4)
+		case enc == 0xF4:
+			entry, err = b.integer(8)
+		default:
+			err = fmt.Errorf("%w: unknown listpack encoding 0x%02x", ErrCorrupt, enc)
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+
+		// Skip the back length, which only exists for reverse traversal
+		if _, err := b.take(backlenSize(b.pos - start)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backlenSize returns how many bytes encode the back length of an entry of size n
+func backlenSize(n int) int {
+	switch {
+	case n <= 127:
+		return 1
+	case n < 16383:
+		return 2
+	case n < 2097151:
+		return 3
+	case n < 268435455:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// parseIntset decodes the members of an intset
+func parseIntset(data []byte) ([]string, error) {
+	b := &blob{data: data, kind: "intset"}
+	header, err := b.take(8)
+	if err != nil {
+		return nil, err
+	}
+	width := int(binary.LittleEndian.Uint32(header))
+	if width != 2 && width != 4 && width != 8 {
+		return nil, fmt.Errorf("%w: intset encoding %d", ErrCorrupt, width)
+	}
+
+	count := int(binary.LittleEndian.Uint32(header[4:]))
+	if count*width != len(data)-8 {
+		return nil, fmt.Errorf("%w: intset length mismatch", ErrCorrupt)
+	}
+	members := make([]string, count)
+	for i := range members {
+		if members[i], err = b.integer(width); err != nil {
+			return nil, err
+		}
+	}
+	return members, nil
+}
+
+// parseZipmap decodes the fields and values of a zipmap
+func parseZipmap(data []byte) ([]string, error) {
+	b := &blob{data: data, kind: "zipmap"}
+	if _, err := b.byte(); err != nil {
+		return nil, err
+	}
+
+	var pairs []string
+	for {
+		fieldLen, end, err := b.zipmapLen()
+		if err != nil {
+			return nil, err
+		}
+		if end {
+			if len(pairs)%2 != 0 {
+				return nil, fmt.Errorf("%w: zipmap field without value", ErrCorrupt)
+			}
+			return pairs, nil
+		}
+		field, err := b.str(fieldLen)
+		if err != nil {
+			return nil, err
+		}
+
+		valueLen, end, err := b.zipmapLen()
+		if err != nil {
+			return nil, err
+		}
+		if end {
+			return nil, fmt.Errorf("%w: zipmap field without value", ErrCorrupt)
+		}
+		free, err := b.byte()
+		if err != nil {
+			return nil, err
+		}
+		value, err := b.str(valueLen)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := b.take(int(free)); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, field, value)
+	}
+}
+
+// zipmapLen reads a zipmap length, reporting the end marker
+func (b *blob) zipmapLen() (int, bool, error) {
+	first, err := b.byte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch first {
+	case 0xFF:
+		return 0, true, nil
+	case 0xFE:
+		buf, err := b.take(4)
+		if err != nil {
+			return 0, false, err
+		}
+		return int(binary.LittleEndian.Uint32(buf)), false, nil
+	default:
+		return int(first), false, nil
+	}
+}
+
+// listpackWriter builds a listpack entry by entry
+type listpackWriter struct {
+	body  []byte
+	count int
+}
+
+// integer appends an integer in its smallest encoding
+func (lp *listpackWriter) integer(v int64) {
+	var entry []byte
+	switch {
+	case v >= 0 && v <= 127:
+		entry = []byte{byte(v)}
+	case v >= -4096 && v <= 4095:
+		u := uint16(v) & 0x1fff
+		entry = []byte{0xC0 | byte(u>>8), byte(u)}
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		entry = binary.LittleEndian.AppendUint16([]byte{0xF1}, uint16(v))
+	case v >= -1<<23 && v < 1<<23:
+		u := uint32(v)
+		entry = []byte{0xF2, byte(u), byte(u >> 8), byte(u >> 16)}
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		entry = binary.LittleEndian.AppendUint32([]byte{0xF3}, uint32(v))
+	default:
+		entry = binary.LittleEndian.AppendUint64([]byte{0xF4}, uint64(v))
+	}
+	lp.append(entry)
+}
+
+// str appends a string
+func (lp *listpackWriter) str(s string) {
+	var entry []byte
+	switch {
+	case len(s) < 1<<6:
+		entry = []byte{0x80 | byte(len(s))}
+	case len(s) < 1<<12:
+		entry = []byte{0xE0 | byte(len(s)>>8), byte(len(s))}
+	default:
+		entry = binary.LittleEndian.AppendUint32([]byte{0xF0}, uint32(len(s)))
+	}
+	lp.append(append(entry, s...))
+}
+
+// append adds an encoded entry followed by its back length
+func (lp *listpackWriter) append(entry []byte) {
+	lp.body = append(lp.body, entry...)
+	lp.body = append(lp.body, encodeBacklen(len(entry))...)
+	lp.count++
+}
+
+// bytes returns the finished listpack with its header and end marker
+func (lp *listpackWriter) bytes() []byte {
+	count := lp.count
+	if count > math.MaxUint16-1 {
+		// The header count saturates and readers count the entries instead
+		count = math.MaxUint16
+	}
+	out := binary.LittleEndian.AppendUint32(nil, uint32(6+len(lp.body)+1))
+	out = binary.LittleEndian.AppendUint16(out, uint16(count))
+	out = append(out, lp.body...)
+	return append(out, 0xFF)
+}
+
+// encodeBacklen encodes an entry size so it can be read from its last byte backwards
+func encodeBacklen(n int) []byte {
+	size := backlenSize(n)
+	out := make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		out[i] = byte(n & 127)
+		if i != 0 {
+			out[i] |= 128
+		}
+		n >>= 7
+	}
+	return out
+}
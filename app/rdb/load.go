@@ -0,0 +1,98 @@
+package rdb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/store"
+)
+
+// LoadStats summarises what a load restored
+type LoadStats struct {
+	Keys    int // keys restored
+	Expired int // keys skipped because their TTL had passed
+
+	Aux map[string]string // metadata fields such as redis-ver
+}
+
+// LoadFile restores the snapshot at path into dbs. A missing file leaves the
+// databases empty, since a server that never saved has nothing to restore.
+func LoadFile(path string, dbs *store.Databases) (LoadStats, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return LoadStats{}, nil
+	}
+	if err != nil {
+		return LoadStats{}, err
+	}
+	defer file.Close()
+	return Load(file, dbs)
+}
+
+// Load restores the snapshot read from r into dbs. It fails on the first key
+// of a type the keyspace cannot hold, such as a set, zset or hash.
+func Load(r io.Reader, dbs *store.Databases) (LoadStats, error) {
+	stats := LoadStats{Aux: make(map[string]string)}
+	now := time.Now()
+	aux := func(key, value string) { stats.Aux[key] = value }
+	err := ParseWithAux(r, aux, func(entry Entry) error {
+		db := dbs.DB(entry.DB)
+		if db == nil {
+			return fmt.Errorf("data file was created with more than %d databases", dbs.Count())
+		}
+		if entry.Expiry != nil && !entry.Expiry.After(now) {
+			stats.Expired++
+			return nil
+		}
+
+		value, ok := storeValue(entry.Value)
+		if !ok {
+			return fmt.Errorf("%w: key %q holds a %s", ErrUnsupportedType, entry.Key, typeName(entry.Value))
+		}
+		stats.Keys++
+		return db.Restore(entry.Key, value, entry.Expiry)
+	})
+
+	// Restoring the snapshot is not a change that needs saving again
+	dbs.ClearDirty(dbs.Dirty())
+	return stats, err
+}
+
+// storeValue converts a parsed value to its keyspace representation
+func storeValue(value interface{}) (interface{}, bool) {
+	switch value := value.(type) {
+	case string:
+		return value, true
+	case List:
+		list := store.NewDoublyLinkedList()
+		for _, element := range value {
+			list.PushBack(element)
+		}
+		return list, true
+	case *Stream:
+		return store.NewStreamFrom(value.Entries, value.LastID), true
+	default:
+		return nil, false
+	}
+}
+
+// typeName returns the TYPE name of a parsed value
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case List:
+		return "list"
+	case Set:
+		return "set"
+	case SortedSet:
+		return "zset"
+	case Hash:
+		return "hash"
+	default:
+		return "stream"
+	}
+}
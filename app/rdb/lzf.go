@@ -0,0 +1,50 @@
+package rdb
+
+import "fmt"
+
+// lzfDecompress expands LZF compressed data into exactly size bytes
+func lzfDecompress(in []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, min(size, 1<<20))
+	for ip := 0; ip < len(in); {
+		ctrl := int(in[ip])
+		ip++
+
+		if ctrl < 1<<5 {
+			// Literal run of ctrl+1 bytes
+			end := ip + ctrl + 1
+			if end > len(in) {
+				return nil, fmt.Errorf("%w: truncated LZF literal", ErrCorrupt)
+			}
+			out = append(out, in[ip:end]...)
+			ip = end
+			continue
+		}
+
+		// Back reference of at least three bytes
+		length := ctrl >> 5
+		if length == 7 {
+			if ip >= len(in) {
+				return nil, fmt.Errorf("%w: truncated LZF reference", ErrCorrupt)
+			}
+			length += int(in[ip])
+			ip++
+		}
+		if ip >= len(in) {
+			return nil, fmt.Errorf("%w: truncated LZF reference", ErrCorrupt)
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[ip]) - 1
+		ip++
+		if ref < 0 {
+			return nil, fmt.Errorf("%w: LZF reference before start of output", ErrCorrupt)
+		}
+		// The source may overlap the bytes being written, so copy one at a time
+		for i := 0; i < length+2; i++ {
+			out = append(out, out[ref+i])
+		}
+	}
+
+	if len(out) != size {
+		return nil, fmt.Errorf("%w: LZF data expands to %d bytes, expected %d", ErrCorrupt, len(out), size)
+	}
+	return out, nil
+}
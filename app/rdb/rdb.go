@@ -0,0 +1,99 @@
+package rdb
+
+import (
+	"errors"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/store"
+)
+
+// ErrCorrupt is wrapped by every error caused by malformed snapshot contents
+var ErrCorrupt = errors.New("corrupt RDB file")
+
+// ErrUnsupportedType is wrapped by the error loading a key whose type the
+// keyspace cannot hold. Loading stops there rather than dropping the key,
+// which the next save would then erase from the file for good.
+var ErrUnsupportedType = errors.New("unsupported value type")
+
+// Opcodes that introduce something other than a key
+const (
+	opSlotInfo     = 0xF4
+	opFunction2    = 0xF5
+	opFunctionPre  = 0xF6
+	opModuleAux    = 0xF7
+	opIdle         = 0xF8
+	opFreq         = 0xF9
+	opAux          = 0xFA
+	opResizeDB     = 0xFB
+	opExpireTimeMs = 0xFC
+	opExpireTime   = 0xFD
+	opSelectDB     = 0xFE
+	opEOF          = 0xFF
+)
+
+// Object type bytes that precede each key
+const (
+	typeString          = 0
+	typeList            = 1
+	typeSet             = 2
+	typeZSet            = 3
+	typeHash            = 4
+	typeZSet2           = 5
+	typeHashZipmap      = 9
+	typeListZiplist     = 10
+	typeSetIntset       = 11
+	typeZSetZiplist     = 12
+	typeHashZiplist     = 13
+	typeListQuicklist   = 14
+	typeStreamListpacks = 15
+	typeHashListpack    = 16
+	typeZSetListpack    = 17
+	typeListQuicklist2  = 18
+	typeStreamListpack2 = 19
+	typeSetListpack     = 20
+	typeStreamListpack3 = 21
+)
+
+// Special string encodings signalled by a length with the top bits set to 11
+const (
+	encInt8  = 0
+	encInt16 = 1
+	encInt32 = 2
+	encLZF   = 3
+)
+
+// maxVersion is the newest format version the parser understands
+const maxVersion = 12
+
+// List is a list value in head to tail order
+type List []string
+
+// Set is a set value
+type Set []string
+
+// SortedSet is a sorted set value
+type SortedSet []ScoredMember
+
+// ScoredMember is one member of a sorted set
+type ScoredMember struct {
+	Member string
+	Score  float64
+}
+
+// Hash is a hash value as alternating fields and values
+type Hash []string
+
+// Stream is a stream value. Consumer groups are not kept.
+type Stream struct {
+	Entries []store.StreamEntry
+	LastID  store.StreamID
+}
+
+// Entry is one key read from a snapshot. Value is a string, List, Set,
+// SortedSet, Hash or *Stream.
+type Entry struct {
+	DB     int
+	Key    string
+	Value  interface{}
+	Expiry *time.Time
+}
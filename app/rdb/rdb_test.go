@@ -0,0 +1,69 @@
+package rdb
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/store"
+)
+
+// payloads are keys and values made of the bytes that delimit protocol lines
+// and the old "field:value,field:value" stream encoding, along with values
+// long enough to need multi-byte lengths
+var payloads = []string{
+	"a:b", "c,d",
+	"line\r\nbreak", "nul\x00byte",
+	"", "\r\n",
+	":,:", "\x00\xff\x80",
+	"12345", strings.Repeat("x\r\n\x00", 20000),
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	dbs := store.NewDatabases(16)
+	db := dbs.DB(0)
+	for i, payload := range payloads {
+		db.Set("key:"+payload, payload)
+		if i%2 == 0 {
+			if _, err := db.XAdd("s", "*", []string{payload, payloads[i+1]}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	db.RPush("l\x00\r\n", payloads...)
+	// A database other than 0 is selected with its own opcode
+	dbs.DB(3).Set("k\r\n3", "v\x003")
+
+	snapshot, _ := dbs.Snapshot()
+	var buf bytes.Buffer
+	if err := Write(&buf, snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := store.NewDatabases(16)
+	stats, err := Load(&buf, loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := len(payloads) + 3; stats.Keys != want {
+		t.Errorf("loaded %d keys, want %d", stats.Keys, want)
+	}
+
+	restored := loaded.DB(0)
+	for _, payload := range payloads {
+		if value, exists, _ := restored.Get("key:" + payload); !exists || value != payload {
+			t.Errorf("GET key:%q = %q, %v, want %q", payload, value, exists, payload)
+		}
+	}
+	if list, _ := restored.LRange("l\x00\r\n", 0, -1); !reflect.DeepEqual(list, payloads) {
+		t.Errorf("list = %q, want %q", list, payloads)
+	}
+	want := db.XRange("s", store.MinStreamID, store.MaxStreamID, 0)
+	if got := restored.XRange("s", store.MinStreamID, store.MaxStreamID, 0); !reflect.DeepEqual(got, want) {
+		t.Errorf("stream = %q, want %q", got, want)
+	}
+	if value, _, _ := loaded.DB(3).Get("k\r\n3"); value != "v\x003" {
+		t.Errorf("GET in db 3 = %q, want %q", value, "v\x003")
+	}
+}
@@ -0,0 +1,723 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/store"
+)
+
+// Stream listpack entry flags
+const (
+	streamItemDeleted    = 1
+	streamItemSameFields = 2
+)
+
+// Quicklist node containers
+const (
+	quicklistPlain  = 1
+	quicklistPacked = 2
+)
+
+// decoder reads the primitives of the format while checksumming everything read
+type decoder struct {
+	r       *bufio.Reader
+	crc     uint64
+	version int
+}
+
+// Parse reads a snapshot from r and calls fn for every key it holds.
+// Keys that had already expired when the snapshot was taken are still passed
+// to fn; deciding what to do with them is up to the caller.
+func Parse(r io.Reader, fn func(entry Entry) error) error {
+	return ParseWithAux(r, nil, fn)
+}
+
+// ParseWithAux reads a snapshot like Parse, also calling aux, when not nil,
+// for every metadata field it holds
+func ParseWithAux(r io.Reader, aux func(key, value string), fn func(entry Entry) error) error {
+	d := &decoder{r: bufio.NewReader(r)}
+
+	header, err := d.read(9)
+	if err != nil {
+		return err
+	}
+	if string(header[:5]) != "REDIS" {
+		return fmt.Errorf("%w: wrong signature", ErrCorrupt)
+	}
+	if d.version, err = strconv.Atoi(string(header[5:])); err != nil || d.version < 1 || d.version > maxVersion {
+		return fmt.Errorf("can't handle RDB format version %s", header[5:])
+	}
+
+	db := 0
+	var expiry *time.Time
+	for {
+		op, err := d.readByte()
+		if err != nil {
+			return err
+		}
+
+		switch op {
+		case opEOF:
+			return d.verifyChecksum()
+		case opSelectDB:
+			index, err := d.readLength()
+			if err != nil {
+				return err
+			}
+			db = int(index)
+		case opResizeDB:
+			// Size hints for the hash tables, which grow on their own
+			if _, err := d.readLength(); err != nil {
+				return err
+			}
+			if _, err := d.readLength(); err != nil {
+				return err
+			}
+		case opAux:
+			// Metadata such as redis-ver and ctime does not affect the data
+			key, err := d.readString()
+			if err != nil {
+				return err
+			}
+			value, err := d.readString()
+			if err != nil {
+				return err
+			}
+			if aux != nil {
+				aux(key, value)
+			}
+		case opExpireTime:
+			buf, err := d.read(4)
+			if err != nil {
+				return err
+			}
+			at := time.Unix(int64(binary.LittleEndian.Uint32(buf)), 0)
+			expiry = &at
+		case opExpireTimeMs:
+			buf, err := d.read(8)
+			if err != nil {
+				return err
+			}
+			at := time.UnixMilli(int64(binary.LittleEndian.Uint64(buf)))
+			expiry = &at
+		case opFreq:
+			if _, err := d.readByte(); err != nil {
+				return err
+			}
+		case opIdle:
+			if _, err := d.readLength(); err != nil {
+				return err
+			}
+		case opSlotInfo:
+			// Slot id, slot size and expires slot size
+			for i := 0; i < 3; i++ {
+				if _, err := d.readLength(); err != nil {
+					return err
+				}
+			}
+		case opFunction2:
+			// Function libraries are not supported, so their code is skipped
+			if _, err := d.readString(); err != nil {
+				return err
+			}
+		case opFunctionPre, opModuleAux:
+			return fmt.Errorf("RDB opcode 0x%02x is not supported", op)
+		default:
+			key, err := d.readString()
+			if err != nil {
+				return err
+			}
+			value, err := d.readObject(op)
+			if err != nil {
+				return fmt.Errorf("key %q: %w", key, err)
+			}
+			if err := fn(Entry{DB: db, Key: key, Value: value, Expiry: expiry}); err != nil {
+				return err
+			}
+			expiry = nil
+		}
+	}
+}
+
+// read returns exactly n bytes
+func (d *decoder) read(n int) ([]byte, error) {
+	// Grow with the data actually present so a corrupt length cannot force a huge allocation
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, d.r, int64(n)); err != nil {
+		return nil, d.unexpected(err)
+	}
+	d.crc = crc64(d.crc, buf.Bytes())
+	return buf.Bytes(), nil
+}
+
+// readByte returns the next byte
+func (d *decoder) readByte() (byte, error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return 0, d.unexpected(err)
+	}
+	d.crc = crc64(d.crc, []byte{b})
+	return b, nil
+}
+
+// unexpected reports running out of data as corruption
+func (d *decoder) unexpected(err error) error {
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: unexpected end of file", ErrCorrupt)
+	}
+	return err
+}
+
+// verifyChecksum checks the trailer against the checksum of everything read.
+// Versions before 5 have no trailer, and a zero trailer means checksums were disabled.
+func (d *decoder) verifyChecksum() error {
+	if d.version < 5 {
+		return nil
+	}
+	expected := d.crc
+	buf, err := d.read(8)
+	if err != nil {
+		return err
+	}
+	if stored := binary.LittleEndian.Uint64(buf); stored != 0 && stored != expected {
+		return fmt.Errorf("%w: checksum mismatch", ErrCorrupt)
+	}
+	return nil
+}
+
+// readLengthOrEncoding reads a length, or the special encoding of a string
+func (d *decoder) readLengthOrEncoding() (uint64, bool, error) {
+	first, err := d.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch first >> 6 {
+	case 0:
+		return uint64(first & 0x3f), false, nil
+	case 1:
+		next, err := d.readByte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(first&0x3f)<<8 | uint64(next), false, nil
+	case 2:
+		switch first {
+		case 0x80:
+			buf, err := d.read(4)
+			if err != nil {
+				return 0, false, err
+			}
+			return uint64(binary.BigEndian.Uint32(buf)), false, nil
+		case 0x81:
+			buf, err := d.read(8)
+			if err != nil {
+				return 0, false, err
+			}
+			return binary.BigEndian.Uint64(buf), false, nil
+		}
+		return 0, false, fmt.Errorf("%w: unknown length encoding 0x%02x", ErrCorrupt, first)
+	default:
+		return uint64(first & 0x3f), true, nil
+	}
+}
+
+// readLength reads a length that may not be a special string encoding
+func (d *decoder) readLength() (uint64, error) {
+	length, encoded, err := d.readLengthOrEncoding()
+	if err == nil && encoded {
+		err = fmt.Errorf("%w: unexpected string encoding", ErrCorrupt)
+	}
+	return length, err
+}
+
+// readCount reads a length used as an element count
+func (d *decoder) readCount() (int, error) {
+	length, err := d.readLength()
+	if err == nil && length > math.MaxInt32 {
+		err = fmt.Errorf("%w: count %d out of range", ErrCorrupt, length)
+	}
+	return int(length), err
+}
+
+// readString reads a string in any of its encodings
+func (d *decoder) readString() (string, error) {
+	length, encoded, err := d.readLengthOrEncoding()
+	if err != nil {
+		return "", err
+	}
+	if !encoded {
+		if length > math.MaxInt32 {
+			return "", fmt.Errorf("%w: string length %d out of range", ErrCorrupt, length)
+		}
+		buf, err := d.read(int(length))
+		return string(buf), err
+	}
+
+	switch length {
+	case encInt8, encInt16, encInt32:
+		size := 1 << length
+		buf, err := d.read(size)
+		if err != nil {
+			return "", err
+		}
+		v, _ := (&blob{data: buf}).signed(size)
+		return strconv.FormatInt(v, 10), nil
+	case encLZF:
+		compressed, err := d.readCount()
+		if err != nil {
+			return "", err
+		}
+		size, err := d.readCount()
+		if err != nil {
+			return "", err
+		}
+		buf, err := d.read(compressed)
+		if err != nil {
+			return "", err
+		}
+		out, err := lzfDecompress(buf, size)
+		return string(out), err
+	default:
+		return "", fmt.Errorf("%w: unknown string encoding %d", ErrCorrupt, length)
+	}
+}
+
+// readStrings reads count strings
+func (d *decoder) readStrings(count int) ([]string, error) {
+	values := make([]string, 0, min(count, 1024))
+	for i := 0; i < count; i++ {
+		value, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// readDouble reads a score stored as a length prefixed decimal string
+func (d *decoder) readDouble() (float64, error) {
+	length, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch length {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	buf, err := d.read(int(length))
+	if err != nil {
+		return 0, err
+	}
+	score, err := strconv.ParseFloat(string(buf), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid score %q", ErrCorrupt, buf)
+	}
+	return score, nil
+}
+
+// readBinaryDouble reads a score stored as a little endian IEEE 754 double
+func (d *decoder) readBinaryDouble() (float64, error) {
+	buf, err := d.read(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(buf)), nil
+}
+
+// readEncoded reads a string holding a compact encoding and decodes it with parse
+func (d *decoder) readEncoded(parse func([]byte) ([]string, error)) ([]string, error) {
+	data, err := d.readString()
+	if err != nil {
+		return nil, err
+	}
+	return parse([]byte(data))
+}
+
+// readObject reads a value of the given type
+func (d *decoder) readObject(kind byte) (interface{}, error) {
+	switch kind {
+	case typeString:
+		return d.readString()
+	case typeList, typeSet, typeHash:
+		count, err := d.readCount()
+		if err != nil {
+			return nil, err
+		}
+		if kind == typeHash {
+			count *= 2
+		}
+		values, err := d.readStrings(count)
+		switch kind {
+		case typeList:
+			return List(values), err
+		case typeSet:
+			return Set(values), err
+		default:
+			return Hash(values), err
+		}
+	case typeZSet, typeZSet2:
+		return d.readZSet(kind == typeZSet2)
+	case typeHashZipmap:
+		values, err := d.readEncoded(parseZipmap)
+		return Hash(values), err
+	case typeListZiplist:
+		values, err := d.readEncoded(parseZiplist)
+		return List(values), err
+	case typeSetIntset:
+		values, err := d.readEncoded(parseIntset)
+		return Set(values), err
+	case typeSetListpack:
+		values, err := d.readEncoded(parseListpack)
+		return Set(values), err
+	case typeHashZiplist, typeHashListpack:
+		parse := parseZiplist
+		if kind == typeHashListpack {
+			parse = parseListpack
+		}
+		values, err := d.readEncoded(parse)
+		if err == nil && len(values)%2 != 0 {
+			err = fmt.Errorf("%w: hash field without value", ErrCorrupt)
+		}
+		return Hash(values), err
+	case typeZSetZiplist, typeZSetListpack:
+		parse := parseZiplist
+		if kind == typeZSetListpack {
+			parse = parseListpack
+		}
+		values, err := d.readEncoded(parse)
+		if err != nil {
+			return nil, err
+		}
+		return scoredMembers(values)
+	case typeListQuicklist, typeListQuicklist2:
+		return d.readQuicklist(kind == typeListQuicklist2)
+	case typeStreamListpacks, typeStreamListpack2, typeStreamListpack3:
+		return d.readStream(kind)
+	default:
+		return nil, fmt.Errorf("RDB object type %d is not supported", kind)
+	}
+}
+
+// readZSet reads a sorted set stored as member and score pairs
+func (d *decoder) readZSet(binaryScores bool) (SortedSet, error) {
+	count, err := d.readCount()
+	if err != nil {
+		return nil, err
+	}
+	members := make(SortedSet, 0, min(count, 1024))
+	for i := 0; i < count; i++ {
+		member, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		var score float64
+		if binaryScores {
+			score, err = d.readBinaryDouble()
+		} else {
+			score, err = d.readDouble()
+		}
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, ScoredMember{Member: member, Score: score})
+	}
+	return members, nil
+}
+
+// scoredMembers pairs the alternating members and scores of a compact sorted set
+func scoredMembers(values []string) (SortedSet, error) {
+	if len(values)%2 != 0 {
+		return nil, fmt.Errorf("%w: sorted set member without score", ErrCorrupt)
+	}
+	members := make(SortedSet, 0, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		score, err := strconv.ParseFloat(values[i+1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid score %q", ErrCorrupt, values[i+1])
+		}
+		members = append(members, ScoredMember{Member: values[i], Score: score})
+	}
+	return members, nil
+}
+
+// readQuicklist reads a list stored as a sequence of ziplist or listpack nodes
+func (d *decoder) readQuicklist(containers bool) (List, error) {
+	nodes, err := d.readCount()
+	if err != nil {
+		return nil, err
+	}
+
+	var values List
+	for i := 0; i < nodes; i++ {
+		container := uint64(quicklistPacked)
+		if containers {
+			if container, err = d.readLength(); err != nil {
+				return nil, err
+			}
+		}
+
+		switch {
+		case !containers:
+			node, err := d.readEncoded(parseZiplist)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, node...)
+		case container == quicklistPlain:
+			value, err := d.readString()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		case container == quicklistPacked:
+			node, err := d.readEncoded(parseListpack)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, node...)
+		default:
+			return nil, fmt.Errorf("%w: unknown quicklist container %d", ErrCorrupt, container)
+		}
+	}
+	return values, nil
+}
+
+// readStreamID reads an ID stored as two lengths
+func (d *decoder) readStreamID() (store.StreamID, error) {
+	ms, err := d.readLength()
+	if err != nil {
+		return store.StreamID{}, err
+	}
+	seq, err := d.readLength()
+	return store.StreamID{Ms: ms, Seq: seq}, err
+}
+
+// readRawStreamID reads an ID stored as 16 big endian bytes
+func (d *decoder) readRawStreamID() (store.StreamID, error) {
+	buf, err := d.read(16)
+	if err != nil {
+		return store.StreamID{}, err
+	}
+	return store.StreamID{Ms: binary.BigEndian.Uint64(buf), Seq: binary.BigEndian.Uint64(buf[8:])}, nil
+}
+
+// readStream reads a stream along with its consumer groups, which are discarded
+func (d *decoder) readStream(kind byte) (*Stream, error) {
+	nodes, err := d.readCount()
+	if err != nil {
+		return nil, err
+	}
+
+	stream := &Stream{}
+	for i := 0; i < nodes; i++ {
+		key, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		if len(key) != 16 {
+			return nil, fmt.Errorf("%w: stream node key of %d bytes", ErrCorrupt, len(key))
+		}
+		master := store.StreamID{
+			Ms:  binary.BigEndian.Uint64([]byte(key)),
+			Seq: binary.BigEndian.Uint64([]byte(key[8:])),
+		}
+		node, err := d.readEncoded(parseListpack)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := streamNodeEntries(master, node)
+		if err != nil {
+			return nil, err
+		}
+		stream.Entries = append(stream.Entries, entries...)
+	}
+
+	// Length, last ID and, from version 2, the first ID, the maximal deleted
+	// ID and the number of entries ever added
+	if _, err := d.readLength(); err != nil {
+		return nil, err
+	}
+	if stream.LastID, err = d.readStreamID(); err != nil {
+		return nil, err
+	}
+	if kind >= typeStreamListpack2 {
+		for i := 0; i < 5; i++ {
+			if _, err := d.readLength(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := d.skipConsumerGroups(kind); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// skipConsumerGroups reads past the consumer groups of a stream
+func (d *decoder) skipConsumerGroups(kind byte) error {
+	groups, err := d.readCount()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < groups; i++ {
+		if _, err := d.readString(); err != nil {
+			return err
+		}
+		if _, err := d.readStreamID(); err != nil {
+			return err
+		}
+		if kind >= typeStreamListpack2 {
+			// entries_read
+			if _, err := d.readLength(); err != nil {
+				return err
+			}
+		}
+
+		// Pending entries: ID, delivery time and delivery count
+		pending, err := d.readCount()
+		if err != nil {
+			return err
+		}
+		for j := 0; j < pending; j++ {
+			if _, err := d.read(16 + 8); err != nil {
+				return err
+			}
+			if _, err := d.readLength(); err != nil {
+				return err
+			}
+		}
+
+		consumers, err := d.readCount()
+		if err != nil {
+			return err
+		}
+		for j := 0; j < consumers; j++ {
+			if _, err := d.readString(); err != nil {
+				return err
+			}
+			// Seen time and, from version 3, active time
+			times := 8
+			if kind >= typeStreamListpack3 {
+				times = 16
+			}
+			if _, err := d.read(times); err != nil {
+				return err
+			}
+			owned, err := d.readCount()
+			if err != nil {
+				return err
+			}
+			for k := 0; k < owned; k++ {
+				if _, err := d.readRawStreamID(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// streamNodeEntries decodes the live entries of one stream listpack. The node
+// starts with a master entry whose fields later entries may share, and every
+// entry's ID is stored relative to the master ID.
+func streamNodeEntries(master store.StreamID, node []string) ([]store.StreamEntry, error) {
+	pos := 0
+	next := func() (int64, error) {
+		if pos >= len(node) {
+			return 0, fmt.Errorf("%w: truncated stream node", ErrCorrupt)
+		}
+		v, err := strconv.ParseInt(node[pos], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: stream node integer %q", ErrCorrupt, node[pos])
+		}
+		pos++
+		return v, nil
+	}
+	slice := func(n int64) ([]string, error) {
+		if n < 0 || int64(len(node)-pos) < n {
+			return nil, fmt.Errorf("%w: truncated stream node", ErrCorrupt)
+		}
+		values := node[pos : pos+int(n)]
+		pos += int(n)
+		return values, nil
+	}
+
+	// Master entry: valid count, deleted count, fields and a terminating zero
+	if _, err := slice(2); err != nil {
+		return nil, err
+	}
+	fieldCount, err := next()
+	if err != nil {
+		return nil, err
+	}
+	masterFields, err := slice(fieldCount)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := next(); err != nil {
+		return nil, err
+	}
+
+	var entries []store.StreamEntry
+	for pos < len(node) {
+		flags, err := next()
+		if err != nil {
+			return nil, err
+		}
+		msDiff, err := next()
+		if err != nil {
+			return nil, err
+		}
+		seqDiff, err := next()
+		if err != nil {
+			return nil, err
+		}
+		id := store.StreamID{Ms: master.Ms + uint64(msDiff), Seq: master.Seq + uint64(seqDiff)}
+
+		var fields []string
+		if flags&streamItemSameFields != 0 {
+			values, err := slice(int64(len(masterFields)))
+			if err != nil {
+				return nil, err
+			}
+			fields = make([]string, 0, 2*len(values))
+			for i, value := range values {
+				fields = append(fields, masterFields[i], value)
+			}
+		} else {
+			count, err := next()
+			if err != nil {
+				return nil, err
+			}
+			pairs, err := slice(2 * count)
+			if err != nil {
+				return nil, err
+			}
+			fields = append([]string(nil), pairs...)
+		}
+
+		// Each entry ends with its own element count for reverse traversal
+		if _, err := next(); err != nil {
+			return nil, err
+		}
+		if flags&streamItemDeleted == 0 {
+			entries = append(entries, store.StreamEntry{ID: id, Fields: fields})
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,270 @@
+package rdb
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/store"
+)
+
+// ErrSaveInProgress is returned when a save is requested while a background save runs
+var ErrSaveInProgress = errors.New("ERR Background save already in progress")
+
+// ErrInvalidSavePoints is returned for a malformed save schedule
+var ErrInvalidSavePoints = errors.New("Invalid save parameters")
+
+// bgsaveRetryDelay is how long the schedule waits after a failed background save
+const bgsaveRetryDelay = 5 * time.Second
+
+// SavePoint triggers a background save once Changes keys changed and
+// Seconds passed since the last successful save
+type SavePoint struct {
+	Seconds int
+	Changes int64
+}
+
+// ParseSavePoints parses a schedule such as "3600 1 300 100". An empty
+// schedule disables automatic saving.
+func ParseSavePoints(spec string) ([]SavePoint, error) {
+	fields := strings.Fields(spec)
+	if len(fields)%2 != 0 {
+		return nil, ErrInvalidSavePoints
+	}
+
+	points := make([]SavePoint, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		seconds, err := strconv.Atoi(fields[i])
+		if err != nil || seconds < 1 {
+			return nil, ErrInvalidSavePoints
+		}
+		changes, err := strconv.ParseInt(fields[i+1], 10, 64)
+		if err != nil || changes < 0 {
+			return nil, ErrInvalidSavePoints
+		}
+		points = append(points, SavePoint{Seconds: seconds, Changes: changes})
+	}
+	return points, nil
+}
+
+// Saver writes snapshots of the databases to the configured RDB file, in the
+// foreground for SAVE or in a background goroutine for BGSAVE and the schedule
+type Saver struct {
+	databases *store.Databases
+	path      func() string
+
+	mutex        sync.Mutex
+	points       []SavePoint
+	saving       bool      // a background save is running
+	scheduled    bool      // BGSAVE SCHEDULE asked for a save once the running one ends
+	saveStarted  time.Time // when the running background save started
+	lastSave     time.Time // when the last successful save was taken
+	lastAttempt  time.Time // when the last background save was taken, successful or not
+	lastErr      error     // outcome of the last background save
+	lastDuration time.Duration
+	saves        int
+}
+
+// NewSaver creates a saver writing to the path returned by path, which is
+// looked up on every save so CONFIG SET dir and dbfilename take effect
+func NewSaver(databases *store.Databases, path func() string) *Saver {
+	return &Saver{
+		databases:    databases,
+		path:         path,
+		lastSave:     time.Now(),
+		lastDuration: -1,
+	}
+}
+
+// SavePoints returns the schedule in the form ParseSavePoints accepts
+func (s *Saver) SavePoints() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	fields := make([]string, 0, 2*len(s.points))
+	for _, point := range s.points {
+		fields = append(fields, strconv.Itoa(point.Seconds), strconv.FormatInt(point.Changes, 10))
+	}
+	return strings.Join(fields, " ")
+}
+
+// SetSavePoints replaces the schedule
+func (s *Saver) SetSavePoints(spec string) error {
+	points, err := ParseSavePoints(spec)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.points = points
+	return nil
+}
+
+// Save writes a snapshot before returning
+func (s *Saver) Save() error {
+	s.mutex.Lock()
+	if s.saving {
+		s.mutex.Unlock()
+		return ErrSaveInProgress
+	}
+	s.mutex.Unlock()
+
+	snapshot, dirty := s.databases.Snapshot()
+	if err := SaveFile(s.path(), snapshot); err != nil {
+		return err
+	}
+	s.databases.ClearDirty(dirty)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastSave = time.Now()
+	s.saves++
+	return nil
+}
+
+// BackgroundSave captures a snapshot and writes it from a background goroutine,
+// so clients keep being served while the file is written
+func (s *Saver) BackgroundSave() error {
+	s.mutex.Lock()
+	if s.saving {
+		s.mutex.Unlock()
+		return ErrSaveInProgress
+	}
+	s.begin()
+	s.mutex.Unlock()
+
+	s.backgroundSave()
+	return nil
+}
+
+// ScheduleBackgroundSave starts a background save, or arranges for one to start
+// when the running one ends. It reports whether the save was deferred.
+func (s *Saver) ScheduleBackgroundSave() bool {
+	s.mutex.Lock()
+	if s.saving {
+		s.scheduled = true
+		s.mutex.Unlock()
+		return true
+	}
+	s.begin()
+	s.mutex.Unlock()
+
+	s.backgroundSave()
+	return false
+}
+
+// begin marks a background save as running. The caller must hold the mutex,
+// and call backgroundSave once it released it.
+func (s *Saver) begin() {
+	s.saving = true
+	s.saveStarted = time.Now()
+}
+
+// backgroundSave takes the snapshot in the caller, so it reflects the moment
+// the save was requested, and writes it in a new goroutine. The mutex is not
+// held while copying, so INFO and LASTSAVE are not held up by a large dataset.
+func (s *Saver) backgroundSave() {
+	snapshot, dirty := s.databases.Snapshot()
+	path := s.path()
+
+	go func() {
+		err := SaveFile(path, snapshot)
+		if err != nil {
+			fmt.Printf("Background saving error: %v\n", err)
+		} else {
+			s.databases.ClearDirty(dirty)
+		}
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.saving = false
+		s.lastErr = err
+		s.lastAttempt = s.saveStarted
+		s.lastDuration = time.Since(s.saveStarted)
+		if err == nil {
+			s.lastSave = time.Now()
+			s.saves++
+		}
+	}()
+}
+
+// Cron starts a background save when a scheduled save is pending or a save
+// point is reached. It is meant to be called periodically.
+func (s *Saver) Cron() {
+	if s.saveDue() {
+		s.backgroundSave()
+	}
+}
+
+// saveDue reports whether Cron should start a background save, marking it
+// as running when it should
+func (s *Saver) saveDue() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.saving {
+		return false
+	}
+	if s.scheduled {
+		s.scheduled = false
+		s.begin()
+		return true
+	}
+
+	// After a failure, only retry once the delay has passed
+	now := time.Now()
+	if s.lastErr != nil && now.Sub(s.lastAttempt) < bgsaveRetryDelay {
+		return false
+	}
+	dirty := s.databases.Dirty()
+	for _, point := range s.points {
+		if dirty >= point.Changes && now.Sub(s.lastSave) >= time.Duration(point.Seconds)*time.Second {
+			fmt.Printf("%d changes in %d seconds. Saving...\n", point.Changes, point.Seconds)
+			s.begin()
+			return true
+		}
+	}
+	return false
+}
+
+// LastSave returns when the last successful save was taken
+func (s *Saver) LastSave() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lastSave
+}
+
+// PersistenceInfo returns the fields of the INFO persistence section in order
+func (s *Saver) PersistenceInfo() [][2]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	inProgress, current := "0", "-1"
+	if s.saving {
+		inProgress = "1"
+		current = strconv.Itoa(int(time.Since(s.saveStarted).Seconds()))
+	}
+	status := "ok"
+	if s.lastErr != nil {
+		status = "err"
+	}
+	lastDuration := "-1"
+	if s.lastDuration >= 0 {
+		lastDuration = strconv.Itoa(int(s.lastDuration.Seconds()))
+	}
+
+	return [][2]string{
+		{"loading", "0"},
+		{"rdb_changes_since_last_save", strconv.FormatInt(s.databases.Dirty(), 10)},
+		{"rdb_bgsave_in_progress", inProgress},
+		{"rdb_last_save_time", strconv.FormatInt(s.lastSave.Unix(), 10)},
+		{"rdb_last_bgsave_status", status},
+		{"rdb_last_bgsave_time_sec", lastDuration},
+		{"rdb_current_bgsave_time_sec", current},
+		{"rdb_saves", strconv.Itoa(s.saves)},
+	}
+}
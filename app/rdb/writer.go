@@ -0,0 +1,280 @@
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/store"
+)
+
+// writeVersion is the format version written, the one Redis 7.2 produces
+const writeVersion = 11
+
+// streamNodeSize bounds how many entries share one stream listpack
+const streamNodeSize = 100
+
+// encoder writes the primitives of the format while checksumming everything written.
+// The first error sticks, so callers check it once at the end.
+type encoder struct {
+	w   *bufio.Writer
+	crc uint64
+	err error
+}
+
+// Write encodes a snapshot, indexed by database, in RDB format, with extra
+// metadata fields given as key-value pairs
+func Write(w io.Writer, snapshot [][]store.SnapshotItem, aux ...[2]string) error {
+	e := &encoder{w: bufio.NewWriter(w)}
+	e.write([]byte(fmt.Sprintf("REDIS%04d", writeVersion)))
+	e.aux("redis-ver", "7.2.0")
+	e.aux("redis-bits", "64")
+	e.aux("ctime", strconv.FormatInt(time.Now().Unix(), 10))
+	e.aux("aof-base", "0")
+	for _, field := range aux {
+		e.aux(field[0], field[1])
+	}
+
+	for index, items := range snapshot {
+		if len(items) == 0 {
+			continue
+		}
+		e.byte(opSelectDB)
+		e.length(uint64(index))
+
+		expires := 0
+		for _, item := range items {
+			if item.Expiry != nil {
+				expires++
+			}
+		}
+		e.byte(opResizeDB)
+		e.length(uint64(len(items)))
+		e.length(uint64(expires))
+
+		for _, item := range items {
+			if err := e.item(item); err != nil {
+				return err
+			}
+		}
+	}
+
+	e.byte(opEOF)
+	var trailer [8]byte
+	binary.LittleEndian.PutUint64(trailer[:], e.crc)
+	e.write(trailer[:])
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+// SaveFile writes a snapshot to path, replacing the previous file only once
+// the new one is complete
+func SaveFile(path string, snapshot [][]store.SnapshotItem) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "temp-*.rdb")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := Write(file, snapshot); err != nil {
+		file.Close()
+		return err
+	}
+	// CreateTemp makes the file private, but snapshots are readable like any file Redis writes
+	if err := file.Chmod(0o644); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// write writes raw bytes
+func (e *encoder) write(data []byte) {
+	if e.err != nil {
+		return
+	}
+	e.crc = crc64(e.crc, data)
+	_, e.err = e.w.Write(data)
+}
+
+// byte writes a single byte
+func (e *encoder) byte(b byte) {
+	e.write([]byte{b})
+}
+
+// length writes a length in the shortest encoding
+func (e *encoder) length(n uint64) {
+	switch {
+	case n < 1<<6:
+		e.byte(byte(n))
+	case n < 1<<14:
+		e.write([]byte{0x40 | byte(n>>8), byte(n)})
+	case n <= 0xFFFFFFFF:
+		var buf [5]byte
+		buf[0] = 0x80
+		binary.BigEndian.PutUint32(buf[1:], uint32(n))
+		e.write(buf[:])
+	default:
+		var buf [9]byte
+		buf[0] = 0x81
+		binary.BigEndian.PutUint64(buf[1:], n)
+		e.write(buf[:])
+	}
+}
+
+// string writes a length prefixed string
+func (e *encoder) string(s string) {
+	e.length(uint64(len(s)))
+	e.write([]byte(s))
+}
+
+// aux writes an auxiliary metadata field
+func (e *encoder) aux(key, value string) {
+	e.byte(opAux)
+	e.string(key)
+	e.string(value)
+}
+
+// item writes one key with its expiry, type and value
+func (e *encoder) item(item store.SnapshotItem) error {
+	if item.Expiry != nil {
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], uint64(item.Expiry.UnixMilli()))
+		e.byte(opExpireTimeMs)
+		e.write(buf[:])
+	}
+
+	switch value := item.Value.(type) {
+	case string:
+		e.byte(typeString)
+		e.string(item.Key)
+		e.string(value)
+	case *store.DoublyLinkedList:
+		e.byte(typeList)
+		e.string(item.Key)
+		values := value.Values()
+		e.length(uint64(len(values)))
+		for _, element := range values {
+			e.string(element)
+		}
+	case *store.Stream:
+		e.byte(typeStreamListpack3)
+		e.string(item.Key)
+		e.stream(value)
+	default:
+		return fmt.Errorf("key %q: cannot encode %T", item.Key, item.Value)
+	}
+	return nil
+}
+
+// stream writes a stream as listpack nodes followed by its metadata.
+// Streams here have no consumer groups.
+func (e *encoder) stream(stream *store.Stream) {
+	entries := stream.Entries()
+	nodes := (len(entries) + streamNodeSize - 1) / streamNodeSize
+	e.length(uint64(nodes))
+	for start := 0; start < len(entries); start += streamNodeSize {
+		node := entries[start:min(start+streamNodeSize, len(entries))]
+		master := node[0].ID
+
+		var key [16]byte
+		binary.BigEndian.PutUint64(key[:], master.Ms)
+		binary.BigEndian.PutUint64(key[8:], master.Seq)
+		e.string(string(key[:]))
+		e.string(string(streamListpack(master, node)))
+	}
+
+	// Length, last ID, first ID, maximal deleted ID and entries ever added
+	var first store.StreamID
+	if len(entries) > 0 {
+		first = entries[0].ID
+	}
+	last := stream.LastID()
+	e.length(uint64(len(entries)))
+	e.length(last.Ms)
+	e.length(last.Seq)
+	e.length(first.Ms)
+	e.length(first.Seq)
+	e.length(0)
+	e.length(0)
+	e.length(uint64(len(entries)))
+
+	// Consumer groups
+	e.length(0)
+}
+
+// streamListpack builds the listpack of one stream node. The first entry's
+// fields become the master fields that later entries can share.
+func streamListpack(master store.StreamID, node []store.StreamEntry) []byte {
+	lp := &listpackWriter{}
+	masterFields := fieldNames(node[0].Fields)
+
+	lp.integer(int64(len(node)))
+	lp.integer(0)
+	lp.integer(int64(len(masterFields)))
+	for _, field := range masterFields {
+		lp.str(field)
+	}
+	lp.integer(0)
+
+	for _, entry := range node {
+		same := sameFields(entry.Fields, masterFields)
+		flags := int64(0)
+		if same {
+			flags = streamItemSameFields
+		}
+		lp.integer(flags)
+		lp.integer(int64(entry.ID.Ms - master.Ms))
+		lp.integer(int64(entry.ID.Seq - master.Seq))
+
+		if same {
+			for i := 1; i < len(entry.Fields); i += 2 {
+				lp.str(entry.Fields[i])
+			}
+			lp.integer(int64(3 + len(masterFields)))
+		} else {
+			lp.integer(int64(len(entry.Fields) / 2))
+			for _, field := range entry.Fields {
+				lp.str(field)
+			}
+			lp.integer(int64(4 + len(entry.Fields)))
+		}
+	}
+	return lp.bytes()
+}
+
+// fieldNames returns the field names of alternating fields and values
+func fieldNames(fields []string) []string {
+	names := make([]string, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		names = append(names, fields[i])
+	}
+	return names
+}
+
+// sameFields reports whether an entry has exactly the master fields, in order
+func sameFields(fields, master []string) bool {
+	if len(fields) != 2*len(master) {
+		return false
+	}
+	for i, name := range master {
+		if fields[2*i] != name {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package replication
+
+// defaultBacklogSize is the repl-backlog-size Redis starts with
+const defaultBacklogSize = 1 << 20
+
+// backlog keeps the most recent bytes of the replication stream, so a replica
+// that reconnects after a short break can continue where it left off
+type backlog struct {
+	data []byte
+	size int
+	end  int64 // replication offset of the last byte written
+}
+
+// newBacklog creates an empty backlog whose first byte will have offset end+1
+func newBacklog(size int, end int64) *backlog {
+	return &backlog{size: size, end: end}
+}
+
+// write appends stream bytes, forgetting the oldest beyond the size
+func (b *backlog) write(p []byte) {
+	b.data = append(b.data, p...)
+	b.end += int64(len(p))
+	// Trimming only once the buffer doubles keeps appends amortised constant
+	if len(b.data) > 2*b.size {
+		b.data = append(b.data[:0:0], b.data[len(b.data)-b.size:]...)
+	}
+}
+
+// histlen returns how many bytes the backlog holds
+func (b *backlog) histlen() int {
+	return min(len(b.data), b.size)
+}
+
+// firstOffset returns the replication offset of the oldest byte held
+func (b *backlog) firstOffset() int64 {
+	return b.end - int64(b.histlen()) + 1
+}
+
+// from returns the bytes from offset on, reporting false when they are no
+// longer held. An offset just past the end yields nothing to send.
+func (b *backlog) from(offset int64) ([]byte, bool) {
+	if offset < b.firstOffset() || offset > b.end+1 {
+		return nil, false
+	}
+	start := len(b.data) - int(b.end-offset+1)
+	return append([]byte(nil), b.data[start:]...), true
+}
+
+// resize changes how many bytes the backlog keeps
+func (b *backlog) resize(size int) {
+	b.size = size
+	if len(b.data) > size {
+		b.data = append(b.data[:0:0], b.data[len(b.data)-size:]...)
+	}
+}
@@ -0,0 +1,219 @@
+package replication
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Errors returned for failovers that cannot start or be aborted
+var (
+	ErrFailoverOnReplica   = errors.New("ERR FAILOVER is not valid when server is a replica.")
+	ErrFailoverNoReplicas  = errors.New("ERR FAILOVER requires connected replicas.")
+	ErrFailoverInProgress  = errors.New("ERR FAILOVER already in progress.")
+	ErrFailoverNotReplica  = errors.New("ERR FAILOVER target HOST and PORT is not a replica.")
+	ErrFailoverNotOnline   = errors.New("ERR FAILOVER target replica is not online.")
+	ErrNoFailover          = errors.New("ERR No failover in progress.")
+	ErrFailoverWrongReplID = errors.New("ERR PSYNC FAILOVER replid must match my replid.")
+)
+
+// Failover states as INFO reports them
+const (
+	failoverNone       = "no-failover"
+	failoverWaitSync   = "waiting-for-sync"     // writes are paused until the target catches up
+	failoverInProgress = "failover-in-progress" // this server is handing over to the target
+)
+
+// FailoverOptions are the options of the FAILOVER command
+type FailoverOptions struct {
+	Host    string        // replica to hand over to, any caught up replica when empty
+	Port    int           // listening port of the replica to hand over to
+	Timeout time.Duration // how long to wait for the target to catch up, 0 for ever
+	Force   bool          // hand over to the target even if it did not catch up in time
+}
+
+// failover is a coordinated switch of roles between this master and one of
+// its replicas. It is guarded by the Replication mutex.
+type failover struct {
+	options FailoverOptions
+	target  *replica // nil when any replica may be chosen
+	state   string
+	resume  chan struct{} // closed once writes may go on
+}
+
+// Failover starts handing this master's role over to a replica. Writes are
+// paused until the target has processed all of them, then this server
+// becomes a replica of the target, which promotes itself when asked to
+// continue the history with PSYNC FAILOVER.
+func (r *Replication) Failover(options FailoverOptions) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.link != nil {
+		return ErrFailoverOnReplica
+	}
+	if len(r.replicas) == 0 {
+		return ErrFailoverNoReplicas
+	}
+	if r.failover != nil {
+		return ErrFailoverInProgress
+	}
+
+	f := &failover{options: options, state: failoverWaitSync, resume: make(chan struct{})}
+	if options.Host != "" {
+		f.target = r.findReplica(options.Host, options.Port)
+		if f.target == nil {
+			return ErrFailoverNotReplica
+		}
+		if !f.target.online() {
+			return ErrFailoverNotOnline
+		}
+	}
+	r.failover = f
+	if f.target != nil {
+		fmt.Printf("FAILOVER requested to %s:%d, pausing writes\n", options.Host, options.Port)
+	} else {
+		fmt.Println("FAILOVER requested to any replica, pausing writes")
+	}
+	go r.runFailover(f)
+	return nil
+}
+
+// AbortFailover gives up a failover in progress, staying or becoming a master again
+func (r *Replication) AbortFailover() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.failover == nil {
+		return ErrNoFailover
+	}
+	r.abortFailover("aborted by a client")
+	return nil
+}
+
+// WaitWrites blocks a write sent on conn while a failover pauses writes
+func (r *Replication) WaitWrites(conn net.Conn) {
+	r.mutex.Lock()
+	f := r.failover
+	r.mutex.Unlock()
+
+	if f != nil && conn != r.client {
+		<-f.resume
+	}
+}
+
+// runFailover waits for a target to catch up with every write, then hands
+// over to it
+func (r *Replication) runFailover(f *failover) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	expired := false
+	if f.options.Timeout > 0 {
+		timer := time.AfterFunc(f.options.Timeout, func() {
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			expired = true
+			r.acks.Broadcast()
+		})
+		defer timer.Stop()
+	}
+
+	// Replicas acknowledge once a second, which covers the last writes
+	target := r.caughtUp(f)
+	for target == nil && !expired && r.failover == f {
+		r.acks.Wait()
+		target = r.caughtUp(f)
+	}
+	if r.failover != f {
+		return
+	}
+	if target == nil {
+		if !f.options.Force {
+			r.abortFailover("the target did not catch up in time")
+			return
+		}
+		target = f.target
+	}
+
+	host, port := f.options.Host, f.options.Port
+	if host == "" {
+		host, port = target.address()
+	}
+	fmt.Printf("Failover target %s:%d caught up, handing over\n", host, port)
+
+	f.state = failoverInProgress
+	r.dropReplicas()
+	link := &masterLink{host: host, port: port, done: make(chan struct{}), state: linkConnect, failover: true}
+	r.link = link
+	go r.replicate(link)
+}
+
+// caughtUp returns the target of f when it processed every write, or any
+// replica that did when f has no target. The caller must hold the mutex.
+func (r *Replication) caughtUp(f *failover) *replica {
+	for _, rep := range r.sortedReplicas() {
+		if f.target != nil && rep != f.target {
+			continue
+		}
+		if rep.acked(r.offset, false) {
+			return rep
+		}
+	}
+	return nil
+}
+
+// findReplica returns the replica connected from host that listens on port.
+// The caller must hold the mutex.
+func (r *Replication) findReplica(host string, port int) *replica {
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil
+	}
+	for _, rep := range r.replicas {
+		ip, repPort := rep.address()
+		if repPort != port {
+			continue
+		}
+		for _, candidate := range ips {
+			if candidate.String() == ip {
+				return rep
+			}
+		}
+	}
+	return nil
+}
+
+// completeFailover ends a failover once the target accepted this server as
+// its replica. The caller must hold the mutex.
+func (r *Replication) completeFailover(link *masterLink) {
+	link.failover = false
+	if r.failover == nil {
+		return
+	}
+	fmt.Printf("Failover to %s:%d completed\n", link.host, link.port)
+	close(r.failover.resume)
+	r.failover = nil
+}
+
+// abortFailover ends a failover without handing over, making this server a
+// master again if it had already turned to the target. The caller must hold
+// the mutex.
+func (r *Replication) abortFailover(reason string) {
+	fmt.Printf("FAILOVER aborted: %s\n", reason)
+	if r.failover.state == failoverInProgress && r.link != nil {
+		r.promote()
+	}
+	close(r.failover.resume)
+	r.failover = nil
+	r.acks.Broadcast()
+}
+
+// failoverState returns the failover state INFO reports. The caller must hold the mutex.
+func (r *Replication) failoverState() string {
+	if r.failover == nil {
+		return failoverNone
+	}
+	return r.failover.state
+}
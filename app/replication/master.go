@@ -0,0 +1,282 @@
+package replication
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/rdb"
+)
+
+// ErrNoMasterLink is returned for PSYNC sent to a replica that is not in sync
+// with its own master
+var ErrNoMasterLink = errors.New("NOMASTERLINK Can't SYNC while not connected with my master")
+
+// replicaBufferLimit bounds the stream waiting to be written to one replica.
+// A replica that falls this far behind is disconnected, as Redis does when a
+// replica exceeds its output buffer limit.
+const replicaBufferLimit = 256 << 20
+
+// States of a replica as INFO reports them
+const (
+	stateWaitBgsave = "wait_bgsave" // the snapshot is being encoded
+	stateSendBulk   = "send_bulk"   // the snapshot is being sent
+	stateOnline     = "online"      // the stream is being sent
+)
+
+// replica is a connected replica. The stream fed to it is buffered and
+// written by its own goroutine, after the snapshot for a full resync.
+type replica struct {
+	conn    net.Conn
+	port    int
+	created time.Time
+
+	mutex     sync.Mutex
+	cond      *sync.Cond
+	pending   []byte
+	state     string
+	stopped   bool
+	ackOffset int64 // offset the replica reported having processed
+	aofOffset int64 // offset the replica reported having on disk
+	lastAck   time.Time
+}
+
+// newReplica creates a replica for conn that announced it listens on port
+func newReplica(conn net.Conn, port int) *replica {
+	now := time.Now()
+	rep := &replica{conn: conn, port: port, created: now, state: stateWaitBgsave, aofOffset: -1, lastAck: now}
+	rep.cond = sync.NewCond(&rep.mutex)
+	return rep
+}
+
+// send queues stream bytes for the replica
+func (rep *replica) send(data []byte) {
+	rep.mutex.Lock()
+	defer rep.mutex.Unlock()
+
+	if rep.stopped {
+		return
+	}
+	if len(rep.pending)+len(data) > replicaBufferLimit {
+		fmt.Printf("Replica %s exceeded its output buffer limit, disconnecting it\n", rep.conn.RemoteAddr())
+		rep.stopped = true
+		rep.conn.Close()
+		return
+	}
+	rep.pending = append(rep.pending, data...)
+	rep.cond.Signal()
+}
+
+// run writes the resync header and, for a full resync, the snapshot encode
+// returns, then the stream until the replica is stopped
+func (rep *replica) run(header []byte, encode func() ([]byte, error)) {
+	if _, err := rep.conn.Write(header); err != nil {
+		rep.conn.Close()
+		return
+	}
+	if encode != nil {
+		payload, err := encode()
+		if err != nil {
+			fmt.Printf("Failed to encode the snapshot for a replica: %v\n", err)
+			rep.conn.Close()
+			return
+		}
+		rep.setState(stateSendBulk)
+		// The snapshot is sent like a bulk string without the trailing CRLF
+		bulk := append([]byte("$"+strconv.Itoa(len(payload))+"\r\n"), payload...)
+		if _, err := rep.conn.Write(bulk); err != nil {
+			rep.conn.Close()
+			return
+		}
+	}
+	rep.setState(stateOnline)
+
+	for {
+		rep.mutex.Lock()
+		for len(rep.pending) == 0 && !rep.stopped {
+			rep.cond.Wait()
+		}
+		if rep.stopped {
+			rep.mutex.Unlock()
+			return
+		}
+		data := rep.pending
+		rep.pending = nil
+		rep.mutex.Unlock()
+
+		if _, err := rep.conn.Write(data); err != nil {
+			rep.conn.Close()
+			return
+		}
+	}
+}
+
+// setState records how far the resync got
+func (rep *replica) setState(state string) {
+	rep.mutex.Lock()
+	defer rep.mutex.Unlock()
+	rep.state = state
+}
+
+// stop ends the writer goroutine
+func (rep *replica) stop() {
+	rep.mutex.Lock()
+	defer rep.mutex.Unlock()
+	rep.stopped = true
+	rep.cond.Broadcast()
+}
+
+// ack records the offsets the replica reported having processed and having on disk
+func (rep *replica) ack(offset, aofOffset int64) {
+	rep.mutex.Lock()
+	defer rep.mutex.Unlock()
+	rep.ackOffset = offset
+	rep.aofOffset = aofOffset
+	rep.lastAck = time.Now()
+}
+
+// acked reports whether the replica is online and acknowledged offset,
+// processed or on disk
+func (rep *replica) acked(offset int64, onDisk bool) bool {
+	rep.mutex.Lock()
+	defer rep.mutex.Unlock()
+	if rep.state != stateOnline {
+		return false
+	}
+	if onDisk {
+		return rep.aofOffset >= offset
+	}
+	return rep.ackOffset >= offset
+}
+
+// online reports whether the replica is being sent the stream
+func (rep *replica) online() bool {
+	rep.mutex.Lock()
+	defer rep.mutex.Unlock()
+	return rep.state == stateOnline
+}
+
+// address returns the IP the replica connected from and the port it listens on
+func (rep *replica) address() (string, int) {
+	ip := ""
+	if addr, ok := rep.conn.RemoteAddr().(*net.TCPAddr); ok {
+		ip = addr.IP.String()
+	}
+	return ip, rep.port
+}
+
+// info formats the replica for its slave<n> INFO field
+func (rep *replica) info() string {
+	ip, port := rep.address()
+
+	rep.mutex.Lock()
+	defer rep.mutex.Unlock()
+	return fmt.Sprintf("ip=%s,port=%d,state=%s,offset=%d,lag=%d",
+		ip, port, rep.state, rep.ackOffset, int(time.Since(rep.lastAck).Seconds()))
+}
+
+// sortedReplicas returns the replicas in the order they connected. The caller
+// must hold the mutex.
+func (r *Replication) sortedReplicas() []*replica {
+	replicas := make([]*replica, 0, len(r.replicas))
+	for _, rep := range r.replicas {
+		replicas = append(replicas, rep)
+	}
+	sort.Slice(replicas, func(i, j int) bool {
+		return replicas[i].created.Before(replicas[j].created)
+	})
+	return replicas
+}
+
+// SetListeningPort records the port a replica connected on conn listens on
+func (r *Replication) SetListeningPort(conn net.Conn, port int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.ports[conn] = port
+}
+
+// Ack records the offsets a replica reported with REPLCONF ACK, the one it
+// processed and the one its append-only file has on disk, -1 without one
+func (r *Replication) Ack(conn net.Conn, offset, aofOffset int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if rep, exists := r.replicas[conn]; exists {
+		rep.ack(offset, aofOffset)
+		r.acks.Broadcast()
+	}
+}
+
+// Sync serves PSYNC on conn. A replica continuing a history this server still
+// holds in its backlog is sent only the bytes it missed; any other is sent a
+// snapshot first. The stream of writes follows either way; a replica passes
+// on the stream of its own master. With failover, the master of this replica
+// hands its role over: this server becomes a master first.
+func (r *Replication) Sync(conn net.Conn, replid string, offset int64, failover bool) error {
+	// No write may land between the snapshot and the offset it is sent with
+	r.writes.Lock()
+	defer r.writes.Unlock()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if failover {
+		if replid != r.replid {
+			return ErrFailoverWrongReplID
+		}
+		if r.link != nil {
+			fmt.Println("Promoted to master by a FAILOVER")
+			r.promote()
+		}
+	}
+
+	if r.link != nil && r.link.state != linkConnected {
+		return ErrNoMasterLink
+	}
+	if old, exists := r.replicas[conn]; exists {
+		old.stop()
+	}
+	if r.backlog == nil {
+		r.backlog = newBacklog(r.backlogSize, r.offset)
+	}
+	rep := newReplica(conn, r.ports[conn])
+	r.replicas[conn] = rep
+
+	if missed, ok := r.continuable(replid, offset); ok {
+		rep.state = stateOnline
+		rep.pending = missed
+		go rep.run([]byte("+CONTINUE "+r.replid+"\r\n"), nil)
+		return nil
+	}
+
+	snapshot, _ := r.databases.Snapshot()
+	var aux [][2]string
+	if r.link == nil {
+		// The replica starts from database 0 once it has loaded the snapshot
+		r.selected = -1
+	} else if r.selected >= 0 {
+		// The stream is passed on unchanged, so the snapshot tells the
+		// replica which database it has selected
+		aux = append(aux, [2]string{"repl-stream-db", strconv.Itoa(r.selected)})
+	}
+	header := fmt.Sprintf("+FULLRESYNC %s %d\r\n", r.replid, r.offset)
+	go rep.run([]byte(header), func() ([]byte, error) {
+		var buf bytes.Buffer
+		err := rdb.Write(&buf, snapshot, aux...)
+		return buf.Bytes(), err
+	})
+	return nil
+}
+
+// continuable returns the bytes a replica resuming at offset of history
+// replid missed, reporting false when it needs a full resync. The caller must
+// hold the mutex.
+func (r *Replication) continuable(replid string, offset int64) ([]byte, bool) {
+	if replid != r.replid && (replid != r.replid2 || offset > r.secondOffset) {
+		return nil, false
+	}
+	return r.backlog.from(offset)
+}
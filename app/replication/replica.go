@@ -0,0 +1,513 @@
+package replication
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// ErrAlreadyConnected is returned by ReplicaOf for the master already replicated
+var ErrAlreadyConnected = errors.New("already connected to specified master")
+
+// ErrReplicaOfFailover is returned by ReplicaOf while a failover changes roles
+var ErrReplicaOfFailover = errors.New("ERR REPLICAOF not allowed while failing over.")
+
+// reconnectDelay is how long a replica waits before reconnecting to its master
+const reconnectDelay = time.Second
+
+// ackPeriod is how often a replica reports the offset it processed
+const ackPeriod = time.Second
+
+// replTimeout is how long a master may stay silent before the link is
+// considered lost, matching the default repl-timeout
+const replTimeout = 60 * time.Second
+
+// Link states as INFO reports them
+const (
+	linkConnect    = "connect"    // waiting to reconnect
+	linkConnecting = "connecting" // handshaking
+	linkSync       = "sync"       // receiving the snapshot
+	linkConnected  = "connected"  // receiving the stream
+)
+
+// masterLink is a replica's connection to its master. Its fields other than
+// the address are guarded by the Replication mutex.
+type masterLink struct {
+	host string
+	port int
+	done chan struct{}
+
+	conn     net.Conn
+	state    string
+	lastIO   time.Time
+	failover bool // the link hands the role of master over to the other end
+
+	writeMutex sync.Mutex // serialises acknowledgements written to conn
+}
+
+// close stops the link for good. The caller must hold the mutex.
+func (l *masterLink) close() {
+	close(l.done)
+	if l.conn != nil {
+		l.conn.Close()
+	}
+}
+
+// closed reports whether the link was stopped
+func (l *masterLink) closed() bool {
+	select {
+	case <-l.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// info returns the INFO fields describing the link. The caller must hold the mutex.
+func (l *masterLink) info() [][2]string {
+	status, lastIO := "down", "-1"
+	if l.state == linkConnected {
+		status = "up"
+		lastIO = strconv.Itoa(int(time.Since(l.lastIO).Seconds()))
+	}
+	return [][2]string{
+		{"master_host", l.host},
+		{"master_port", strconv.Itoa(l.port)},
+		{"master_link_status", status},
+		{"master_last_io_seconds_ago", lastIO},
+		{"master_sync_in_progress", boolInfo(l.state == linkSync)},
+	}
+}
+
+// ReplicaOf makes this server a replica of the master at host and port,
+// connecting in the background. A master gives up its own replicas, which
+// resync once they reconnect.
+func (r *Replication) ReplicaOf(host string, port int) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.failover != nil {
+		return ErrReplicaOfFailover
+	}
+
+	if r.link != nil {
+		if r.link.host == host && r.link.port == port {
+			return ErrAlreadyConnected
+		}
+		r.link.close()
+	} else {
+		r.dropReplicas()
+	}
+
+	link := &masterLink{host: host, port: port, done: make(chan struct{}), state: linkConnect}
+	r.link = link
+	go r.replicate(link)
+	return nil
+}
+
+// ReplicaOfNoOne turns a replica into a master. It starts a new history,
+// keeping the old ID valid up to the current offset.
+func (r *Replication) ReplicaOfNoOne() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.failover != nil {
+		return ErrReplicaOfFailover
+	}
+	if r.link != nil {
+		r.promote()
+	}
+	return nil
+}
+
+// promote stops replicating and starts a new history, keeping the old ID
+// valid up to the current offset. The caller must hold the mutex.
+func (r *Replication) promote() {
+	r.link.close()
+	r.link = nil
+
+	r.replid2 = r.replid
+	r.secondOffset = r.offset + 1
+	r.replid = newReplID()
+	r.selected = -1
+	// Half a transaction never took effect, so it is not passed on
+	r.pending = nil
+	r.streamMulti = false
+}
+
+// replicate keeps the link to the master up until it is closed
+func (r *Replication) replicate(link *masterLink) {
+	for {
+		err := r.syncWithMaster(link)
+		if link.closed() {
+			return
+		}
+		fmt.Printf("Connection with master %s:%d lost: %v\n", link.host, link.port, err)
+
+		r.mutex.Lock()
+		link.state = linkConnect
+		// A target that did not take over leaves this server the master
+		if link.failover && r.failover != nil {
+			r.abortFailover("the target did not accept the handover")
+			r.mutex.Unlock()
+			return
+		}
+		r.mutex.Unlock()
+
+		select {
+		case <-link.done:
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// syncWithMaster connects to the master, resynchronises and applies the
+// stream until the connection fails
+func (r *Replication) syncWithMaster(link *masterLink) error {
+	address := net.JoinHostPort(link.host, strconv.Itoa(link.port))
+	conn, err := net.DialTimeout("tcp", address, replTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	r.mutex.Lock()
+	if link.closed() {
+		r.mutex.Unlock()
+		return nil
+	}
+	link.conn = conn
+	link.state = linkConnecting
+	replid, offset := r.replid, r.offset
+	hasHistory := r.synced || r.backlog != nil
+	handover := link.failover
+	r.mutex.Unlock()
+
+	recorder := &recordingReader{r: conn}
+	reader := bufio.NewReader(recorder)
+	request := func(args ...string) (string, error) {
+		conn.SetDeadline(time.Now().Add(replTimeout))
+		if _, err := conn.Write(resp.AppendCommand(nil, args)); err != nil {
+			return "", err
+		}
+		return readLine(reader)
+	}
+
+	// The master must answer PING before anything else is sent
+	reply, err := request("PING")
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(reply, "-NOAUTH") || strings.HasPrefix(reply, "-NOPERM") {
+		return fmt.Errorf("master refused PING: %s", reply[1:])
+	}
+	// Masters that do not know these options still replicate
+	if reply, err := request("REPLCONF", "listening-port", strconv.Itoa(r.port)); err != nil {
+		return err
+	} else if strings.HasPrefix(reply, "-") {
+		fmt.Printf("Master does not understand REPLCONF listening-port: %s\n", reply[1:])
+	}
+	if reply, err := request("REPLCONF", "capa", "psync2"); err != nil {
+		return err
+	} else if strings.HasPrefix(reply, "-") {
+		fmt.Printf("Master does not understand REPLCONF capa: %s\n", reply[1:])
+	}
+
+	// Without a history of its own, the replica asks for a full resync
+	psyncID, psyncOffset := "?", "-1"
+	if hasHistory {
+		psyncID, psyncOffset = replid, strconv.FormatInt(offset+1, 10)
+	}
+	r.mutex.Lock()
+	link.state = linkSync
+	r.mutex.Unlock()
+	psync := []string{"PSYNC", psyncID, psyncOffset}
+	if handover {
+		// The target promotes itself before continuing this history
+		psync = append(psync, "FAILOVER")
+	}
+	reply, err = request(psync...)
+	if err != nil {
+		return err
+	}
+
+	fields := strings.Fields(reply)
+	switch {
+	case len(fields) == 3 && fields[0] == "+FULLRESYNC":
+		masterOffset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad FULLRESYNC reply: %s", reply)
+		}
+		aux, err := r.loadSnapshot(reader)
+		if err != nil {
+			return err
+		}
+		r.mutex.Lock()
+		r.replid, r.offset = fields[1], masterOffset
+		r.replid2, r.secondOffset = noReplID, -1
+		r.synced = true
+		r.backlog = newBacklog(r.backlogSize, masterOffset)
+		r.selected = -1
+		if db, err := strconv.Atoi(aux["repl-stream-db"]); err == nil {
+			r.selected = db
+		}
+		// Sub-replicas hold the dataset that was just replaced
+		r.dropReplicas()
+		r.mutex.Unlock()
+		fmt.Printf("Full resync with master %s completed\n", address)
+	case len(fields) >= 1 && fields[0] == "+CONTINUE":
+		r.mutex.Lock()
+		// A master that was promoted since continues under a new ID, which
+		// sub-replicas learn when they reconnect
+		if len(fields) == 2 && fields[1] != r.replid {
+			r.replid2, r.secondOffset = r.replid, r.offset+1
+			r.replid = fields[1]
+			r.dropReplicas()
+		}
+		if r.backlog == nil {
+			r.backlog = newBacklog(r.backlogSize, r.offset)
+		}
+		r.mutex.Unlock()
+		fmt.Printf("Partial resync with master %s accepted\n", address)
+	default:
+		return fmt.Errorf("unexpected PSYNC reply: %s", reply)
+	}
+
+	r.mutex.Lock()
+	link.state = linkConnected
+	link.lastIO = time.Now()
+	if link.failover {
+		r.completeFailover(link)
+	}
+	r.mutex.Unlock()
+	r.resetClient()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go r.ackPeriodically(link, conn, stop)
+	return r.applyStream(link, conn, recorder, reader)
+}
+
+// resetClient readies the connection the stream runs on to continue from the
+// offset reached: whatever a lost link left half done is dropped, and the
+// database the stream selected there is selected again
+func (r *Replication) resetClient() {
+	r.mutex.Lock()
+	r.pending = nil
+	r.streamMulti = false
+	r.pendingDB = r.selected
+	selected := r.selected
+	r.mutex.Unlock()
+
+	r.executor.CleanupConnection(r.client)
+	if selected >= 0 {
+		r.executor.Process(resp.RespValue{Type: resp.ArrayType, Value: []resp.RespValue{
+			{Type: resp.BulkString, Value: "SELECT"},
+			{Type: resp.BulkString, Value: strconv.Itoa(selected)},
+		}}, r.client)
+	}
+}
+
+// ackPeriodically reports the processed offset to the master until stop is
+// closed, starting right away so a resync is acknowledged at once
+func (r *Replication) ackPeriodically(link *masterLink, conn net.Conn, stop <-chan struct{}) {
+	ticker := time.NewTicker(ackPeriod)
+	defer ticker.Stop()
+	for {
+		r.mutex.Lock()
+		offset := r.offset
+		r.mutex.Unlock()
+		if err := r.sendAck(link, conn, offset); err != nil {
+			return
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendAck reports to the master that the stream was processed up to offset,
+// along with the offset up to which the append-only file is on disk
+func (r *Replication) sendAck(link *masterLink, conn net.Conn, offset int64) error {
+	ack := resp.AppendCommand(nil, []string{
+		"REPLCONF", "ACK", strconv.FormatInt(offset, 10),
+		"FACK", strconv.FormatInt(r.executor.FsyncedOffset(), 10),
+	})
+
+	link.writeMutex.Lock()
+	defer link.writeMutex.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(replTimeout))
+	_, err := conn.Write(ack)
+	return err
+}
+
+// loadSnapshot reads the snapshot of a full resync and loads it in place of
+// the dataset, returning its metadata fields
+func (r *Replication) loadSnapshot(reader *bufio.Reader) (map[string]string, error) {
+	// Masters may send newlines to keep the link alive while preparing it
+	var header string
+	for header == "" {
+		line, err := readLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		header = line
+	}
+	if !strings.HasPrefix(header, "$") {
+		return nil, fmt.Errorf("bad snapshot header: %s", header)
+	}
+	size, err := strconv.Atoi(header[1:])
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("bad snapshot header: %s", header)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, err
+	}
+	return r.executor.LoadSnapshot(bytes.NewReader(payload))
+}
+
+// applyStream runs the commands the master streams. Each is fed on to
+// sub-replicas and the backlog as the exact bytes received, advancing the
+// offset, once it took effect.
+func (r *Replication) applyStream(link *masterLink, conn net.Conn, recorder *recordingReader, reader *bufio.Reader) error {
+	recorder.start(reader)
+	for {
+		conn.SetReadDeadline(time.Now().Add(replTimeout))
+		command, err := resp.ParseRESP(reader)
+		if err != nil {
+			return err
+		}
+		raw := recorder.take(reader)
+		name, arg := commandName(command)
+
+		r.mutex.Lock()
+		offset := r.offset
+		r.pending = append(r.pending, raw...)
+		switch name {
+		case "MULTI":
+			r.streamMulti = true
+		case "SELECT":
+			if db, err := strconv.Atoi(arg); err == nil {
+				r.pendingDB = db
+			}
+		}
+		r.applying = true
+		r.mutex.Unlock()
+
+		if name == "REPLCONF" && strings.EqualFold(arg, "GETACK") {
+			// The acknowledged offset excludes the GETACK itself
+			err = r.sendAck(link, conn, offset)
+		} else {
+			err = r.executor.Process(command, r.client)
+		}
+
+		r.mutex.Lock()
+		r.applying = false
+		if name == "EXEC" || name == "DISCARD" {
+			r.streamMulti = false
+		}
+		// Queued commands take effect with EXEC, so the offset only moves
+		// past them then
+		if !r.streamMulti {
+			r.commitPending()
+		}
+		link.lastIO = time.Now()
+		r.mutex.Unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// commitPending feeds on the part of the master's stream that took effect.
+// The caller must hold the mutex.
+func (r *Replication) commitPending() {
+	if len(r.pending) == 0 {
+		return
+	}
+	r.feed(r.pending)
+	r.pending = nil
+	r.selected = r.pendingDB
+}
+
+// commandName returns the upper-cased name and first argument of a command
+func commandName(command resp.RespValue) (string, string) {
+	parts, ok := command.Value.([]resp.RespValue)
+	if !ok || len(parts) == 0 {
+		return "", ""
+	}
+	name, _ := parts[0].Value.(string)
+	arg := ""
+	if len(parts) > 1 {
+		arg, _ = parts[1].Value.(string)
+	}
+	return strings.ToUpper(name), arg
+}
+
+// readLine reads a CRLF terminated line and returns it without the terminator
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// recordingReader keeps the bytes read through it once started, so the stream
+// can be fed on exactly as the master sent it
+type recordingReader struct {
+	r         io.Reader
+	recording bool
+	data      []byte
+}
+
+func (rr *recordingReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	if rr.recording {
+		rr.data = append(rr.data, p[:n]...)
+	}
+	return n, err
+}
+
+// start records from the first byte reader has not returned yet
+func (rr *recordingReader) start(reader *bufio.Reader) {
+	buffered, _ := reader.Peek(reader.Buffered())
+	rr.data = append([]byte(nil), buffered...)
+	rr.recording = true
+}
+
+// take returns the bytes reader returned since the last take
+func (rr *recordingReader) take(reader *bufio.Reader) []byte {
+	n := len(rr.data) - reader.Buffered()
+	taken := rr.data[:n:n]
+	rr.data = rr.data[n:]
+	return taken
+}
+
+// masterClient is the connection commands streamed by the master run on.
+// Replies to the master are suppressed, so they are discarded.
+type masterClient struct{}
+
+func (c *masterClient) Write(b []byte) (n int, err error)  { return len(b), nil }
+func (c *masterClient) Read(b []byte) (n int, err error)   { return 0, nil }
+func (c *masterClient) Close() error                       { return nil }
+func (c *masterClient) LocalAddr() net.Addr                { return nil }
+func (c *masterClient) RemoteAddr() net.Addr               { return nil }
+func (c *masterClient) SetDeadline(t time.Time) error      { return nil }
+func (c *masterClient) SetReadDeadline(t time.Time) error  { return nil }
+func (c *masterClient) SetWriteDeadline(t time.Time) error { return nil }
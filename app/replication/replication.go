@@ -0,0 +1,358 @@
+package replication
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/store"
+)
+
+// ErrReadOnly is returned for writes sent by clients to a read-only replica
+var ErrReadOnly = errors.New("READONLY You can't write against a read only replica.")
+
+// pingPeriod is how often a master pings its replicas, so they can tell a
+// quiet master from a lost one
+const pingPeriod = 10 * time.Second
+
+// Executor runs the commands a master streams and loads the snapshots it sends
+type Executor interface {
+	Process(command resp.RespValue, conn net.Conn) error
+	CleanupConnection(conn net.Conn)
+	LoadSnapshot(r io.Reader) (map[string]string, error)
+	FsyncedOffset() int64
+}
+
+// Replication holds the replication state of the server: as a master, the
+// stream of writes fed to its replicas and the backlog of it kept for partial
+// resyncs, and as a replica, the link to its master
+type Replication struct {
+	databases *store.Databases
+	writes    sync.Locker // held by writers from executing a command until it is fed
+	executor  Executor
+	port      int // port this server listens on, announced to masters
+
+	mutex        sync.Mutex
+	replid       string // ID of the history the stream belongs to
+	replid2      string // ID of the history before the last promotion
+	offset       int64  // offset of the last byte of the stream
+	secondOffset int64  // offset up to which replid2 is valid, -1 without one
+	backlog      *backlog
+	backlogSize  int
+	selected     int    // database of the last fed command, -1 to select again
+	applying     bool   // a command from the master is being applied
+	pending      []byte // bytes of the master's stream applied but not yet fed on
+	pendingDB    int    // database the stream selects once pending is fed on
+	streamMulti  bool   // the master's stream is inside MULTI
+	lastPing     time.Time
+	acks         *sync.Cond // signalled as replicas acknowledge offsets
+	replicas     map[net.Conn]*replica
+	ports        map[net.Conn]int // listening ports announced with REPLCONF
+	readOnly     bool
+	link         *masterLink   // nil while this server is a master
+	failover     *failover     // nil unless a failover is under way
+	client       *masterClient // runs the commands the master streams
+	synced       bool          // whether the stream continues a master's history
+}
+
+// New creates the replication state of a master with a fresh replication ID.
+// writes must be held by every writer from executing a command until it is fed.
+func New(databases *store.Databases, writes sync.Locker, port int) *Replication {
+	r := &Replication{
+		databases:    databases,
+		writes:       writes,
+		port:         port,
+		replid:       newReplID(),
+		replid2:      noReplID,
+		secondOffset: -1,
+		backlogSize:  defaultBacklogSize,
+		selected:     -1,
+		replicas:     make(map[net.Conn]*replica),
+		ports:        make(map[net.Conn]int),
+		readOnly:     true,
+		client:       &masterClient{},
+	}
+	r.acks = sync.NewCond(&r.mutex)
+	return r
+}
+
+// SetExecutor sets what runs the commands streamed by a master
+func (r *Replication) SetExecutor(executor Executor) {
+	r.executor = executor
+}
+
+// noReplID is reported for a replid2 that is not set
+const noReplID = "0000000000000000000000000000000000000000"
+
+// newReplID returns a random 40 character replication ID
+func newReplID() string {
+	buf := make([]byte, 20)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// IsReplica reports whether this server replicates a master
+func (r *Replication) IsReplica() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.link != nil
+}
+
+// Role returns the role HELLO reports
+func (r *Replication) Role() string {
+	if r.IsReplica() {
+		return "replica"
+	}
+	return "master"
+}
+
+// RejectsWrite reports whether a write sent on conn must be refused: replicas
+// only take writes from their master unless they were made writable
+func (r *Replication) RejectsWrite(conn net.Conn) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.link != nil && r.readOnly && conn != r.client
+}
+
+// IsMasterClient reports whether conn runs the commands the master streams
+func (r *Replication) IsMasterClient(conn net.Conn) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.client != nil && conn == net.Conn(r.client)
+}
+
+// ReadOnly returns the replica-read-only parameter
+func (r *Replication) ReadOnly() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.readOnly {
+		return "yes"
+	}
+	return "no"
+}
+
+// SetReadOnly sets the replica-read-only parameter
+func (r *Replication) SetReadOnly(value string) error {
+	readOnly, err := parseYesNo(value)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.readOnly = readOnly
+	return nil
+}
+
+// BacklogSize returns the repl-backlog-size parameter
+func (r *Replication) BacklogSize() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return strconv.Itoa(r.backlogSize)
+}
+
+// SetBacklogSize sets the repl-backlog-size parameter
+func (r *Replication) SetBacklogSize(value string) error {
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 1 {
+		return errors.New("argument must be a positive integer")
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.backlogSize = size
+	if r.backlog != nil {
+		r.backlog.resize(size)
+	}
+	return nil
+}
+
+// parseYesNo parses a boolean parameter
+func parseYesNo(value string) (bool, error) {
+	switch value {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	}
+	return false, errors.New("argument must be 'yes' or 'no'")
+}
+
+// Feed appends a write command executed against database db to the stream
+// sent to replicas and returns the offset it ends at. Callers hold the writes
+// lock, or otherwise exclude other writers, so commands are fed in the order
+// they executed.
+func (r *Replication) Feed(db int, args []string) int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// A replica's stream is the one its master sends. Writes applied from it
+	// are fed on as the bytes the master sent, as soon as they took effect.
+	if r.link != nil {
+		if r.applying {
+			r.commitPending()
+		}
+		return r.offset
+	}
+
+	var buf []byte
+	if db != r.selected {
+		buf = resp.AppendCommand(buf, []string{"SELECT", strconv.Itoa(db)})
+		r.selected = db
+	}
+	r.feed(resp.AppendCommand(buf, args))
+	return r.offset
+}
+
+// feed appends encoded commands to the stream. The offset advances even
+// before the first replica created the backlog, so waits on the local fsync
+// can refer to it. The caller must hold the mutex.
+func (r *Replication) feed(data []byte) {
+	r.offset += int64(len(data))
+	if r.backlog != nil {
+		r.backlog.write(data)
+	}
+	for _, replica := range r.replicas {
+		replica.send(data)
+	}
+}
+
+// dropReplicas disconnects every replica, so they resync once they
+// reconnect. The caller must hold the mutex.
+func (r *Replication) dropReplicas() {
+	for conn, rep := range r.replicas {
+		rep.stop()
+		conn.Close()
+	}
+}
+
+// Cron pings the replicas of a master periodically and wakes waits on the
+// local fsync to check it again. It is meant to be called periodically.
+func (r *Replication) Cron() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.acks.Broadcast()
+	// The offset holds still while a failover waits for a target to reach it
+	if r.link != nil || r.backlog == nil || len(r.replicas) == 0 || r.failover != nil {
+		return
+	}
+	if time.Since(r.lastPing) >= pingPeriod {
+		r.lastPing = time.Now()
+		r.feed(resp.AppendCommand(nil, []string{"PING"}))
+	}
+}
+
+// CleanupConnection forgets a closed connection, which may be a replica
+func (r *Replication) CleanupConnection(conn net.Conn) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if replica, exists := r.replicas[conn]; exists {
+		replica.stop()
+		delete(r.replicas, conn)
+	}
+	delete(r.ports, conn)
+}
+
+// ReplicationInfo returns the fields of the INFO replication section in order
+func (r *Replication) ReplicationInfo() [][2]string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var info [][2]string
+	if r.link == nil {
+		info = append(info, [2]string{"role", "master"})
+	} else {
+		info = append(info, [2]string{"role", "slave"})
+		info = append(info, r.link.info()...)
+		info = append(info,
+			[2]string{"slave_read_repl_offset", strconv.FormatInt(r.offset, 10)},
+			[2]string{"slave_repl_offset", strconv.FormatInt(r.offset, 10)},
+			[2]string{"slave_priority", "100"},
+			[2]string{"slave_read_only", boolInfo(r.readOnly)},
+			[2]string{"replica_announced", "1"},
+		)
+	}
+
+	info = append(info, [2]string{"connected_slaves", strconv.Itoa(len(r.replicas))})
+	for i, replica := range r.sortedReplicas() {
+		info = append(info, [2]string{"slave" + strconv.Itoa(i), replica.info()})
+	}
+
+	info = append(info, [2]string{"master_failover_state", r.failoverState()})
+
+	active, first, histlen := "0", "0", "0"
+	if r.backlog != nil {
+		active = "1"
+		first = strconv.FormatInt(r.backlog.firstOffset(), 10)
+		histlen = strconv.Itoa(r.backlog.histlen())
+	}
+	return append(info,
+		[2]string{"master_replid", r.replid},
+		[2]string{"master_replid2", r.replid2},
+		[2]string{"master_repl_offset", strconv.FormatInt(r.offset, 10)},
+		[2]string{"second_repl_offset", strconv.FormatInt(r.secondOffset, 10)},
+		[2]string{"repl_backlog_active", active},
+		[2]string{"repl_backlog_size", strconv.Itoa(r.backlogSize)},
+		[2]string{"repl_backlog_first_byte_offset", first},
+		[2]string{"repl_backlog_histlen", histlen},
+	)
+}
+
+// RoleState is the replication role of the server as ROLE reports it
+type RoleState struct {
+	Replica  bool
+	Offset   int64          // offset of the stream processed
+	Replicas []ReplicaState // replicas of a master, in the order they connected
+
+	// The master of a replica and the state of the link to it
+	MasterHost string
+	MasterPort int
+	LinkState  string
+}
+
+// ReplicaState is a replica of a master as ROLE lists it
+type ReplicaState struct {
+	IP     string
+	Port   int
+	Offset int64 // offset the replica acknowledged
+}
+
+// RoleState returns the role of the server with its offsets
+func (r *Replication) RoleState() RoleState {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.link != nil {
+		return RoleState{
+			Replica:    true,
+			Offset:     r.offset,
+			MasterHost: r.link.host,
+			MasterPort: r.link.port,
+			LinkState:  r.link.state,
+		}
+	}
+
+	state := RoleState{Offset: r.offset, Replicas: make([]ReplicaState, 0, len(r.replicas))}
+	for _, replica := range r.sortedReplicas() {
+		ip, port := replica.address()
+		replica.mutex.Lock()
+		offset := replica.ackOffset
+		replica.mutex.Unlock()
+		state.Replicas = append(state.Replicas, ReplicaState{IP: ip, Port: port, Offset: offset})
+	}
+	return state
+}
+
+// boolInfo formats a flag for INFO
+func boolInfo(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,99 @@
+package replication
+
+import (
+	"errors"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// Errors returned for waits a replica cannot serve, or that ask for an
+// append-only file that is off
+var (
+	ErrWaitOnReplica    = errors.New("ERR WAIT cannot be used with replica instances. Please also note that since Redis 4.0 if a replica is configured to be writable (which is not the default) writes to replicas are just local and are not propagated.")
+	ErrWaitAOFOnReplica = errors.New("ERR WAITAOF cannot be used with replica instances. Please also note that writes to replicas are just local and are not propagated.")
+	ErrAppendOnlyOff    = errors.New("ERR WAITAOF cannot be used when numlocal is set but appendonly is disabled.")
+)
+
+// WaitForReplicas blocks until numReplicas replicas acknowledged the stream
+// up to offset, the end of the last write of the waiting client, or until
+// timeout elapses, waiting forever when it is 0 and not at all when it is
+// negative. It returns how many replicas acknowledged.
+func (r *Replication) WaitForReplicas(offset int64, numReplicas int, timeout time.Duration) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.link != nil {
+		return 0, ErrWaitOnReplica
+	}
+	r.wait(timeout, func() bool {
+		return r.countAcked(offset, false) >= numReplicas
+	})
+	return r.countAcked(offset, false), nil
+}
+
+// WaitForFsync blocks until the stream up to offset is on disk in the local
+// append-only file, when numLocal is set, and in those of numReplicas
+// replicas, or until timeout elapses as for WaitForReplicas. The files log
+// offsets of the stream, which only move on with writes. It returns whether
+// the local file has them and how many replicas do.
+func (r *Replication) WaitForFsync(offset int64, numLocal, numReplicas int, timeout time.Duration) (int, int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.link != nil {
+		return 0, 0, ErrWaitAOFOnReplica
+	}
+	if numLocal > 0 && r.executor.FsyncedOffset() < 0 {
+		return 0, 0, ErrAppendOnlyOff
+	}
+	local := func() int {
+		if r.executor.FsyncedOffset() >= offset {
+			return 1
+		}
+		return 0
+	}
+	r.wait(timeout, func() bool {
+		return local() >= numLocal && r.countAcked(offset, true) >= numReplicas
+	})
+	return local(), r.countAcked(offset, true), nil
+}
+
+// wait blocks until done reports true or timeout elapses, asking replicas to
+// acknowledge their offsets first. The caller must hold the mutex, which is
+// released while waiting.
+func (r *Replication) wait(timeout time.Duration, done func() bool) {
+	if timeout < 0 || done() {
+		return
+	}
+	// Replicas acknowledge once a second anyway; asking makes them do it now
+	if len(r.replicas) > 0 {
+		r.feed(resp.AppendCommand(nil, []string{"REPLCONF", "GETACK", "*"}))
+	}
+
+	expired := false
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			expired = true
+			r.acks.Broadcast()
+		})
+		defer timer.Stop()
+	}
+	for !expired && !done() {
+		r.acks.Wait()
+	}
+}
+
+// countAcked returns how many replicas acknowledged offset, processed or on
+// disk. The caller must hold the mutex.
+func (r *Replication) countAcked(offset int64, onDisk bool) int {
+	count := 0
+	for _, rep := range r.replicas {
+		if rep.acked(offset, onDisk) {
+			count++
+		}
+	}
+	return count
+}
@@ -16,6 +16,10 @@ const (
 	IntegerType
 	BulkString
 	ArrayType
+	// MapType holds alternating keys and values; RESP2 clients receive it as a flat array
+	MapType
+	// PushType is an out-of-band message; RESP2 clients receive it as an array
+	PushType
 )
 
 // RespValue represents a RESP protocol value
@@ -24,7 +28,65 @@ type RespValue struct {
 	Value interface{}
 }
 
-// ParseRESP reads the next RESP value from the stream
+// StringArgs converts the parts of a command to strings, reporting whether
+// all of them were strings
+func StringArgs(parts []RespValue) ([]string, bool) {
+	args := make([]string, len(parts))
+	for i, part := range parts {
+		s, ok := part.Value.(string)
+		if !ok {
+			return nil, false
+		}
+		args[i] = s
+	}
+	return args, true
+}
+
+// ErrProtocol is returned for malformed input; the stream cannot be resynchronised after it
+var ErrProtocol = errors.New("Protocol error")
+
+// Errors returned for lengths out of range, checked before anything is
+// allocated for the value
+var (
+	ErrInvalidBulkLength      = errors.New("Protocol error: invalid bulk length")
+	ErrInvalidMultibulkLength = errors.New("Protocol error: invalid multibulk length")
+)
+
+// Limits on declared lengths, matching Redis's proto-max-bulk-len and the
+// largest multibulk it accepts
+const (
+	MaxBulkLength      = 512 * 1024 * 1024
+	MaxMultibulkLength = 1024 * 1024
+)
+
+// readLine reads a CRLF terminated line and returns it without the terminator
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(line, "\r\n") {
+		return "", ErrProtocol
+	}
+	return line[:len(line)-2], nil
+}
+
+// readLength reads the length line of a bulk string or aggregate header,
+// which may be -1 for null but no more than limit
+func readLength(r *bufio.Reader, limit int, invalid error) (int, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return 0, err
+	}
+	length, err := strconv.Atoi(line)
+	if err != nil || length < -1 || length > limit {
+		return 0, invalid
+	}
+	return length, nil
+}
+
+// ParseRESP reads the next RESP value from the stream. Bulk strings are read by
+// their declared length, so they may contain any bytes including CRLF and NUL.
 func ParseRESP(r *bufio.Reader) (RespValue, error) {
 	prefix, err := r.ReadByte()
 	if err != nil {
@@ -32,40 +94,91 @@ func ParseRESP(r *bufio.Reader) (RespValue, error) {
 	}
 	switch prefix {
 	case '+':
-		line, _ := r.ReadString('\n')
-		return RespValue{SimpleString, strings.TrimSuffix(line, "\r\n")}, nil
+		line, err := readLine(r)
+		if err != nil {
+			return RespValue{}, err
+		}
+		return RespValue{SimpleString, line}, nil
 	case '-':
-		line, _ := r.ReadString('\n')
-		return RespValue{ErrorType, strings.TrimSuffix(line, "\r\n")}, nil
+		line, err := readLine(r)
+		if err != nil {
+			return RespValue{}, err
+		}
+		return RespValue{ErrorType, line}, nil
 	case ':':
-		line, _ := r.ReadString('\n')
-		num, _ := strconv.ParseInt(strings.TrimSuffix(line, "\r\n"), 10, 64)
+		line, err := readLine(r)
+		if err != nil {
+			return RespValue{}, err
+		}
+		num, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return RespValue{}, ErrProtocol
+		}
 		return RespValue{IntegerType, num}, nil
 	case '$':
-		lenLine, _ := r.ReadString('\n')
-		length, _ := strconv.Atoi(strings.TrimSuffix(lenLine, "\r\n"))
+		length, err := readLength(r, MaxBulkLength, ErrInvalidBulkLength)
+		if err != nil {
+			return RespValue{}, err
+		}
 		if length == -1 {
 			return RespValue{BulkString, nil}, nil // Null bulk string
 		}
 		buf := make([]byte, length+2) // +2 for \r\n
-		io.ReadFull(r, buf)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return RespValue{}, err
+		}
+		if buf[length] != '\r' || buf[length+1] != '\n' {
+			return RespValue{}, ErrProtocol
+		}
 		return RespValue{BulkString, string(buf[:length])}, nil
-	case '*':
-		lenLine, _ := r.ReadString('\n')
-		count, _ := strconv.Atoi(strings.TrimSuffix(lenLine, "\r\n"))
+	case '*', '>':
+		count, err := readLength(r, MaxMultibulkLength, ErrInvalidMultibulkLength)
+		if err != nil {
+			return RespValue{}, err
+		}
 		if count == -1 {
 			return RespValue{ArrayType, nil}, nil // Null array
 		}
-		items := make([]RespValue, count)
-		for i := 0; i < count; i++ {
-			item, err := ParseRESP(r)
-			if err != nil {
-				return RespValue{}, err
-			}
-			items[i] = item
+		items, err := parseItems(r, count)
+		if err != nil {
+			return RespValue{}, err
+		}
+		if prefix == '>' {
+			return RespValue{PushType, items}, nil
 		}
 		return RespValue{ArrayType, items}, nil
+	case '%':
+		count, err := readLength(r, MaxMultibulkLength/2, ErrInvalidMultibulkLength)
+		if err != nil {
+			return RespValue{}, err
+		}
+		if count < 0 {
+			return RespValue{}, ErrInvalidMultibulkLength
+		}
+		items, err := parseItems(r, count*2)
+		if err != nil {
+			return RespValue{}, err
+		}
+		return RespValue{MapType, items}, nil
+	case '_':
+		if _, err := readLine(r); err != nil {
+			return RespValue{}, err
+		}
+		return RespValue{BulkString, nil}, nil // RESP3 null
 	default:
 		return RespValue{}, errors.New("unknown RESP prefix")
 	}
 }
+
+// parseItems reads count consecutive RESP values
+func parseItems(r *bufio.Reader, count int) ([]RespValue, error) {
+	items := make([]RespValue, count)
+	for i := 0; i < count; i++ {
+		item, err := ParseRESP(r)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = item
+	}
+	return items, nil
+}
@@ -0,0 +1,182 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func parse(t *testing.T, input string) (RespValue, error) {
+	t.Helper()
+	return ParseRESP(bufio.NewReader(strings.NewReader(input)))
+}
+
+func TestParseBinarySafeBulkStrings(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"empty", "$0\r\n\r\n", ""},
+		{"crlf inside", "$8\r\nfoo\r\nbar\r\n", "foo\r\nbar"},
+		{"nul inside", "$7\r\nfoo\x00bar\r\n", "foo\x00bar"},
+		{"only crlf", "$2\r\n\r\n\r\n", "\r\n"},
+		{"high bytes", "$3\r\n\xff\xfe\x80\r\n", "\xff\xfe\x80"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parse(t, tt.input)
+			if err != nil {
+				t.Fatalf("ParseRESP(%q) error: %v", tt.input, err)
+			}
+			if got.Type != BulkString || got.Value != tt.want {
+				t.Errorf("ParseRESP(%q) = %#v, want bulk %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCommandArray(t *testing.T) {
+	got, err := parse(t, "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$5\r\na\r\nb\x00\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RespValue{ArrayType, []RespValue{
+		{BulkString, "SET"}, {BulkString, "k"}, {BulkString, "a\r\nb\x00"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+
+	args, ok := StringArgs(got.Value.([]RespValue))
+	if !ok || !reflect.DeepEqual(args, []string{"SET", "k", "a\r\nb\x00"}) {
+		t.Errorf("StringArgs = %q, %v", args, ok)
+	}
+	if _, ok := StringArgs([]RespValue{{BulkString, "GET"}, {BulkString, nil}}); ok {
+		t.Error("StringArgs accepted a null bulk string")
+	}
+}
+
+func TestAppendCommand(t *testing.T) {
+	input := "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$5\r\na\r\nb\x00\r\n"
+	buf := AppendCommand([]byte("prefix"), []string{"SET", "k", "a\r\nb\x00"})
+	if got := string(buf); got != "prefix"+input {
+		t.Errorf("AppendCommand = %q, want %q", got, "prefix"+input)
+	}
+	if got := string(AppendCommand(nil, nil)); got != "*0\r\n" {
+		t.Errorf("AppendCommand with no args = %q", got)
+	}
+}
+
+func TestParsePartialReads(t *testing.T) {
+	input := "*2\r\n$4\r\nECHO\r\n$6\r\nab\r\ncd\r\n+OK\r\n"
+	// One byte per read splits every header and payload across reads
+	reader := bufio.NewReaderSize(iotest.OneByteReader(strings.NewReader(input)), 16)
+
+	first, err := ParseRESP(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := first.Value.([]RespValue)
+	if len(items) != 2 || items[1].Value != "ab\r\ncd" {
+		t.Errorf("first value = %#v", first)
+	}
+	second, err := ParseRESP(reader)
+	if err != nil || second.Value != "OK" {
+		t.Errorf("second value = %#v, %v", second, err)
+	}
+	if _, err := ParseRESP(reader); err != io.EOF {
+		t.Errorf("after last value err = %v, want EOF", err)
+	}
+}
+
+func TestParseTruncatedInput(t *testing.T) {
+	for _, input := range []string{"$5\r\nab", "*2\r\n$1\r\na\r\n", "+OK"} {
+		if _, err := parse(t, input); err == nil {
+			t.Errorf("ParseRESP(%q) succeeded on truncated input", input)
+		}
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{"bulk missing crlf", "$3\r\nfooXY", ErrProtocol},
+		{"bulk bare newline", "$3\nfoo\r\n", ErrProtocol},
+		{"bulk not a number", "$abc\r\n", ErrInvalidBulkLength},
+		{"bulk negative", "$-2\r\n", ErrInvalidBulkLength},
+		{"bulk huge", "*1\r\n$9223372036854775807\r\n", ErrInvalidBulkLength},
+		{"bulk overflow", "$99999999999999999999\r\n", ErrInvalidBulkLength},
+		{"bulk above limit", "$536870913\r\n", ErrInvalidBulkLength},
+		{"multibulk negative", "*-5\r\n", ErrInvalidMultibulkLength},
+		{"multibulk huge", "*9223372036854775807\r\n", ErrInvalidMultibulkLength},
+		{"multibulk above limit", "*1048577\r\n", ErrInvalidMultibulkLength},
+		{"map above limit", "%1048576\r\n", ErrInvalidMultibulkLength},
+		{"map negative", "%-1\r\n", ErrInvalidMultibulkLength},
+		{"integer", ":12a\r\n", ErrProtocol},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parse(t, tt.input)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ParseRESP(%q) error = %v, want %v", tt.input, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNulls(t *testing.T) {
+	for _, input := range []string{"$-1\r\n", "*-1\r\n", "_\r\n"} {
+		got, err := parse(t, input)
+		if err != nil || got.Value != nil {
+			t.Errorf("ParseRESP(%q) = %#v, %v, want null", input, got, err)
+		}
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	payloads := []string{"", "plain", "a\r\nb", "\x00\x01\x02", "\r\n\r\n", strings.Repeat("x", 70000)}
+
+	writer, conn := NewCapturingWriter()
+	if err := writer.WriteArray(payloads); err != nil {
+		t.Fatal(err)
+	}
+	got := conn.GetCapturedResponse()
+	items, ok := got.Value.([]RespValue)
+	if !ok || len(items) != len(payloads) {
+		t.Fatalf("round trip = %#v", got)
+	}
+	for i, item := range items {
+		if item.Value != payloads[i] {
+			t.Errorf("item %d = %q, want %q", i, item.Value, payloads[i])
+		}
+	}
+}
+
+func TestWriterNestedValues(t *testing.T) {
+	value := RespValue{MapType, []RespValue{
+		{BulkString, "key\r\n"}, {ArrayType, []RespValue{{IntegerType, int64(1)}, {BulkString, nil}}},
+	}}
+	tests := []struct {
+		protocol int
+		want     string
+	}{
+		{RESP2, "*2\r\n$5\r\nkey\r\n\r\n*2\r\n:1\r\n$-1\r\n"},
+		{RESP3, "%1\r\n$5\r\nkey\r\n\r\n*2\r\n:1\r\n_\r\n"},
+	}
+	for _, tt := range tests {
+		writer, conn := NewCapturingWriter()
+		writer.SetProtocol(tt.protocol)
+		writer.WriteValue(value)
+		if got := conn.buffer.String(); got != tt.want {
+			t.Errorf("RESP%d: got %q, want %q", tt.protocol, got, tt.want)
+		}
+	}
+}
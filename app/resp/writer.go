@@ -3,17 +3,35 @@ package resp
 import (
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 )
 
+// Protocol versions a client can negotiate with HELLO
+const (
+	RESP2 = 2
+	RESP3 = 3
+)
+
 // ResponseWriter handles writing RESP responses to connections
 type ResponseWriter struct {
-	conn net.Conn
+	conn     net.Conn
+	protocol int
 }
 
 // NewResponseWriter creates a new RESP response writer
 func NewResponseWriter(conn net.Conn) *ResponseWriter {
-	return &ResponseWriter{conn: conn}
+	return &ResponseWriter{conn: conn, protocol: RESP2}
+}
+
+// SetProtocol sets the protocol version replies are encoded with
+func (w *ResponseWriter) SetProtocol(protocol int) {
+	w.protocol = protocol
+}
+
+// Protocol returns the protocol version replies are encoded with
+func (w *ResponseWriter) Protocol() int {
+	return w.protocol
 }
 
 // writeResponse is a helper method to write the final response
@@ -28,10 +46,21 @@ func formatBulkString(s string) string {
 }
 
 // formatNullBulkString formats a null bulk string
-func formatNullBulkString() string {
+func formatNullBulkString(protocol int) string {
+	if protocol == RESP3 {
+		return "_\r\n"
+	}
 	return "$-1\r\n"
 }
 
+// formatNullArray formats a null array
+func formatNullArray(protocol int) string {
+	if protocol == RESP3 {
+		return "_\r\n"
+	}
+	return "*-1\r\n"
+}
+
 // formatArrayHeader formats an array header
 func formatArrayHeader(length int) string {
 	return fmt.Sprintf("*%d\r\n", length)
@@ -68,46 +97,89 @@ func (w *ResponseWriter) WriteArray(items []string) error {
 }
 
 func (w *ResponseWriter) WriteNullBulkString() error {
-	return w.writeResponse(formatNullBulkString())
+	return w.writeResponse(formatNullBulkString(w.protocol))
 }
 
 func (w *ResponseWriter) WriteNullArray() error {
-	return w.writeResponse("*-1\r\n")
+	return w.writeResponse(formatNullArray(w.protocol))
 }
 
 func (w *ResponseWriter) WriteEmptyArray() error {
 	return w.writeResponse("*0\r\n")
 }
 
+// WriteValue writes an arbitrary, possibly nested, RESP value
+func (w *ResponseWriter) WriteValue(value RespValue) error {
+	return w.writeResponse(formatRespValue(value, w.protocol))
+}
+
 // WriteTransactionResults writes the results of a transaction
 func (w *ResponseWriter) WriteTransactionResults(results []RespValue) error {
 	var response strings.Builder
 	response.WriteString(formatArrayHeader(len(results)))
 
 	for _, result := range results {
-		response.WriteString(formatRespValue(result))
+		response.WriteString(formatRespValue(result, w.protocol))
 	}
 
 	return w.writeResponse(response.String())
 }
 
-// formatRespValue formats a single RespValue for transaction results
-func formatRespValue(value RespValue) string {
+// FormatPush formats an out-of-band message such as a Pub/Sub message, as a
+// push frame for RESP3 clients and as a plain array for RESP2 clients
+func FormatPush(protocol int, items ...RespValue) []byte {
+	return []byte(formatRespValue(RespValue{Type: PushType, Value: items}, protocol))
+}
+
+// formatRespValue formats a single RespValue for the given protocol, recursing
+// into aggregates
+func formatRespValue(value RespValue, protocol int) string {
 	switch value.Type {
 	case SimpleString:
 		return fmt.Sprintf("+%s\r\n", value.Value)
 	case BulkString:
 		if value.Value == nil {
-			return formatNullBulkString()
+			return formatNullBulkString(protocol)
 		}
 		return formatBulkString(value.Value.(string))
 	case IntegerType:
 		return fmt.Sprintf(":%d\r\n", value.Value)
 	case ErrorType:
 		return fmt.Sprintf("-%s\r\n", value.Value)
+	case ArrayType, MapType, PushType:
+		items, ok := value.Value.([]RespValue)
+		if !ok {
+			return formatNullArray(protocol)
+		}
+		var response strings.Builder
+		switch {
+		case value.Type == MapType && protocol == RESP3:
+			response.WriteString(fmt.Sprintf("%%%d\r\n", len(items)/2))
+		case value.Type == PushType && protocol == RESP3:
+			response.WriteString(fmt.Sprintf(">%d\r\n", len(items)))
+		default:
+			response.WriteString(formatArrayHeader(len(items)))
+		}
+		for _, item := range items {
+			response.WriteString(formatRespValue(item, protocol))
+		}
+		return response.String()
 	default:
-		return formatNullBulkString()
+		return formatNullBulkString(protocol)
+	}
+}
+
+// formatStreamEntry formats one entry as [id, [field1, value1, field2, value2, ...]]
+func formatStreamEntry(entry StreamEntry) string {
+	var response strings.Builder
+	response.WriteString("*2\r\n")
+	response.WriteString(formatBulkString(entry.ID))
+
+	response.WriteString(formatArrayHeader(len(entry.Fields)))
+	for _, item := range entry.Fields {
+		response.WriteString(formatBulkString(item))
 	}
+	return response.String()
 }
 
 // WriteStreamEntries writes stream entries in the correct RESP format
@@ -116,18 +188,7 @@ func (w *ResponseWriter) WriteStreamEntries(entries []StreamEntry) error {
 	response.WriteString(formatArrayHeader(len(entries)))
 
 	for _, entry := range entries {
-		// Each entry is an array of 2 elements: [id, [field1, value1, field2, value2, ...]]
-		response.WriteString("*2\r\n")
-		response.WriteString(formatBulkString(entry.ID))
-
-		// Format field-value pairs as an array
-		fieldCount := len(entry.Fields) * 2
-		response.WriteString(formatArrayHeader(fieldCount))
-
-		for field, value := range entry.Fields {
-			response.WriteString(formatBulkString(field))
-			response.WriteString(formatBulkString(value))
-		}
+		response.WriteString(formatStreamEntry(entry))
 	}
 
 	return w.writeResponse(response.String())
@@ -135,8 +196,9 @@ func (w *ResponseWriter) WriteStreamEntries(entries []StreamEntry) error {
 
 // StreamEntry represents a single stream entry
 type StreamEntry struct {
-	ID     string
-	Fields map[string]string
+	ID string
+	// Fields holds alternating field names and values in insertion order
+	Fields []string
 }
 
 // StreamResult represents a stream with its entries for XREAD responses
@@ -155,23 +217,27 @@ func (w *ResponseWriter) WriteStreamResults(results []StreamResult) error {
 		response.WriteString("*2\r\n")
 		response.WriteString(formatBulkString(result.Key))
 
-		// Write entries array
 		response.WriteString(formatArrayHeader(len(result.Entries)))
 		for _, entry := range result.Entries {
-			// Each entry is an array of 2 elements: [id, [field1, value1, field2, value2, ...]]
-			response.WriteString("*2\r\n")
-			response.WriteString(formatBulkString(entry.ID))
-
-			// Format field-value pairs as an array
-			fieldCount := len(entry.Fields) * 2
-			response.WriteString(formatArrayHeader(fieldCount))
-
-			for field, value := range entry.Fields {
-				response.WriteString(formatBulkString(field))
-				response.WriteString(formatBulkString(value))
-			}
+			response.WriteString(formatStreamEntry(entry))
 		}
 	}
 
 	return w.writeResponse(response.String())
 }
+
+// AppendCommand appends args encoded as a RESP array of bulk strings, the
+// form commands take in the AOF and in the stream sent to replicas
+func AppendCommand(buf []byte, args []string) []byte {
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	return buf
+}
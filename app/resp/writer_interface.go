@@ -11,6 +11,7 @@ type Writer interface {
 	WriteNullBulkString() error
 	WriteNullArray() error
 	WriteEmptyArray() error
+	WriteValue(value RespValue) error
 	WriteTransactionResults(results []RespValue) error
 	WriteStreamEntries(entries []StreamEntry) error
 	WriteStreamResults(results []StreamResult) error
@@ -0,0 +1,109 @@
+package sentinel
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// commandTimeout bounds how long a monitored instance may take to answer
+const commandTimeout = time.Second
+
+// client is a connection a sentinel sends commands on
+type client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dial connects to the instance at address
+func dial(address string) (*client, error) {
+	conn, err := net.DialTimeout("tcp", address, commandTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &client{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// do sends a command and returns its reply, which is an error reply as well
+// as an error
+func (c *client) do(args ...string) (resp.RespValue, error) {
+	c.conn.SetDeadline(time.Now().Add(commandTimeout))
+	if _, err := c.conn.Write(formatCommand(args)); err != nil {
+		return resp.RespValue{}, err
+	}
+	reply, err := resp.ParseRESP(c.reader)
+	if err != nil {
+		return resp.RespValue{}, err
+	}
+	if reply.Type == resp.ErrorType {
+		message, _ := reply.Value.(string)
+		return reply, errors.New(message)
+	}
+	return reply, nil
+}
+
+// subscribe subscribes to channel and passes every message published on it
+// to fn until the connection fails or is closed
+func (c *client) subscribe(channel string, fn func(message string)) error {
+	c.conn.SetDeadline(time.Now().Add(commandTimeout))
+	if _, err := c.conn.Write(formatCommand([]string{"SUBSCRIBE", channel})); err != nil {
+		return err
+	}
+	c.conn.SetDeadline(time.Time{})
+	for {
+		push, err := resp.ParseRESP(c.reader)
+		if err != nil {
+			return err
+		}
+		items, _ := push.Value.([]resp.RespValue)
+		if len(items) != 3 {
+			continue
+		}
+		if kind, _ := items[0].Value.(string); kind != "message" {
+			continue
+		}
+		if message, ok := items[2].Value.(string); ok {
+			fn(message)
+		}
+	}
+}
+
+// localIP returns the address this side of the connection has, which is the
+// one other clients of the instance can reach this process on
+func (c *client) localIP() string {
+	if addr, ok := c.conn.LocalAddr().(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	return ""
+}
+
+// close closes the connection
+func (c *client) close() {
+	c.conn.Close()
+}
+
+// formatCommand encodes args as a RESP array of bulk strings
+func formatCommand(args []string) []byte {
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(arg))+"\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	return buf
+}
+
+// sendCommand runs a single command on a fresh connection to address
+func sendCommand(address string, args ...string) error {
+	c, err := dial(address)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	_, err = c.do(args...)
+	return err
+}
@@ -0,0 +1,320 @@
+package sentinel
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MasterNames returns the names of the monitored masters in order
+func (s *Sentinel) MasterNames() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	names := make([]string, 0, len(s.masters))
+	for _, m := range s.sortedMasters() {
+		names = append(names, m.name)
+	}
+	return names
+}
+
+// Masters returns the state of every monitored master as SENTINEL MASTERS
+// reports it
+func (s *Sentinel) Masters() [][][2]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var masters [][][2]string
+	for _, m := range s.sortedMasters() {
+		masters = append(masters, s.masterFields(m))
+	}
+	return masters
+}
+
+// Master returns the state of the master called name
+func (s *Sentinel) Master(name string) ([][2]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m, ok := s.masters[name]
+	if !ok {
+		return nil, ErrNoSuchMaster
+	}
+	return s.masterFields(m), nil
+}
+
+// Replicas returns the state of every replica of the master called name
+func (s *Sentinel) Replicas(name string) ([][][2]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m, ok := s.masters[name]
+	if !ok {
+		return nil, ErrNoSuchMaster
+	}
+	replicas := make([]*instance, 0, len(m.replicas))
+	for _, rep := range m.replicas {
+		replicas = append(replicas, rep)
+	}
+	sort.Slice(replicas, func(i, j int) bool { return replicas[i].address() < replicas[j].address() })
+
+	result := [][][2]string{}
+	for _, rep := range replicas {
+		fields := append(instanceFields(rep),
+			[2]string{"master-link-down-time", "0"},
+			[2]string{"master-link-status", linkStatus(rep.masterLinkUp)},
+			[2]string{"master-host", rep.masterHost},
+			[2]string{"master-port", strconv.Itoa(rep.masterPort)},
+			[2]string{"slave-priority", strconv.Itoa(rep.priority)},
+			[2]string{"slave-repl-offset", strconv.FormatInt(rep.offset, 10)},
+			[2]string{"replica-announced", "1"},
+		)
+		result = append(result, fields)
+	}
+	return result, nil
+}
+
+// Sentinels returns the state of the other sentinels monitoring the master
+// called name
+func (s *Sentinel) Sentinels(name string) ([][][2]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m, ok := s.masters[name]
+	if !ok {
+		return nil, ErrNoSuchMaster
+	}
+	peers := make([]*instance, 0, len(m.sentinels))
+	for _, peer := range m.sentinels {
+		peers = append(peers, peer)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].runID < peers[j].runID })
+
+	result := [][][2]string{}
+	for _, peer := range peers {
+		leader := peer.votedLeader
+		if leader == "" {
+			leader = "?"
+		}
+		fields := append(instanceFields(peer),
+			[2]string{"last-hello-message", millisSince(peer.lastHello)},
+			[2]string{"voted-leader", leader},
+			[2]string{"voted-leader-epoch", strconv.FormatUint(peer.votedEpoch, 10)},
+		)
+		result = append(result, fields)
+	}
+	return result, nil
+}
+
+// MasterAddr returns the address of the master called name, which is that of
+// the replica promoted in its place once a failover has promoted one
+func (s *Sentinel) MasterAddr(name string) (string, int, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m, ok := s.masters[name]
+	if !ok {
+		return "", 0, false
+	}
+	host, port := s.currentAddress(m)
+	return host, port, true
+}
+
+// IsMasterDownByAddr tells another sentinel whether this one finds the master
+// at host and port down. When runID is not "*", the other sentinel is also
+// asking for a vote to lead a failover in epoch, and the leader this sentinel
+// voted for and in which epoch are returned.
+func (s *Sentinel) IsMasterDownByAddr(host string, port int, epoch uint64, runID string) (bool, string, uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m := s.masterByAddress(host, port)
+	if m == nil {
+		return false, "*", 0
+	}
+	if runID == "*" {
+		return m.sdown, "*", 0
+	}
+	leader, leaderEpoch := s.vote(m, epoch, runID)
+	return m.sdown, leader, leaderEpoch
+}
+
+// Failover fails the master called name over right away, without asking
+// other sentinels to agree
+func (s *Sentinel) Failover(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m, ok := s.masters[name]
+	if !ok {
+		return ErrNoSuchMaster
+	}
+	if m.failoverState != failoverNone {
+		return ErrFailoverInProgress
+	}
+	if s.selectReplica(m) == nil {
+		return ErrNoGoodReplica
+	}
+	s.startFailover(m)
+	m.forced = true
+	return nil
+}
+
+// CheckQuorum reports whether enough sentinels monitoring the master called
+// name are reachable to find it down and to elect a leader for a failover
+func (s *Sentinel) CheckQuorum(name string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m, ok := s.masters[name]
+	if !ok {
+		return "", ErrNoSuchMaster
+	}
+	usable := 1
+	for _, peer := range m.sentinels {
+		if !peer.sdown && peer.connected {
+			usable++
+		}
+	}
+	voters := len(m.sentinels) + 1
+	if usable < m.quorum {
+		return "", quorumError("NOQUORUM", usable, "Not enough available Sentinels to reach the specified quorum for this master")
+	}
+	if usable < voters/2+1 {
+		return "", quorumError("NOAUTH", usable, "Not enough available Sentinels to reach the majority and authorize a failover")
+	}
+	return "OK " + strconv.Itoa(usable) + " usable Sentinels. Quorum and failover authorization can be reached", nil
+}
+
+// quorumError formats a failed quorum check the way Redis does
+func quorumError(code string, usable int, reason string) error {
+	return errors.New(code + " " + strconv.Itoa(usable) + " usable Sentinels. " + reason)
+}
+
+// SentinelInfo returns the fields of the sentinel section of INFO
+func (s *Sentinel) SentinelInfo() [][2]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	info := [][2]string{
+		{"sentinel_masters", strconv.Itoa(len(s.masters))},
+		{"sentinel_tilt", "0"},
+		{"sentinel_running_scripts", "0"},
+		{"sentinel_scripts_queue_length", "0"},
+		{"sentinel_simulate_failure_flags", "0"},
+	}
+	for i, m := range s.sortedMasters() {
+		status := "ok"
+		if m.odown {
+			status = "odown"
+		} else if m.sdown {
+			status = "sdown"
+		}
+		host, port := s.currentAddress(m)
+		info = append(info, [2]string{"master" + strconv.Itoa(i), "name=" + m.name + ",status=" + status +
+			",address=" + host + ":" + strconv.Itoa(port) + ",slaves=" + strconv.Itoa(len(m.replicas)) +
+			",sentinels=" + strconv.Itoa(len(m.sentinels)+1)})
+	}
+	return info
+}
+
+// masterFields returns the state of m. The caller must hold the mutex.
+func (s *Sentinel) masterFields(m *master) [][2]string {
+	fields := instanceFields(m.instance)
+	if m.odown {
+		fields = append(fields, [2]string{"o-down-time", millisSince(m.odownSince)})
+	}
+	fields = append(fields,
+		[2]string{"config-epoch", strconv.FormatUint(m.configEpoch, 10)},
+		[2]string{"num-slaves", strconv.Itoa(len(m.replicas))},
+		[2]string{"num-other-sentinels", strconv.Itoa(len(m.sentinels))},
+		[2]string{"quorum", strconv.Itoa(m.quorum)},
+		[2]string{"failover-timeout", strconv.FormatInt(m.failoverTimeout.Milliseconds(), 10)},
+		[2]string{"parallel-syncs", "1"},
+	)
+	if m.failoverState != failoverNone {
+		fields = append(fields, [2]string{"failover-state", m.failoverState.String()})
+	}
+	return fields
+}
+
+// instanceFields returns the state every kind of instance reports. The
+// caller must hold the mutex.
+func instanceFields(inst *instance) [][2]string {
+	fields := [][2]string{
+		{"name", inst.instanceName()},
+		{"ip", inst.host},
+		{"port", strconv.Itoa(inst.port)},
+		{"runid", inst.runID},
+		{"flags", inst.flags()},
+		{"link-pending-commands", "0"},
+		{"link-refcount", "1"},
+		{"last-ping-sent", millisSince(inst.pingPending)},
+		{"last-ok-ping-reply", millisSince(inst.lastPong)},
+		{"last-ping-reply", millisSince(inst.lastPong)},
+	}
+	if inst.sdown {
+		fields = append(fields, [2]string{"s-down-time", millisSince(inst.sdownSince)})
+	}
+	fields = append(fields, [2]string{"down-after-milliseconds", strconv.FormatInt(inst.master.downAfter.Milliseconds(), 10)})
+	if inst.kind != sentinelKind {
+		fields = append(fields,
+			[2]string{"info-refresh", millisSince(inst.lastInfo)},
+			[2]string{"role-reported", inst.role},
+			[2]string{"role-reported-time", millisSince(inst.roleSince)},
+		)
+	}
+	return fields
+}
+
+// flags returns the flags SENTINEL replies report for inst. The caller must
+// hold the mutex.
+func (inst *instance) flags() string {
+	flags := []string{[...]string{masterKind: "master", replicaKind: "slave", sentinelKind: "sentinel"}[inst.kind]}
+	m := inst.master
+	if inst.sdown {
+		flags = append(flags, "s_down")
+	}
+	if inst.kind == masterKind && m.odown {
+		flags = append(flags, "o_down")
+	}
+	if !inst.connected {
+		flags = append(flags, "disconnected")
+	}
+	if inst.kind == sentinelKind && inst.masterDown {
+		flags = append(flags, "master_down")
+	}
+	if inst.kind == masterKind && m.failoverState != failoverNone {
+		flags = append(flags, "failover_in_progress")
+	}
+	if inst == m.promoted {
+		flags = append(flags, "promoted")
+	}
+	switch inst.reconf {
+	case reconfSent:
+		flags = append(flags, "reconf_sent")
+	case reconfInProgress:
+		flags = append(flags, "reconf_inprog")
+	case reconfDone:
+		flags = append(flags, "reconf_done")
+	}
+	return strings.Join(flags, ",")
+}
+
+// linkStatus formats the state of a replica's link to its master
+func linkStatus(up bool) string {
+	if up {
+		return "ok"
+	}
+	return "err"
+}
+
+// millisSince returns the milliseconds elapsed since t, or 0 if it is unset
+func millisSince(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(time.Since(t).Milliseconds(), 10)
+}
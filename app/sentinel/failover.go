@@ -0,0 +1,379 @@
+package sentinel
+
+import (
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// failoverState is how far a failover of a master has come
+type failoverState int
+
+const (
+	failoverNone               failoverState = iota
+	failoverWaitStart                        // waiting to be elected leader
+	failoverSelectReplica                    // choosing the replica to promote
+	failoverSendReplicaOfNoOne               // telling the chosen replica to become a master
+	failoverWaitPromotion                    // waiting for it to report itself a master
+	failoverReconfReplicas                   // pointing the other replicas at it
+)
+
+// String returns the name Redis reports for the state
+func (f failoverState) String() string {
+	return [...]string{"none", "wait_start", "select_slave", "send_slaveof_noone", "wait_promotion", "reconf_slaves"}[f]
+}
+
+// reconfState is how far a replica has come following a new master
+type reconfState int
+
+const (
+	reconfNone       reconfState = iota
+	reconfSent                   // told to replicate the new master
+	reconfInProgress             // replicating it, not yet in sync
+	reconfDone                   // in sync with it
+)
+
+// Limits of the stages of a failover
+const (
+	electionTimeout = 10 * time.Second // longest wait to be elected, unless failover-timeout is shorter
+	reconfTimeout   = 10 * time.Second // longest wait for a replica to start following the new master
+	maxDesync       = time.Second      // longest random delay keeping sentinels from starting failovers together
+)
+
+// checkSubjectivelyDown marks inst down once its oldest unanswered PING, or
+// its last reply while disconnected, is older than down-after-milliseconds,
+// and up again once it answers. The caller must hold the mutex.
+func (s *Sentinel) checkSubjectivelyDown(inst *instance) {
+	var late time.Duration
+	if !inst.pingPending.IsZero() {
+		late = time.Since(inst.pingPending)
+	} else if !inst.connected {
+		late = time.Since(inst.lastPong)
+	}
+	down := late > inst.master.downAfter
+	if down && !inst.sdown {
+		inst.sdown, inst.sdownSince = true, time.Now()
+		s.event("+sdown", inst, "")
+	} else if !down && inst.sdown {
+		inst.sdown = false
+		s.event("-sdown", inst, "")
+	}
+}
+
+// checkObjectivelyDown marks m down once quorum sentinels, this one included,
+// find it down. The caller must hold the mutex.
+func (s *Sentinel) checkObjectivelyDown(m *master) {
+	votes := 0
+	if m.sdown {
+		votes = 1
+		for _, peer := range m.sentinels {
+			if peer.masterDown {
+				votes++
+			}
+		}
+	}
+	down := m.sdown && votes >= m.quorum
+	if down && !m.odown {
+		m.odown, m.odownSince = true, time.Now()
+		m.failoverDelay = time.Duration(rand.Int63n(int64(maxDesync)))
+		s.event("+odown", m.instance, "#quorum "+strconv.Itoa(votes)+"/"+strconv.Itoa(m.quorum))
+	} else if !down && m.odown {
+		m.odown = false
+		s.event("-odown", m.instance, "")
+	}
+}
+
+// failoverStep starts a failover of m once it is objectively down, or moves
+// the one under way on. The caller must hold the mutex.
+func (s *Sentinel) failoverStep(m *master) {
+	switch m.failoverState {
+	case failoverNone:
+		// Sentinels finding the master down together wait a random delay, so
+		// the first to start can ask the others for their votes before they
+		// vote for themselves. A failover attempt, won or lost, holds off the
+		// next one.
+		if m.odown && time.Since(m.odownSince) >= m.failoverDelay && time.Since(m.failoverStart) >= 2*m.failoverTimeout {
+			s.startFailover(m)
+		}
+	case failoverWaitStart:
+		if leader := s.leader(m, m.failoverEpoch); leader != s.id && !m.forced {
+			timeout := min(electionTimeout, m.failoverTimeout)
+			if time.Since(m.failoverStart) > timeout {
+				s.event("-failover-abort-not-elected", m.instance, "")
+				s.abortFailover(m)
+			}
+			return
+		}
+		s.event("+elected-leader", m.instance, "")
+		s.setFailoverState(m, failoverSelectReplica)
+	case failoverSelectReplica:
+		rep := s.selectReplica(m)
+		if rep == nil {
+			s.event("-failover-abort-no-good-slave", m.instance, "")
+			s.abortFailover(m)
+			return
+		}
+		s.event("+selected-slave", rep, "")
+		m.promoted = rep
+		s.setFailoverState(m, failoverSendReplicaOfNoOne)
+	case failoverSendReplicaOfNoOne:
+		if !m.promoted.connected {
+			if time.Since(m.failoverStateChanged) > m.failoverTimeout {
+				s.event("-failover-abort-slave-timeout", m.instance, "")
+				s.abortFailover(m)
+			}
+			return
+		}
+		go sendCommand(m.promoted.address(), "REPLICAOF", "NO", "ONE")
+		s.setFailoverState(m, failoverWaitPromotion)
+	case failoverWaitPromotion:
+		// The replica's INFO reporting it a master moves the failover on
+		if time.Since(m.failoverStateChanged) > m.failoverTimeout {
+			s.event("-failover-abort-slave-timeout", m.instance, "")
+			s.abortFailover(m)
+		}
+	case failoverReconfReplicas:
+		s.reconfReplicas(m)
+	}
+}
+
+// startFailover begins a failover of m in a new epoch, in which this sentinel
+// asks the others to elect it. The caller must hold the mutex.
+func (s *Sentinel) startFailover(m *master) {
+	s.setEpoch(s.currentEpoch + 1)
+	m.failoverEpoch = s.currentEpoch
+	m.failoverState = failoverWaitStart
+	m.failoverStateChanged = time.Now()
+	m.failoverStart = time.Now().Add(time.Duration(rand.Int63n(int64(maxDesync))))
+	s.event("+try-failover", m.instance, "")
+
+	// Ask for votes right away rather than at the next ask period, which
+	// would leave the others time to vote for themselves
+	for _, peer := range m.sentinels {
+		peer.lastAsked = time.Time{}
+		select {
+		case peer.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// setFailoverState moves the failover of m to state. The caller must hold the
+// mutex.
+func (s *Sentinel) setFailoverState(m *master, state failoverState) {
+	m.failoverState = state
+	m.failoverStateChanged = time.Now()
+	inst := m.instance
+	if state > failoverSelectReplica {
+		inst = m.promoted
+	}
+	s.event("+failover-state-"+state.String(), inst, "")
+}
+
+// abortFailover gives up the failover of m. The caller must hold the mutex.
+func (s *Sentinel) abortFailover(m *master) {
+	m.failoverState = failoverNone
+	m.failoverStateChanged = time.Now()
+	m.forced = false
+	m.promoted = nil
+	for _, rep := range m.replicas {
+		rep.reconf = reconfNone
+	}
+}
+
+// vote votes for runID as the leader of a failover of m in epoch, unless this
+// sentinel already voted in that epoch or a later one, and returns the leader
+// it voted for and in which epoch. The caller must hold the mutex.
+func (s *Sentinel) vote(m *master, epoch uint64, runID string) (string, uint64) {
+	s.setEpoch(epoch)
+	if m.leaderEpoch < epoch && s.currentEpoch <= epoch {
+		m.leader, m.leaderEpoch = runID, s.currentEpoch
+		s.event("+vote-for-leader", nil, runID+" "+strconv.FormatUint(m.leaderEpoch, 10))
+		// Voting for another sentinel holds off failing over ourselves
+		if runID != s.id {
+			m.failoverStart = time.Now().Add(time.Duration(rand.Int63n(int64(maxDesync))))
+		}
+	}
+	return m.leader, m.leaderEpoch
+}
+
+// leader returns the sentinel elected to fail m over in epoch, or "" while
+// none has the votes of both a majority of the sentinels and the quorum. This
+// sentinel votes for the one most others voted for, or for itself. The caller
+// must hold the mutex.
+func (s *Sentinel) leader(m *master, epoch uint64) string {
+	votes := make(map[string]int)
+	for _, peer := range m.sentinels {
+		if peer.votedLeader != "" && peer.votedEpoch == epoch {
+			votes[peer.votedLeader]++
+		}
+	}
+	candidate := mostVoted(votes)
+	if candidate == "" {
+		candidate = s.id
+	}
+	if leader, leaderEpoch := s.vote(m, epoch, candidate); leaderEpoch == epoch {
+		votes[leader]++
+	}
+
+	winner := mostVoted(votes)
+	voters := len(m.sentinels) + 1
+	if votes[winner] < voters/2+1 || votes[winner] < m.quorum {
+		return ""
+	}
+	return winner
+}
+
+// mostVoted returns the run ID with the most votes, the lowest on a tie
+func mostVoted(votes map[string]int) string {
+	winner := ""
+	for runID, count := range votes {
+		if count > votes[winner] || (count == votes[winner] && runID < winner) {
+			winner = runID
+		}
+	}
+	return winner
+}
+
+// selectReplica returns the best replica of m to promote: one that is up and
+// was heard from lately, with the lowest priority, then the most data, then
+// the lowest run ID. Replicas with priority 0 are never promoted. The caller
+// must hold the mutex.
+func (s *Sentinel) selectReplica(m *master) *instance {
+	maxInfoAge := 3 * infoPeriod
+	if m.sdown {
+		maxInfoAge = 5 * pingPeriod
+	}
+	var candidates []*instance
+	for _, rep := range m.replicas {
+		if rep.sdown || !rep.connected || rep.role != "slave" || rep.priority == 0 ||
+			time.Since(rep.lastPong) > 5*pingPeriod || time.Since(rep.lastInfo) > maxInfoAge {
+			continue
+		}
+		candidates = append(candidates, rep)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.priority != b.priority {
+			return a.priority < b.priority
+		}
+		if a.offset != b.offset {
+			return a.offset > b.offset
+		}
+		return a.runID < b.runID
+	})
+	return candidates[0]
+}
+
+// promoted moves the failover of m on once the replica chosen reports itself
+// a master: the new configuration takes the failover's epoch, which makes it
+// win over the old one with the other sentinels. The caller must hold the
+// mutex.
+func (s *Sentinel) promoted(m *master) {
+	m.configEpoch = m.failoverEpoch
+	s.event("+promoted-slave", m.promoted, "")
+	s.setFailoverState(m, failoverReconfReplicas)
+}
+
+// reconfReplicas points every other replica of m at the promoted one, and
+// ends the failover once they all follow it or failover-timeout elapsed. The
+// caller must hold the mutex.
+func (s *Sentinel) reconfReplicas(m *master) {
+	host, port := m.promoted.host, strconv.Itoa(m.promoted.port)
+	timedOut := time.Since(m.failoverStateChanged) > m.failoverTimeout
+	done := true
+	for _, rep := range m.replicas {
+		if rep == m.promoted || rep.reconf == reconfDone {
+			continue
+		}
+		switch {
+		case rep.reconf == reconfNone && (rep.connected || timedOut):
+			rep.reconf, rep.reconfSent = reconfSent, time.Now()
+			go sendCommand(rep.address(), "REPLICAOF", host, port)
+			s.event("+slave-reconf-sent", rep, "")
+		case rep.reconf == reconfSent && time.Since(rep.reconfSent) > reconfTimeout:
+			// Replicas that do not follow are left to be fixed once the failover ends
+			s.event("-slave-reconf-sent-timeout", rep, "")
+			rep.reconf = reconfDone
+			continue
+		}
+		if !rep.sdown {
+			done = false
+		}
+	}
+	if !done && !timedOut {
+		return
+	}
+	if timedOut {
+		s.event("+failover-end-for-timeout", m.instance, "")
+	}
+	s.event("+failover-end", m.instance, "")
+	s.switchMaster(m, m.promoted.host, m.promoted.port)
+}
+
+// reconfProgress records a replica following the promoted master. The caller
+// must hold the mutex.
+func (s *Sentinel) reconfProgress(rep *instance) {
+	m := rep.master
+	following := rep.role == "slave" && rep.masterHost == m.promoted.host && rep.masterPort == m.promoted.port
+	if rep.reconf == reconfSent && following {
+		rep.reconf = reconfInProgress
+		s.event("+slave-reconf-inprog", rep, "")
+	}
+	if rep.reconf == reconfInProgress && following && rep.masterLinkUp {
+		rep.reconf = reconfDone
+		s.event("+slave-reconf-done", rep, "")
+	}
+}
+
+// switchMaster makes the instance at host and port the master of m, its old
+// master and other replicas becoming its replicas. The caller must hold the
+// mutex.
+func (s *Sentinel) switchMaster(m *master, host string, port int) {
+	s.event("+switch-master", nil, m.name+" "+m.host+" "+strconv.Itoa(m.port)+" "+host+" "+strconv.Itoa(port))
+
+	newAddress := net.JoinHostPort(host, strconv.Itoa(port))
+	var replicas [][2]string
+	for address, rep := range m.replicas {
+		if address != newAddress {
+			replicas = append(replicas, [2]string{rep.host, strconv.Itoa(rep.port)})
+		}
+	}
+	if m.address() != newAddress {
+		replicas = append(replicas, [2]string{m.host, strconv.Itoa(m.port)})
+	}
+
+	m.stop()
+	m.instance = s.newInstance(masterKind, m, host, port)
+	m.replicas = make(map[string]*instance)
+	for _, address := range replicas {
+		repPort, _ := strconv.Atoi(address[1])
+		rep := s.newInstance(replicaKind, m, address[0], repPort)
+		m.replicas[rep.address()] = rep
+		s.event("+slave", rep, "")
+	}
+
+	m.odown = false
+	m.failoverState = failoverNone
+	m.failoverStart = time.Time{}
+	m.forced = false
+	m.promoted = nil
+	for _, peer := range m.sentinels {
+		peer.masterDown = false
+	}
+}
+
+// currentAddress returns the address of the master of m as clients should
+// see it: that of the promoted replica once a failover has promoted it. The
+// caller must hold the mutex.
+func (s *Sentinel) currentAddress(m *master) (string, int) {
+	if m.failoverState >= failoverReconfReplicas && m.promoted != nil {
+		return m.promoted.host, m.promoted.port
+	}
+	return m.host, m.port
+}
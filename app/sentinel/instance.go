@@ -0,0 +1,486 @@
+package sentinel
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// kind tells what a monitored instance is
+type kind int
+
+const (
+	masterKind kind = iota
+	replicaKind
+	sentinelKind
+)
+
+// convertDelay is how long a replica must report the wrong role or master
+// before it is reconfigured, so a failover in flight is not undone
+const convertDelay = 4 * helloPeriod
+
+// instance is a master, replica or sentinel being monitored, with what was
+// last learned about it. Its fields are guarded by the Sentinel mutex.
+type instance struct {
+	kind   kind
+	master *master // the master the instance belongs to, its own for a master
+	host   string
+	port   int
+	runID  string
+	done   chan struct{} // closed to stop monitoring the instance
+	wake   chan struct{} // signalled to send the commands due before the next tick
+
+	connected    bool
+	lastPingSent time.Time
+	pingPending  time.Time // oldest PING not answered yet, unset once one is
+	lastPong     time.Time // last valid reply to PING
+	sdown        bool
+	sdownSince   time.Time
+
+	// What the last INFO reported, for masters and replicas
+	lastInfoSent  time.Time
+	lastInfo      time.Time
+	lastHelloSent time.Time
+	role          string
+	roleSince     time.Time // last change of the role or master reported
+	masterHost    string
+	masterPort    int
+	masterLinkUp  bool
+	priority      int
+	offset        int64
+	lastConvert   time.Time // last time it was told which master to replicate
+
+	// Failover progress, for replicas
+	reconf     reconfState
+	reconfSent time.Time
+
+	// What another sentinel last said, for sentinels
+	lastHello   time.Time
+	lastAsked   time.Time
+	lastReply   time.Time
+	masterDown  bool
+	votedLeader string
+	votedEpoch  uint64
+}
+
+// master is a monitored master with its replicas and the other sentinels
+// monitoring it
+type master struct {
+	*instance
+	name            string
+	quorum          int
+	downAfter       time.Duration
+	failoverTimeout time.Duration
+	configEpoch     uint64
+	odown           bool
+	odownSince      time.Time
+	failoverDelay   time.Duration        // random wait once objectively down before failing over
+	replicas        map[string]*instance // by address
+	sentinels       map[string]*instance // by run ID
+
+	// This sentinel's vote for the leader of a failover of the master
+	leader      string
+	leaderEpoch uint64
+
+	failoverState        failoverState
+	failoverEpoch        uint64
+	failoverStart        time.Time
+	failoverStateChanged time.Time
+	forced               bool
+	promoted             *instance
+}
+
+// newInstance creates an instance of m and starts monitoring it. The caller
+// must hold the mutex.
+func (s *Sentinel) newInstance(kind kind, m *master, host string, port int) *instance {
+	now := time.Now()
+	inst := &instance{
+		kind:     kind,
+		master:   m,
+		host:     host,
+		port:     port,
+		done:     make(chan struct{}),
+		wake:     make(chan struct{}, 1),
+		priority: 100,
+		// Until it first answers, the instance is as late as a PING sent now
+		pingPending: now,
+		lastPong:    now,
+	}
+	go s.run(inst)
+	if kind != sentinelKind {
+		go s.listen(inst)
+	}
+	return inst
+}
+
+// stop stops monitoring the instance, and a master's replicas with it
+func (inst *instance) stop() {
+	close(inst.done)
+	if inst.kind != masterKind {
+		return
+	}
+	for _, rep := range inst.master.replicas {
+		close(rep.done)
+	}
+}
+
+// address returns the host and port of the instance joined
+func (inst *instance) address() string {
+	return net.JoinHostPort(inst.host, strconv.Itoa(inst.port))
+}
+
+// instanceName returns what the instance is called in events and replies
+func (inst *instance) instanceName() string {
+	switch inst.kind {
+	case masterKind:
+		return inst.master.name
+	case sentinelKind:
+		return inst.runID
+	}
+	return inst.address()
+}
+
+// describe returns the type, name and address of the instance, followed for
+// replicas and sentinels by those of their master
+func (inst *instance) describe() string {
+	kinds := [...]string{masterKind: "master", replicaKind: "slave", sentinelKind: "sentinel"}
+	description := kinds[inst.kind] + " " + inst.instanceName() + " " + inst.host + " " + strconv.Itoa(inst.port)
+	if inst.kind != masterKind {
+		m := inst.master
+		description += " @ " + m.name + " " + m.host + " " + strconv.Itoa(m.port)
+	}
+	return description
+}
+
+// run keeps the command link to inst up, sending it the commands that are due
+func (s *Sentinel) run(inst *instance) {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	var c *client
+	var lastDial time.Time
+	defer func() {
+		if c != nil {
+			c.close()
+		}
+	}()
+	for {
+		select {
+		case <-inst.done:
+			return
+		case <-ticker.C:
+		case <-inst.wake:
+		}
+
+		if c == nil {
+			if time.Since(lastDial) < reconnectDelay {
+				continue
+			}
+			lastDial = time.Now()
+			var err error
+			if c, err = dial(inst.address()); err != nil {
+				continue
+			}
+			s.mutex.Lock()
+			inst.connected = true
+			s.mutex.Unlock()
+		}
+
+		for _, args := range s.due(inst, c.localIP()) {
+			reply, err := c.do(args...)
+			if err != nil && reply.Type != resp.ErrorType {
+				c.close()
+				c = nil
+				s.mutex.Lock()
+				inst.connected = false
+				s.mutex.Unlock()
+				break
+			}
+			s.mutex.Lock()
+			s.handleReply(inst, args[0], reply)
+			s.mutex.Unlock()
+		}
+	}
+}
+
+// listen subscribes to the hello channel of a master or replica, learning of
+// the other sentinels and of their view of the master
+func (s *Sentinel) listen(inst *instance) {
+	for {
+		if c, err := dial(inst.address()); err == nil {
+			stopped := make(chan struct{})
+			go func() {
+				select {
+				case <-inst.done:
+					c.close()
+				case <-stopped:
+				}
+			}()
+			c.subscribe(helloChannel, s.processHello)
+			close(stopped)
+			c.close()
+		}
+
+		select {
+		case <-inst.done:
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// due returns the commands to send to inst now, recording them as sent.
+// localIP is the address the instance sees this sentinel connect from.
+func (s *Sentinel) due(inst *instance, localIP string) [][]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	m := inst.master
+	var commands [][]string
+	if now.Sub(inst.lastPingSent) >= min(m.downAfter, pingPeriod) {
+		inst.lastPingSent = now
+		if inst.pingPending.IsZero() {
+			inst.pingPending = now
+		}
+		commands = append(commands, []string{"PING"})
+	}
+
+	if inst.kind == sentinelKind {
+		// Other sentinels are asked for their opinion, and for their vote
+		// once this one tries to fail the master over
+		if m.sdown && now.Sub(inst.lastAsked) >= askPeriod {
+			inst.lastAsked = now
+			runID := "*"
+			if m.failoverState != failoverNone {
+				runID = s.id
+			}
+			commands = append(commands, []string{"SENTINEL", "is-master-down-by-addr",
+				m.host, strconv.Itoa(m.port), strconv.FormatUint(s.currentEpoch, 10), runID})
+		}
+		return commands
+	}
+
+	// Replicas are watched closely while their master is failing
+	period := infoPeriod
+	if inst.kind == replicaKind && (m.odown || m.failoverState != failoverNone) {
+		period = time.Second
+	}
+	if now.Sub(inst.lastInfoSent) >= period {
+		inst.lastInfoSent = now
+		commands = append(commands, []string{"INFO"})
+	}
+	if now.Sub(inst.lastHelloSent) >= helloPeriod && localIP != "" {
+		inst.lastHelloSent = now
+		host, port := s.currentAddress(m)
+		hello := strings.Join([]string{
+			localIP, strconv.Itoa(s.port), s.id, strconv.FormatUint(s.currentEpoch, 10),
+			m.name, host, strconv.Itoa(port), strconv.FormatUint(m.configEpoch, 10),
+		}, ",")
+		commands = append(commands, []string{"PUBLISH", helloChannel, hello})
+	}
+	return commands
+}
+
+// handleReply records the reply of inst to command. The caller must hold the
+// mutex.
+func (s *Sentinel) handleReply(inst *instance, command string, reply resp.RespValue) {
+	switch command {
+	case "PING":
+		message, _ := reply.Value.(string)
+		// An instance still loading its data or cut off from its master is alive
+		if reply.Type != resp.ErrorType || strings.HasPrefix(message, "LOADING") || strings.HasPrefix(message, "MASTERDOWN") {
+			inst.lastPong, inst.pingPending = time.Now(), time.Time{}
+		}
+	case "INFO":
+		if info, ok := reply.Value.(string); ok && reply.Type != resp.ErrorType {
+			s.refreshInfo(inst, parseInfo(info))
+		}
+	case "SENTINEL":
+		items, _ := reply.Value.([]resp.RespValue)
+		if reply.Type != resp.ArrayType || len(items) != 3 {
+			return
+		}
+		down, _ := items[0].Value.(int64)
+		leader, _ := items[1].Value.(string)
+		epoch, _ := items[2].Value.(int64)
+		inst.lastReply = time.Now()
+		inst.masterDown = down == 1
+		if leader != "*" {
+			inst.votedLeader, inst.votedEpoch = leader, uint64(epoch)
+		}
+	}
+}
+
+// parseInfo returns the fields of an INFO reply
+func parseInfo(info string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(info, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSuffix(line, "\r"), ":")
+		if ok && !strings.HasPrefix(key, "#") {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// refreshInfo records what INFO reported for inst: its role, the replicas of a
+// master and the master of a replica. The caller must hold the mutex.
+func (s *Sentinel) refreshInfo(inst *instance, fields map[string]string) {
+	now := time.Now()
+	m := inst.master
+	inst.lastInfo = now
+	if runID := fields["run_id"]; runID != "" {
+		if inst.runID != "" && inst.runID != runID {
+			s.event("+reboot", inst, "")
+		}
+		inst.runID = runID
+	}
+	if role := fields["role"]; role != inst.role {
+		if inst.role != "" {
+			s.event("-role-change", inst, "new reported role is "+role)
+		}
+		inst.role, inst.roleSince = role, now
+	}
+
+	if inst.role == "slave" {
+		masterHost := fields["master_host"]
+		masterPort, _ := strconv.Atoi(fields["master_port"])
+		if masterHost != inst.masterHost || masterPort != inst.masterPort {
+			inst.masterHost, inst.masterPort = masterHost, masterPort
+			inst.roleSince = now
+		}
+		inst.masterLinkUp = fields["master_link_status"] == "up"
+		inst.offset, _ = strconv.ParseInt(fields["slave_repl_offset"], 10, 64)
+		if priority, err := strconv.Atoi(fields["slave_priority"]); err == nil {
+			inst.priority = priority
+		}
+	}
+
+	// A master lists its replicas as slave0, slave1 and so on
+	if inst.kind == masterKind && inst.role == "master" {
+		for i := 0; ; i++ {
+			line, ok := fields["slave"+strconv.Itoa(i)]
+			if !ok {
+				break
+			}
+			host, port := parseReplicaLine(line)
+			if host == "" {
+				continue
+			}
+			address := net.JoinHostPort(host, strconv.Itoa(port))
+			if _, known := m.replicas[address]; !known {
+				rep := s.newInstance(replicaKind, m, host, port)
+				m.replicas[address] = rep
+				s.event("+slave", rep, "")
+			}
+		}
+	}
+
+	if inst.kind != replicaKind {
+		return
+	}
+	switch {
+	case inst == m.promoted && m.failoverState == failoverWaitPromotion && inst.role == "master":
+		s.promoted(m)
+	case m.failoverState == failoverReconfReplicas:
+		s.reconfProgress(inst)
+	case m.failoverState == failoverNone:
+		s.checkReplicaConfig(inst)
+	}
+}
+
+// parseReplicaLine returns the address of a replica from its INFO line
+func parseReplicaLine(line string) (string, int) {
+	host, port := "", 0
+	for _, field := range strings.Split(line, ",") {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "ip":
+			host = value
+		case "port":
+			port, _ = strconv.Atoi(value)
+		}
+	}
+	if port < 1 {
+		return "", 0
+	}
+	return host, port
+}
+
+// checkReplicaConfig points a replica that reports being a master, or
+// replicating another master, back at its master once it has done so for a
+// while. The caller must hold the mutex.
+func (s *Sentinel) checkReplicaConfig(rep *instance) {
+	m := rep.master
+	if m.sdown || m.role != "master" || time.Since(rep.roleSince) < convertDelay || time.Since(rep.lastConvert) < convertDelay {
+		return
+	}
+	switch {
+	case rep.role == "master":
+		s.event("+convert-to-slave", rep, "")
+	case rep.role == "slave" && (rep.masterHost != m.host || rep.masterPort != m.port):
+		s.event("+fix-slave-config", rep, "")
+	default:
+		return
+	}
+	rep.lastConvert = time.Now()
+	go sendCommand(rep.address(), "REPLICAOF", m.host, strconv.Itoa(m.port))
+}
+
+// processHello records what another sentinel announced on the hello channel
+func (s *Sentinel) processHello(message string) {
+	fields := strings.Split(message, ",")
+	if len(fields) != 8 {
+		return
+	}
+	host, runID, name, masterHost := fields[0], fields[2], fields[4], fields[5]
+	port, err1 := strconv.Atoi(fields[1])
+	epoch, err2 := strconv.ParseUint(fields[3], 10, 64)
+	masterPort, err3 := strconv.Atoi(fields[6])
+	configEpoch, err4 := strconv.ParseUint(fields[7], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m, ok := s.masters[name]
+	if !ok || runID == s.id {
+		return
+	}
+	peer, known := m.sentinels[runID]
+	if known && (peer.host != host || peer.port != port) {
+		peer.stop()
+		delete(m.sentinels, runID)
+		known = false
+	}
+	if !known {
+		// A sentinel restarted on the same address replaces its old self
+		for id, other := range m.sentinels {
+			if other.host == host && other.port == port {
+				other.stop()
+				delete(m.sentinels, id)
+			}
+		}
+		peer = s.newInstance(sentinelKind, m, host, port)
+		peer.runID = runID
+		m.sentinels[runID] = peer
+		s.event("+sentinel", peer, "")
+	}
+	peer.lastHello = time.Now()
+	s.setEpoch(epoch)
+
+	// A newer configuration of the master wins, whoever failed it over
+	if configEpoch > m.configEpoch {
+		m.configEpoch = configEpoch
+		if m.host != masterHost || m.port != masterPort {
+			s.event("+config-update-from", peer, "")
+			s.switchMaster(m, masterHost, masterPort)
+		}
+	}
+}
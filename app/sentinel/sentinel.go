@@ -0,0 +1,244 @@
+package sentinel
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Errors returned for masters that cannot be monitored or are not
+var (
+	ErrNoSuchMaster       = errors.New("ERR No such master with that name")
+	ErrDuplicateMaster    = errors.New("ERR Duplicated master name")
+	ErrInvalidQuorum      = errors.New("ERR Quorum must be 1 or greater.")
+	ErrInvalidAddress     = errors.New("ERR Invalid IP address or hostname specified")
+	ErrNoGoodReplica      = errors.New("NOGOODSLAVE No suitable replica to promote")
+	ErrFailoverInProgress = errors.New("INPROG Failover already in progress")
+)
+
+// Periods of the work a sentinel does for every instance, as in Redis
+const (
+	tickInterval   = 100 * time.Millisecond // how often instances and masters are checked
+	pingPeriod     = time.Second
+	infoPeriod     = 10 * time.Second
+	helloPeriod    = 2 * time.Second
+	askPeriod      = time.Second // how often other sentinels are asked about a master that is down
+	reconnectDelay = time.Second
+)
+
+// helloChannel is where sentinels announce themselves and their view of a
+// master, on the master and on its replicas
+const helloChannel = "__sentinel__:hello"
+
+// Publisher delivers the events a sentinel raises to its own subscribers
+type Publisher interface {
+	Publish(channel, message string) int
+}
+
+// Sentinel monitors masters and their replicas, agrees with the other
+// sentinels monitoring them on whether a master is down and, when it is,
+// elects one of them to promote a replica in its place
+type Sentinel struct {
+	id              string
+	port            int
+	events          Publisher
+	downAfter       time.Duration // defaults for the masters monitored
+	failoverTimeout time.Duration
+
+	mutex        sync.Mutex
+	currentEpoch uint64
+	masters      map[string]*master
+}
+
+// New creates a sentinel listening on port with the given run ID, monitoring
+// no masters yet
+func New(id string, port int, events Publisher, downAfter, failoverTimeout time.Duration) *Sentinel {
+	return &Sentinel{
+		id:              id,
+		port:            port,
+		events:          events,
+		downAfter:       downAfter,
+		failoverTimeout: failoverTimeout,
+		masters:         make(map[string]*master),
+	}
+}
+
+// Start runs the periodic checks that find instances down and drive failovers
+func (s *Sentinel) Start() {
+	go func() {
+		ticker := time.NewTicker(tickInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.cron()
+		}
+	}()
+}
+
+// cron checks every instance for being down and moves failovers on
+func (s *Sentinel) cron() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, m := range s.masters {
+		s.checkSubjectivelyDown(m.instance)
+		for _, rep := range m.replicas {
+			s.checkSubjectivelyDown(rep)
+		}
+		for _, peer := range m.sentinels {
+			s.checkSubjectivelyDown(peer)
+			// Opinions of other sentinels are only trusted while fresh
+			if peer.masterDown && time.Since(peer.lastReply) > 5*askPeriod {
+				peer.masterDown = false
+			}
+		}
+		s.checkObjectivelyDown(m)
+		s.failoverStep(m)
+	}
+}
+
+// MyID returns the run ID this sentinel is known by to the others
+func (s *Sentinel) MyID() string {
+	return s.id
+}
+
+// Role returns the role HELLO reports, which is master for a sentinel as in Redis
+func (s *Sentinel) Role() string {
+	return "master"
+}
+
+// Monitor starts monitoring the master at host and port under name. quorum
+// sentinels must agree it is down before a failover is attempted.
+func (s *Sentinel) Monitor(name, host string, port, quorum int) error {
+	if quorum < 1 {
+		return ErrInvalidQuorum
+	}
+	if _, err := net.LookupHost(host); err != nil || port < 1 || port > 65535 {
+		return ErrInvalidAddress
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.masters[name]; exists {
+		return ErrDuplicateMaster
+	}
+	m := &master{
+		name:            name,
+		quorum:          quorum,
+		downAfter:       s.downAfter,
+		failoverTimeout: s.failoverTimeout,
+		replicas:        make(map[string]*instance),
+		sentinels:       make(map[string]*instance),
+	}
+	m.instance = s.newInstance(masterKind, m, host, port)
+	s.masters[name] = m
+	s.event("+monitor", m.instance, "quorum "+strconv.Itoa(quorum))
+	return nil
+}
+
+// Remove stops monitoring the master called name
+func (s *Sentinel) Remove(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m, ok := s.masters[name]
+	if !ok {
+		return ErrNoSuchMaster
+	}
+	m.stop()
+	for _, peer := range m.sentinels {
+		peer.stop()
+	}
+	delete(s.masters, name)
+	s.event("-monitor", m.instance, "")
+	return nil
+}
+
+// Set changes options of the master called name, given as option and value
+// pairs
+func (s *Sentinel) Set(name string, options [][2]string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m, ok := s.masters[name]
+	if !ok {
+		return ErrNoSuchMaster
+	}
+	// Every option is checked before any is applied
+	apply := make([]func(), 0, len(options))
+	for _, option := range options {
+		value, err := strconv.Atoi(option[1])
+		switch option[0] {
+		case "down-after-milliseconds", "failover-timeout", "quorum":
+			if err != nil || value < 1 {
+				return fmt.Errorf("ERR Invalid argument '%s' for SENTINEL SET '%s'", option[1], option[0])
+			}
+		default:
+			return fmt.Errorf("ERR Invalid argument '%s' to SENTINEL SET", option[0])
+		}
+		switch option[0] {
+		case "down-after-milliseconds":
+			apply = append(apply, func() { m.downAfter = time.Duration(value) * time.Millisecond })
+		case "failover-timeout":
+			apply = append(apply, func() { m.failoverTimeout = time.Duration(value) * time.Millisecond })
+		case "quorum":
+			apply = append(apply, func() { m.quorum = value })
+		}
+	}
+	for _, fn := range apply {
+		fn()
+	}
+	for _, option := range options {
+		s.event("+set", m.instance, option[0]+" "+option[1])
+	}
+	return nil
+}
+
+// masterByAddress returns the master monitored at host and port. The caller
+// must hold the mutex.
+func (s *Sentinel) masterByAddress(host string, port int) *master {
+	for _, m := range s.masters {
+		if m.host == host && m.port == port {
+			return m
+		}
+	}
+	return nil
+}
+
+// sortedMasters returns the masters in name order. The caller must hold the
+// mutex.
+func (s *Sentinel) sortedMasters() []*master {
+	masters := make([]*master, 0, len(s.masters))
+	for _, m := range s.masters {
+		masters = append(masters, m)
+	}
+	sort.Slice(masters, func(i, j int) bool { return masters[i].name < masters[j].name })
+	return masters
+}
+
+// setEpoch moves the current epoch forward to epoch. The caller must hold the
+// mutex.
+func (s *Sentinel) setEpoch(epoch uint64) {
+	if epoch > s.currentEpoch {
+		s.currentEpoch = epoch
+		s.event("+new-epoch", nil, strconv.FormatUint(epoch, 10))
+	}
+}
+
+// event logs an event and publishes it on the channel named after it. The
+// message starts with the instance it is about, followed by extra.
+func (s *Sentinel) event(name string, inst *instance, extra string) {
+	message := extra
+	if inst != nil {
+		message = inst.describe()
+		if extra != "" {
+			message += " " + extra
+		}
+	}
+	fmt.Printf("%s %s\n", name, message)
+	s.events.Publish(name, message)
+}
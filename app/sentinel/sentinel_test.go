@@ -0,0 +1,381 @@
+package sentinel
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// recorder is a Publisher keeping the names of the events published
+type recorder struct {
+	events []string
+}
+
+func (r *recorder) Publish(channel, message string) int {
+	r.events = append(r.events, channel)
+	return 0
+}
+
+// newTestSentinel returns a sentinel monitoring master m at 127.0.0.1:6379
+// along with peers other sentinels, without connecting to any of them
+func newTestSentinel(t *testing.T, quorum, peers int) (*Sentinel, *master, *recorder) {
+	t.Helper()
+	events := &recorder{}
+	s := New("me", 26379, events, time.Second, time.Minute)
+	m := &master{
+		name:            "m",
+		quorum:          quorum,
+		downAfter:       time.Second,
+		failoverTimeout: time.Minute,
+		replicas:        make(map[string]*instance),
+		sentinels:       make(map[string]*instance),
+	}
+	m.instance = newTestInstance(masterKind, m, 6379)
+	for i := 0; i < peers; i++ {
+		peer := newTestInstance(sentinelKind, m, 26380+i)
+		peer.runID = "peer" + strconv.Itoa(i)
+		m.sentinels[peer.runID] = peer
+	}
+	s.masters[m.name] = m
+	return s, m, events
+}
+
+// newTestInstance returns a connected instance that just answered a PING
+func newTestInstance(kind kind, m *master, port int) *instance {
+	return &instance{
+		kind:      kind,
+		master:    m,
+		host:      "127.0.0.1",
+		port:      port,
+		done:      make(chan struct{}),
+		wake:      make(chan struct{}, 1),
+		connected: true,
+		lastPong:  time.Now(),
+		priority:  100,
+	}
+}
+
+// addReplica adds a healthy replica of m that just reported its INFO
+func addReplica(m *master, port int, runID string, priority int, offset int64) *instance {
+	rep := newTestInstance(replicaKind, m, port)
+	rep.runID, rep.priority, rep.offset = runID, priority, offset
+	rep.role, rep.lastInfo = "slave", time.Now()
+	m.replicas[rep.address()] = rep
+	return rep
+}
+
+func TestSubjectivelyDown(t *testing.T) {
+	tests := []struct {
+		name        string
+		connected   bool
+		pingPending time.Duration // how long ago the oldest unanswered PING was sent, 0 if none
+		lastPong    time.Duration
+		want        bool
+	}{
+		{"answering", true, 0, 0, false},
+		{"answering but idle", true, 0, 5 * time.Second, false},
+		{"ping pending briefly", true, 500 * time.Millisecond, 5 * time.Second, false},
+		{"ping pending too long", true, 2 * time.Second, 2 * time.Second, true},
+		{"disconnected briefly", false, 0, 500 * time.Millisecond, false},
+		{"disconnected too long", false, 0, 2 * time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, m, _ := newTestSentinel(t, 1, 0)
+			inst := m.instance
+			inst.connected = tt.connected
+			inst.lastPong = time.Now().Add(-tt.lastPong)
+			if tt.pingPending > 0 {
+				inst.pingPending = time.Now().Add(-tt.pingPending)
+			}
+			s.checkSubjectivelyDown(inst)
+			if inst.sdown != tt.want {
+				t.Errorf("sdown = %v, want %v", inst.sdown, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubjectivelyDownRecovers(t *testing.T) {
+	s, m, events := newTestSentinel(t, 1, 0)
+	inst := m.instance
+	inst.pingPending = time.Now().Add(-2 * time.Second)
+	s.checkSubjectivelyDown(inst)
+
+	s.handleReply(inst, "PING", resp.RespValue{Type: resp.SimpleString, Value: "PONG"})
+	if !inst.pingPending.IsZero() {
+		t.Error("PONG left the PING pending")
+	}
+	s.checkSubjectivelyDown(inst)
+	if inst.sdown {
+		t.Error("still down after answering")
+	}
+	if want := []string{"+sdown", "-sdown"}; !slices.Equal(events.events, want) {
+		t.Errorf("events = %v, want %v", events.events, want)
+	}
+}
+
+func TestPingReplies(t *testing.T) {
+	tests := []struct {
+		reply resp.RespValue
+		valid bool
+	}{
+		{resp.RespValue{Type: resp.SimpleString, Value: "PONG"}, true},
+		{resp.RespValue{Type: resp.ErrorType, Value: "LOADING Redis is loading the dataset in memory"}, true},
+		{resp.RespValue{Type: resp.ErrorType, Value: "MASTERDOWN Link with MASTER is down"}, true},
+		{resp.RespValue{Type: resp.ErrorType, Value: "ERR unknown command"}, false},
+	}
+	for _, tt := range tests {
+		s, m, _ := newTestSentinel(t, 1, 0)
+		sent := time.Now().Add(-time.Second)
+		m.pingPending = sent
+		s.handleReply(m.instance, "PING", tt.reply)
+		if answered := m.pingPending.IsZero(); answered != tt.valid {
+			t.Errorf("reply %v answered the PING = %v, want %v", tt.reply.Value, answered, tt.valid)
+		}
+	}
+}
+
+func TestPingPeriod(t *testing.T) {
+	tests := []struct {
+		downAfter time.Duration
+		lastPing  time.Duration
+		want      bool
+	}{
+		{30 * time.Second, 500 * time.Millisecond, false},
+		{30 * time.Second, 1100 * time.Millisecond, true},
+		{300 * time.Millisecond, 200 * time.Millisecond, false},
+		{300 * time.Millisecond, 400 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		s, m, _ := newTestSentinel(t, 1, 0)
+		m.downAfter = tt.downAfter
+		m.lastPingSent = time.Now().Add(-tt.lastPing)
+		m.lastInfoSent = time.Now()
+
+		commands := s.due(m.instance, "")
+		pinged := len(commands) == 1 && commands[0][0] == "PING"
+		if pinged != tt.want {
+			t.Errorf("down-after %v, last PING %v ago: due %v, want PING %v", tt.downAfter, tt.lastPing, commands, tt.want)
+		}
+	}
+}
+
+func TestPendingPingKeepsOldest(t *testing.T) {
+	s, m, _ := newTestSentinel(t, 1, 0)
+	oldest := time.Now().Add(-5 * time.Second)
+	m.pingPending = oldest
+	m.lastInfoSent = time.Now()
+
+	if commands := s.due(m.instance, ""); len(commands) != 1 {
+		t.Fatalf("due = %v, want a PING", commands)
+	}
+	if !m.pingPending.Equal(oldest) {
+		t.Error("a new PING replaced the oldest unanswered one")
+	}
+}
+
+func TestObjectivelyDown(t *testing.T) {
+	tests := []struct {
+		name      string
+		quorum    int
+		sdown     bool
+		peersDown int
+		want      bool
+	}{
+		{"up", 1, false, 2, false},
+		{"alone reaching quorum", 1, true, 0, true},
+		{"short of quorum", 2, true, 0, false},
+		{"quorum with peers", 2, true, 1, true},
+		{"quorum of all", 3, true, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, m, _ := newTestSentinel(t, tt.quorum, 2)
+			m.sdown = tt.sdown
+			for i := 0; i < tt.peersDown; i++ {
+				m.sentinels["peer"+strconv.Itoa(i)].masterDown = true
+			}
+			s.checkObjectivelyDown(m)
+			if m.odown != tt.want {
+				t.Errorf("odown = %v, want %v", m.odown, tt.want)
+			}
+		})
+	}
+}
+
+func TestLeaderElection(t *testing.T) {
+	tests := []struct {
+		name   string
+		quorum int
+		votes  []string // votes of peer0 and peer1 in epoch 1
+		want   string
+	}{
+		{"no votes yet", 2, []string{"", ""}, ""},
+		{"majority for me", 2, []string{"me", ""}, "me"},
+		{"majority for a peer", 2, []string{"peer1", "peer1"}, "peer1"},
+		{"tie broken by own vote", 2, []string{"peer1", "peer0"}, "peer0"},
+		{"majority short of quorum", 3, []string{"me", ""}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, m, _ := newTestSentinel(t, tt.quorum, 2)
+			for i, vote := range tt.votes {
+				peer := m.sentinels["peer"+strconv.Itoa(i)]
+				peer.votedLeader, peer.votedEpoch = vote, 1
+			}
+			if got := s.leader(m, 1); got != tt.want {
+				t.Errorf("leader = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVoteOncePerEpoch(t *testing.T) {
+	s, m, _ := newTestSentinel(t, 1, 2)
+	if leader, epoch := s.vote(m, 3, "peer0"); leader != "peer0" || epoch != 3 {
+		t.Fatalf("vote = %s in %d, want peer0 in 3", leader, epoch)
+	}
+	if s.currentEpoch != 3 {
+		t.Errorf("current epoch = %d, want 3", s.currentEpoch)
+	}
+	if leader, _ := s.vote(m, 3, "peer1"); leader != "peer0" {
+		t.Errorf("second vote in epoch 3 went to %s", leader)
+	}
+	if leader, _ := s.vote(m, 2, "peer1"); leader != "peer0" {
+		t.Errorf("vote in an older epoch went to %s", leader)
+	}
+	if leader, epoch := s.vote(m, 4, "peer1"); leader != "peer1" || epoch != 4 {
+		t.Errorf("vote in epoch 4 = %s in %d, want peer1 in 4", leader, epoch)
+	}
+}
+
+func TestSelectReplica(t *testing.T) {
+	s, m, _ := newTestSentinel(t, 1, 0)
+	addReplica(m, 7001, "c", 100, 50)
+	want := addReplica(m, 7002, "b", 10, 50)
+	addReplica(m, 7003, "a", 10, 40)
+	addReplica(m, 7004, "0", 0, 99) // priority 0 is never promoted
+	down := addReplica(m, 7005, "1", 1, 99)
+	down.sdown = true
+	gone := addReplica(m, 7006, "2", 1, 99)
+	gone.connected = false
+	stale := addReplica(m, 7007, "3", 1, 99)
+	stale.lastInfo = time.Now().Add(-time.Minute)
+
+	if got := s.selectReplica(m); got != want {
+		t.Errorf("selected %v, want %v", got.address(), want.address())
+	}
+
+	tie := addReplica(m, 7008, "a0", 10, 50)
+	if got := s.selectReplica(m); got != tie {
+		t.Errorf("on a tie selected %v, want the lowest run ID", got.address())
+	}
+}
+
+func TestFailoverSteps(t *testing.T) {
+	s, m, events := newTestSentinel(t, 2, 2)
+	rep := addReplica(m, 7001, "r", 100, 10)
+	m.pingPending = time.Now().Add(-2 * time.Second)
+	m.sentinels["peer0"].masterDown = true
+	for _, peer := range m.sentinels {
+		peer.lastReply = time.Now()
+	}
+
+	s.cron()
+	if !m.sdown || !m.odown {
+		t.Fatalf("sdown %v, odown %v after the master went down", m.sdown, m.odown)
+	}
+	m.odownSince = time.Now().Add(-maxDesync)
+	s.cron()
+	if m.failoverState != failoverWaitStart {
+		t.Fatalf("state %v once the start delay passed", m.failoverState)
+	}
+	if m.failoverEpoch != 1 {
+		t.Fatalf("failover in epoch %d, want 1", m.failoverEpoch)
+	}
+
+	// Not elected until a peer votes for this sentinel too
+	s.cron()
+	if m.failoverState != failoverWaitStart || m.leader != "me" {
+		t.Fatalf("state %v with vote for %q without a majority", m.failoverState, m.leader)
+	}
+	m.sentinels["peer1"].votedLeader, m.sentinels["peer1"].votedEpoch = "me", 1
+	s.cron()
+	if m.failoverState != failoverSelectReplica {
+		t.Fatalf("state %v once elected, want %v", m.failoverState, failoverSelectReplica)
+	}
+	s.cron()
+	if m.failoverState != failoverSendReplicaOfNoOne || m.promoted != rep {
+		t.Fatalf("state %v promoting %v", m.failoverState, m.promoted)
+	}
+
+	want := []string{"+sdown", "+odown", "+new-epoch", "+try-failover", "+vote-for-leader",
+		"+elected-leader", "+failover-state-select_slave", "+selected-slave", "+failover-state-send_slaveof_noone"}
+	if !slices.Equal(events.events, want) {
+		t.Errorf("events = %v, want %v", events.events, want)
+	}
+}
+
+func TestFailoverStartDelay(t *testing.T) {
+	s, m, _ := newTestSentinel(t, 1, 0)
+	m.odown, m.odownSince = true, time.Now()
+	m.failoverDelay = 500 * time.Millisecond
+
+	s.failoverStep(m)
+	if m.failoverState != failoverNone {
+		t.Fatalf("state %v before the start delay passed", m.failoverState)
+	}
+	m.odownSince = time.Now().Add(-600 * time.Millisecond)
+	s.failoverStep(m)
+	if m.failoverState != failoverWaitStart {
+		t.Errorf("state %v after the start delay, want %v", m.failoverState, failoverWaitStart)
+	}
+}
+
+func TestFailoverAsksForVotesAtOnce(t *testing.T) {
+	s, m, _ := newTestSentinel(t, 2, 1)
+	peer := m.sentinels["peer0"]
+	m.sdown, m.odown = true, true
+	peer.lastAsked = time.Now()
+	peer.lastPingSent = time.Now()
+
+	if commands := s.due(peer, ""); len(commands) != 0 {
+		t.Fatalf("due = %v before the failover, want nothing", commands)
+	}
+	s.startFailover(m)
+	select {
+	case <-peer.wake:
+	default:
+		t.Error("starting the failover did not wake the link to the peer")
+	}
+	want := []string{"SENTINEL", "is-master-down-by-addr", "127.0.0.1", "6379", "1", "me"}
+	if commands := s.due(peer, ""); len(commands) != 1 || !slices.Equal(commands[0], want) {
+		t.Errorf("due = %v, want %v", commands, want)
+	}
+}
+
+func TestFailoverAbortsWithoutReplica(t *testing.T) {
+	s, m, events := newTestSentinel(t, 1, 0)
+	m.odown = true
+	s.startFailover(m)
+	m.failoverStart = time.Now()
+
+	s.failoverStep(m)
+	s.failoverStep(m)
+	if m.failoverState != failoverNone {
+		t.Fatalf("state %v with no replica to promote", m.failoverState)
+	}
+	if !slices.Contains(events.events, "-failover-abort-no-good-slave") {
+		t.Errorf("events = %v, want an abort", events.events)
+	}
+
+	// The attempt holds off the next one
+	s.failoverStep(m)
+	if m.failoverState != failoverNone {
+		t.Errorf("failover restarted right after an abort")
+	}
+}
@@ -3,8 +3,8 @@ package server
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"net"
-	"strings"
 
 	"github.com/codecrafters-io/redis-starter-go/app/resp"
 )
@@ -75,24 +75,20 @@ func (s *Server) handleConnection(conn net.Conn) {
 		conn.Close()
 	}()
 
+	// A single buffered reader per connection keeps pipelined commands and
+	// payloads larger than one read intact
+	reader := bufio.NewReader(conn)
 	for {
-		buf := make([]byte, 1024)
-		n, err := conn.Read(buf)
+		command, err := resp.ParseRESP(reader)
 		if err != nil {
-			fmt.Printf("Error reading from connection: %v\n", err)
+			if err != io.EOF {
+				fmt.Printf("Error reading from connection: %v\n", err)
+				writer := resp.NewResponseWriter(conn)
+				writer.WriteError("ERR " + err.Error())
+			}
 			return
 		}
 
-		request := string(buf[:n])
-		r := bufio.NewReader(strings.NewReader(request))
-
-		command, err := resp.ParseRESP(r)
-		if err != nil {
-			writer := resp.NewResponseWriter(conn)
-			writer.WriteError("ERR unknown command")
-			continue
-		}
-
 		fmt.Printf("CommandType: %v, Value: %v\n", command.Type, command.Value)
 
 		// Process command using the command processor
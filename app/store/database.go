@@ -0,0 +1,473 @@
+package store
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrWrongType is returned when a command is applied to a key holding another type
+var ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// ErrNoSuchKey is returned when a command requires a key that does not exist
+var ErrNoSuchKey = errors.New("ERR no such key")
+
+// lazyFreeThreshold is the number of elements above which UNLINK releases a
+// value in the background instead of in the caller
+const lazyFreeThreshold = 64
+
+// Item is a value of any supported type with an optional expiry
+type Item struct {
+	Value  interface{}
+	Expiry *time.Time
+}
+
+// IsExpired checks if the item has expired
+func (i *Item) IsExpired() bool {
+	return i.Expiry != nil && time.Now().After(*i.Expiry)
+}
+
+// Database is a single keyspace holding strings, lists and streams side by side
+type Database struct {
+	index          int
+	items          *Dict[*Item]
+	watchers       map[string]map[*Watch]struct{}
+	mutex          sync.RWMutex
+	streamNotifier *StreamNotifier
+	hook           KeyEventHook
+	dirty          *atomic.Int64
+	// expireCursor is where the next active expire cycle resumes scanning
+	expireCursor uint64
+}
+
+// NewDatabase creates an empty database
+func NewDatabase() *Database {
+	return &Database{
+		items:          NewDict[*Item](),
+		watchers:       make(map[string]map[*Watch]struct{}),
+		streamNotifier: NewStreamNotifier(),
+		dirty:          new(atomic.Int64),
+	}
+}
+
+// lookup returns the live item at key, treating expired items as missing.
+// The caller must hold at least the read lock.
+func (db *Database) lookup(key string) (*Item, bool) {
+	item, found := db.items.Get(key)
+	if !found || item.IsExpired() {
+		return nil, false
+	}
+	return item, true
+}
+
+// stringEntry loads the string at key into an entry. Other types fail unless
+// replace is set, which presents them as an existing entry with OtherType set.
+// The caller must hold at least the read lock.
+func (db *Database) stringEntry(key string, replace bool) (*StringEntry, error) {
+	entry := &StringEntry{}
+	item, exists := db.lookup(key)
+	if !exists {
+		return entry, nil
+	}
+
+	value, ok := item.Value.(string)
+	if !ok && !replace {
+		return nil, ErrWrongType
+	}
+	entry.OtherType = !ok
+	entry.Value = value
+	entry.Exists = true
+	entry.Expiry = item.Expiry
+	return entry, nil
+}
+
+// storeEntry writes an entry back, deleting the key when the entry no longer exists.
+// The caller must hold the write lock.
+func (db *Database) storeEntry(key string, entry *StringEntry) {
+	if !entry.Exists {
+		db.remove(key)
+		return
+	}
+	db.touch(key)
+	db.put(key, &Item{Value: entry.Value, Expiry: entry.Expiry})
+}
+
+// Set stores a string at key, replacing any existing value of any type
+func (db *Database) Set(key, value string, expiry ...time.Duration) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	var expiryTime *time.Time
+	if len(expiry) > 0 && expiry[0] > 0 {
+		t := time.Now().Add(expiry[0])
+		expiryTime = &t
+	}
+
+	db.put(key, &Item{Value: value, Expiry: expiryTime})
+	db.touch(key)
+	return nil
+}
+
+// Get returns the string at key, failing with ErrWrongType for other types
+func (db *Database) Get(key string) (string, bool, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	item, exists := db.lookupRead(key)
+	if !exists {
+		return "", false, nil
+	}
+	value, ok := item.Value.(string)
+	if !ok {
+		return "", false, ErrWrongType
+	}
+	return value, true, nil
+}
+
+// Update atomically applies fn to the string stored at key.
+// Expired keys are presented to fn as missing.
+func (db *Database) Update(key string, fn UpdateFunc) error {
+	return db.update(key, false, fn)
+}
+
+// Replace is Update for commands that overwrite keys of any type, like SETEX.
+// A key holding another type is presented to fn as existing with OtherType set.
+func (db *Database) Replace(key string, fn UpdateFunc) error {
+	return db.update(key, true, fn)
+}
+
+func (db *Database) update(key string, replace bool, fn UpdateFunc) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	entry, err := db.stringEntry(key, replace)
+	if err != nil {
+		return err
+	}
+
+	changed, err := fn(entry)
+	if err != nil || !changed {
+		return err
+	}
+
+	db.storeEntry(key, entry)
+	return nil
+}
+
+// UpdateMultiple atomically applies fn to the strings stored at keys,
+// so no reader can observe a partially applied update.
+func (db *Database) UpdateMultiple(keys []string, fn MultiUpdateFunc) error {
+	return db.updateMultiple(keys, false, fn)
+}
+
+// ReplaceMultiple is UpdateMultiple for commands that may overwrite keys of
+// any type, like MSET. Keys holding another type are presented to fn as
+// existing with OtherType set, for it to reject where they are only read.
+func (db *Database) ReplaceMultiple(keys []string, fn MultiUpdateFunc) error {
+	return db.updateMultiple(keys, true, fn)
+}
+
+func (db *Database) updateMultiple(keys []string, replace bool, fn MultiUpdateFunc) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	// Repeated keys share one entry so later writes are not clobbered by earlier views
+	entries := make([]*StringEntry, len(keys))
+	byKey := make(map[string]*StringEntry, len(keys))
+	for i, key := range keys {
+		if entry, seen := byKey[key]; seen {
+			entries[i] = entry
+			continue
+		}
+		entry, err := db.stringEntry(key, replace)
+		if err != nil {
+			return err
+		}
+		entries[i] = entry
+		byKey[key] = entry
+	}
+
+	changed, err := fn(entries)
+	if err != nil || !changed {
+		return err
+	}
+
+	for key, entry := range byKey {
+		db.storeEntry(key, entry)
+	}
+	return nil
+}
+
+// GetMultiple returns the strings at several keys from a single consistent view.
+// Keys holding other types are reported as missing, as MGET does.
+func (db *Database) GetMultiple(keys []string) ([]string, []bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	values := make([]string, len(keys))
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		if item, exists := db.lookupRead(key); exists {
+			values[i], found[i] = item.Value.(string)
+		}
+	}
+	return values, found
+}
+
+// Delete removes key regardless of its type
+func (db *Database) Delete(key string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.remove(key)
+	return nil
+}
+
+// Type returns the type name of the value at key, or "none" if it does not exist
+func (db *Database) Type(key string) string {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	item, exists := db.lookup(key)
+	if !exists {
+		return "none"
+	}
+	return typeName(item.Value)
+}
+
+// typeName maps a stored value to the name reported by TYPE
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case *DoublyLinkedList:
+		return "list"
+	case *Stream:
+		return "stream"
+	default:
+		return "none"
+	}
+}
+
+// Del removes the given keys and returns how many existed
+func (db *Database) Del(keys ...string) int {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	removed := 0
+	for _, key := range keys {
+		if db.remove(key) {
+			removed++
+		}
+	}
+	return removed
+}
+
+// Unlink removes the given keys like Del, but large values are released by a
+// background goroutine so the caller does not pay for freeing them
+func (db *Database) Unlink(keys ...string) int {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	removed := 0
+	for _, key := range keys {
+		item, exists := db.lookup(key)
+		if exists {
+			removed++
+			if list, ok := item.Value.(*DoublyLinkedList); ok && list.Length() > lazyFreeThreshold {
+				go freeValue(item.Value)
+			}
+		}
+		db.remove(key)
+	}
+	return removed
+}
+
+// Exists counts how many of the given keys exist; repeated keys are counted each time
+func (db *Database) Exists(keys ...string) int {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	count := 0
+	for _, key := range keys {
+		if _, exists := db.lookup(key); exists {
+			count++
+		}
+	}
+	return count
+}
+
+// Keys returns every live key in no particular order
+func (db *Database) Keys() []string {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	keys := make([]string, 0, db.items.Len())
+	db.items.Range(func(key string, item *Item) bool {
+		if !item.IsExpired() {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys
+}
+
+// randomKeyAttempts bounds how many expired keys RandomKey skips before
+// falling back to listing every live key
+const randomKeyAttempts = 100
+
+// RandomKey returns a random live key, reporting false if the database is empty
+func (db *Database) RandomKey() (string, bool) {
+	db.mutex.RLock()
+	for i := 0; i < randomKeyAttempts; i++ {
+		key, item, exists := db.items.RandomEntry()
+		if !exists {
+			db.mutex.RUnlock()
+			return "", false
+		}
+		if !item.IsExpired() {
+			db.mutex.RUnlock()
+			return key, true
+		}
+	}
+	db.mutex.RUnlock()
+
+	keys := db.Keys()
+	if len(keys) == 0 {
+		return "", false
+	}
+	return keys[rand.Intn(len(keys))], true
+}
+
+// Scan visits buckets starting at cursor until at least count keys have been
+// collected or the iteration completes, returning the keys and the next cursor.
+// A non-empty keyType keeps only keys holding that type.
+func (db *Database) Scan(cursor uint64, count int, keyType string) (uint64, []string) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	var keys []string
+	// Bound the work done for sparse tables where most buckets are empty
+	for budget := count * 10; budget > 0; budget-- {
+		cursor = db.items.Scan(cursor, func(key string, item *Item) {
+			if item.IsExpired() || (keyType != "" && typeName(item.Value) != keyType) {
+				return
+			}
+			keys = append(keys, key)
+		})
+		if cursor == 0 || len(keys) >= count {
+			break
+		}
+	}
+	return cursor, keys
+}
+
+// Rename moves the value and TTL at src to dst. With nx set the rename only
+// happens when dst does not exist; the result reports whether it happened.
+func (db *Database) Rename(src, dst string, nx bool) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	item, exists := db.lookup(src)
+	if !exists {
+		return false, ErrNoSuchKey
+	}
+	if nx {
+		if _, exists := db.lookup(dst); exists {
+			return false, nil
+		}
+	}
+
+	db.items.Delete(src)
+	db.put(dst, item)
+	db.touch(src)
+	db.touch(dst)
+	return true, nil
+}
+
+// Restore stores value at key with the given expiry, replacing any existing key.
+// value must be a string, *DoublyLinkedList or *Stream.
+func (db *Database) Restore(key string, value interface{}, expiry *time.Time) error {
+	if typeName(value) == "none" {
+		return ErrWrongType
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.put(key, &Item{Value: value, Expiry: expiry})
+	db.touch(key)
+	return nil
+}
+
+// cloneItem deep copies an item so the copy can be modified independently
+func cloneItem(item *Item) *Item {
+	clone := &Item{Expiry: item.Expiry}
+	switch value := item.Value.(type) {
+	case *DoublyLinkedList:
+		clone.Value = value.Clone()
+	case *Stream:
+		clone.Value = value.Clone()
+	default:
+		clone.Value = value
+	}
+	return clone
+}
+
+// Size returns the number of keys, including expired keys not yet reclaimed
+func (db *Database) Size() int {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return db.items.Len()
+}
+
+// Stats returns the number of keys and how many of them have an expiry
+func (db *Database) Stats() (keys, expires int) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	db.items.Range(func(key string, item *Item) bool {
+		if item.Expiry != nil {
+			expires++
+		}
+		return true
+	})
+	return db.items.Len(), expires
+}
+
+// Flush removes every key. With async set the old contents are released by a
+// background goroutine.
+func (db *Database) Flush(async bool) {
+	db.mutex.Lock()
+	old := db.items
+	db.items = NewDict[*Item]()
+	db.touchExisting(old)
+	db.dirty.Add(int64(old.Len()))
+	db.mutex.Unlock()
+
+	if async {
+		go freeItems(old)
+	}
+}
+
+// freeItems dismantles every value of a detached keyspace
+func freeItems(items *Dict[*Item]) {
+	items.Range(func(key string, item *Item) bool {
+		freeValue(item.Value)
+		return true
+	})
+	items.Clear()
+}
+
+// freeValue dismantles a value that is no longer reachable from any keyspace
+func freeValue(value interface{}) {
+	if list, ok := value.(*DoublyLinkedList); ok {
+		list.clear()
+	}
+}
+
+// GetStreamNotifier returns the stream notifier for this database
+func (db *Database) GetStreamNotifier() *StreamNotifier {
+	return db.streamNotifier
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"sync/atomic"
+)
+
+// Databases is the fixed set of numbered logical databases served by one instance
+type Databases struct {
+	dbs   []*Database
+	dirty atomic.Int64 // key changes since the last snapshot, shared by every database
+}
+
+// NewDatabases creates count empty databases numbered from zero
+func NewDatabases(count int) *Databases {
+	d := &Databases{dbs: make([]*Database, count)}
+	for i := range d.dbs {
+		d.dbs[i] = NewDatabase()
+		d.dbs[i].index = i
+		d.dbs[i].dirty = &d.dirty
+	}
+	return d
+}
+
+// Count returns the number of databases
+func (d *Databases) Count() int {
+	return len(d.dbs)
+}
+
+// DB returns the database with the given index, or nil if it is out of range
+func (d *Databases) DB(index int) *Database {
+	if index < 0 || index >= len(d.dbs) {
+		return nil
+	}
+	return d.dbs[index]
+}
+
+// lockPair write-locks both databases in index order so concurrent cross-database
+// commands cannot deadlock; a and b may be the same database
+func lockPair(a, b *Database) func() {
+	if a == b {
+		a.mutex.Lock()
+		return a.mutex.Unlock
+	}
+	if b.index < a.index {
+		a, b = b, a
+	}
+	a.mutex.Lock()
+	b.mutex.Lock()
+	return func() {
+		b.mutex.Unlock()
+		a.mutex.Unlock()
+	}
+}
+
+// Move transfers key with its TTL from one database to another. Nothing is
+// moved when the key is missing from the source or already exists in the target.
+func (d *Databases) Move(key string, from, to int) bool {
+	src, dst := d.DB(from), d.DB(to)
+	unlock := lockPair(src, dst)
+	defer unlock()
+
+	item, exists := src.lookup(key)
+	if !exists {
+		return false
+	}
+	if _, exists := dst.lookup(key); exists {
+		return false
+	}
+
+	src.items.Delete(key)
+	dst.put(key, item)
+	src.touch(key)
+	dst.touch(key)
+	return true
+}
+
+// Copy stores an independent copy of the value and TTL of src in database from
+// under dst in database to. Without replace an existing dst is left untouched
+// and false is returned.
+func (d *Databases) Copy(src, dst string, from, to int, replace bool) bool {
+	srcDB, dstDB := d.DB(from), d.DB(to)
+	unlock := lockPair(srcDB, dstDB)
+	defer unlock()
+
+	item, exists := srcDB.lookup(src)
+	if !exists {
+		return false
+	}
+	if _, exists := dstDB.lookup(dst); exists && !replace {
+		return false
+	}
+
+	dstDB.put(dst, cloneItem(item))
+	dstDB.touch(dst)
+	return true
+}
+
+// Swap exchanges the contents of two databases, so clients connected to one
+// immediately see the data of the other
+func (d *Databases) Swap(i, j int) {
+	a, b := d.DB(i), d.DB(j)
+	if a == b {
+		return
+	}
+
+	unlock := lockPair(a, b)
+	a.items, b.items = b.items, a.items
+	a.touchExisting(a.items, b.items)
+	b.touchExisting(a.items, b.items)
+	d.dirty.Add(1)
+	unlock()
+
+	// Clients blocked on either database may now find their keys
+	a.streamNotifier.NotifyAll()
+	b.streamNotifier.NotifyAll()
+}
+
+// FlushAll removes every key from every database
+func (d *Databases) FlushAll(async bool) {
+	for _, db := range d.dbs {
+		db.Flush(async)
+	}
+}
+
+// Stats returns the number of keys and keys with an expiry in database index
+func (d *Databases) Stats(index int) (keys, expires int) {
+	return d.DB(index).Stats()
+}
@@ -0,0 +1,168 @@
+package store
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"math/rand"
+)
+
+// dictInitialSize is the smallest number of buckets a Dict ever has
+const dictInitialSize = 4
+
+type dictEntry[V any] struct {
+	key   string
+	value V
+	next  *dictEntry[V]
+}
+
+// Dict is a chained hash table with a power-of-two number of buckets. Unlike a
+// Go map its bucket layout is visible, which is what allows Scan to offer a
+// stateless cursor. Any collection type that needs SCAN-style iteration
+// (keyspaces, hashes, sets, sorted sets) can be built on it.
+type Dict[V any] struct {
+	table []*dictEntry[V]
+	used  int
+	seed  maphash.Seed
+}
+
+// NewDict creates an empty dict
+func NewDict[V any]() *Dict[V] {
+	return &Dict[V]{
+		table: make([]*dictEntry[V], dictInitialSize),
+		seed:  maphash.MakeSeed(),
+	}
+}
+
+// Len returns the number of entries
+func (d *Dict[V]) Len() int {
+	return d.used
+}
+
+func (d *Dict[V]) bucket(key string) uint64 {
+	return maphash.String(d.seed, key) & uint64(len(d.table)-1)
+}
+
+// Get returns the value stored under key
+func (d *Dict[V]) Get(key string) (V, bool) {
+	for e := d.table[d.bucket(key)]; e != nil; e = e.next {
+		if e.key == key {
+			return e.value, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// Set stores value under key, replacing any existing value
+func (d *Dict[V]) Set(key string, value V) {
+	idx := d.bucket(key)
+	for e := d.table[idx]; e != nil; e = e.next {
+		if e.key == key {
+			e.value = value
+			return
+		}
+	}
+
+	d.table[idx] = &dictEntry[V]{key: key, value: value, next: d.table[idx]}
+	d.used++
+	if d.used > len(d.table) {
+		d.resize(len(d.table) * 2)
+	}
+}
+
+// Delete removes key and reports whether it was present
+func (d *Dict[V]) Delete(key string) bool {
+	idx := d.bucket(key)
+	for link := &d.table[idx]; *link != nil; link = &(*link).next {
+		if (*link).key == key {
+			*link = (*link).next
+			d.used--
+			// Shrink once the table is less than 1/8 full, like Redis
+			if len(d.table) > dictInitialSize && d.used < len(d.table)/8 {
+				d.resize(len(d.table) / 2)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Clear removes every entry
+func (d *Dict[V]) Clear() {
+	d.table = make([]*dictEntry[V], dictInitialSize)
+	d.used = 0
+}
+
+// Range calls fn for every entry until fn returns false. The dict must not be
+// modified during the iteration.
+func (d *Dict[V]) Range(fn func(key string, value V) bool) {
+	for _, e := range d.table {
+		for ; e != nil; e = e.next {
+			if !fn(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+// RandomEntry returns a uniformly chosen bucket's random entry, reporting false
+// if the dict is empty
+func (d *Dict[V]) RandomEntry() (string, V, bool) {
+	if d.used == 0 {
+		var zero V
+		return "", zero, false
+	}
+
+	var head *dictEntry[V]
+	for head == nil {
+		head = d.table[rand.Intn(len(d.table))]
+	}
+
+	length := 0
+	for e := head; e != nil; e = e.next {
+		length++
+	}
+	e := head
+	for i := rand.Intn(length); i > 0; i-- {
+		e = e.next
+	}
+	return e.key, e.value, true
+}
+
+// Scan calls fn for every entry in the bucket addressed by cursor and returns
+// the cursor of the next bucket, or 0 when the iteration is complete.
+//
+// Cursors are advanced by incrementing their reversed bits, as in Redis's
+// dictScan. Because the table size is always a power of two, the buckets a
+// cursor has already visited map onto buckets the cursor has also passed when
+// the table grows or shrinks, so every entry present for the whole iteration is
+// returned at least once. Entries may be returned more than once after a shrink.
+func (d *Dict[V]) Scan(cursor uint64, fn func(key string, value V)) uint64 {
+	mask := uint64(len(d.table) - 1)
+	for e := d.table[cursor&mask]; e != nil; e = e.next {
+		fn(e.key, e.value)
+	}
+
+	// Set the unmasked bits so incrementing the reversed cursor carries into
+	// the masked bits, then increment
+	cursor |= ^mask
+	cursor = bits.Reverse64(cursor)
+	cursor++
+	return bits.Reverse64(cursor)
+}
+
+// resize rehashes every entry into a table with size buckets
+func (d *Dict[V]) resize(size int) {
+	table := make([]*dictEntry[V], size)
+	mask := uint64(size - 1)
+	for _, e := range d.table {
+		for e != nil {
+			next := e.next
+			idx := maphash.String(d.seed, e.key) & mask
+			e.next = table[idx]
+			table[idx] = e
+			e = next
+		}
+	}
+	d.table = table
+}
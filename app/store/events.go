@@ -0,0 +1,68 @@
+package store
+
+// KeyEvent is a change to a key that the store detects on its own, as
+// opposed to the command level events reported by handlers
+type KeyEvent int
+
+const (
+	// KeyCreated is reported when a write creates a key that did not exist
+	KeyCreated KeyEvent = iota
+	// KeyDeleted is reported when a command deletes a key. A list removed
+	// because its last element was popped is reported by the popping command.
+	KeyDeleted
+	// KeyExpired is reported when an expired key is reclaimed
+	KeyExpired
+	// KeyMissed is reported when a read finds no key
+	KeyMissed
+)
+
+// KeyEventHook receives key events with the index of the database they
+// happened in. It is called with the database lock held, so it must not call
+// back into the database.
+type KeyEventHook func(event KeyEvent, db int, key string)
+
+// SetKeyEventHook installs hook on every database. It must be called before
+// the databases are used.
+func (dbs *Databases) SetKeyEventHook(hook KeyEventHook) {
+	for _, db := range dbs.dbs {
+		db.hook = hook
+	}
+}
+
+// emit reports a key event to the hook, if one is installed
+func (db *Database) emit(event KeyEvent, key string) {
+	if db.hook != nil {
+		db.hook(event, db.index, key)
+	}
+}
+
+// put stores item at key, reporting the key as created when it did not exist.
+// The caller must hold the write lock.
+func (db *Database) put(key string, item *Item) {
+	if _, exists := db.lookup(key); !exists {
+		db.emit(KeyCreated, key)
+	}
+	db.items.Set(key, item)
+}
+
+// lookupRead is lookup for commands that read key, reporting a miss.
+// The caller must hold at least the read lock.
+func (db *Database) lookupRead(key string) (*Item, bool) {
+	item, exists := db.lookup(key)
+	if !exists {
+		db.emit(KeyMissed, key)
+	}
+	return item, exists
+}
+
+// remove deletes key, reporting the deletion when it existed.
+// The caller must hold the write lock.
+func (db *Database) remove(key string) bool {
+	_, exists := db.lookup(key)
+	if exists {
+		db.touch(key)
+		db.emit(KeyDeleted, key)
+	}
+	db.items.Delete(key)
+	return exists
+}
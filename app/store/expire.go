@@ -0,0 +1,38 @@
+package store
+
+// activeExpireBuckets bounds how many hash table buckets one expire cycle
+// inspects per database, so a cycle never holds a database lock for long
+const activeExpireBuckets = 1000
+
+// ActiveExpireCycle reclaims expired keys in every database. Each call
+// resumes an incremental scan where the previous one stopped, so repeated
+// calls eventually visit every key while doing bounded work each time.
+func (dbs *Databases) ActiveExpireCycle() {
+	for _, db := range dbs.dbs {
+		db.expireCycle()
+	}
+}
+
+// expireCycle scans the next batch of buckets and deletes the expired keys in them
+func (db *Database) expireCycle() {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	var expired []string
+	for budget := activeExpireBuckets; budget > 0; budget-- {
+		db.expireCursor = db.items.Scan(db.expireCursor, func(key string, item *Item) {
+			if item.IsExpired() {
+				expired = append(expired, key)
+			}
+		})
+		if db.expireCursor == 0 {
+			break
+		}
+	}
+
+	for _, key := range expired {
+		db.items.Delete(key)
+		db.touch(key)
+		db.emit(KeyExpired, key)
+	}
+}
@@ -0,0 +1,282 @@
+package store
+
+// ListNode represents a node in a doubly linked list
+type ListNode struct {
+	Value string
+	Next  *ListNode
+	Prev  *ListNode
+}
+
+// DoublyLinkedList represents a doubly linked list with length tracking
+type DoublyLinkedList struct {
+	head   *ListNode
+	tail   *ListNode
+	length int
+}
+
+// NewDoublyLinkedList creates a new doubly linked list
+func NewDoublyLinkedList() *DoublyLinkedList {
+	return &DoublyLinkedList{}
+}
+
+func (dll *DoublyLinkedList) PushFront(value string) {
+	node := &ListNode{Value: value}
+
+	if dll.head == nil {
+		dll.head = node
+		dll.tail = node
+	} else {
+		node.Next = dll.head
+		dll.head.Prev = node
+		dll.head = node
+	}
+	dll.length++
+}
+
+func (dll *DoublyLinkedList) PushBack(value string) {
+	node := &ListNode{Value: value}
+
+	if dll.tail == nil {
+		dll.head = node
+		dll.tail = node
+	} else {
+		node.Prev = dll.tail
+		dll.tail.Next = node
+		dll.tail = node
+	}
+	dll.length++
+}
+
+func (dll *DoublyLinkedList) PopFront() (string, bool) {
+	if dll.head == nil {
+		return "", false
+	}
+
+	value := dll.head.Value
+	dll.head = dll.head.Next
+
+	if dll.head != nil {
+		dll.head.Prev = nil
+	} else {
+		dll.tail = nil
+	}
+
+	dll.length--
+	return value, true
+}
+
+func (dll *DoublyLinkedList) PopFrontMultiple(count int) []string {
+	if count <= 0 || dll.head == nil {
+		return []string{}
+	}
+
+	values := make([]string, 0, count)
+	for i := 0; i < count && dll.head != nil; i++ {
+		value, _ := dll.PopFront()
+		values = append(values, value)
+	}
+
+	return values
+}
+
+func (dll *DoublyLinkedList) Range(start, end int) []string {
+	if dll.head == nil {
+		return []string{}
+	}
+
+	// Handle negative indices
+	if start < 0 {
+		start = dll.length + start
+	}
+	if end < 0 {
+		end = dll.length + end
+	}
+
+	// Bounds checking
+	if start < 0 {
+		start = 0
+	}
+	if end >= dll.length {
+		end = dll.length - 1
+	}
+	if start > end || start >= dll.length {
+		return []string{}
+	}
+
+	result := make([]string, 0, end-start+1)
+	current := dll.head
+
+	// Skip to start position
+	for i := 0; i < start && current != nil; i++ {
+		current = current.Next
+	}
+
+	// Collect values in range
+	for i := start; i <= end && current != nil; i++ {
+		result = append(result, current.Value)
+		current = current.Next
+	}
+
+	return result
+}
+
+func (dll *DoublyLinkedList) Length() int {
+	return dll.length
+}
+
+// Values returns every element of the list from head to tail
+func (dll *DoublyLinkedList) Values() []string {
+	values := make([]string, 0, dll.length)
+	for node := dll.head; node != nil; node = node.Next {
+		values = append(values, node.Value)
+	}
+	return values
+}
+
+// Clone returns an independent copy of the list
+func (dll *DoublyLinkedList) Clone() *DoublyLinkedList {
+	clone := NewDoublyLinkedList()
+	for node := dll.head; node != nil; node = node.Next {
+		clone.PushBack(node.Value)
+	}
+	return clone
+}
+
+// clear unlinks every node so a large list can be dismantled incrementally
+func (dll *DoublyLinkedList) clear() {
+	for node := dll.head; node != nil; {
+		next := node.Next
+		node.Next, node.Prev = nil, nil
+		node = next
+	}
+	dll.head, dll.tail, dll.length = nil, nil, 0
+}
+
+// listForWrite returns the list at key, creating it when missing.
+// The caller must hold the write lock.
+func (db *Database) listForWrite(key string) (*DoublyLinkedList, error) {
+	item, exists := db.lookup(key)
+	if !exists {
+		list := NewDoublyLinkedList()
+		db.put(key, &Item{Value: list})
+		return list, nil
+	}
+
+	list, ok := item.Value.(*DoublyLinkedList)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return list, nil
+}
+
+// listForRead returns the list at key if it exists and holds a list,
+// reporting a miss for reads when notify is set.
+// The caller must hold at least the read lock.
+func (db *Database) listForRead(key string, notify bool) (*DoublyLinkedList, bool) {
+	item, exists := db.lookup(key)
+	if !exists {
+		if notify {
+			db.emit(KeyMissed, key)
+		}
+		return nil, false
+	}
+	list, ok := item.Value.(*DoublyLinkedList)
+	return list, ok
+}
+
+func (db *Database) LPush(key string, values ...string) (int, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	list, err := db.listForWrite(key)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, value := range values {
+		list.PushFront(value)
+	}
+	db.touch(key)
+
+	return list.Length(), nil
+}
+
+func (db *Database) RPush(key string, values ...string) (int, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	list, err := db.listForWrite(key)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, value := range values {
+		list.PushBack(value)
+	}
+	db.touch(key)
+
+	return list.Length(), nil
+}
+
+// LPop removes up to count values from the head of the list at key, one
+// without a count. A list left empty is deleted, which is reported through
+// emptied rather than the key event hook: the caller publishes the deletion
+// after its own pop event, in the order Redis sends them.
+func (db *Database) LPop(key string, count ...int) (values []string, emptied bool, exists bool) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	list, exists := db.listForRead(key, false)
+	if !exists {
+		return nil, false, false
+	}
+
+	popCount := 1
+	if len(count) > 0 && count[0] > 0 {
+		popCount = count[0]
+	}
+
+	if popCount == 1 {
+		value, ok := list.PopFront()
+		if !ok {
+			return nil, false, false
+		}
+		values = []string{value}
+	} else {
+		values = list.PopFrontMultiple(popCount)
+		if len(values) == 0 {
+			return nil, false, false
+		}
+	}
+	db.touch(key)
+
+	if list.Length() == 0 {
+		db.items.Delete(key)
+		emptied = true
+	}
+	return values, emptied, true
+}
+
+func (db *Database) LRange(key string, start, end int) ([]string, bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	list, exists := db.listForRead(key, true)
+	if !exists {
+		return nil, false
+	}
+
+	return list.Range(start, end), true
+}
+
+func (db *Database) LLen(key string) (int, bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	list, exists := db.listForRead(key, true)
+	if !exists {
+		return 0, false
+	}
+
+	return list.Length(), true
+}
@@ -0,0 +1,62 @@
+package store
+
+import "time"
+
+// SnapshotItem is one key captured by Snapshot
+type SnapshotItem struct {
+	Key    string
+	Value  interface{}
+	Expiry *time.Time
+}
+
+// Snapshot captures a copy of every database, indexed by database, along
+// with the dirty count it reflects. Values are deep copied, so the snapshot
+// can be serialized while the databases keep changing.
+//
+// Every database is read-locked for the whole copy, so the snapshot is the
+// state at one point in time: a write it holds is never missing the writes
+// made before it, in any database.
+func (d *Databases) Snapshot() ([][]SnapshotItem, int64) {
+	// Locking in index order, as lockPair does, cannot deadlock with
+	// commands spanning two databases
+	for _, db := range d.dbs {
+		db.mutex.RLock()
+	}
+	defer func() {
+		for _, db := range d.dbs {
+			db.mutex.RUnlock()
+		}
+	}()
+
+	dirty := d.dirty.Load()
+	snapshot := make([][]SnapshotItem, len(d.dbs))
+	for i, db := range d.dbs {
+		snapshot[i] = db.snapshot()
+	}
+	return snapshot, dirty
+}
+
+// snapshot copies the live keys of db. The caller must hold at least the
+// read lock.
+func (db *Database) snapshot() []SnapshotItem {
+	items := make([]SnapshotItem, 0, db.items.Len())
+	db.items.Range(func(key string, item *Item) bool {
+		if !item.IsExpired() {
+			clone := cloneItem(item)
+			items = append(items, SnapshotItem{Key: key, Value: clone.Value, Expiry: clone.Expiry})
+		}
+		return true
+	})
+	return items
+}
+
+// Dirty returns the number of key changes since the last snapshot was saved
+func (d *Databases) Dirty() int64 {
+	return d.dirty.Load()
+}
+
+// ClearDirty discounts n changes, typically the count a saved snapshot
+// reflected, so changes made while it was being written still count
+func (d *Databases) ClearDirty(n int64) {
+	d.dirty.Add(-n)
+}
@@ -0,0 +1,292 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidStreamID is returned for IDs that cannot be parsed
+	ErrInvalidStreamID = errors.New("ERR Invalid stream ID specified as stream command argument")
+	// ErrStreamIDTooSmall is returned when a new entry would not advance the stream
+	ErrStreamIDTooSmall = errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	// ErrStreamIDZero is returned for the reserved 0-0 ID
+	ErrStreamIDZero = errors.New("ERR The ID specified in XADD must be greater than 0-0")
+)
+
+// StreamID identifies a stream entry by millisecond timestamp and sequence number
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// MinStreamID and MaxStreamID bound every valid stream ID
+var (
+	MinStreamID = StreamID{0, 0}
+	MaxStreamID = StreamID{math.MaxUint64, math.MaxUint64}
+)
+
+// String formats the ID as "<ms>-<seq>"
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Less reports whether id sorts before other
+func (id StreamID) Less(other StreamID) bool {
+	return id.Ms < other.Ms || (id.Ms == other.Ms && id.Seq < other.Seq)
+}
+
+// Next returns the smallest ID greater than id, reporting false on overflow
+func (id StreamID) Next() (StreamID, bool) {
+	if id.Seq < math.MaxUint64 {
+		return StreamID{id.Ms, id.Seq + 1}, true
+	}
+	if id.Ms < math.MaxUint64 {
+		return StreamID{id.Ms + 1, 0}, true
+	}
+	return id, false
+}
+
+// ParseStreamID parses "<ms>-<seq>" or a bare "<ms>", in which case the sequence
+// defaults to defaultSeq
+func ParseStreamID(s string, defaultSeq uint64) (StreamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+	if !hasSeq {
+		return StreamID{ms, defaultSeq}, nil
+	}
+
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+	return StreamID{ms, seq}, nil
+}
+
+// StreamEntry is a single stream entry. Fields holds alternating field names and
+// values in insertion order; both may contain arbitrary bytes.
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string
+}
+
+// Stream is an append-only log of entries kept sorted by ID
+type Stream struct {
+	entries []StreamEntry
+	lastID  StreamID
+}
+
+// NewStream creates an empty stream
+func NewStream() *Stream {
+	return &Stream{}
+}
+
+// NewStreamFrom creates a stream holding entries, which must be sorted by ID.
+// lastID may be greater than the last entry's ID when trailing entries were deleted.
+func NewStreamFrom(entries []StreamEntry, lastID StreamID) *Stream {
+	return &Stream{entries: entries, lastID: lastID}
+}
+
+// Len returns the number of entries in the stream
+func (s *Stream) Len() int {
+	return len(s.entries)
+}
+
+// LastID returns the ID of the most recently added entry
+func (s *Stream) LastID() StreamID {
+	return s.lastID
+}
+
+// Add appends an entry. idSpec may be "*" for a fully generated ID, "<ms>-*"
+// for a generated sequence number, or an explicit ID.
+func (s *Stream) Add(idSpec string, fields []string, now time.Time) (StreamID, error) {
+	id, err := s.resolveID(idSpec, now)
+	if err != nil {
+		return StreamID{}, err
+	}
+
+	s.entries = append(s.entries, StreamEntry{ID: id, Fields: fields})
+	s.lastID = id
+	return id, nil
+}
+
+// resolveID turns an XADD ID argument into a concrete ID greater than the last one
+func (s *Stream) resolveID(idSpec string, now time.Time) (StreamID, error) {
+	if idSpec == "*" {
+		ms := uint64(now.UnixMilli())
+		if ms > s.lastID.Ms {
+			return StreamID{ms, 0}, nil
+		}
+		next, ok := s.lastID.Next()
+		if !ok {
+			return StreamID{}, ErrStreamIDTooSmall
+		}
+		return next, nil
+	}
+
+	if msPart, found := strings.CutSuffix(idSpec, "-*"); found {
+		ms, err := strconv.ParseUint(msPart, 10, 64)
+		if err != nil {
+			return StreamID{}, ErrInvalidStreamID
+		}
+
+		switch {
+		case len(s.entries) > 0 && ms < s.lastID.Ms:
+			return StreamID{}, ErrStreamIDTooSmall
+		case len(s.entries) > 0 && ms == s.lastID.Ms:
+			if s.lastID.Seq == math.MaxUint64 {
+				return StreamID{}, ErrStreamIDTooSmall
+			}
+			return StreamID{ms, s.lastID.Seq + 1}, nil
+		case ms == 0:
+			return StreamID{0, 1}, nil
+		default:
+			return StreamID{ms, 0}, nil
+		}
+	}
+
+	id, err := ParseStreamID(idSpec, 0)
+	if err != nil {
+		return StreamID{}, err
+	}
+	if id == MinStreamID {
+		return StreamID{}, ErrStreamIDZero
+	}
+	if !s.lastID.Less(id) {
+		return StreamID{}, ErrStreamIDTooSmall
+	}
+	return id, nil
+}
+
+// Range returns up to count entries with start <= ID <= end; count <= 0 means no limit
+func (s *Stream) Range(start, end StreamID, count int) []StreamEntry {
+	i := sort.Search(len(s.entries), func(i int) bool {
+		return !s.entries[i].ID.Less(start)
+	})
+
+	var result []StreamEntry
+	for ; i < len(s.entries) && !end.Less(s.entries[i].ID); i++ {
+		result = append(result, s.entries[i])
+		if count > 0 && len(result) >= count {
+			break
+		}
+	}
+	return result
+}
+
+// After returns every entry with an ID strictly greater than id
+func (s *Stream) After(id StreamID) []StreamEntry {
+	start, ok := id.Next()
+	if !ok {
+		return nil
+	}
+	return s.Range(start, MaxStreamID, 0)
+}
+
+// Entries returns all entries in ID order
+func (s *Stream) Entries() []StreamEntry {
+	return s.entries
+}
+
+// Clone returns a copy of the stream that shares no mutable state with s
+func (s *Stream) Clone() *Stream {
+	entries := make([]StreamEntry, len(s.entries))
+	copy(entries, s.entries)
+	return &Stream{entries: entries, lastID: s.lastID}
+}
+
+// streamForRead returns the stream at key if it exists and holds a stream.
+// The caller must hold at least the read lock.
+func (db *Database) streamForRead(key string) (*Stream, bool) {
+	item, exists := db.lookup(key)
+	if !exists {
+		return nil, false
+	}
+	stream, ok := item.Value.(*Stream)
+	return stream, ok
+}
+
+// XAdd appends an entry to the stream at key, creating the stream if needed
+func (db *Database) XAdd(key, id string, fields []string) (StreamID, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	stream := NewStream()
+	if item, exists := db.lookup(key); exists {
+		var ok bool
+		if stream, ok = item.Value.(*Stream); !ok {
+			return StreamID{}, ErrWrongType
+		}
+	}
+
+	entryID, err := stream.Add(id, fields, time.Now())
+	if err != nil {
+		return StreamID{}, err
+	}
+
+	if stream.Len() == 1 {
+		db.put(key, &Item{Value: stream})
+	}
+	db.touch(key)
+	return entryID, nil
+}
+
+// XRange returns up to count entries of the stream at key between start and end inclusive
+func (db *Database) XRange(key string, start, end StreamID, count int) []StreamEntry {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	item, exists := db.lookupRead(key)
+	if !exists {
+		return nil
+	}
+	stream, ok := item.Value.(*Stream)
+	if !ok {
+		return nil
+	}
+	return stream.Range(start, end, count)
+}
+
+// XReadAfter returns the entries of the stream at key with IDs greater than id
+func (db *Database) XReadAfter(key string, id StreamID) []StreamEntry {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	stream, exists := db.streamForRead(key)
+	if !exists {
+		return nil
+	}
+	return stream.After(id)
+}
+
+// XLastID returns the ID of the last entry added to the stream at key
+func (db *Database) XLastID(key string) (StreamID, bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	stream, exists := db.streamForRead(key)
+	if !exists {
+		return StreamID{}, false
+	}
+	return stream.LastID(), true
+}
+
+// XLen returns the number of entries in the stream at key
+func (db *Database) XLen(key string) (int, bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	stream, exists := db.streamForRead(key)
+	if !exists {
+		return 0, false
+	}
+	return stream.Len(), true
+}
@@ -60,3 +60,18 @@ func (sn *StreamNotifier) Notify(streamKey string) {
 		}
 	}
 }
+
+// NotifyAll notifies every listener, whatever stream it waits on
+func (sn *StreamNotifier) NotifyAll() {
+	sn.mutex.RLock()
+	defer sn.mutex.RUnlock()
+
+	for _, listeners := range sn.listeners {
+		for _, ch := range listeners {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package store
+
+import (
+	"time"
+)
+
+// StringEntry is a mutable view of a string key handed to atomic update callbacks.
+// Setting Exists to false deletes the key when the update is applied.
+type StringEntry struct {
+	Value  string
+	Exists bool
+	Expiry *time.Time
+	// OtherType is set when the key holds another type, which writing the
+	// entry replaces. Only Replace and ReplaceMultiple hand such entries out.
+	OtherType bool
+}
+
+// UpdateFunc mutates a string entry in place and reports whether it changed it.
+// Returning an error aborts the update without writing anything.
+type UpdateFunc func(entry *StringEntry) (bool, error)
+
+// MultiUpdateFunc mutates several string entries at once, in the order their keys
+// were given, and reports whether any of them changed. A key given more than once
+// is represented by the same entry at each of its positions.
+type MultiUpdateFunc func(entries []*StringEntry) (bool, error)
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// watchedKey is a key watched by one client
+type watchedKey struct {
+	db  *Database
+	key string
+	// expired records that the key was already logically expired when it was
+	// watched, so its later expiry is not a change
+	expired bool
+}
+
+// Watch is the set of keys one client watches for optimistic locking. It is
+// marked dirty by any write to one of the keys, including deletion by
+// expiry or eviction.
+type Watch struct {
+	mu    sync.Mutex
+	keys  []watchedKey
+	dirty atomic.Bool
+}
+
+// NewWatch creates an empty watch
+func NewWatch() *Watch {
+	return &Watch{}
+}
+
+// Add starts watching key in db
+func (w *Watch) Add(db *Database, key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, wk := range w.keys {
+		if wk.db == db && wk.key == key {
+			return
+		}
+	}
+
+	db.mutex.Lock()
+	item, found := db.items.Get(key)
+	expired := found && item.IsExpired()
+	if db.watchers[key] == nil {
+		db.watchers[key] = make(map[*Watch]struct{})
+	}
+	db.watchers[key][w] = struct{}{}
+	db.mutex.Unlock()
+
+	w.keys = append(w.keys, watchedKey{db: db, key: key, expired: expired})
+}
+
+// Dirty reports whether any watched key has changed since it was watched. A
+// key that has expired since then counts as changed even if it has not been
+// reclaimed yet.
+func (w *Watch) Dirty() bool {
+	if w.dirty.Load() {
+		return true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, wk := range w.keys {
+		if wk.expired {
+			continue
+		}
+		wk.db.mutex.RLock()
+		item, found := wk.db.items.Get(wk.key)
+		expired := found && item.IsExpired()
+		wk.db.mutex.RUnlock()
+		if expired {
+			return true
+		}
+	}
+	return false
+}
+
+// Clear stops watching every key and resets the dirty flag
+func (w *Watch) Clear() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, wk := range w.keys {
+		wk.db.mutex.Lock()
+		if watchers := wk.db.watchers[wk.key]; watchers != nil {
+			delete(watchers, w)
+			if len(watchers) == 0 {
+				delete(wk.db.watchers, wk.key)
+			}
+		}
+		wk.db.mutex.Unlock()
+	}
+	w.keys = nil
+	w.dirty.Store(false)
+}
+
+// touch marks every client watching key as dirty and counts the change
+// towards the next snapshot. The caller must hold the write lock.
+func (db *Database) touch(key string) {
+	db.dirty.Add(1)
+	for w := range db.watchers[key] {
+		w.dirty.Store(true)
+	}
+}
+
+// touchExisting marks clients dirty for every watched key present in any of
+// the given keyspaces, used when a whole keyspace is replaced.
+// The caller must hold the write lock.
+func (db *Database) touchExisting(keyspaces ...*Dict[*Item]) {
+	for key, watchers := range db.watchers {
+		for _, items := range keyspaces {
+			if _, found := items.Get(key); found {
+				for w := range watchers {
+					w.dirty.Store(true)
+				}
+				break
+			}
+		}
+	}
+}